@@ -48,7 +48,8 @@ import (
 const pluginName = "filestream"
 
 type state struct {
-	Offset int64 `json:"offset" struct:"offset"`
+	Offset    int64    `json:"offset" struct:"offset"`
+	CSVHeader []string `json:"csv_header,omitempty" struct:"csv_header,omitempty"`
 }
 
 type fileMeta struct {
@@ -119,7 +120,7 @@ func (inp *filestream) Test(src loginp.Source, ctx input.TestContext) error {
 		return fmt.Errorf("not file source")
 	}
 
-	reader, _, err := inp.open(ctx.Logger, ctx.Cancelation, fs, 0)
+	reader, _, err := inp.open(ctx.Logger, ctx.Cancelation, fs, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -141,7 +142,8 @@ func (inp *filestream) Run(
 	log := ctx.Logger.With("path", fs.newPath).With("state-id", src.Name())
 	state := initState(log, cursor, fs)
 
-	r, truncated, err := inp.open(log, ctx.Cancelation, fs, state.Offset)
+	parserState := &parser.State{CSVHeader: state.CSVHeader}
+	r, truncated, err := inp.open(log, ctx.Cancelation, fs, state.Offset, parserState)
 	if err != nil {
 		log.Errorf("File could not be opened for reading: %v", err)
 		return err
@@ -165,7 +167,7 @@ func (inp *filestream) Run(
 	})
 	defer streamCancel()
 
-	if err := inp.readFromSource(ctx, log, r, fs.newPath, state, publisher, metrics); err != nil {
+	if err := inp.readFromSource(ctx, log, r, fs.newPath, state, parserState, publisher, metrics); err != nil {
 		ctx.UpdateStatus(status.Degraded, fmt.Sprintf("error while reading from source: %v", err))
 		return err
 	}
@@ -191,6 +193,7 @@ func (inp *filestream) open(
 	canceler input.Canceler,
 	fs fileSource,
 	offset int64,
+	parserState *parser.State,
 ) (reader.Reader, bool, error) {
 
 	f, encoding, truncated, err := inp.openFile(log, fs.newPath, offset)
@@ -200,6 +203,9 @@ func (inp *filestream) open(
 
 	if truncated {
 		offset = 0
+		if parserState != nil {
+			*parserState = parser.State{}
+		}
 	}
 
 	ok := false // used for cleanup
@@ -253,7 +259,7 @@ func (inp *filestream) open(
 
 	r = readfile.NewFilemeta(r, fs.newPath, fs.desc.Info, fs.desc.Fingerprint, offset)
 
-	r = inp.parsers.Create(r)
+	r = inp.parsers.CreateWithState(r, parserState)
 
 	r = readfile.NewLimitReader(r, inp.readerConfig.MaxBytes)
 
@@ -351,6 +357,7 @@ func (inp *filestream) readFromSource(
 	r reader.Reader,
 	path string,
 	s state,
+	parserState *parser.State,
 	p loginp.Publisher,
 	metrics *loginp.Metrics,
 ) error {
@@ -379,6 +386,7 @@ func (inp *filestream) readFromSource(
 		}
 
 		s.Offset += int64(message.Bytes) + int64(message.Offset)
+		s.CSVHeader = parserState.CSVHeader
 
 		metrics.MessagesRead.Inc()
 		if message.IsEmpty() || inp.isDroppedLine(log, string(message.Content)) {
@@ -598,3 +598,49 @@ SetAdCodeMiddleware.default_ad_code route
 	cancelInput()
 	env.waitUntilInputStops()
 }
+
+// The csv header is stored in the cursor, so it is still known when the
+// harvester is restarted and reading resumes after it.
+func TestParsersCSVHeaderAcrossRestarts(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.csv"
+	inp := env.mustCreateInput(map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+		"close.reader.on_eof":               "true",
+		"parsers": []map[string]interface{}{
+			{
+				"csv": map[string]interface{}{
+					"header": true,
+				},
+			},
+		},
+	})
+
+	testlines := []byte("name,note\na,\"multi\nline\"\nb,single\n")
+	env.mustWriteToFile(testlogName, testlines)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+	env.requireEventContents(0, "csv.name", "a")
+	env.requireEventContents(0, "csv.note", "multi\nline")
+	env.requireEventContents(1, "csv.name", "b")
+
+	env.waitUntilHarvesterIsDone()
+
+	moreLines := []byte("c,after restart\n")
+	env.mustAppendToFile(testlogName, moreLines)
+
+	env.waitUntilEventCount(3)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(moreLines))
+	env.requireEventContents(2, "csv.name", "c")
+	env.requireEventContents(2, "csv.note", "after restart")
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
@@ -0,0 +1,130 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package datacheck
+
+import (
+	"bytes"
+	"errors"
+	"net"
+)
+
+// Check executes over an open connection using the send / receive
+// parameters the user has defined.
+type Check func(net.Conn) error
+
+// maxDatagramSize is the maximum size of a UDP datagram.
+const maxDatagramSize = 64 * 1024
+
+var (
+	ErrNoDataReceived = errors.New("no data")
+	ErrRecvMismatch   = errors.New("received string mismatch")
+)
+
+func (c Check) Check(conn net.Conn) error {
+	return c(conn)
+}
+
+// All runs the given checks in order, stopping at the first error.
+func All(checks ...Check) Check {
+	return func(conn net.Conn) error {
+		for _, check := range checks {
+			if err := check(conn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Send writes buf to the connection.
+func Send(buf []byte) Check {
+	return func(conn net.Conn) error {
+		return sendBuffer(conn, buf)
+	}
+}
+
+// Recv reads as many bytes as expected contains from the connection, and
+// compares them with expected.
+func Recv(expected []byte) Check {
+	return func(conn net.Conn) error {
+		buf := make([]byte, len(expected))
+		if err := recvBuffer(conn, buf); err != nil {
+			return err
+		}
+		if !bytes.Equal(expected, buf) {
+			//nolint:godox // old TODO
+			//TODO: report received value and expected value in event
+			return ErrRecvMismatch
+		}
+		return nil
+	}
+}
+
+// RecvDatagram reads a single datagram from the connection, and compares its
+// start with expected. Unlike Recv, it doesn't wait for more data if the
+// datagram is shorter than expected.
+func RecvDatagram(expected []byte) Check {
+	return func(conn net.Conn) error {
+		// Reading a datagram into a smaller buffer discards the rest of it.
+		buf := make([]byte, max(maxDatagramSize, len(expected)))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(buf[:n], expected) {
+			return ErrRecvMismatch
+		}
+		return nil
+	}
+}
+
+// RecvAny succeeds once any data is read from the connection.
+func RecvAny(conn net.Conn) error {
+	// receive 'anything'
+	var buf [1024]byte
+	n, err := conn.Read(buf[:])
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoDataReceived
+	}
+	return nil
+}
+
+func sendBuffer(conn net.Conn, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := conn.Write(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+func recvBuffer(conn net.Conn, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
@@ -18,6 +18,7 @@
 package dialchain
 
 import (
+	"context"
 	cryptoTLS "crypto/tls"
 	"fmt"
 	"net"
@@ -33,6 +34,16 @@ import (
 // The layer will update the active event with the TLS RTT and
 // crypto/cert details.
 func TLSLayer(cfg *tlscommon.TLSConfig, to time.Duration) Layer {
+	return tlsLayer(cfg, to, nil)
+}
+
+// ALPNTLSLayer configures a TLS layer offering the given application
+// protocols during the handshake, as required by HTTP/2 servers.
+func ALPNTLSLayer(cfg *tlscommon.TLSConfig, to time.Duration, protos []string) Layer {
+	return tlsLayer(cfg, to, protos)
+}
+
+func tlsLayer(cfg *tlscommon.TLSConfig, to time.Duration, protos []string) Layer {
 	return func(event *beat.Event, next transport.Dialer) (transport.Dialer, error) {
 		var timer timer
 
@@ -41,6 +52,18 @@ func TLSLayer(cfg *tlscommon.TLSConfig, to time.Duration) Layer {
 		next = startTimerAfterDial(&timer, next)
 
 		dialer := transport.TLSDialer(next, cfg, to)
+		if len(protos) > 0 {
+			// The H2 dialer takes the protocols from the config passed to
+			// each dial.
+			h2, err := transport.TLSDialerH2(next, cfg, to)
+			if err != nil {
+				return nil, err
+			}
+			alpn := &cryptoTLS.Config{NextProtos: protos}
+			dialer = transport.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+				return h2.DialContext(ctx, network, address, alpn)
+			})
+		}
 		return afterDial(dialer, func(conn net.Conn) (net.Conn, error) {
 			tlsConn, ok := conn.(*cryptoTLS.Conn)
 			if !ok {
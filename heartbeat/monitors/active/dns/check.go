@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// responseCheck validates a DNS response.
+type responseCheck func(*dns.Msg) error
+
+func makeResponseCheck(c *checkConfig) (responseCheck, error) {
+	rcode, err := parseRCode(c.RCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(resp *dns.Msg) error {
+		if resp.Rcode != rcode {
+			return fmt.Errorf("received response code %s, expected %s",
+				dns.RcodeToString[resp.Rcode], dns.RcodeToString[rcode])
+		}
+
+		if c.AuthenticatedData && !resp.AuthenticatedData {
+			return fmt.Errorf("response is not DNSSEC authenticated")
+		}
+
+		answers := make([]string, len(resp.Answer))
+		for i, rr := range resp.Answer {
+			answers[i] = answerData(rr)
+		}
+
+		for _, expected := range c.Answers {
+			if !containsAnswer(answers, expected) {
+				return fmt.Errorf("answer '%s' not found in response", expected)
+			}
+		}
+
+		for i, m := range c.AnswersRegex {
+			if !matchesAnswer(answers, m.MatchString) {
+				return fmt.Errorf("no answer matches check.answers_regex[%d]", i)
+			}
+		}
+
+		return nil
+	}, nil
+}
+
+func containsAnswer(answers []string, expected string) bool {
+	return matchesAnswer(answers, func(answer string) bool {
+		// Domain names in answers are fully qualified, but users don't
+		// necessarily configure them with the trailing dot.
+		return answer == expected || answer == dns.Fqdn(expected)
+	})
+}
+
+func matchesAnswer(answers []string, match func(string) bool) bool {
+	for _, answer := range answers {
+		if match(answer) {
+			return true
+		}
+	}
+	return false
+}
+
+// answerData returns the resource data of a record in presentation format.
+// TXT records are returned unquoted, with their strings concatenated.
+func answerData(rr dns.RR) string {
+	if txt, ok := rr.(*dns.TXT); ok {
+		return strings.Join(txt.Txt, "")
+	}
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// responseFields returns the ECS dns fields of a response.
+func responseFields(resp *dns.Msg) mapstr.M {
+	fields := mapstr.M{
+		"id":            resp.Id,
+		"response_code": dns.RcodeToString[resp.Rcode],
+		"header_flags":  headerFlags(resp),
+	}
+
+	if len(resp.Question) > 0 {
+		q := resp.Question[0]
+		fields["question"] = mapstr.M{
+			"name":  strings.TrimSuffix(q.Name, "."),
+			"type":  dns.TypeToString[q.Qtype],
+			"class": dns.ClassToString[q.Qclass],
+		}
+	}
+
+	if len(resp.Answer) > 0 {
+		answers := make([]mapstr.M, 0, len(resp.Answer))
+		var resolvedIPs []string
+		for _, rr := range resp.Answer {
+			hdr := rr.Header()
+			answers = append(answers, mapstr.M{
+				"name":  strings.TrimSuffix(hdr.Name, "."),
+				"type":  dns.TypeToString[hdr.Rrtype],
+				"class": dns.ClassToString[hdr.Class],
+				"ttl":   int64(hdr.Ttl),
+				"data":  answerData(rr),
+			})
+			switch rr := rr.(type) {
+			case *dns.A:
+				resolvedIPs = append(resolvedIPs, rr.A.String())
+			case *dns.AAAA:
+				resolvedIPs = append(resolvedIPs, rr.AAAA.String())
+			}
+		}
+		fields["answers"] = answers
+		if len(resolvedIPs) > 0 {
+			fields["resolved_ip"] = resolvedIPs
+		}
+	}
+
+	return fields
+}
+
+func headerFlags(resp *dns.Msg) []string {
+	flags := []string{}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"AA", resp.Authoritative},
+		{"TC", resp.Truncated},
+		{"RD", resp.RecursionDesired},
+		{"RA", resp.RecursionAvailable},
+		{"AD", resp.AuthenticatedData},
+		{"CD", resp.CheckingDisabled},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	if opt := resp.IsEdns0(); opt != nil && opt.Do() {
+		flags = append(flags, "DO")
+	}
+	return flags
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+)
+
+func TestResponseCheck(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.SetQuestion("example.com.", dns.TypeMX)
+	resp.Answer = []dns.RR{
+		mustRR(t, "example.com. 300 IN CNAME mail.example.com."),
+		mustRR(t, "mail.example.com. 300 IN MX 10 mx1.example.com."),
+	}
+
+	tests := []struct {
+		name  string
+		check checkConfig
+		err   string
+	}{
+		{"rcode", checkConfig{RCode: "NOERROR"}, ""},
+		{"rcode mismatch", checkConfig{RCode: "SERVFAIL"}, "received response code NOERROR, expected SERVFAIL"},
+		{"answer", checkConfig{RCode: "NOERROR", Answers: []string{"10 mx1.example.com."}}, ""},
+		{"answer without trailing dot", checkConfig{RCode: "NOERROR", Answers: []string{"mail.example.com", "10 mx1.example.com"}}, ""},
+		{"missing answer", checkConfig{RCode: "NOERROR", Answers: []string{"10 mx2.example.com"}}, "answer '10 mx2.example.com' not found in response"},
+		{"regex", checkConfig{RCode: "NOERROR", AnswersRegex: []match.Matcher{match.MustCompile(`^\d+ mx\d\.`)}}, ""},
+		{"regex mismatch", checkConfig{RCode: "NOERROR", AnswersRegex: []match.Matcher{match.MustCompile(`^20 `)}}, "no answer matches check.answers_regex[0]"},
+		{"authenticated data", checkConfig{RCode: "NOERROR", AuthenticatedData: true}, "response is not DNSSEC authenticated"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check, err := makeResponseCheck(&test.check)
+			require.NoError(t, err)
+
+			err = check(resp)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+type config struct {
+	// resolvers to query, optionally prefixed with the transport to use
+	Hosts []string `config:"hosts" validate:"required"`
+
+	Mode monitors.IPSettings `config:",inline"`
+
+	// default transport for hosts without a scheme: udp, tcp or tls
+	Transport string `config:"transport"`
+
+	// configure DNS over TLS
+	TLS *tlscommon.Config `config:"ssl"`
+
+	Timeout time.Duration `config:"timeout"`
+
+	// query
+	Query            string   `config:"query" validate:"required"`
+	RecordTypes      []string `config:"record_types"`
+	RecursionDesired bool     `config:"recursion_desired"`
+	DNSSEC           bool     `config:"dnssec"`
+
+	// validate response
+	Check checkConfig `config:"check"`
+}
+
+type checkConfig struct {
+	RCode             string          `config:"rcode"`
+	Answers           []string        `config:"answers"`
+	AnswersRegex      []match.Matcher `config:"answers_regex"`
+	AuthenticatedData bool            `config:"authenticated_data"`
+}
+
+func defaultConfig() config {
+	return config{
+		Mode:             monitors.DefaultIPSettings,
+		Transport:        "udp",
+		Timeout:          16 * time.Second,
+		RecordTypes:      []string{"A"},
+		RecursionDesired: true,
+		Check: checkConfig{
+			RCode: "NOERROR",
+		},
+	}
+}
+
+func (c *config) Validate() error {
+	switch c.Transport {
+	case "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("unsupported transport '%s', expected one of udp, tcp or tls", c.Transport)
+	}
+
+	if len(c.RecordTypes) == 0 {
+		return errors.New("at least one record type is required")
+	}
+	for _, typ := range c.RecordTypes {
+		if _, err := parseRecordType(typ); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseRCode(c.Check.RCode); err != nil {
+		return err
+	}
+
+	if c.Check.AuthenticatedData && !c.DNSSEC {
+		return errors.New("check.authenticated_data requires dnssec to be enabled")
+	}
+
+	return nil
+}
+
+func parseRecordType(s string) (uint16, error) {
+	typ, ok := dns.StringToType[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown record type '%s'", s)
+	}
+	return typ, nil
+}
+
+func parseRCode(s string) (int, error) {
+	rcode, ok := dns.StringToRcode[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown response code '%s'", s)
+	}
+	return rcode, nil
+}
@@ -0,0 +1,88 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   mapstr.M
+		valid bool
+	}{
+		{"defaults", mapstr.M{}, true},
+		{"record types", mapstr.M{"record_types": []string{"a", "AAAA", "MX", "TXT"}}, true},
+		{"unknown record type", mapstr.M{"record_types": []string{"NOPE"}}, false},
+		{"tls transport", mapstr.M{"transport": "tls"}, true},
+		{"unknown transport", mapstr.M{"transport": "https"}, false},
+		{"rcode", mapstr.M{"check.rcode": "nxdomain"}, true},
+		{"unknown rcode", mapstr.M{"check.rcode": "NOPE"}, false},
+		{"authenticated data", mapstr.M{"dnssec": true, "check.authenticated_data": true}, true},
+		{"authenticated data without dnssec", mapstr.M{"check.authenticated_data": true}, false},
+		{"invalid regex", mapstr.M{"check.answers_regex": []string{"("}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfgMap := mapstr.M{"hosts": []string{"127.0.0.1"}, "query": "example.com"}
+			cfgMap.DeepUpdate(test.cfg)
+			c, err := conf.NewConfigFrom(cfgMap)
+			require.NoError(t, err)
+
+			config := defaultConfig()
+			err = c.Unpack(&config)
+			assert.Equal(t, test.valid, err == nil, "unexpected result: %v", err)
+		})
+	}
+}
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		host      string
+		transport string
+		expected  string
+	}{
+		{"8.8.8.8", "udp", "udp://8.8.8.8:53"},
+		{"8.8.8.8:5353", "udp", "udp://8.8.8.8:5353"},
+		{"2001:4860:4860::8888", "udp", "udp://[2001:4860:4860::8888]:53"},
+		{"[2001:4860:4860::8888]:5353", "tcp", "tcp://[2001:4860:4860::8888]:5353"},
+		{"dns.example.com", "tls", "tls://dns.example.com:853"},
+		{"tcp://dns.example.com", "udp", "tcp://dns.example.com:53"},
+		{"tls://1.1.1.1/", "udp", "tls://1.1.1.1:853"},
+	}
+
+	for _, test := range tests {
+		u, err := parseServer(test.host, test.transport)
+		if assert.NoError(t, err, test.host) {
+			assert.Equal(t, test.expected, u.String(), test.host)
+		}
+	}
+
+	for _, host := range []string{"https://dns.example.com", "udp://", "tls://1.1.1.1/dns-query"} {
+		_, err := parseServer(host, "udp")
+		assert.Error(t, err, host)
+	}
+}
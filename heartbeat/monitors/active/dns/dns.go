@@ -0,0 +1,224 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/elastic/beats/v7/heartbeat/eventext"
+	"github.com/elastic/beats/v7/heartbeat/look"
+	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/beats/v7/heartbeat/monitors/jobs"
+	"github.com/elastic/beats/v7/heartbeat/monitors/plugin"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers/wraputil"
+	"github.com/elastic/beats/v7/heartbeat/reason"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func init() {
+	plugin.Register("dns", create)
+}
+
+var debugf = logp.MakeDebug("dns")
+
+// defaultPorts are the ports used for resolvers configured without a port.
+var defaultPorts = map[string]string{
+	"udp": "53",
+	"tcp": "53",
+	"tls": "853",
+}
+
+func create(
+	name string,
+	cfg *conf.C,
+) (p plugin.Plugin, err error) {
+	return createWithResolver(cfg, monitors.NewStdResolver())
+}
+
+// createWithResolver allows tests to resolve the hostnames of DNS servers
+// without depending on the hostnames existing in test environments.
+func createWithResolver(
+	cfg *conf.C,
+	resolver monitors.Resolver,
+) (p plugin.Plugin, err error) {
+	jf, err := newJobFactory(cfg, resolver)
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	js, err := jf.makeJobs()
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	return plugin.Plugin{Jobs: js, Endpoints: len(js)}, nil
+}
+
+type jobFactory struct {
+	config      config
+	tlsConfig   *tlscommon.TLSConfig
+	servers     []*url.URL
+	recordTypes []uint16
+	check       responseCheck
+	resolver    monitors.Resolver
+}
+
+func newJobFactory(commonCfg *conf.C, resolver monitors.Resolver) (*jobFactory, error) {
+	jf := &jobFactory{config: defaultConfig(), resolver: resolver}
+	if err := jf.loadConfig(commonCfg); err != nil {
+		return nil, err
+	}
+	return jf, nil
+}
+
+// loadConfig parses the YAML config and populates the jobFactory fields.
+func (jf *jobFactory) loadConfig(commonCfg *conf.C) error {
+	var err error
+	if err = commonCfg.Unpack(&jf.config); err != nil {
+		return err
+	}
+
+	jf.tlsConfig, err = tlscommon.LoadTLSConfig(jf.config.TLS)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range jf.config.Hosts {
+		u, err := parseServer(host, jf.config.Transport)
+		if err != nil {
+			return err
+		}
+		jf.servers = append(jf.servers, u)
+	}
+
+	for _, typ := range jf.config.RecordTypes {
+		// Record types are validated when unpacking the config.
+		qtype, _ := parseRecordType(typ)
+		jf.recordTypes = append(jf.recordTypes, qtype)
+	}
+
+	jf.check, err = makeResponseCheck(&jf.config.Check)
+	return err
+}
+
+// parseServer parses a DNS server given as host, host:port or
+// transport://host:port.
+func parseServer(host, defaultTransport string) (*url.URL, error) {
+	// IPv6 addresses are only recognized with a port if enclosed in brackets.
+	if ip := net.ParseIP(host); ip != nil {
+		host = net.JoinHostPort(host, defaultPorts[defaultTransport])
+	}
+	if !strings.Contains(host, "://") {
+		host = defaultTransport + "://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS server '%s': %w", host, err)
+	}
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("invalid DNS server '%s': unsupported transport '%s'", host, u.Scheme)
+	}
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid DNS server '%s'", host)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	u.Path = ""
+	return u, nil
+}
+
+// makeJobs returns one job per configured DNS server and record type.
+func (jf *jobFactory) makeJobs() ([]jobs.Job, error) {
+	var js []jobs.Job
+	for _, server := range jf.servers {
+		for _, qtype := range jf.recordTypes {
+			job, err := jf.makeServerJob(server, qtype)
+			if err != nil {
+				return nil, err
+			}
+			js = append(js, wraputil.WithURLField(server, job))
+		}
+	}
+	return js, nil
+}
+
+// makeServerJob makes a job that first resolves the IPs of the DNS server
+// (depending on config.Mode), and queries each of them.
+func (jf *jobFactory) makeServerJob(server *url.URL, qtype uint16) (jobs.Job, error) {
+	return monitors.MakeByHostJob(
+		server.Hostname(),
+		jf.config.Mode,
+		jf.resolver,
+		monitors.MakePingIPFactory(func(event *beat.Event, ip *net.IPAddr) error {
+			return jf.query(event, net.JoinHostPort(ip.String(), server.Port()), server, qtype)
+		}))
+}
+
+// query sends the configured query to the DNS server at addr, and validates
+// the response.
+func (jf *jobFactory) query(event *beat.Event, addr string, server *url.URL, qtype uint16) error {
+	client := &dns.Client{
+		Net:     server.Scheme,
+		Timeout: jf.config.Timeout,
+	}
+	if server.Scheme == "tls" {
+		client.Net = "tcp-tls"
+		client.TLSConfig = jf.tlsConfig.BuildModuleClientConfig(server.Hostname())
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(jf.config.Query), qtype)
+	msg.RecursionDesired = jf.config.RecursionDesired
+	if jf.config.DNSSEC {
+		msg.AuthenticatedData = true
+		msg.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	resp, rtt, err := client.Exchange(msg, addr)
+	if err == nil && resp.Truncated && client.Net == "udp" {
+		// Retry truncated responses over TCP, as a stub resolver would.
+		debugf("response from %s truncated, retrying over tcp", addr)
+		client.Net = "tcp"
+		resp, rtt, err = client.Exchange(msg, addr)
+	}
+	if err != nil {
+		debugf("query to %s failed with: %v", addr, err)
+		return reason.IOFailed(err)
+	}
+
+	dnsFields := responseFields(resp)
+	dnsFields["rtt"] = look.RTT(rtt)
+	eventext.MergeEventFields(event, mapstr.M{"dns": dnsFields})
+
+	if err := jf.check(resp); err != nil {
+		return reason.MakeValidateError(err)
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dns
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-lookslike"
+	"github.com/elastic/go-lookslike/isdef"
+	"github.com/elastic/go-lookslike/testslike"
+	"github.com/elastic/go-lookslike/validator"
+
+	"github.com/elastic/beats/v7/heartbeat/hbtest"
+	"github.com/elastic/beats/v7/heartbeat/hbtestllext"
+	"github.com/elastic/beats/v7/heartbeat/monitors/stdfields"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers"
+	"github.com/elastic/beats/v7/heartbeat/scheduler/schedule"
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// startStubServer starts a DNS server on a random port of 127.0.0.1, and
+// returns its address. See serveStub for the records it serves.
+func startStubServer(t *testing.T, network string, tlsConfig *tls.Config) string {
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		serveStub(t, &dns.Server{PacketConn: pc})
+		return pc.LocalAddr().String()
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	serveStub(t, &dns.Server{Listener: l})
+	return l.Addr().String()
+}
+
+// serveStub serves queries for example.com until the test ends. Queries for
+// large.example.com are truncated over UDP. Responses are flagged as
+// authenticated if DNSSEC records are requested.
+func serveStub(t *testing.T, srv *dns.Server) {
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.RecursionAvailable = true
+
+		q := req.Question[0]
+		_, isUDP := w.RemoteAddr().(*net.UDPAddr)
+		switch {
+		case q.Name == "large.example.com." && isUDP:
+			resp.Truncated = true
+		case q.Name == "large.example.com.":
+			resp.Answer = []dns.RR{mustRR(t, "large.example.com. 60 IN A 192.0.2.20")}
+		case q.Name != "example.com.":
+			resp.Rcode = dns.RcodeNameError
+		case q.Qtype == dns.TypeA:
+			resp.Answer = []dns.RR{mustRR(t, "example.com. 300 IN A 192.0.2.10")}
+		case q.Qtype == dns.TypeAAAA:
+			resp.Answer = []dns.RR{mustRR(t, "example.com. 300 IN AAAA 2001:db8::10")}
+		case q.Qtype == dns.TypeTXT:
+			resp.Answer = []dns.RR{mustRR(t, `example.com. 300 IN TXT "v=spf1 " "-all"`)}
+		}
+		if opt := req.IsEdns0(); opt != nil && opt.Do() {
+			resp.AuthenticatedData = true
+			resp.SetEdns0(dns.DefaultMsgSize, true)
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+func testDNSConfigCheck(t *testing.T, configMap mapstr.M) []*beat.Event {
+	config, err := conf.NewConfigFrom(configMap)
+	require.NoError(t, err)
+
+	p, err := create("dns", config)
+	require.NoError(t, err)
+
+	sched := schedule.MustParse("@every 1s")
+	js := wrappers.WrapCommon(p.Jobs, stdfields.StdMonitorFields{ID: "test", Type: "dns", Schedule: sched, Timeout: 1}, nil)
+	require.Len(t, js, p.Endpoints)
+
+	events := make([]*beat.Event, 0, len(js))
+	for _, job := range js {
+		event := &beat.Event{}
+		_, err = job(event)
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	return events
+}
+
+func serverURLChecks(t *testing.T, scheme, addr string) validator.Validator {
+	return hbtest.URLChecks(t, &url.URL{Scheme: scheme, Host: addr})
+}
+
+// answerChecks validates the dns fields of a successful query, which is
+// answered with a single record.
+func answerChecks(name, typ string, flags []string, data string, ttl int64) validator.Validator {
+	var resolvedIPCheck interface{} = isdef.KeyMissing
+	if typ == "A" || typ == "AAAA" {
+		resolvedIPCheck = []interface{}{data}
+	}
+	return lookslike.MustCompile(map[string]interface{}{
+		"dns": map[string]interface{}{
+			"id":            isdef.KeyPresent,
+			"response_code": "NOERROR",
+			"header_flags":  flags,
+			"question": map[string]interface{}{
+				"name":  name,
+				"type":  typ,
+				"class": "IN",
+			},
+			"answers": []interface{}{
+				map[string]interface{}{
+					"name":  name,
+					"type":  typ,
+					"class": "IN",
+					"ttl":   ttl,
+					"data":  data,
+				},
+			},
+			"resolved_ip": resolvedIPCheck,
+			"rtt.us":      hbtestllext.IsInt64,
+		},
+	})
+}
+
+var recursiveFlags = []string{"RD", "RA"}
+
+func TestUpQuery(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			addr := startStubServer(t, network, nil)
+
+			events := testDNSConfigCheck(t, mapstr.M{
+				"hosts":         []string{network + "://" + addr},
+				"query":         "example.com",
+				"record_types":  []string{"A", "AAAA"},
+				"timeout":       "1s",
+				"check.answers": []string{"192.0.2.10"},
+			})
+			require.Len(t, events, 2)
+
+			testslike.Test(
+				t,
+				lookslike.Strict(lookslike.Compose(
+					hbtest.BaseChecks("127.0.0.1", "up", "dns"),
+					hbtest.SummaryStateChecks(1, 0),
+					serverURLChecks(t, network, addr),
+					answerChecks("example.com", "A", recursiveFlags, "192.0.2.10", 300),
+				)),
+				events[0].Fields,
+			)
+			// The expected answer is checked for every record type.
+			testslike.Test(
+				t,
+				lookslike.Strict(lookslike.Compose(
+					hbtest.BaseChecks("127.0.0.1", "down", "dns"),
+					hbtest.SummaryStateChecks(0, 1),
+					serverURLChecks(t, network, addr),
+					answerChecks("example.com", "AAAA", recursiveFlags, "2001:db8::10", 300),
+					hbtest.ErrorChecks("answer '192.0.2.10' not found in response", "validate"),
+				)),
+				events[1].Fields,
+			)
+		})
+	}
+}
+
+func TestTLSQuery(t *testing.T) {
+	// Reuse the certificate of an httptest server, which is valid for
+	// 127.0.0.1.
+	certServer := httptest.NewTLSServer(nil)
+	certServer.Close()
+	certFile := hbtest.CertToTempFile(t, certServer.Certificate())
+	defer certFile.Close()
+
+	addr := startStubServer(t, "tcp", &tls.Config{Certificates: certServer.TLS.Certificates, MinVersion: tls.VersionTLS12})
+
+	events := testDNSConfigCheck(t, mapstr.M{
+		"hosts":                       []string{addr},
+		"transport":                   "tls",
+		"query":                       "example.com",
+		"record_types":                []string{"TXT"},
+		"timeout":                     "1s",
+		"ssl.certificate_authorities": certFile.Name(),
+		"check.answers_regex":         []string{"^v=spf1 "},
+	})
+	require.Len(t, events, 1)
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "dns"),
+			hbtest.SummaryStateChecks(1, 0),
+			serverURLChecks(t, "tls", addr),
+			answerChecks("example.com", "TXT", recursiveFlags, "v=spf1 -all", 300),
+		)),
+		events[0].Fields,
+	)
+}
+
+func TestDNSSECQuery(t *testing.T) {
+	addr := startStubServer(t, "udp", nil)
+
+	events := testDNSConfigCheck(t, mapstr.M{
+		"hosts":                    []string{addr},
+		"query":                    "example.com",
+		"timeout":                  "1s",
+		"dnssec":                   true,
+		"check.authenticated_data": true,
+	})
+	require.Len(t, events, 1)
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "dns"),
+			hbtest.SummaryStateChecks(1, 0),
+			serverURLChecks(t, "udp", addr),
+			answerChecks("example.com", "A", []string{"RD", "RA", "AD", "DO"}, "192.0.2.10", 300),
+		)),
+		events[0].Fields,
+	)
+}
+
+func TestTruncatedQueryRetriesOverTCP(t *testing.T) {
+	// Serve UDP and TCP on the same port.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	udpAddr := pc.LocalAddr().String()
+	l, err := net.Listen("tcp", udpAddr)
+	if err != nil {
+		pc.Close()
+		t.Skipf("port of %s not available for tcp: %v", udpAddr, err)
+	}
+	serveStub(t, &dns.Server{PacketConn: pc})
+	serveStub(t, &dns.Server{Listener: l})
+
+	events := testDNSConfigCheck(t, mapstr.M{
+		"hosts":   []string{udpAddr},
+		"query":   "large.example.com",
+		"timeout": "1s",
+	})
+	require.Len(t, events, 1)
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "dns"),
+			hbtest.SummaryStateChecks(1, 0),
+			serverURLChecks(t, "udp", udpAddr),
+			answerChecks("large.example.com", "A", recursiveFlags, "192.0.2.20", 60),
+		)),
+		events[0].Fields,
+	)
+}
+
+func TestNXDomain(t *testing.T) {
+	addr := startStubServer(t, "udp", nil)
+
+	events := testDNSConfigCheck(t, mapstr.M{
+		"hosts":   []string{addr},
+		"query":   "missing.example.com",
+		"timeout": "1s",
+	})
+	require.Len(t, events, 1)
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "dns"),
+			hbtest.SummaryStateChecks(0, 1),
+			serverURLChecks(t, "udp", addr),
+			lookslike.MustCompile(map[string]interface{}{
+				"dns": map[string]interface{}{
+					"id":            isdef.KeyPresent,
+					"response_code": "NXDOMAIN",
+					"header_flags":  recursiveFlags,
+					"question": map[string]interface{}{
+						"name":  "missing.example.com",
+						"type":  "A",
+						"class": "IN",
+					},
+					"rtt.us": hbtestllext.IsInt64,
+				},
+			}),
+			hbtest.ErrorChecks("received response code NXDOMAIN, expected NOERROR", "validate"),
+		)),
+		events[0].Fields,
+	)
+}
+
+func TestUnreachableServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	events := testDNSConfigCheck(t, mapstr.M{
+		"hosts":     []string{addr},
+		"transport": "tcp",
+		"query":     "example.com",
+		"timeout":   "1s",
+	})
+	require.Len(t, events, 1)
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "dns"),
+			hbtest.SummaryStateChecks(0, 1),
+			serverURLChecks(t, "tcp", addr),
+			hbtest.ErrorChecks("connection refused", "io"),
+		)),
+		events[0].Fields,
+	)
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"fmt"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	methodCheck = "check"
+	methodWatch = "watch"
+)
+
+type config struct {
+	Hosts []string            `config:"hosts" validate:"required"`
+	Mode  monitors.IPSettings `config:",inline"`
+
+	Timeout time.Duration     `config:"timeout"`
+	TLS     *tlscommon.Config `config:"ssl"`
+
+	// Services to check. The empty name checks the overall server health.
+	Services []string `config:"services"`
+
+	// Method of the grpc.health.v1.Health service to call, check or watch.
+	Method string `config:"method"`
+
+	// Headers are sent as request metadata.
+	Headers map[string]string `config:"headers"`
+
+	Check checkConfig `config:"check"`
+}
+
+type checkConfig struct {
+	// Status is the expected serving status.
+	Status string `config:"status"`
+}
+
+func defaultConfig() config {
+	return config{
+		Mode:     monitors.DefaultIPSettings,
+		Timeout:  16 * time.Second,
+		Services: []string{""},
+		Method:   methodCheck,
+		Check: checkConfig{
+			Status: healthpb.HealthCheckResponse_SERVING.String(),
+		},
+	}
+}
+
+func (c *config) Validate() error {
+	switch c.Method {
+	case methodCheck, methodWatch:
+	default:
+		return fmt.Errorf("invalid method '%s', must be one of %s or %s", c.Method, methodCheck, methodWatch)
+	}
+
+	if _, err := parseServingStatus(c.Check.Status); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseServingStatus parses a serving status name, such as SERVING.
+func parseServingStatus(name string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	status, ok := healthpb.HealthCheckResponse_ServingStatus_value[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid serving status '%s'", name)
+	}
+	return healthpb.HealthCheckResponse_ServingStatus(status), nil
+}
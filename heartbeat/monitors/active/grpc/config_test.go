@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input mapstr.M
+		valid bool
+	}{
+		{"defaults", mapstr.M{"hosts": "localhost:50051"}, true},
+		{"no hosts", mapstr.M{}, false},
+		{"watch", mapstr.M{"hosts": "localhost:50051", "method": "watch"}, true},
+		{"invalid method", mapstr.M{"hosts": "localhost:50051", "method": "list"}, false},
+		{"status", mapstr.M{"hosts": "localhost:50051", "check.status": "NOT_SERVING"}, true},
+		{"invalid status", mapstr.M{"hosts": "localhost:50051", "check.status": "serving"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(test.input)
+			require.NoError(t, err)
+
+			c := defaultConfig()
+			err = cfg.Unpack(&c)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
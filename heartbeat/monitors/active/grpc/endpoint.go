@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// makeURLs parses the configured hosts. Hosts can be given as host:port, or
+// as grpc://host:port or grpcs://host:port to use plaintext or TLS
+// independent of the defaultScheme.
+func makeURLs(hosts []string, defaultScheme string) ([]*url.URL, error) {
+	urls := make([]*url.URL, 0, len(hosts))
+	for _, h := range hosts {
+		if !strings.Contains(h, "://") {
+			h = defaultScheme + "://" + h
+		}
+		u, err := url.Parse(h)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse grpc host '%s': %w", h, err)
+		}
+		if u.Scheme != "grpc" && u.Scheme != "grpcs" {
+			return nil, fmt.Errorf("'%s' is not a supported connection scheme in '%s', supported schemes are grpc and grpcs", u.Scheme, u)
+		}
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("could not parse grpc host '%s'", u)
+		}
+		if u.Port() == "" {
+			return nil, fmt.Errorf("host '%s' missing port number", u)
+		}
+
+		urls = append(urls, &url.URL{Scheme: u.Scheme, Host: u.Host})
+	}
+	return urls, nil
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeURLs(t *testing.T) {
+	tests := []struct {
+		name          string
+		hosts         []string
+		defaultScheme string
+		expected      []string
+	}{
+		{"host and port", []string{"localhost:50051"}, "grpc", []string{"grpc://localhost:50051"}},
+		{"default tls", []string{"localhost:50051"}, "grpcs", []string{"grpcs://localhost:50051"}},
+		{"explicit scheme", []string{"grpc://10.0.0.1:50051", "grpcs://[::1]:443"}, "grpcs", []string{"grpc://10.0.0.1:50051", "grpcs://[::1]:443"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urls, err := makeURLs(test.hosts, test.defaultScheme)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, u := range urls {
+				actual = append(actual, u.String())
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	for _, host := range []string{"localhost", "http://localhost:50051", "grpc://:50051"} {
+		_, err := makeURLs([]string{host}, "grpc")
+		assert.Error(t, err, host)
+	}
+}
@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/heartbeat/eventext"
+	"github.com/elastic/beats/v7/heartbeat/look"
+	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/dialchain"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/dialchain/tlsmeta"
+	"github.com/elastic/beats/v7/heartbeat/monitors/jobs"
+	"github.com/elastic/beats/v7/heartbeat/monitors/plugin"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers/wraputil"
+	"github.com/elastic/beats/v7/heartbeat/reason"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/version"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/transport"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/elastic/elastic-agent-libs/useragent"
+)
+
+func init() {
+	plugin.Register("grpc", create)
+}
+
+var debugf = logp.MakeDebug("grpc")
+
+var userAgent = useragent.UserAgent("Heartbeat", version.GetDefaultVersion(), version.Commit(), version.BuildTime().String())
+
+func create(
+	name string,
+	cfg *conf.C,
+) (p plugin.Plugin, err error) {
+	return createWithResolver(cfg, monitors.NewStdResolver())
+}
+
+// Custom resolver is useful for tests against hostnames locally where we don't want to depend on any
+// hostnames existing in test environments
+func createWithResolver(
+	cfg *conf.C,
+	resolver monitors.Resolver,
+) (p plugin.Plugin, err error) {
+	jf, err := newJobFactory(cfg, resolver)
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	js, err := jf.makeJobs()
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	return plugin.Plugin{Jobs: js, Endpoints: len(js)}, nil
+}
+
+type jobFactory struct {
+	config    config
+	tlsConfig *tlscommon.TLSConfig
+	urls      []*url.URL
+	status    healthpb.HealthCheckResponse_ServingStatus
+	metadata  metadata.MD
+	resolver  monitors.Resolver
+}
+
+func newJobFactory(commonCfg *conf.C, resolver monitors.Resolver) (*jobFactory, error) {
+	jf := &jobFactory{config: defaultConfig(), resolver: resolver}
+	if err := commonCfg.Unpack(&jf.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	jf.tlsConfig, err = tlscommon.LoadTLSConfig(jf.config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultScheme := "grpc"
+	if jf.tlsConfig != nil {
+		defaultScheme = "grpcs"
+	}
+	jf.urls, err = makeURLs(jf.config.Hosts, defaultScheme)
+	if err != nil {
+		return nil, err
+	}
+
+	jf.status, err = parseServingStatus(jf.config.Check.Status)
+	if err != nil {
+		return nil, err
+	}
+	jf.metadata = metadata.New(jf.config.Headers)
+
+	return jf, nil
+}
+
+// makeJobs returns a job per configured host and service.
+func (jf *jobFactory) makeJobs() ([]jobs.Job, error) {
+	var js []jobs.Job
+	for _, u := range jf.urls {
+		for _, service := range jf.config.Services {
+			endpointURL, service := u, service
+			job, err := monitors.MakeByHostJob(
+				endpointURL.Hostname(),
+				jf.config.Mode,
+				jf.resolver,
+				monitors.MakePingIPFactory(func(event *beat.Event, ip *net.IPAddr) error {
+					// use address from resolved IP
+					ipPort := net.JoinHostPort(ip.String(), endpointURL.Port())
+					return jf.check(event, ipPort, endpointURL, service)
+				}))
+			if err != nil {
+				return nil, err
+			}
+			js = append(js, wraputil.WithURLField(endpointURL, job))
+		}
+	}
+	return js, nil
+}
+
+// buildDialer creates a dialer connecting to dialAddr. If canonicalURL uses
+// TLS, the certificate is verified against the host of canonicalURL.
+func (jf *jobFactory) buildDialer(event *beat.Event, dialAddr string, canonicalURL *url.URL) (transport.Dialer, error) {
+	dc := &dialchain.DialerChain{
+		Net: dialchain.TCPDialer(jf.config.Timeout),
+	}
+	dc.AddLayer(dialchain.ConstAddrLayer(dialAddr))
+	if canonicalURL.Scheme == "grpcs" {
+		// gRPC servers require the h2 protocol to be negotiated.
+		dc.AddLayer(dialchain.ALPNTLSLayer(jf.tlsConfig, jf.config.Timeout, []string{"h2"}))
+		dc.AddLayer(dialchain.ConstAddrLayer(canonicalURL.Host))
+	}
+	return dc.Build(event)
+}
+
+// check calls the health service of the server at dialAddr for a single service.
+func (jf *jobFactory) check(event *beat.Event, dialAddr string, canonicalURL *url.URL, service string) error {
+	dialer, err := jf.buildDialer(event, dialAddr, canonicalURL)
+	if err != nil {
+		return err
+	}
+
+	// Errors returned by the dialer are only reported as text by gRPC, keep
+	// the original error to report certificate details.
+	var (
+		dialErrMu sync.Mutex
+		dialErr   error
+	)
+	conn, err := grpc.NewClient(
+		"passthrough:///"+canonicalURL.Host,
+		// TLS is handled by the dialer chain.
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				dialErrMu.Lock()
+				dialErr = err
+				dialErrMu.Unlock()
+			}
+			return conn, err
+		}),
+		grpc.WithUserAgent(userAgent),
+		grpc.WithDisableRetry(),
+	)
+	if err != nil {
+		return reason.IOFailed(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), jf.config.Timeout)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, jf.metadata)
+
+	fields := mapstr.M{"service": service}
+	start := time.Now()
+	resp, err := jf.call(ctx, healthpb.NewHealthClient(conn), service)
+	fields["status_code"] = status.Code(err).String()
+	if err == nil {
+		fields["status"] = resp.GetStatus().String()
+		fields["rtt"] = look.RTT(time.Since(start))
+	}
+	eventext.MergeEventFields(event, mapstr.M{"grpc": fields})
+
+	dialErrMu.Lock()
+	defer dialErrMu.Unlock()
+	if dialErr != nil {
+		debugf("dial failed with: %v", dialErr)
+		var certErr x509.CertificateInvalidError
+		if errors.As(dialErr, &certErr) {
+			tlsFields := tlsmeta.CertFields(certErr.Cert, nil)
+			event.Fields.DeepUpdate(mapstr.M{"tls": tlsFields})
+		}
+		return reason.IOFailed(dialErr)
+	}
+	if err != nil {
+		debugf("health check failed with: %v", err)
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return reason.IOFailed(err)
+		default:
+			return reason.MakeValidateError(err)
+		}
+	}
+
+	if resp.GetStatus() != jf.status {
+		return reason.MakeValidateError(fmt.Errorf("serving status %s, expected %s", resp.GetStatus(), jf.status))
+	}
+	return nil
+}
+
+// call executes the configured health service method. Watch returns once the
+// first status update was received.
+func (jf *jobFactory) call(ctx context.Context, client healthpb.HealthClient, service string) (*healthpb.HealthCheckResponse, error) {
+	req := &healthpb.HealthCheckRequest{Service: service}
+	if jf.config.Method == methodCheck {
+		return client.Check(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Recv()
+}
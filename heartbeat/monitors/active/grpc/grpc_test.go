@@ -0,0 +1,333 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-lookslike"
+	"github.com/elastic/go-lookslike/testslike"
+	"github.com/elastic/go-lookslike/validator"
+
+	"github.com/elastic/beats/v7/heartbeat/ecserr"
+	"github.com/elastic/beats/v7/heartbeat/hbtest"
+	"github.com/elastic/beats/v7/heartbeat/hbtestllext"
+	"github.com/elastic/beats/v7/heartbeat/monitors/stdfields"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers"
+	"github.com/elastic/beats/v7/heartbeat/scheduler/schedule"
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// startHealthServer starts a gRPC server exposing the health service. The
+// metadata of the last request is sent to the returned channel.
+func startHealthServer(t *testing.T, opts ...grpc.ServerOption) (string, *health.Server, <-chan metadata.MD) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	md := make(chan metadata.MD, 10)
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			m, _ := metadata.FromIncomingContext(ctx)
+			md <- m
+			return handler(ctx, req)
+		}),
+	)
+	srv := grpc.NewServer(opts...)
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(srv.Stop)
+
+	return l.Addr().String(), healthSrv, md
+}
+
+// startTLSHealthServer starts a health server using the certificate of the
+// httptest package, valid for 127.0.0.1 and example.com.
+func startTLSHealthServer(t *testing.T) (string, *x509.Certificate, string) {
+	httpSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsCert := httpSrv.TLS.Certificates[0]
+	httpSrv.Close()
+
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	require.NoError(t, err)
+
+	certFile := hbtest.CertToTempFile(t, cert)
+	require.NoError(t, certFile.Close())
+	t.Cleanup(func() { os.Remove(certFile.Name()) })
+
+	addr, _, _ := startHealthServer(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		MinVersion:   tls.VersionTLS12,
+	})))
+	return addr, cert, certFile.Name()
+}
+
+func testGRPCConfigCheck(t *testing.T, configMap mapstr.M) *beat.Event {
+	config, err := conf.NewConfigFrom(configMap)
+	require.NoError(t, err)
+
+	p, err := create("grpc", config)
+	require.NoError(t, err)
+	require.Equal(t, 1, p.Endpoints)
+
+	sched := schedule.MustParse("@every 1s")
+	job := wrappers.WrapCommon(p.Jobs, stdfields.StdMonitorFields{ID: "test", Type: "grpc", Schedule: sched, Timeout: 1}, nil)[0]
+
+	event := &beat.Event{}
+	_, err = job(event)
+	require.NoError(t, err)
+
+	return event
+}
+
+func grpcChecks(t *testing.T, scheme, addr, service, statusCode, status string) validator.Validator {
+	fields := map[string]interface{}{
+		"service":     service,
+		"status_code": statusCode,
+	}
+	if status != "" {
+		fields["status"] = status
+		fields["rtt.us"] = hbtestllext.IsInt64
+	}
+	return lookslike.Compose(
+		hbtest.URLChecks(t, &url.URL{Scheme: scheme, Host: addr}),
+		hbtest.RespondingTCPChecks(),
+		lookslike.MustCompile(map[string]interface{}{"grpc": fields}),
+	)
+}
+
+func TestServingJob(t *testing.T) {
+	addr, _, _ := startHealthServer(t)
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   addr,
+		"timeout": "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "grpc"),
+			hbtest.SummaryStateChecks(1, 0),
+			grpcChecks(t, "grpc", addr, "", "OK", "SERVING"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestServiceStatus(t *testing.T) {
+	addr, healthSrv, _ := startHealthServer(t)
+	healthSrv.SetServingStatus("orders", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	for _, method := range []string{"check", "watch"} {
+		t.Run(method, func(t *testing.T) {
+			event := testGRPCConfigCheck(t, mapstr.M{
+				"hosts":    addr,
+				"services": []string{"orders"},
+				"method":   method,
+				"timeout":  "1s",
+			})
+
+			testslike.Test(
+				t,
+				lookslike.Strict(lookslike.Compose(
+					hbtest.BaseChecks("127.0.0.1", "down", "grpc"),
+					hbtest.SummaryStateChecks(0, 1),
+					grpcChecks(t, "grpc", addr, "orders", "OK", "NOT_SERVING"),
+					hbtest.ErrorChecks("serving status NOT_SERVING, expected SERVING", "validate"),
+				)),
+				event.Fields,
+			)
+		})
+	}
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":        addr,
+		"services":     []string{"orders"},
+		"check.status": "NOT_SERVING",
+		"timeout":      "1s",
+	})
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "grpc"),
+			hbtest.SummaryStateChecks(1, 0),
+			grpcChecks(t, "grpc", addr, "orders", "OK", "NOT_SERVING"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestUnknownServiceJob(t *testing.T) {
+	addr, _, _ := startHealthServer(t)
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":    addr,
+		"services": []string{"unknown"},
+		"timeout":  "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "grpc"),
+			hbtest.SummaryStateChecks(0, 1),
+			grpcChecks(t, "grpc", addr, "unknown", "NotFound", ""),
+			hbtest.ErrorChecks("unknown service", "validate"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestHeaders(t *testing.T) {
+	addr, _, md := startHealthServer(t)
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   addr,
+		"headers": mapstr.M{"Authorization": "Bearer secret"},
+		"timeout": "1s",
+	})
+	require.Equal(t, "up", event.Fields["monitor"].(mapstr.M)["status"])
+
+	received := <-md
+	require.Equal(t, []string{"Bearer secret"}, received.Get("authorization"))
+	require.Contains(t, received.Get("user-agent")[0], "Heartbeat")
+}
+
+func TestTLSJob(t *testing.T) {
+	addr, cert, certFile := startTLSHealthServer(t)
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   addr,
+		"ssl":     mapstr.M{"certificate_authorities": certFile},
+		"timeout": "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "grpc"),
+			hbtest.SummaryStateChecks(1, 0),
+			grpcChecks(t, "grpcs", addr, "", "OK", "SERVING"),
+			hbtest.TLSChecks(0, 0, cert),
+			lookslike.MustCompile(map[string]interface{}{"tls.next_protocol": "h2"}),
+		)),
+		event.Fields,
+	)
+}
+
+func TestTLSInvalidCert(t *testing.T) {
+	addr, cert, _ := startTLSHealthServer(t)
+
+	// Without the CA the self-signed certificate of the server isn't trusted.
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   "grpcs://" + addr,
+		"timeout": "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "grpc"),
+			hbtest.SummaryStateChecks(0, 1),
+			grpcChecks(t, "grpcs", addr, "", "Unavailable", ""),
+			hbtest.ErrorChecks(x509.UnknownAuthorityError{Cert: cert}.Error(), "io"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestTLSExpiredCert(t *testing.T) {
+	certFile := "../fixtures/expired.cert"
+	tlsCert, err := tls.LoadX509KeyPair(certFile, "../fixtures/expired.key")
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	require.NoError(t, err)
+
+	addr, _, _ := startHealthServer(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		MinVersion:   tls.VersionTLS12,
+	})))
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	host := net.JoinHostPort("localhost", port)
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   host,
+		"ssl":     mapstr.M{"certificate_authorities": certFile},
+		"timeout": "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "grpc"),
+			hbtest.SummaryStateChecks(0, 1),
+			hbtest.ResolveChecks("127.0.0.1"),
+			grpcChecks(t, "grpcs", host, "", "Unavailable", ""),
+			hbtest.ExpiredCertChecks(cert),
+		)),
+		event.Fields,
+	)
+}
+
+func TestUnreachableJob(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	event := testGRPCConfigCheck(t, mapstr.M{
+		"hosts":   addr,
+		"timeout": "1s",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "grpc"),
+			hbtest.SummaryStateChecks(0, 1),
+			hbtest.URLChecks(t, &url.URL{Scheme: "grpc", Host: addr}),
+			lookslike.MustCompile(map[string]interface{}{
+				"grpc.service":     "",
+				"grpc.status_code": "Unavailable",
+			}),
+			hbtest.ECSErrCodeChecks(ecserr.CODE_NET_COULD_NOT_CONNECT, "dial tcp "+addr),
+		)),
+		event.Fields,
+	)
+}
@@ -18,25 +18,12 @@
 package tcp
 
 import (
-	"bytes"
-	"errors"
-	"net"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/datacheck"
 )
 
-// dataCheck executes over an open TCP connection using the send / receive
-// parameters the user has defined.
-type dataCheck func(net.Conn) error
-
-var (
-	errNoDataReceived = errors.New("no data")
-	errRecvMismatch   = errors.New("received string mismatch")
-)
-
-func (c dataCheck) Check(conn net.Conn) error {
-	return c(conn)
-}
-
-func makeDataCheck(config *config) dataCheck {
+// makeDataCheck returns the check to execute over an open TCP connection
+// using the send / receive parameters the user has defined.
+func makeDataCheck(config *config) datacheck.Check {
 	send := config.SendString
 	recv := config.ReceiveString
 
@@ -44,77 +31,10 @@ func makeDataCheck(config *config) dataCheck {
 	case send == "" && recv == "":
 		return nil
 	case send != "" && recv == "":
-		return checkAll(checkSend([]byte(send)), checkRecvAny)
+		return datacheck.All(datacheck.Send([]byte(send)), datacheck.RecvAny)
 	case send == "" && recv != "":
-		return checkRecv([]byte(recv))
+		return datacheck.Recv([]byte(recv))
 	default: // send != "" && recv != "":
-		return checkAll(checkSend([]byte(send)), checkRecv([]byte(recv)))
-	}
-}
-
-func checkAll(checks ...dataCheck) dataCheck {
-	return func(conn net.Conn) error {
-		for _, check := range checks {
-			if err := check(conn); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-}
-
-func checkSend(buf []byte) dataCheck {
-	return func(conn net.Conn) error {
-		return sendBuffer(conn, buf)
-	}
-}
-
-func checkRecv(expected []byte) dataCheck {
-	return func(conn net.Conn) error {
-		buf := make([]byte, len(expected))
-		if err := recvBuffer(conn, buf); err != nil {
-			return err
-		}
-		if !bytes.Equal(expected, buf) {
-			//nolint:godox // old TODO
-			//TODO: report received value and expected value in event
-			return errRecvMismatch
-		}
-		return nil
-	}
-}
-
-func checkRecvAny(conn net.Conn) error {
-	// receive 'anything'
-	var buf [1024]byte
-	n, err := conn.Read(buf[:])
-	if err != nil {
-		return err
-	}
-	if n == 0 {
-		return errNoDataReceived
-	}
-	return nil
-}
-
-func sendBuffer(conn net.Conn, buf []byte) error {
-	for len(buf) > 0 {
-		n, err := conn.Write(buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[n:]
-	}
-	return nil
-}
-
-func recvBuffer(conn net.Conn, buf []byte) error {
-	for len(buf) > 0 {
-		n, err := conn.Read(buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[n:]
+		return datacheck.All(datacheck.Send([]byte(send)), datacheck.Recv([]byte(recv)))
 	}
-	return nil
 }
@@ -27,6 +27,7 @@ import (
 	"github.com/elastic/beats/v7/heartbeat/eventext"
 	"github.com/elastic/beats/v7/heartbeat/look"
 	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/datacheck"
 	"github.com/elastic/beats/v7/heartbeat/monitors/active/dialchain"
 	"github.com/elastic/beats/v7/heartbeat/monitors/active/dialchain/tlsmeta"
 	"github.com/elastic/beats/v7/heartbeat/monitors/jobs"
@@ -80,7 +81,7 @@ type jobFactory struct {
 	tlsConfig     *tlscommon.TLSConfig
 	defaultScheme string
 	endpoints     []endpoint
-	dataCheck     dataCheck
+	dataCheck     datacheck.Check
 	resolver      monitors.Resolver
 }
 
@@ -250,7 +251,7 @@ func (jf *jobFactory) execDialer(
 
 	validateStart := time.Now()
 	err = jf.dataCheck.Check(conn)
-	if err != nil && !errors.Is(err, errRecvMismatch) {
+	if err != nil && !errors.Is(err, datacheck.ErrRecvMismatch) {
 		debugf("check failed with: %v", err)
 		return reason.IOFailed(err)
 	}
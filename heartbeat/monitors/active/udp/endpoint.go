@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package udp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// makeURLs creates a single URL for each host/port permutation. Hosts can be
+// given as host, host:port or udp://host:port.
+func makeURLs(hosts []string, ports []uint16) ([]*url.URL, error) {
+	var urls []*url.URL
+	for _, h := range hosts {
+		if !strings.Contains(h, "://") {
+			h = "udp://" + h
+		}
+		u, err := url.Parse(h)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse udp host '%s': %w", h, err)
+		}
+		if u.Scheme != "udp" {
+			return nil, fmt.Errorf("'%s' is not a supported connection scheme in '%s', the supported scheme is udp", u.Scheme, u)
+		}
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("could not parse udp host '%s'", u)
+		}
+
+		hostPorts := ports
+		if u.Port() != "" {
+			port, err := strconv.ParseUint(u.Port(), 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in udp host '%s': %w", u, err)
+			}
+			hostPorts = []uint16{uint16(port)}
+		}
+		if len(hostPorts) == 0 {
+			return nil, fmt.Errorf("host '%s' missing port number", u)
+		}
+
+		for _, port := range hostPorts {
+			urls = append(urls, &url.URL{
+				Scheme: "udp",
+				Host:   net.JoinHostPort(u.Hostname(), strconv.Itoa(int(port))),
+			})
+		}
+	}
+	return urls, nil
+}
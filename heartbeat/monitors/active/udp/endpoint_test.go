@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package udp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		hosts    []string
+		ports    []uint16
+		expected []string
+	}{
+		{"host and ports", []string{"localhost"}, []uint16{514, 1514}, []string{"udp://localhost:514", "udp://localhost:1514"}},
+		{"host with port", []string{"localhost:514"}, []uint16{1514}, []string{"udp://localhost:514"}},
+		{"url", []string{"udp://10.0.0.1:27015"}, nil, []string{"udp://10.0.0.1:27015"}},
+		{"ipv6", []string{"[::1]:514"}, nil, []string{"udp://[::1]:514"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urls, err := makeURLs(test.hosts, test.ports)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, u := range urls {
+				actual = append(actual, u.String())
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	for _, host := range []string{"localhost", "tcp://localhost:514", "udp://:514", "localhost:99999"} {
+		_, err := makeURLs([]string{host}, nil)
+		assert.Error(t, err, host)
+	}
+}
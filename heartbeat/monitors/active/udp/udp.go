@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package udp
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/elastic/beats/v7/heartbeat/eventext"
+	"github.com/elastic/beats/v7/heartbeat/look"
+	"github.com/elastic/beats/v7/heartbeat/monitors"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/datacheck"
+	"github.com/elastic/beats/v7/heartbeat/monitors/active/dialchain"
+	"github.com/elastic/beats/v7/heartbeat/monitors/jobs"
+	"github.com/elastic/beats/v7/heartbeat/monitors/plugin"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers/wraputil"
+	"github.com/elastic/beats/v7/heartbeat/reason"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func init() {
+	plugin.Register("udp", create)
+}
+
+var debugf = logp.MakeDebug("udp")
+
+func create(
+	name string,
+	cfg *conf.C,
+) (p plugin.Plugin, err error) {
+	return createWithResolver(cfg, monitors.NewStdResolver())
+}
+
+// Custom resolver is useful for tests against hostnames locally where we don't want to depend on any
+// hostnames existing in test environments
+func createWithResolver(
+	cfg *conf.C,
+	resolver monitors.Resolver,
+) (p plugin.Plugin, err error) {
+	jf, err := newJobFactory(cfg, resolver)
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	js, err := jf.makeJobs()
+	if err != nil {
+		return plugin.Plugin{}, err
+	}
+
+	return plugin.Plugin{Jobs: js, Endpoints: len(jf.urls)}, nil
+}
+
+type jobFactory struct {
+	config    config
+	urls      []*url.URL
+	dataCheck datacheck.Check
+	resolver  monitors.Resolver
+}
+
+func newJobFactory(commonCfg *conf.C, resolver monitors.Resolver) (*jobFactory, error) {
+	jf := &jobFactory{config: defaultConfig(), resolver: resolver}
+	if err := commonCfg.Unpack(&jf.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	jf.urls, err = makeURLs(jf.config.Hosts, jf.config.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	jf.dataCheck = makeDataCheck(&jf.config)
+	return jf, nil
+}
+
+// makeDataCheck sends the payload, and if a response is expected, compares
+// the start of the response datagram with it. Without an expected response
+// the endpoint is up once the payload was sent, as UDP services such as
+// syslog don't respond.
+func makeDataCheck(config *config) datacheck.Check {
+	send := datacheck.Send([]byte(config.SendString))
+	if config.ReceiveString == "" {
+		return send
+	}
+	return datacheck.All(send, datacheck.RecvDatagram([]byte(config.ReceiveString)))
+}
+
+// makeJobs returns the actual schedulable jobs for this monitor.
+func (jf *jobFactory) makeJobs() ([]jobs.Job, error) {
+	var js []jobs.Job
+	for _, u := range jf.urls {
+		endpointURL := u
+		job, err := monitors.MakeByHostJob(
+			endpointURL.Hostname(),
+			jf.config.Mode,
+			jf.resolver,
+			monitors.MakePingIPFactory(func(event *beat.Event, ip *net.IPAddr) error {
+				// use address from resolved IP
+				return jf.dial(event, net.JoinHostPort(ip.String(), endpointURL.Port()))
+			}))
+		if err != nil {
+			return nil, err
+		}
+		js = append(js, wraputil.WithURLField(endpointURL, job))
+	}
+	return js, nil
+}
+
+// dial connects to addr and executes the data check.
+func (jf *jobFactory) dial(event *beat.Event, addr string) error {
+	dc := &dialchain.DialerChain{
+		Net: dialchain.UDPDialer(jf.config.Timeout),
+	}
+	dc.AddLayer(dialchain.ConstAddrLayer(addr))
+
+	dialer, err := dc.Build(event)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	conn, err := dialer.Dial("udp", addr)
+	if err != nil {
+		debugf("dial failed with: %v", err)
+		return reason.IOFailed(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(start.Add(jf.config.Timeout)); err != nil {
+		debugf("setting connection deadline failed with: %v", err)
+		return reason.IOFailed(err)
+	}
+
+	validateStart := time.Now()
+	err = jf.dataCheck.Check(conn)
+	if err != nil && !errors.Is(err, datacheck.ErrRecvMismatch) {
+		debugf("check failed with: %v", err)
+		return reason.IOFailed(err)
+	}
+
+	end := time.Now()
+	eventext.MergeEventFields(event, mapstr.M{
+		"udp": mapstr.M{
+			"rtt": mapstr.M{
+				"validate": look.RTT(end.Sub(validateStart)),
+			},
+		},
+	})
+	if err != nil {
+		return reason.MakeValidateError(err)
+	}
+
+	return nil
+}
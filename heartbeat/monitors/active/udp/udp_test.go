@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package udp
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-lookslike"
+	"github.com/elastic/go-lookslike/testslike"
+	"github.com/elastic/go-lookslike/validator"
+
+	"github.com/elastic/beats/v7/heartbeat/hbtest"
+	"github.com/elastic/beats/v7/heartbeat/hbtestllext"
+	"github.com/elastic/beats/v7/heartbeat/monitors/stdfields"
+	"github.com/elastic/beats/v7/heartbeat/monitors/wrappers"
+	"github.com/elastic/beats/v7/heartbeat/scheduler/schedule"
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// startPongServer starts a UDP server answering "ping" datagrams with
+// "pong", and ignoring anything else. It returns the server address, and
+// a channel receiving every datagram.
+func startPongServer(t *testing.T) (string, <-chan []byte) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan []byte, 10)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg := bytes.Clone(buf[:n])
+			received <- msg
+			if bytes.Equal(msg, []byte("ping")) {
+				_, _ = conn.WriteTo([]byte("pong"), addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), received
+}
+
+func testUDPConfigCheck(t *testing.T, configMap mapstr.M) *beat.Event {
+	config, err := conf.NewConfigFrom(configMap)
+	require.NoError(t, err)
+
+	p, err := create("udp", config)
+	require.NoError(t, err)
+	require.Equal(t, 1, p.Endpoints)
+
+	sched := schedule.MustParse("@every 1s")
+	job := wrappers.WrapCommon(p.Jobs, stdfields.StdMonitorFields{ID: "test", Type: "udp", Schedule: sched, Timeout: 1}, nil)[0]
+
+	event := &beat.Event{}
+	_, err = job(event)
+	require.NoError(t, err)
+
+	return event
+}
+
+func udpChecks(t *testing.T, addr string) validator.Validator {
+	return lookslike.Compose(
+		hbtest.URLChecks(t, &url.URL{Scheme: "udp", Host: addr}),
+		lookslike.MustCompile(map[string]interface{}{
+			"udp.rtt.connect.us": hbtestllext.IsInt64,
+		}),
+	)
+}
+
+func validateChecks() validator.Validator {
+	return lookslike.MustCompile(map[string]interface{}{
+		"udp.rtt.validate.us": hbtestllext.IsInt64,
+	})
+}
+
+func TestUpEndpointJob(t *testing.T) {
+	addr, received := startPongServer(t)
+
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":         addr,
+		"timeout":       "1s",
+		"check.send":    "ping",
+		"check.receive": "pong",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "udp"),
+			hbtest.SummaryStateChecks(1, 0),
+			udpChecks(t, addr),
+			validateChecks(),
+		)),
+		event.Fields,
+	)
+	require.Equal(t, []byte("ping"), <-received)
+}
+
+func TestSendOnlyEndpointJob(t *testing.T) {
+	addr, received := startPongServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":      "udp://" + host,
+		"ports":      []string{port},
+		"timeout":    "1s",
+		"check.send": "<14>heartbeat: hello",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "udp"),
+			hbtest.SummaryStateChecks(1, 0),
+			udpChecks(t, addr),
+			validateChecks(),
+		)),
+		event.Fields,
+	)
+	require.Equal(t, []byte("<14>heartbeat: hello"), <-received)
+}
+
+func TestResponseMismatchEndpointJob(t *testing.T) {
+	addr, _ := startPongServer(t)
+
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":         addr,
+		"timeout":       "1s",
+		"check.send":    "ping",
+		"check.receive": "PONG",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "udp"),
+			hbtest.SummaryStateChecks(0, 1),
+			udpChecks(t, addr),
+			validateChecks(),
+			hbtest.ErrorChecks("received string mismatch", "validate"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestShortResponseEndpointJob(t *testing.T) {
+	addr, _ := startPongServer(t)
+
+	// The response is shorter than expected, the check must fail without
+	// waiting for more data.
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":         addr,
+		"timeout":       "10s",
+		"check.send":    "ping",
+		"check.receive": "pong and more",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "udp"),
+			hbtest.SummaryStateChecks(0, 1),
+			udpChecks(t, addr),
+			validateChecks(),
+			hbtest.ErrorChecks("received string mismatch", "validate"),
+		)),
+		event.Fields,
+	)
+}
+
+func TestPrefixResponseEndpointJob(t *testing.T) {
+	addr, _ := startPongServer(t)
+
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":         addr,
+		"timeout":       "1s",
+		"check.send":    "ping",
+		"check.receive": "po",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "up", "udp"),
+			hbtest.SummaryStateChecks(1, 0),
+			udpChecks(t, addr),
+			validateChecks(),
+		)),
+		event.Fields,
+	)
+}
+
+func TestNoResponseEndpointJob(t *testing.T) {
+	addr, _ := startPongServer(t)
+
+	event := testUDPConfigCheck(t, mapstr.M{
+		"hosts":         addr,
+		"timeout":       "100ms",
+		"check.send":    "hello",
+		"check.receive": "pong",
+	})
+
+	testslike.Test(
+		t,
+		lookslike.Strict(lookslike.Compose(
+			hbtest.BaseChecks("127.0.0.1", "down", "udp"),
+			hbtest.SummaryStateChecks(0, 1),
+			udpChecks(t, addr),
+			hbtest.ErrorChecks("i/o timeout", "io"),
+		)),
+		event.Fields,
+	)
+}
@@ -402,6 +402,87 @@ output:
 `),
 			expectValidationError: "disk queue is not supported when management is enabled accessing config",
 		},
+		"managementRoutedOutputSpillQueue": {
+			input: []byte(`
+name: mockbeat
+management:
+  enabled: true
+output:
+  elasticsearch:
+    hosts:
+      - "localhost:9200"
+outputs:
+  - name: archive
+    queue:
+      spill:
+        disk.max_size: 1G
+    output:
+      file:
+        path: "/tmp/archive"
+`),
+			expectValidationError: `spill queue of output "archive" is not supported when management is enabled accessing config`,
+		},
+		"managementRoutedOutputLevelDiskQueue": {
+			input: []byte(`
+name: mockbeat
+management:
+  enabled: true
+output:
+  elasticsearch:
+    hosts:
+      - "localhost:9200"
+outputs:
+  - name: archive
+    output:
+      file:
+        path: "/tmp/archive"
+        queue:
+          disk:
+            max_size: 1G
+`),
+			expectValidationError: `disk queue of output "archive" is not supported when management is enabled accessing config`,
+		},
+		"routedOutputAndOutputLevelQueue": {
+			input: []byte(`
+name: mockbeat
+output:
+  elasticsearch:
+    hosts:
+      - "localhost:9200"
+outputs:
+  - name: archive
+    queue:
+      mem:
+        events: 2048
+    output:
+      file:
+        path: "/tmp/archive"
+        queue:
+          mem:
+            events: 8096
+`),
+			expectValidationError: `output "archive" has queue and output level queue settings defined, only one is allowed accessing 'outputs.0'`,
+		},
+		"managementFalseRoutedOutputDiskQueue": {
+			input: []byte(`
+name: mockbeat
+management:
+  enabled: false
+output:
+  elasticsearch:
+    hosts:
+      - "localhost:9200"
+outputs:
+  - name: archive
+    queue:
+      disk:
+        max_size: 1G
+    output:
+      file:
+        path: "/tmp/archive"
+`),
+			expectValidationError: "",
+		},
 		"managementFalseOutputLevelDiskQueue": {
 			input: []byte(`
 name: mockbeat
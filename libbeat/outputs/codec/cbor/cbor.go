@@ -0,0 +1,39 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/structcodec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Encoder for serializing a beat.Event to CBOR.
+type Encoder = structcodec.Encoder
+
+func init() {
+	codec.RegisterType("cbor", func(info beat.Info, _ *config.C) (codec.Codec, error) {
+		return New(info.Version), nil
+	})
+}
+
+// New creates a new CBOR Encoder.
+func New(version string) *Encoder {
+	return structcodec.New(version, newVisitor)
+}
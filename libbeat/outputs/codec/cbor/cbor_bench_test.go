@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var result []byte
+
+func BenchmarkUTCTime(b *testing.B) {
+	var r []byte
+	codec := New("1.2.3")
+	fields := mapstr.M{"msg": "message"}
+	var t time.Time
+	var d time.Duration = 1000000000
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t = t.Add(d)
+		r, _ = codec.Encode("test", &beat.Event{Fields: fields, Timestamp: t})
+	}
+	result = r
+}
+
+func BenchmarkLogEvent(b *testing.B) {
+	var r []byte
+	codec := New("1.2.3")
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"message": "2024-05-01T12:30:15.123Z INFO [publisher] pipeline/retry.go:213 retryer: send wait signal to consumer",
+			"log": mapstr.M{
+				"file":   mapstr.M{"path": "/var/log/filebeat/filebeat.log"},
+				"offset": 1284313,
+			},
+			"input": mapstr.M{"type": "filestream"},
+			"host": mapstr.M{
+				"name":         "host1",
+				"architecture": "x86_64",
+				"ip":           []string{"10.0.0.1", "fe80::1"},
+				"os":           mapstr.M{"family": "debian", "kernel": "6.1.0", "version": "12"},
+			},
+			"agent": mapstr.M{"type": "filebeat", "version": "8.15.0", "ephemeral_id": "4f3b6c1e-2f1a-4a6e-9d3b-6a8f0c2e7b1d"},
+			"ecs":   mapstr.M{"version": "8.0.0"},
+			"tags":  []string{"production", "beats"},
+		},
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r, _ = codec.Encode("test", event)
+	}
+	result = r
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ugorjicodec "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/structcodec"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
+)
+
+func TestCBORCodecLayout(t *testing.T) {
+	codec := New("1.2.3")
+	encoded, err := codec.Encode("test", &beat.Event{Fields: mapstr.M{"n": 1}})
+	require.NoError(t, err)
+
+	// Objects are written as indefinite-length maps, arrays and values with
+	// their most compact representation.
+	expected := "\xbf" +
+		"\x6a@timestamp\x78\x180001-01-01T00:00:00.000Z" +
+		"\x69@metadata\xbf" +
+		"\x64beat\x64test\x64type\x64_doc\x67version\x651.2.3" +
+		"\xff" +
+		"\x61n\x01" +
+		"\xff"
+	assert.Equal(t, expected, string(encoded))
+}
+
+func TestCBORCodecInlinedFields(t *testing.T) {
+	event := &beat.Event{Fields: mapstr.M{"a": 1, "b": 2, "c": 3}}
+
+	// The cborl visitor writes the length reported by the iterator, which
+	// counts the inlined fields as a single entry: the event has 5 keys, but
+	// its header announces 3.
+	plain := structcodec.New("1.2.3", func(buf *bytes.Buffer) structform.Visitor {
+		return cborl.NewVisitor(buf)
+	})
+	encoded, err := plain.Encode("test", event)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xa3), encoded[0])
+	assert.NotEqual(t, 5, len(decodePrefix(t, encoded)))
+
+	encoded, err = New("1.2.3").Encode("test", event)
+	require.NoError(t, err)
+	assert.Len(t, decode(t, encoded), 5)
+}
+
+func decode(t *testing.T, encoded []byte) map[string]interface{} {
+	t.Helper()
+
+	var h ugorjicodec.CborHandle
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	var decoded map[string]interface{}
+	require.NoError(t, ugorjicodec.NewDecoderBytes(encoded, &h).Decode(&decoded))
+	return decoded
+}
+
+// decodePrefix decodes the first value of encoded, ignoring the bytes
+// following it.
+func decodePrefix(t *testing.T, encoded []byte) map[string]interface{} {
+	t.Helper()
+
+	var h ugorjicodec.CborHandle
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	var decoded map[string]interface{}
+	require.NoError(t, ugorjicodec.NewDecoder(bytes.NewReader(encoded), &h).Decode(&decoded))
+	return decoded
+}
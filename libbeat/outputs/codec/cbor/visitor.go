@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"bytes"
+
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
+)
+
+// visitor writes the values reported by a go-structform iterator in the CBOR
+// format (RFC 8949).
+//
+// The lengths reported for objects can not be relied on, as the iterator
+// reports the number of fields of a struct even if one of them is an inlined
+// map. Objects are therefore written as indefinite-length maps.
+type visitor struct {
+	*cborl.Visitor
+}
+
+func newVisitor(buf *bytes.Buffer) structform.Visitor {
+	return visitor{cborl.NewVisitor(buf)}
+}
+
+func (v visitor) OnObjectStart(_ int, baseType structform.BaseType) error {
+	return v.Visitor.OnObjectStart(-1, baseType)
+}
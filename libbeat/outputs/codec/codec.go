@@ -17,7 +17,16 @@
 
 package codec
 
-import "github.com/elastic/beats/v7/libbeat/beat"
+import (
+	"errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// ErrTemporary is wrapped by the errors of codecs that failed to encode an
+// event because of a temporary condition, such as an unreachable schema
+// registry. Outputs should retry these events, instead of dropping them.
+var ErrTemporary = errors.New("temporary encoding failure")
 
 type Codec interface {
 	Encode(index string, event *beat.Event) ([]byte, error)
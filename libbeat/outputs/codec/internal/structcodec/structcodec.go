@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package structcodec encodes events in the layout of the json codec, with
+// the binary formats of the cbor and msgpack codecs.
+package structcodec
+
+import (
+	"bytes"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// Format returns the visitor writing the values of an event to buf in an
+// encoding format.
+type Format func(buf *bytes.Buffer) structform.Visitor
+
+// Encoder for serializing a beat.Event with a Format.
+type Encoder struct {
+	buf    bytes.Buffer
+	folder *gotype.Iterator
+	format Format
+
+	version string
+}
+
+// New creates a new Encoder writing events with format.
+func New(version string, format Format) *Encoder {
+	e := &Encoder{version: version, format: format}
+	e.reset()
+	return e
+}
+
+func (e *Encoder) reset() {
+	var err error
+	e.folder, err = gotype.NewIterator(e.format(&e.buf),
+		gotype.Folders(
+			codec.MakeTimestampEncoder(),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Encode serializes a beat event. The event is encoded as a map with the
+// same keys as the documents of the json codec, including the `@metadata`
+// namespace.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.buf.Reset()
+	if err := e.folder.Fold(makeEvent(index, e.version, event)); err != nil {
+		e.reset()
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package structcodec_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ugorjicodec "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/cbor"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/structcodec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/msgpack"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type format struct {
+	new    func(version string) *structcodec.Encoder
+	handle ugorjicodec.Handle
+	// uint converts a small positive integer to the type it is decoded as.
+	uint func(uint64) interface{}
+}
+
+func formats() map[string]format {
+	var cborHandle ugorjicodec.CborHandle
+	cborHandle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	var msgpackHandle ugorjicodec.MsgpackHandle
+	msgpackHandle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	msgpackHandle.RawToString = true
+	msgpackHandle.WriteExt = true
+
+	return map[string]format{
+		"cbor": {
+			new:    cbor.New,
+			handle: &cborHandle,
+			uint:   func(u uint64) interface{} { return u },
+		},
+		"msgpack": {
+			new:    msgpack.New,
+			handle: &msgpackHandle,
+			// Positive fixints are decoded as int64.
+			uint: func(u uint64) interface{} { return int64(u) },
+		},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 15, 123000000, time.UTC)
+
+	for name, f := range formats() {
+		f := f
+		cases := map[string]struct {
+			meta     mapstr.M
+			fields   mapstr.M
+			expected map[string]interface{}
+		}{
+			"default": {
+				fields: mapstr.M{"msg": "message"},
+				expected: map[string]interface{}{
+					"@timestamp": "2024-05-01T12:30:15.123Z",
+					"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+					"msg":        "message",
+				},
+			},
+			"metadata": {
+				meta:   mapstr.M{"pipeline": "logs"},
+				fields: mapstr.M{"msg": "message"},
+				expected: map[string]interface{}{
+					"@timestamp": "2024-05-01T12:30:15.123Z",
+					"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3", "pipeline": "logs"},
+					"msg":        "message",
+				},
+			},
+			"nested values": {
+				fields: mapstr.M{
+					"host": mapstr.M{"name": "host1", "ip": []string{"10.0.0.1", "10.0.0.2"}},
+					"tags": []interface{}{"a", 1, true, nil},
+					"event": mapstr.M{
+						"created":  common.Time(ts),
+						"empty":    mapstr.M{},
+						"sequence": []int{},
+					},
+				},
+				expected: map[string]interface{}{
+					"@timestamp": "2024-05-01T12:30:15.123Z",
+					"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+					"host":       map[string]interface{}{"name": "host1", "ip": []interface{}{"10.0.0.1", "10.0.0.2"}},
+					"tags":       []interface{}{"a", f.uint(1), true, nil},
+					"event": map[string]interface{}{
+						"created":  "2024-05-01T12:30:15.123Z",
+						"empty":    map[string]interface{}{},
+						"sequence": []interface{}{},
+					},
+				},
+			},
+			"numbers": {
+				fields: mapstr.M{
+					"fixint":   127,
+					"uint8":    uint8(200),
+					"uint16":   60000,
+					"uint32":   uint32(math.MaxUint32),
+					"uint64":   uint64(math.MaxUint64),
+					"negfix":   -32,
+					"int8":     -100,
+					"int16":    -30000,
+					"int32":    int32(math.MinInt32),
+					"int64":    int64(math.MinInt64),
+					"float32":  float32(1.5),
+					"float64":  2.25,
+					"infinity": math.Inf(1),
+				},
+				expected: map[string]interface{}{
+					"@timestamp": "2024-05-01T12:30:15.123Z",
+					"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+					"fixint":     f.uint(127),
+					"uint8":      uint64(200),
+					"uint16":     uint64(60000),
+					"uint32":     uint64(math.MaxUint32),
+					"uint64":     uint64(math.MaxUint64),
+					"negfix":     int64(-32),
+					"int8":       int64(-100),
+					"int16":      int64(-30000),
+					"int32":      int64(math.MinInt32),
+					"int64":      int64(math.MinInt64),
+					"float32":    float64(1.5),
+					"float64":    2.25,
+					"infinity":   math.Inf(1),
+				},
+			},
+			"long strings": {
+				fields: mapstr.M{
+					"str8":  strings.Repeat("a", 200),
+					"str16": strings.Repeat("b", 1000),
+					"str32": strings.Repeat("c", 70000),
+				},
+				expected: map[string]interface{}{
+					"@timestamp": "2024-05-01T12:30:15.123Z",
+					"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+					"str8":       strings.Repeat("a", 200),
+					"str16":      strings.Repeat("b", 1000),
+					"str32":      strings.Repeat("c", 70000),
+				},
+			},
+		}
+
+		for caseName, test := range cases {
+			t.Run(name+"/"+caseName, func(t *testing.T) {
+				codec := f.new("1.2.3")
+				encoded, err := codec.Encode("test", &beat.Event{Timestamp: ts, Meta: test.meta, Fields: test.fields})
+				require.NoError(t, err)
+
+				var decoded map[string]interface{}
+				require.NoError(t, ugorjicodec.NewDecoderBytes(encoded, f.handle).Decode(&decoded))
+				assert.Equal(t, test.expected, decoded)
+			})
+		}
+	}
+}
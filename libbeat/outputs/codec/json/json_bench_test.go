@@ -58,3 +58,35 @@ func BenchmarkLocalTime(b *testing.B) {
 	}
 	result = r
 }
+
+func BenchmarkLogEvent(b *testing.B) {
+	var r []byte
+	codec := New("1.2.3", Config{})
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"message": "2024-05-01T12:30:15.123Z INFO [publisher] pipeline/retry.go:213 retryer: send wait signal to consumer",
+			"log": mapstr.M{
+				"file":   mapstr.M{"path": "/var/log/filebeat/filebeat.log"},
+				"offset": 1284313,
+			},
+			"input": mapstr.M{"type": "filestream"},
+			"host": mapstr.M{
+				"name":         "host1",
+				"architecture": "x86_64",
+				"ip":           []string{"10.0.0.1", "fe80::1"},
+				"os":           mapstr.M{"family": "debian", "kernel": "6.1.0", "version": "12"},
+			},
+			"agent": mapstr.M{"type": "filebeat", "version": "8.15.0", "ephemeral_id": "4f3b6c1e-2f1a-4a6e-9d3b-6a8f0c2e7b1d"},
+			"ecs":   mapstr.M{"version": "8.0.0"},
+			"tags":  []string{"production", "beats"},
+		},
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r, _ = codec.Encode("test", event)
+	}
+	result = r
+}
@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMsgpackCodecLayout(t *testing.T) {
+	codec := New("1.2.3")
+	encoded, err := codec.Encode("test", &beat.Event{Fields: mapstr.M{"n": 1}})
+	require.NoError(t, err)
+
+	// Objects are written with map32 headers, arrays and values with their
+	// most compact representation.
+	expected := "\xdf\x00\x00\x00\x03" +
+		"\xaa@timestamp\xb80001-01-01T00:00:00.000Z" +
+		"\xa9@metadata\xdf\x00\x00\x00\x03" +
+		"\xa4beat\xa4test\xa4type\xa4_doc\xa7version\xa51.2.3" +
+		"\xa1n\x01"
+	assert.Equal(t, expected, string(encoded))
+}
@@ -0,0 +1,284 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/elastic/go-structform"
+)
+
+// visitor writes the values reported by a go-structform iterator to a buffer
+// in the MessagePack format.
+//
+// The lengths reported for objects can not be relied on, as the iterator
+// reports the number of fields of a struct even if one of them is an inlined
+// map. Objects are therefore written with a map32 header, whose length is
+// filled in once the object is finished. The same applies to arrays of
+// unknown length.
+type visitor struct {
+	buf     *bytes.Buffer
+	stack   []container
+	scratch [9]byte
+}
+
+type container struct {
+	// offset of the length in the buffer, -1 if the length was written
+	// with the header.
+	offset int
+	count  uint32
+	array  bool
+}
+
+var _ structform.StringRefVisitor = (*visitor)(nil)
+
+const (
+	codeNil     = 0xc0
+	codeFalse   = 0xc2
+	codeTrue    = 0xc3
+	codeFloat32 = 0xca
+	codeFloat64 = 0xcb
+	codeUint8   = 0xcc
+	codeUint16  = 0xcd
+	codeUint32  = 0xce
+	codeUint64  = 0xcf
+	codeInt8    = 0xd0
+	codeInt16   = 0xd1
+	codeInt32   = 0xd2
+	codeInt64   = 0xd3
+	codeStr8    = 0xd9
+	codeStr16   = 0xda
+	codeStr32   = 0xdb
+	codeArray16 = 0xdc
+	codeArray32 = 0xdd
+	codeMap32   = 0xdf
+
+	fixArray = 0x90
+	fixStr   = 0xa0
+)
+
+func newVisitor(buf *bytes.Buffer) *visitor {
+	return &visitor{buf: buf}
+}
+
+// value counts a new value of the enclosing array.
+func (v *visitor) value() {
+	if n := len(v.stack); n > 0 && v.stack[n-1].array {
+		v.stack[n-1].count++
+	}
+}
+
+func (v *visitor) begin(array bool, code byte) {
+	v.buf.WriteByte(code)
+	v.stack = append(v.stack, container{offset: v.buf.Len(), array: array})
+	v.buf.Write(v.scratch[:4])
+}
+
+func (v *visitor) end() error {
+	n := len(v.stack)
+	if n == 0 {
+		return errUnbalanced
+	}
+	c := v.stack[n-1]
+	v.stack = v.stack[:n-1]
+
+	if c.offset >= 0 {
+		binary.BigEndian.PutUint32(v.buf.Bytes()[c.offset:], c.count)
+	}
+	return nil
+}
+
+func (v *visitor) OnObjectStart(_ int, _ structform.BaseType) error {
+	v.value()
+	v.begin(false, codeMap32)
+	return nil
+}
+
+func (v *visitor) OnObjectFinished() error {
+	return v.end()
+}
+
+func (v *visitor) OnKey(s string) error {
+	v.stack[len(v.stack)-1].count++
+	v.writeString(s)
+	return nil
+}
+
+func (v *visitor) OnKeyRef(s []byte) error {
+	v.stack[len(v.stack)-1].count++
+	v.writeStringBytes(s)
+	return nil
+}
+
+func (v *visitor) OnArrayStart(l int, _ structform.BaseType) error {
+	v.value()
+	switch {
+	case l < 0:
+		v.begin(true, codeArray32)
+		return nil
+	case l < 16:
+		v.buf.WriteByte(fixArray | byte(l))
+	case l <= math.MaxUint16:
+		v.writeUint16(codeArray16, uint16(l))
+	default:
+		v.writeUint32(codeArray32, uint32(l))
+	}
+	v.stack = append(v.stack, container{offset: -1, array: true})
+	return nil
+}
+
+func (v *visitor) OnArrayFinished() error {
+	return v.end()
+}
+
+func (v *visitor) OnNil() error {
+	v.value()
+	v.buf.WriteByte(codeNil)
+	return nil
+}
+
+func (v *visitor) OnBool(b bool) error {
+	v.value()
+	if b {
+		v.buf.WriteByte(codeTrue)
+	} else {
+		v.buf.WriteByte(codeFalse)
+	}
+	return nil
+}
+
+func (v *visitor) OnString(s string) error {
+	v.value()
+	v.writeString(s)
+	return nil
+}
+
+func (v *visitor) OnStringRef(s []byte) error {
+	v.value()
+	v.writeStringBytes(s)
+	return nil
+}
+
+func (v *visitor) OnInt8(i int8) error   { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt16(i int16) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt32(i int32) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt(i int) error     { return v.OnInt64(int64(i)) }
+
+func (v *visitor) OnInt64(i int64) error {
+	if i >= 0 {
+		return v.OnUint64(uint64(i))
+	}
+
+	v.value()
+	switch {
+	case i >= -32:
+		// negative fixint
+		v.buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		v.scratch[0], v.scratch[1] = codeInt8, byte(i)
+		v.buf.Write(v.scratch[:2])
+	case i >= math.MinInt16:
+		v.writeUint16(codeInt16, uint16(i))
+	case i >= math.MinInt32:
+		v.writeUint32(codeInt32, uint32(i))
+	default:
+		v.writeUint64(codeInt64, uint64(i))
+	}
+	return nil
+}
+
+func (v *visitor) OnByte(b byte) error     { return v.OnUint64(uint64(b)) }
+func (v *visitor) OnUint8(u uint8) error   { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint16(u uint16) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint32(u uint32) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint(u uint) error     { return v.OnUint64(uint64(u)) }
+
+func (v *visitor) OnUint64(u uint64) error {
+	v.value()
+	switch {
+	case u <= math.MaxInt8:
+		// positive fixint
+		v.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		v.scratch[0], v.scratch[1] = codeUint8, byte(u)
+		v.buf.Write(v.scratch[:2])
+	case u <= math.MaxUint16:
+		v.writeUint16(codeUint16, uint16(u))
+	case u <= math.MaxUint32:
+		v.writeUint32(codeUint32, uint32(u))
+	default:
+		v.writeUint64(codeUint64, u)
+	}
+	return nil
+}
+
+func (v *visitor) OnFloat32(f float32) error {
+	v.value()
+	v.writeUint32(codeFloat32, math.Float32bits(f))
+	return nil
+}
+
+func (v *visitor) OnFloat64(f float64) error {
+	v.value()
+	v.writeUint64(codeFloat64, math.Float64bits(f))
+	return nil
+}
+
+func (v *visitor) writeString(s string) {
+	v.writeStringHeader(len(s))
+	v.buf.WriteString(s)
+}
+
+func (v *visitor) writeStringBytes(s []byte) {
+	v.writeStringHeader(len(s))
+	v.buf.Write(s)
+}
+
+func (v *visitor) writeStringHeader(l int) {
+	switch {
+	case l < 32:
+		v.buf.WriteByte(fixStr | byte(l))
+	case l <= math.MaxUint8:
+		v.scratch[0], v.scratch[1] = codeStr8, byte(l)
+		v.buf.Write(v.scratch[:2])
+	case l <= math.MaxUint16:
+		v.writeUint16(codeStr16, uint16(l))
+	default:
+		v.writeUint32(codeStr32, uint32(l))
+	}
+}
+
+func (v *visitor) writeUint16(code byte, u uint16) {
+	v.scratch[0] = code
+	binary.BigEndian.PutUint16(v.scratch[1:], u)
+	v.buf.Write(v.scratch[:3])
+}
+
+func (v *visitor) writeUint32(code byte, u uint32) {
+	v.scratch[0] = code
+	binary.BigEndian.PutUint32(v.scratch[1:], u)
+	v.buf.Write(v.scratch[:5])
+}
+
+func (v *visitor) writeUint64(code byte, u uint64) {
+	v.scratch[0] = code
+	binary.BigEndian.PutUint64(v.scratch[1:], u)
+	v.buf.Write(v.scratch[:9])
+}
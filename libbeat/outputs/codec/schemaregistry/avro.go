@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// avroSerializer serializes events as Avro records.
+type avroSerializer struct {
+	schema avro.Schema
+}
+
+func newAvroSerializer(s *registeredSchema, refs []namedSchema) (*avroSerializer, error) {
+	cache := &avro.SchemaCache{}
+	for _, ref := range refs {
+		if _, err := avro.ParseWithCache(ref.schema.Schema, "", cache); err != nil {
+			return nil, fmt.Errorf("invalid Avro schema reference %q: %w", ref.name, err)
+		}
+	}
+	schema, err := avro.ParseWithCache(s.Schema, "", cache)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	if schema.Type() != avro.Record {
+		return nil, fmt.Errorf("schema must be an Avro record, got %v", schema.Type())
+	}
+	return &avroSerializer{schema: schema}, nil
+}
+
+func (s *avroSerializer) appendPayload(buf []byte, fields map[string]interface{}) ([]byte, error) {
+	record, err := avroValue(s.schema, fields)
+	if err != nil {
+		return nil, err
+	}
+	data, err := avro.Marshal(s.schema, record)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, data...), nil
+}
+
+// avroValue converts an event value to the Go type the Avro encoder expects
+// for schema. Values that can't be converted are returned as is, for the
+// encoder to report them.
+func avroValue(schema avro.Schema, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch schema := schema.(type) {
+	case *avro.RefSchema:
+		return avroValue(schema.Schema(), v)
+
+	case *avro.RecordSchema:
+		m, ok := toMap(v)
+		if !ok {
+			return v, nil
+		}
+		record := make(map[string]interface{}, len(schema.Fields()))
+		for _, field := range schema.Fields() {
+			value, exists := m[field.Name()]
+			if !exists {
+				continue
+			}
+			value, err := avroValue(field.Type(), value)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", field.Name(), err)
+			}
+			record[field.Name()] = value
+		}
+		return record, nil
+
+	case *avro.MapSchema:
+		m, ok := toMap(v)
+		if !ok {
+			return v, nil
+		}
+		values := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			value, err := avroValue(schema.Values(), value)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			values[k] = value
+		}
+		return values, nil
+
+	case *avro.ArraySchema:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return v, nil
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			item, err := avroValue(schema.Items(), rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			items[i] = item
+		}
+		return items, nil
+
+	case *avro.UnionSchema:
+		if !schema.Nullable() {
+			return v, nil
+		}
+		for _, t := range schema.Types() {
+			if t.Type() == avro.Null {
+				continue
+			}
+			value, err := avroValue(t, v)
+			if err != nil {
+				return nil, err
+			}
+			// Maps are encoded in unions as a single entry map, keyed by
+			// the name of the union type.
+			if m, ok := value.(map[string]interface{}); ok {
+				return map[string]interface{}{avroTypeName(t): m}, nil
+			}
+			return value, nil
+		}
+		return v, nil
+
+	case *avro.PrimitiveSchema:
+		return avroPrimitive(schema, v)
+	}
+	return v, nil
+}
+
+// avroTypeName returns the name of a type in a union.
+func avroTypeName(schema avro.Schema) string {
+	switch schema := schema.(type) {
+	case *avro.RefSchema:
+		return schema.Schema().FullName()
+	case avro.NamedSchema:
+		return schema.FullName()
+	}
+	return string(schema.Type())
+}
+
+func avroPrimitive(schema *avro.PrimitiveSchema, v interface{}) (interface{}, error) {
+	if t, ok := toTime(v); ok {
+		switch {
+		case schema.Logical() != nil:
+			return t, nil
+		case schema.Type() == avro.Long:
+			return t.UnixMilli(), nil
+		case schema.Type() == avro.String:
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+		return v, nil
+	}
+
+	switch schema.Type() {
+	case avro.Int:
+		if i, ok := toInt64(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i), nil
+		}
+	case avro.Long:
+		if i, ok := toInt64(v); ok {
+			return i, nil
+		}
+	case avro.Float:
+		if f, ok := toFloat64(v); ok {
+			return float32(f), nil
+		}
+	case avro.Double:
+		if f, ok := toFloat64(v); ok {
+			return f, nil
+		}
+	}
+	return v, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case mapstr.M:
+		return m, true
+	}
+	return nil, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case common.Time:
+		return time.Time(t), true
+	}
+	return time.Time{}, false
+}
+
+// toInt64 converts integers, and floats without a fractional part.
+func toInt64(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const latestVersion = "latest"
+
+// Config is the configuration of the schema_registry codec.
+type Config struct {
+	// URL of the schema registry.
+	URL      string `config:"url" validate:"required"`
+	Username string `config:"username"`
+	Password string `config:"password"`
+
+	// Subject of the schema events are serialized with.
+	Subject *fmtstr.EventFormatString `config:"subject" validate:"required"`
+
+	// Version of the subject schema, either "latest" or a version number.
+	Version string `config:"version"`
+
+	// Message is the fully qualified name of the Protobuf message events are
+	// serialized as. It defaults to the first message of the schema.
+	Message string `config:"message"`
+
+	// CacheTTL is how long schemas are cached before being fetched again.
+	CacheTTL time.Duration `config:"cache_ttl" validate:"min=0"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+func defaultConfig() Config {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 10 * time.Second
+	return Config{
+		Version:   latestVersion,
+		CacheTTL:  5 * time.Minute,
+		Transport: transport,
+	}
+}
+
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid schema registry url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid schema registry url %q: scheme must be http or https", c.URL)
+	}
+
+	if c.Version != latestVersion {
+		if v, err := strconv.Atoi(c.Version); err != nil || v <= 0 {
+			return errors.New("schema version must be 'latest' or a positive number")
+		}
+	}
+	return nil
+}
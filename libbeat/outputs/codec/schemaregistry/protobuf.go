@@ -0,0 +1,122 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufSerializer serializes events as Protobuf messages.
+type protobufSerializer struct {
+	message protoreflect.MessageDescriptor
+
+	// indexes is the encoded path of the message in its schema, written
+	// before each message.
+	indexes []byte
+}
+
+func newProtobufSerializer(s *registeredSchema, refs []namedSchema, messageName string) (*protobufSerializer, error) {
+	files := make(map[string]string, len(refs)+1)
+	for _, ref := range refs {
+		files[ref.name] = ref.schema.Schema
+	}
+	path := s.Subject + ".proto"
+	files[path] = s.Schema
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Protobuf schema: %w", err)
+	}
+	file := compiled[0]
+
+	var message protoreflect.MessageDescriptor
+	if messageName == "" {
+		if file.Messages().Len() == 0 {
+			return nil, errors.New("no message is defined in the Protobuf schema")
+		}
+		message = file.Messages().Get(0)
+	} else {
+		desc := file.FindDescriptorByName(protoreflect.FullName(messageName))
+		md, ok := desc.(protoreflect.MessageDescriptor)
+		if !ok || md.ParentFile().Path() != path {
+			return nil, fmt.Errorf("message %q is not defined in the Protobuf schema", messageName)
+		}
+		message = md
+	}
+
+	return &protobufSerializer{
+		message: message,
+		indexes: messageIndexes(message),
+	}, nil
+}
+
+// messageIndexes encodes the path of a message in its file, as the indexes of
+// the message and its parents in their parent, in the schema registry wire
+// format.
+func messageIndexes(message protoreflect.MessageDescriptor) []byte {
+	var indexes []int
+	var desc protoreflect.Descriptor = message
+	for {
+		indexes = append([]int{desc.Index()}, indexes...)
+		desc = desc.Parent()
+		if _, ok := desc.(protoreflect.FileDescriptor); ok {
+			break
+		}
+	}
+
+	// The path of the first message is shortened to a single 0.
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return []byte{0}
+	}
+	buf := binary.AppendVarint(nil, int64(len(indexes)))
+	for _, i := range indexes {
+		buf = binary.AppendVarint(buf, int64(i))
+	}
+	return buf
+}
+
+func (s *protobufSerializer) appendPayload(buf []byte, fields map[string]interface{}) ([]byte, error) {
+	// Events are converted to messages using the Protobuf JSON mapping, that
+	// handles the conversion of values to the field types.
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(s.message)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	buf = append(buf, s.indexes...)
+	return proto.MarshalOptions{}.MarshalAppend(buf, msg)
+}
@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// registry is a client of the Confluent Schema Registry REST API.
+type registry struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// registeredSchema is a version of a subject schema.
+type registeredSchema struct {
+	Subject    string      `json:"subject"`
+	ID         int         `json:"id"`
+	Version    int         `json:"version"`
+	SchemaType string      `json:"schemaType"`
+	Schema     string      `json:"schema"`
+	References []reference `json:"references"`
+}
+
+// reference is a schema imported by another schema.
+type reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// namedSchema is a referenced schema, with the name it is imported as.
+type namedSchema struct {
+	name   string
+	schema *registeredSchema
+}
+
+// registryError is an error response of the schema registry.
+type registryError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("schema registry returned status %d: %s (error code %d)", e.StatusCode, e.Message, e.ErrorCode)
+}
+
+func newRegistry(registryURL, username, password string, client *http.Client) *registry {
+	return &registry{
+		url:      strings.TrimSuffix(registryURL, "/"),
+		username: username,
+		password: password,
+		client:   client,
+	}
+}
+
+// schema fetches a version of a subject schema. The errors caused by an
+// unavailable registry wrap codec.ErrTemporary.
+func (r *registry) schema(subject, version string) (*registeredSchema, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url+"/subjects/"+url.PathEscape(subject)+"/versions/"+version, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", contentType)
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", codec.ErrTemporary, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read schema registry response: %w", codec.ErrTemporary, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		regErr := &registryError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, regErr) != nil || regErr.Message == "" {
+			regErr.Message = http.StatusText(resp.StatusCode)
+		}
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %w", codec.ErrTemporary, regErr)
+		}
+		return nil, regErr
+	}
+
+	var s registeredSchema
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode schema of subject %q: %w", subject, err)
+	}
+	return &s, nil
+}
+
+// references fetches the schemas referenced by s, recursively. Schemas are
+// returned after the schemas they reference.
+func (r *registry) references(s *registeredSchema) ([]namedSchema, error) {
+	var (
+		refs  []namedSchema
+		seen  = map[string]bool{}
+		visit func(*registeredSchema) error
+	)
+	visit = func(s *registeredSchema) error {
+		for _, ref := range s.References {
+			if seen[ref.Name] {
+				continue
+			}
+			seen[ref.Name] = true
+
+			refSchema, err := r.schema(ref.Subject, strconv.Itoa(ref.Version))
+			if err != nil {
+				return fmt.Errorf("failed to fetch schema reference %q: %w", ref.Name, err)
+			}
+			if err := visit(refSchema); err != nil {
+				return err
+			}
+			refs = append(refs, namedSchema{name: ref.Name, schema: refSchema})
+		}
+		return nil
+	}
+	if err := visit(s); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
@@ -0,0 +1,201 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schemaregistry provides a codec that serializes events in the
+// Confluent Schema Registry wire format, as Avro or Protobuf, using the
+// schemas registered for a subject.
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	// magicByte starts the messages of the wire format, before the schema ID.
+	magicByte = 0
+
+	// failedFetchTTL is how long a failure to fetch a schema is cached,
+	// before the registry is queried again.
+	failedFetchTTL = 10 * time.Second
+
+	// timestampField is the field events timestamp is serialized as.
+	timestampField = "timestamp"
+)
+
+// Encoder serializes events with the schema registered for their subject.
+type Encoder struct {
+	log      *logp.Logger
+	registry *registry
+	subject  *fmtstr.EventFormatString
+	version  string
+	message  string
+	cacheTTL time.Duration
+
+	mu      sync.Mutex
+	schemas map[string]*cachedSchema
+}
+
+// serializer serializes events with a schema.
+type serializer interface {
+	// appendPayload appends the serialized fields to buf.
+	appendPayload(buf []byte, fields map[string]interface{}) ([]byte, error)
+}
+
+type cachedSchema struct {
+	id         int
+	serializer serializer
+
+	// err is set if the schema couldn't be fetched.
+	err error
+
+	// expires is when the schema must be fetched again. Zero if it never
+	// expires.
+	expires time.Time
+}
+
+func init() {
+	codec.RegisterType("schema_registry", func(_ beat.Info, cfg *config.C) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("empty schema_registry codec configuration")
+		}
+
+		config := defaultConfig()
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		log := logp.NewLogger("schema_registry")
+		client, err := config.Transport.Client(httpcommon.WithLogger(log))
+		if err != nil {
+			return nil, err
+		}
+		return newEncoder(log, newRegistry(config.URL, config.Username, config.Password, client), config), nil
+	})
+}
+
+func newEncoder(log *logp.Logger, registry *registry, config Config) *Encoder {
+	return &Encoder{
+		log:      log,
+		registry: registry,
+		subject:  config.Subject,
+		version:  config.Version,
+		message:  config.Message,
+		cacheTTL: config.CacheTTL,
+		schemas:  map[string]*cachedSchema{},
+	}
+}
+
+// Encode serializes an event with the schema of its subject. Errors caused by
+// an unavailable schema registry wrap codec.ErrTemporary, all other errors
+// mean the event can't be serialized.
+func (e *Encoder) Encode(_ string, event *beat.Event) ([]byte, error) {
+	subject, err := e.subject.Run(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select schema subject: %w", err)
+	}
+	schema, err := e.schema(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{}, len(event.Fields)+1)
+	for k, v := range event.Fields {
+		fields[k] = v
+	}
+	if _, exists := fields[timestampField]; !exists {
+		fields[timestampField] = event.Timestamp
+	}
+
+	buf := make([]byte, 5, 512)
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:], uint32(schema.id))
+	buf, err = schema.serializer.appendPayload(buf, fields)
+	if err != nil {
+		return nil, fmt.Errorf("event is incompatible with schema %d of subject %q: %w", schema.id, subject, err)
+	}
+	return buf, nil
+}
+
+// schema returns the cached schema of subject, fetching it if it's not
+// cached or has expired. If the registry is unavailable, the expired schema
+// is used until it can be fetched again.
+func (e *Encoder) schema(subject string) (*cachedSchema, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	cached := e.schemas[subject]
+	if cached != nil && (cached.expires.IsZero() || now.Before(cached.expires)) {
+		return cached, cached.err
+	}
+
+	fetched, err := e.fetch(subject)
+	if err != nil {
+		if cached != nil && cached.err == nil && errors.Is(err, codec.ErrTemporary) {
+			e.log.Warnf("Failed to refresh schema of subject %q, using the cached schema: %v", subject, err)
+			cached.expires = now.Add(failedFetchTTL)
+			return cached, nil
+		}
+		e.log.Errorf("Failed to fetch schema of subject %q: %v", subject, err)
+		e.schemas[subject] = &cachedSchema{err: err, expires: now.Add(failedFetchTTL)}
+		return nil, err
+	}
+
+	if e.cacheTTL > 0 {
+		fetched.expires = now.Add(e.cacheTTL)
+	}
+	e.schemas[subject] = fetched
+	return fetched, nil
+}
+
+func (e *Encoder) fetch(subject string) (*cachedSchema, error) {
+	s, err := e.registry.schema(subject, e.version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema of subject %q: %w", subject, err)
+	}
+	refs, err := e.registry.references(s)
+	if err != nil {
+		return nil, err
+	}
+	e.log.Debugf("Fetched schema %d, version %d of subject %q", s.ID, s.Version, subject)
+
+	var ser serializer
+	switch schemaType := strings.ToUpper(s.SchemaType); schemaType {
+	case "", "AVRO":
+		ser, err = newAvroSerializer(s, refs)
+	case "PROTOBUF":
+		ser, err = newProtobufSerializer(s, refs, e.message)
+	default:
+		return nil, fmt.Errorf("unsupported schema type %v of subject %q", schemaType, subject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schema %d of subject %q: %w", s.ID, subject, err)
+	}
+	return &cachedSchema{id: s.ID, serializer: ser}, nil
+}
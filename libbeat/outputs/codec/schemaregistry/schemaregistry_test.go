@@ -0,0 +1,419 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const avroSchema = `{
+  "type": "record",
+  "name": "Log",
+  "namespace": "test",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "message", "type": "string"},
+    {"name": "level", "type": ["null", "string"], "default": null},
+    {"name": "bytes", "type": "long"},
+    {"name": "ratio", "type": "double", "default": 0},
+    {"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "host", "type": ["null", {
+      "type": "record",
+      "name": "Host",
+      "fields": [{"name": "name", "type": "string"}]
+    }], "default": null}
+  ]
+}`
+
+const protobufSchema = `syntax = "proto3";
+package test;
+
+import "google/protobuf/timestamp.proto";
+import "host.proto";
+
+message Log {
+  google.protobuf.Timestamp timestamp = 1;
+  string message = 2;
+  int64 bytes = 3;
+  repeated string tags = 4;
+  Host host = 5;
+
+  message Error {
+    string message = 1;
+    int32 code = 2;
+  }
+}
+`
+
+const protobufHostSchema = `syntax = "proto3";
+package test;
+
+message Host {
+  string name = 1;
+}
+`
+
+// testRegistry is a schema registry stand-in, serving the versions of the
+// subjects schemas.
+type testRegistry struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	subjects    map[string][]registeredSchema
+	requests    int
+	unavailable bool
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{subjects: map[string][]registeredSchema{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) register(subject, schemaType, schema string, refs ...reference) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := 100
+	for _, versions := range r.subjects {
+		id += len(versions)
+	}
+	r.subjects[subject] = append(r.subjects[subject], registeredSchema{
+		Subject:    subject,
+		ID:         id,
+		Version:    len(r.subjects[subject]) + 1,
+		SchemaType: schemaType,
+		Schema:     schema,
+		References: refs,
+	})
+	return id
+}
+
+func (r *testRegistry) setUnavailable(unavailable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unavailable = unavailable
+}
+
+func (r *testRegistry) requestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	w.Header().Set("Content-Type", contentType)
+	if r.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/subjects/"), "/versions/")
+	versions := r.subjects[parts[0]]
+	if len(parts) != 2 || len(versions) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		return
+	}
+
+	version := len(versions)
+	if parts[1] != latestVersion {
+		version, _ = strconv.Atoi(parts[1])
+	}
+	if version < 1 || version > len(versions) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40402,"message":"Version not found."}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(versions[version-1])
+}
+
+func newTestEncoder(t *testing.T, r *testRegistry, settings map[string]interface{}) *Encoder {
+	t.Helper()
+
+	cfg := defaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(mapstr.M{
+		"url":     r.URL,
+		"subject": "%{[fields.log_type]}-value",
+	}).Unpack(&cfg))
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	return newEncoder(logp.NewLogger("schema_registry"), newRegistry(cfg.URL, "", "", http.DefaultClient), cfg)
+}
+
+func testEvent(fields mapstr.M) *beat.Event {
+	fields.DeepUpdateNoOverwrite(mapstr.M{"fields": mapstr.M{"log_type": "logs"}})
+	return &beat.Event{
+		Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Fields:    fields,
+	}
+}
+
+// splitMessage checks the wire format header of msg, and returns its payload.
+func splitMessage(t *testing.T, msg []byte, id int) []byte {
+	t.Helper()
+	require.Greater(t, len(msg), 5)
+	assert.Equal(t, byte(magicByte), msg[0])
+	assert.Equal(t, uint32(id), binary.BigEndian.Uint32(msg[1:5]))
+	return msg[5:]
+}
+
+func TestEncodeAvro(t *testing.T) {
+	r := newTestRegistry(t)
+	id := r.register("logs-value", "", avroSchema)
+	enc := newTestEncoder(t, r, nil)
+
+	msg, err := enc.Encode("", testEvent(mapstr.M{
+		"message": "hello",
+		"level":   "info",
+		"bytes":   float64(1024),
+		"ratio":   1,
+		"tags":    []string{"a", "b"},
+		"host":    mapstr.M{"name": "host-1", "ip": "10.0.0.1"},
+		"unknown": "ignored",
+	}))
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, avro.Unmarshal(avro.MustParse(avroSchema), splitMessage(t, msg, id), &decoded))
+	assert.Equal(t, map[string]interface{}{
+		"timestamp": time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		"message":   "hello",
+		"level":     "info",
+		"bytes":     int64(1024),
+		"ratio":     float64(1),
+		"tags":      []interface{}{"a", "b"},
+		"host":      map[string]interface{}{"test.Host": map[string]interface{}{"name": "host-1"}},
+	}, decoded)
+}
+
+func TestEncodeProtobuf(t *testing.T) {
+	r := newTestRegistry(t)
+	r.register("host", "PROTOBUF", protobufHostSchema)
+	id := r.register("logs-value", "PROTOBUF", protobufSchema, reference{Name: "host.proto", Subject: "host", Version: 1})
+
+	t.Run("first message", func(t *testing.T) {
+		enc := newTestEncoder(t, r, nil)
+		msg, err := enc.Encode("", testEvent(mapstr.M{
+			"message": "hello",
+			"bytes":   1024,
+			"tags":    []string{"a", "b"},
+			"host":    mapstr.M{"name": "host-1", "ip": "10.0.0.1"},
+		}))
+		require.NoError(t, err)
+
+		payload := splitMessage(t, msg, id)
+		require.Equal(t, byte(0), payload[0], "message indexes")
+
+		serializer := enc.schemas["logs-value"].serializer.(*protobufSerializer)
+		decoded := dynamicpb.NewMessage(serializer.message)
+		require.NoError(t, proto.Unmarshal(payload[1:], decoded))
+
+		fields := serializer.message.Fields()
+		assert.Equal(t, "hello", decoded.Get(fields.ByName("message")).String())
+		assert.Equal(t, int64(1024), decoded.Get(fields.ByName("bytes")).Int())
+		assert.Equal(t, 2, decoded.Get(fields.ByName("tags")).List().Len())
+		host := decoded.Get(fields.ByName("host")).Message()
+		assert.Equal(t, "host-1", host.Get(host.Descriptor().Fields().ByName("name")).String())
+		ts := decoded.Get(fields.ByName("timestamp")).Message()
+		assert.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC).Unix(),
+			ts.Get(ts.Descriptor().Fields().ByName("seconds")).Int())
+	})
+
+	t.Run("nested message", func(t *testing.T) {
+		enc := newTestEncoder(t, r, map[string]interface{}{"message": "test.Log.Error"})
+		msg, err := enc.Encode("", testEvent(mapstr.M{"message": "failed", "code": 3}))
+		require.NoError(t, err)
+
+		// Two indexes, 0 and 0, as zigzag encoded varints.
+		payload := splitMessage(t, msg, id)
+		require.Equal(t, []byte{4, 0, 0}, payload[:3], "message indexes")
+
+		serializer := enc.schemas["logs-value"].serializer.(*protobufSerializer)
+		assert.Equal(t, protoreflect.FullName("test.Log.Error"), serializer.message.FullName())
+		decoded := dynamicpb.NewMessage(serializer.message)
+		require.NoError(t, proto.Unmarshal(payload[3:], decoded))
+		assert.Equal(t, int64(3), decoded.Get(serializer.message.Fields().ByName("code")).Int())
+	})
+
+	t.Run("unknown message", func(t *testing.T) {
+		enc := newTestEncoder(t, r, map[string]interface{}{"message": "test.Missing"})
+		_, err := enc.Encode("", testEvent(mapstr.M{"message": "hello"}))
+		assert.ErrorContains(t, err, `message "test.Missing" is not defined`)
+		assert.False(t, errors.Is(err, codec.ErrTemporary))
+	})
+}
+
+func TestEncodeIncompatibleEvent(t *testing.T) {
+	r := newTestRegistry(t)
+	r.register("logs-value", "AVRO", avroSchema)
+	r.register("metrics-value", "PROTOBUF", protobufHostSchema)
+	enc := newTestEncoder(t, r, nil)
+
+	tests := map[string]mapstr.M{
+		"missing required field":   {"message": "hello"},
+		"wrong field type":         {"message": "hello", "bytes": "many"},
+		"fractional integer":       {"message": "hello", "bytes": 1.5},
+		"wrong protobuf type":      {"fields": mapstr.M{"log_type": "metrics"}, "name": 3},
+		"unregistered subject":     {"fields": mapstr.M{"log_type": "traces"}},
+		"missing subject field":    {"fields": mapstr.M{"log_type": nil}},
+		"wrong nested record type": {"message": "hello", "bytes": 1, "host": "host-1"},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := enc.Encode("", testEvent(fields))
+			require.Error(t, err)
+			assert.False(t, errors.Is(err, codec.ErrTemporary), "error must not be temporary: %v", err)
+		})
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	r := newTestRegistry(t)
+	firstID := r.register("logs-value", "", avroSchema)
+	enc := newTestEncoder(t, r, map[string]interface{}{"cache_ttl": "1h"})
+	event := testEvent(mapstr.M{"message": "hello", "bytes": 1})
+
+	msg, err := enc.Encode("", event)
+	require.NoError(t, err)
+	splitMessage(t, msg, firstID)
+	_, err = enc.Encode("", event)
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.requestCount(), "schema must be cached")
+
+	// The cached schema is used while the registry is unavailable.
+	secondID := r.register("logs-value", "", avroSchema)
+	r.setUnavailable(true)
+	enc.schemas["logs-value"].expires = time.Now()
+	msg, err = enc.Encode("", event)
+	require.NoError(t, err)
+	splitMessage(t, msg, firstID)
+
+	// The new version is used once the registry is available again.
+	r.setUnavailable(false)
+	enc.schemas["logs-value"].expires = time.Now()
+	msg, err = enc.Encode("", event)
+	require.NoError(t, err)
+	splitMessage(t, msg, secondID)
+}
+
+func TestRegistryUnavailable(t *testing.T) {
+	r := newTestRegistry(t)
+	id := r.register("logs-value", "", avroSchema)
+	r.setUnavailable(true)
+	enc := newTestEncoder(t, r, nil)
+	event := testEvent(mapstr.M{"message": "hello", "bytes": 1})
+
+	_, err := enc.Encode("", event)
+	assert.ErrorIs(t, err, codec.ErrTemporary)
+
+	// The failure is cached, to not query the registry for every event.
+	_, err = enc.Encode("", event)
+	assert.ErrorIs(t, err, codec.ErrTemporary)
+	assert.Equal(t, 1, r.requestCount())
+
+	r.setUnavailable(false)
+	enc.schemas["logs-value"].expires = time.Now()
+	msg, err := enc.Encode("", event)
+	require.NoError(t, err)
+	splitMessage(t, msg, id)
+
+	r.Close()
+	enc.schemas["logs-value"].expires = time.Now()
+	delete(enc.schemas, "logs-value")
+	_, err = enc.Encode("", event)
+	assert.ErrorIs(t, err, codec.ErrTemporary)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	r := newTestRegistry(t)
+	firstID := r.register("logs-value", "", avroSchema)
+	r.register("logs-value", "", avroSchema)
+	enc := newTestEncoder(t, r, map[string]interface{}{"version": 1})
+
+	msg, err := enc.Encode("", testEvent(mapstr.M{"message": "hello", "bytes": 1}))
+	require.NoError(t, err)
+	splitMessage(t, msg, firstID)
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		settings mapstr.M
+		valid    bool
+	}{
+		"valid":              {mapstr.M{"url": "http://localhost:8081", "subject": "logs-value"}, true},
+		"version":            {mapstr.M{"url": "https://localhost:8081", "subject": "logs-value", "version": 3}, true},
+		"missing url":        {mapstr.M{"subject": "logs-value"}, false},
+		"missing subject":    {mapstr.M{"url": "http://localhost:8081"}, false},
+		"invalid url scheme": {mapstr.M{"url": "localhost:8081", "subject": "logs-value"}, false},
+		"invalid version":    {mapstr.M{"url": "http://localhost:8081", "subject": "logs-value", "version": "first"}, false},
+		"zero version":       {mapstr.M{"url": "http://localhost:8081", "subject": "logs-value", "version": 0}, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.settings).Unpack(&cfg)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCodecRegistered(t *testing.T) {
+	var cfg codec.Config
+	require.NoError(t, config.MustNewConfigFrom(mapstr.M{
+		"schema_registry": mapstr.M{
+			"url":     "http://localhost:8081",
+			"subject": "logs-value",
+		},
+	}).Unpack(&cfg))
+
+	enc, err := codec.CreateEncoder(beat.Info{}, cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &Encoder{}, enc)
+}
@@ -0,0 +1,334 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeJSON   = "application/json"
+
+	// Limit how much of an error response is read into error messages.
+	maxErrorBodySize = 1024
+)
+
+type client struct {
+	log       *logp.Logger
+	observer  outputs.Observer
+	http      *http.Client
+	codec     codec.Codec
+	index     string
+	userAgent string
+	rawURL    string
+	url       *fmtstr.EventFormatString
+	config    *httpConfig
+
+	done    chan struct{}
+	backoff backoff.Backoff
+}
+
+// request holds the encoded events sent to a single URL.
+type request struct {
+	url    string
+	events []publisher.Event
+	body   bytes.Buffer
+}
+
+// statusError is returned for unsuccessful HTTP responses.
+type statusError struct {
+	code       int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected HTTP status %d", e.code)
+	}
+	return fmt.Sprintf("unexpected HTTP status %d: %s", e.code, e.body)
+}
+
+func newClient(
+	log *logp.Logger,
+	observer outputs.Observer,
+	httpClient *http.Client,
+	codec codec.Codec,
+	beat beat.Info,
+	rawURL string,
+	config *httpConfig,
+) *client {
+	done := make(chan struct{})
+	return &client{
+		log:       log,
+		observer:  observer,
+		http:      httpClient,
+		codec:     codec,
+		index:     strings.ToLower(beat.IndexPrefix),
+		userAgent: beat.UserAgent,
+		rawURL:    rawURL,
+		url:       config.URL,
+		config:    config,
+		done:      done,
+		backoff:   backoff.NewEqualJitterBackoff(done, config.Backoff.Init, config.Backoff.Max),
+	}
+}
+
+func (c *client) Connect() error {
+	return nil
+}
+
+func (c *client) Close() error {
+	close(c.done)
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *client) String() string {
+	return "http(" + c.rawURL + ")"
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	requests, retry := c.encode(events)
+	start := time.Now()
+
+	var acked int
+	var retryAfter time.Duration
+	var publishErr error
+	for _, req := range requests {
+		err := c.send(ctx, req)
+		if err == nil {
+			acked += len(req.events)
+			continue
+		}
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			if c.config.StatusCodes.action(statusErr.code) == actionDrop {
+				c.log.Errorf("Dropping %d events rejected by %v: %v", len(req.events), req.url, err)
+				c.observer.PermanentErrors(len(req.events))
+				continue
+			}
+			retryAfter = max(retryAfter, statusErr.retryAfter)
+		}
+
+		retry = append(retry, req.events...)
+		if publishErr == nil {
+			publishErr = fmt.Errorf("failed to send events to %v: %w", req.url, err)
+		}
+	}
+	c.observer.ReportLatency(time.Since(start))
+	c.observer.AckedEvents(acked)
+
+	if len(retry) == 0 {
+		c.backoff.Reset()
+		batch.ACK()
+		return nil
+	}
+
+	c.observer.RetryableErrors(len(retry))
+	batch.RetryEvents(retry)
+	c.wait(retryAfter)
+	if publishErr == nil {
+		publishErr = fmt.Errorf("failed to encode %d events", len(retry))
+	}
+	return publishErr
+}
+
+// encode groups the events by URL, and encodes the events of each URL into
+// a request body. Events that can not be encoded are dropped, unless the
+// codec failed temporarily, in which case they are returned to be retried.
+func (c *client) encode(events []publisher.Event) ([]*request, []publisher.Event) {
+	var requests []*request
+	var retry []publisher.Event
+	byURL := map[string]*request{}
+
+	for i := range events {
+		event := &events[i].Content
+
+		url, err := c.url.Run(event)
+		if err == nil && !c.url.IsConst() {
+			err = validateURL(url)
+		}
+		if err != nil {
+			c.log.Errorf("Dropping event: failed to format the url: %v", err)
+			c.observer.PermanentErrors(1)
+			continue
+		}
+
+		serialized, err := c.codec.Encode(c.index, event)
+		if errors.Is(err, codec.ErrTemporary) {
+			c.log.Errorf("Failed to encode event, retrying: %v", err)
+			retry = append(retry, events[i])
+			continue
+		}
+		if err != nil {
+			c.log.Errorf("Dropping event: failed to encode event: %v", err)
+			c.observer.PermanentErrors(1)
+			continue
+		}
+
+		req := byURL[url]
+		if req == nil {
+			req = &request{url: url}
+			byURL[url] = req
+			requests = append(requests, req)
+		}
+
+		switch c.config.Format {
+		case formatJSONArray:
+			if len(req.events) == 0 {
+				req.body.WriteByte('[')
+			} else {
+				req.body.WriteByte(',')
+			}
+			req.body.Write(serialized)
+		default:
+			req.body.Write(serialized)
+			req.body.WriteByte('\n')
+		}
+		req.events = append(req.events, events[i])
+	}
+
+	if c.config.Format == formatJSONArray {
+		for _, req := range requests {
+			req.body.WriteByte(']')
+		}
+	}
+	return requests, retry
+}
+
+// send sends the request body to its URL, and returns a *statusError if the
+// response status code is not 2xx.
+func (c *client) send(ctx context.Context, req *request) error {
+	body := req.body.Bytes()
+	if c.config.CompressionLevel > 0 {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, c.config.CompressionLevel)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, c.config.Method, req.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if c.config.Format == formatJSONArray {
+		httpReq.Header.Set("Content-Type", contentTypeJSON)
+	} else {
+		httpReq.Header.Set("Content-Type", contentTypeNDJSON)
+	}
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
+	}
+	for k, v := range c.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if c.config.CompressionLevel > 0 {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.config.Username != "" {
+		httpReq.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &statusError{
+			code:       resp.StatusCode,
+			body:       string(msg),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now(), c.config.Backoff.Max),
+		}
+	}
+
+	// Drain the body, so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// wait delays the next batch after a failed batch, for the duration asked by
+// the endpoint in a Retry-After header, or else with exponential backoff.
+func (c *client) wait(retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		c.backoff.Wait()
+		return
+	}
+
+	timer := time.NewTimer(retryAfter)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.done:
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, which is either
+// a number of seconds or an HTTP date. It returns 0 if the header is missing
+// or invalid. The delay is capped at limit, so that an endpoint can't stall
+// the output for longer than the maximum backoff.
+func parseRetryAfter(value string, now time.Time, limit time.Duration) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Compare in seconds, the delay could overflow time.Duration.
+		if seconds > int64(limit/time.Second) {
+			return limit
+		}
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return min(max(date.Sub(now), 0), limit)
+	}
+	return 0
+}
@@ -0,0 +1,391 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	jsoncodec "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// testServer records the requests it receives, and responds with the status
+// code and headers of its handler.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	respond  func(w http.ResponseWriter)
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, data)
+		respond := s.respond
+		s.mu.Unlock()
+
+		if respond != nil {
+			respond(w)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestClient(t *testing.T, settings mapstr.M) (*client, *monitoring.Registry) {
+	t.Helper()
+
+	cfg := defaultConfig()
+	cfg.Backoff = backoffConfig{Init: time.Millisecond, Max: time.Millisecond}
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	reg := monitoring.NewRegistry()
+	observer := outputs.NewStats(reg)
+	httpClient, err := newHTTPClient(logp.L(), observer, &cfg)
+	require.NoError(t, err)
+
+	info := beat.Info{Beat: "test", IndexPrefix: "test", Version: "1.2.3", UserAgent: "Test/1.2.3"}
+	c := newClient(logp.L(), observer, httpClient, jsoncodec.New("1.2.3", jsoncodec.Config{}), info, settings["url"].(string), &cfg)
+	t.Cleanup(func() { c.Close() })
+	return c, reg
+}
+
+func testEvents(n int, fields mapstr.M) []beat.Event {
+	events := make([]beat.Event, n)
+	for i := range events {
+		events[i] = beat.Event{
+			Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Fields:    mapstr.M{"message": "hello", "n": i},
+		}
+		events[i].Fields.DeepUpdate(fields)
+	}
+	return events
+}
+
+func TestPublishNDJSON(t *testing.T) {
+	server := newTestServer(t)
+	c, reg := newTestClient(t, mapstr.M{
+		"url":      server.URL + "/%{[tenant]}/events",
+		"username": "beats",
+		"password": "secret",
+		"headers":  mapstr.M{"X-Source": "beats"},
+	})
+
+	events := append(testEvents(2, mapstr.M{"tenant": "a"}), testEvents(1, mapstr.M{"tenant": "b"})...)
+	batch := outest.NewBatch(events...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, uint64(3), reg.Get("events.acked").(*monitoring.Uint).Get())
+
+	// The events are grouped by URL, in the order of the batch.
+	require.Len(t, server.requests, 2)
+	assert.Equal(t, "/a/events", server.requests[0].URL.Path)
+	assert.Equal(t, "/b/events", server.requests[1].URL.Path)
+
+	req := server.requests[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, contentTypeNDJSON, req.Header.Get("Content-Type"))
+	assert.Equal(t, "beats", req.Header.Get("X-Source"))
+	assert.Equal(t, "Test/1.2.3", req.Header.Get("User-Agent"))
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "beats", user)
+	assert.Equal(t, "secret", password)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(server.bodies[0]))
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+		lines = append(lines, doc)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, float64(0), lines[0]["n"])
+	assert.Equal(t, float64(1), lines[1]["n"])
+	assert.Equal(t, "2024-05-01T12:00:00.000Z", lines[0]["@timestamp"])
+}
+
+func TestPublishJSONArrayGzip(t *testing.T) {
+	server := newTestServer(t)
+	c, _ := newTestClient(t, mapstr.M{
+		"url":               server.URL + "/events",
+		"method":            "PUT",
+		"format":            "json_array",
+		"compression_level": 5,
+	})
+
+	batch := outest.NewBatch(testEvents(3, nil)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	require.Len(t, server.requests, 1)
+	req := server.requests[0]
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, contentTypeJSON, req.Header.Get("Content-Type"))
+	assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+
+	var docs []map[string]interface{}
+	require.NoError(t, json.Unmarshal(server.bodies[0], &docs))
+	require.Len(t, docs, 3)
+	assert.Equal(t, float64(2), docs[2]["n"])
+}
+
+func TestPublishStatusCodes(t *testing.T) {
+	tests := map[string]struct {
+		status      int
+		settings    mapstr.M
+		wantSignal  outest.BatchSignalTag
+		wantDropped uint64
+	}{
+		"retry by default": {
+			status:     http.StatusServiceUnavailable,
+			wantSignal: outest.BatchRetryEvents,
+		},
+		"drop by default": {
+			status:      http.StatusBadRequest,
+			wantSignal:  outest.BatchACK,
+			wantDropped: 2,
+		},
+		"retry listed status code": {
+			status:     http.StatusUnauthorized,
+			settings:   mapstr.M{"status_codes.retry": []int{401}},
+			wantSignal: outest.BatchRetryEvents,
+		},
+		"drop listed status code": {
+			status: http.StatusInternalServerError,
+			settings: mapstr.M{
+				"status_codes.retry": []int{503},
+				"status_codes.drop":  []int{500},
+			},
+			wantSignal:  outest.BatchACK,
+			wantDropped: 2,
+		},
+		"drop default retry status code": {
+			status:      http.StatusBadGateway,
+			settings:    mapstr.M{"status_codes.drop": []int{502}},
+			wantSignal:  outest.BatchACK,
+			wantDropped: 2,
+		},
+		"retry unlisted status code": {
+			status:     http.StatusTeapot,
+			settings:   mapstr.M{"status_codes.default": "retry"},
+			wantSignal: outest.BatchRetryEvents,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestServer(t)
+			server.respond = func(w http.ResponseWriter) {
+				http.Error(w, "rejected", test.status)
+			}
+			settings := mapstr.M{"url": server.URL}
+			settings.DeepUpdate(test.settings)
+			c, reg := newTestClient(t, settings)
+
+			batch := outest.NewBatch(testEvents(2, nil)...)
+			err := c.Publish(context.Background(), batch)
+			if test.wantSignal == outest.BatchRetryEvents {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "rejected")
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.wantSignal, batch.Signals[0].Tag)
+			if test.wantSignal == outest.BatchRetryEvents {
+				assert.Len(t, batch.Signals[0].Events, 2)
+			}
+			assert.Equal(t, test.wantDropped, reg.Get("events.dropped").(*monitoring.Uint).Get())
+		})
+	}
+}
+
+func TestPublishRetryAfter(t *testing.T) {
+	server := newTestServer(t)
+	server.respond = func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	c, _ := newTestClient(t, mapstr.M{"url": server.URL, "backoff.max": "1m"})
+
+	batch := outest.NewBatch(testEvents(1, nil)...)
+	start := time.Now()
+	require.Error(t, c.Publish(context.Background(), batch))
+
+	// The initial backoff is 1ms, the delay comes from Retry-After.
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+		"86400":                         time.Hour,
+		"9223372036854775807":           time.Hour,
+		"Thu, 01 May 2025 12:00:00 GMT": time.Hour,
+	}
+	for value, want := range tests {
+		assert.Equal(t, want, parseRetryAfter(value, now, time.Hour), "Retry-After: %q", value)
+	}
+}
+
+func TestPublishEncodingErrors(t *testing.T) {
+	server := newTestServer(t)
+	c, reg := newTestClient(t, mapstr.M{"url": server.URL + "/%{[tenant]}"})
+	c.codec = errorCodec{c.codec}
+
+	batch := outest.NewBatch(
+		beat.Event{Fields: mapstr.M{"tenant": "a"}},
+		beat.Event{Fields: mapstr.M{"tenant": "a", "error": "temporary"}},
+		beat.Event{Fields: mapstr.M{"tenant": "a", "error": "permanent"}},
+		beat.Event{Fields: mapstr.M{"message": "no tenant"}},
+	)
+	require.Error(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "temporary", batch.Signals[0].Events[0].Content.Fields["error"])
+	assert.Equal(t, uint64(2), reg.Get("events.dropped").(*monitoring.Uint).Get())
+	assert.Len(t, server.requests, 1)
+}
+
+// errorCodec fails to encode the events with an "error" field.
+type errorCodec struct {
+	codec.Codec
+}
+
+func (c errorCodec) Encode(index string, event *beat.Event) ([]byte, error) {
+	switch event.Fields["error"] {
+	case "temporary":
+		return nil, codec.ErrTemporary
+	case "permanent":
+		return nil, assert.AnError
+	}
+	return c.Codec.Encode(index, event)
+}
+
+// newTokenServer starts an OAuth 2.0 token endpoint that grants the access
+// token "token" to client credentials requests.
+func newTokenServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			http.Error(w, "unexpected grant", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOAuth2(t *testing.T) {
+	tokenServer := newTokenServer(t)
+	server := newTestServer(t)
+	c, _ := newTestClient(t, mapstr.M{
+		"url": server.URL,
+		"oauth2": mapstr.M{
+			"client.id":     "beats",
+			"client.secret": "secret",
+			"token_url":     tokenServer.URL,
+		},
+	})
+
+	batch := outest.NewBatch(testEvents(1, nil)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, "Bearer token", server.requests[0].Header.Get("Authorization"))
+}
+
+func TestOAuth2Timeout(t *testing.T) {
+	tokenServer := newTokenServer(t)
+	server := newTestServer(t)
+	unblock := make(chan struct{})
+	t.Cleanup(func() { close(unblock) })
+	server.respond = func(w http.ResponseWriter) {
+		<-unblock
+	}
+	c, _ := newTestClient(t, mapstr.M{
+		"url":     server.URL,
+		"timeout": "100ms",
+		"oauth2": mapstr.M{
+			"client.id":     "beats",
+			"client.secret": "secret",
+			"token_url":     tokenServer.URL,
+		},
+	})
+
+	batch := outest.NewBatch(testEvents(1, nil)...)
+	start := time.Now()
+	err := c.Publish(context.Background(), batch)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+}
@@ -0,0 +1,215 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	formatNDJSON    = "ndjson"
+	formatJSONArray = "json_array"
+
+	actionRetry = "retry"
+	actionDrop  = "drop"
+)
+
+type httpConfig struct {
+	// URL of the endpoint, formatted for each event.
+	URL    *fmtstr.EventFormatString `config:"url" validate:"required"`
+	Method string                    `config:"method"`
+
+	// Format of the request bodies, either "ndjson" or "json_array".
+	Format           string            `config:"format"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+	Headers          map[string]string `config:"headers"`
+	Username         string            `config:"username"`
+	Password         string            `config:"password"`
+	OAuth2           *oauth2Config     `config:"oauth2"`
+
+	StatusCodes statusCodesConfig `config:"status_codes"`
+
+	Codec       codec.Config     `config:"codec"`
+	Workers     int              `config:"worker" validate:"min=1"`
+	BulkMaxSize int              `config:"bulk_max_size"`
+	MaxRetries  int              `config:"max_retries" validate:"min=-1"`
+	Backoff     backoffConfig    `config:"backoff"`
+	Queue       config.Namespace `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// statusCodesConfig defines whether the events of a request that failed with
+// an HTTP status code are retried or dropped.
+type statusCodesConfig struct {
+	// Retry defaults to defaultRetryStatusCodes when it is not set. The
+	// defaults are not set in defaultConfig, as the unpacked list would be
+	// merged into them instead of replacing them.
+	Retry []int `config:"retry"`
+	Drop  []int `config:"drop"`
+
+	// Default is the action for the status codes that are neither listed in
+	// Retry nor in Drop.
+	Default string `config:"default"`
+}
+
+// oauth2Config configures the OAuth 2.0 client credentials grant used to get
+// the access tokens sent with the requests.
+type oauth2Config struct {
+	ClientID       string              `config:"client.id"     validate:"required"`
+	ClientSecret   string              `config:"client.secret" validate:"required"`
+	TokenURL       string              `config:"token_url"     validate:"required"`
+	Scopes         []string            `config:"scopes"`
+	EndpointParams map[string][]string `config:"endpoint_params"`
+}
+
+// defaultRetryStatusCodes are the status codes retried when
+// status_codes.retry is not set.
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+type backoffConfig struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() httpConfig {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 90 * time.Second
+	return httpConfig{
+		Method:      http.MethodPost,
+		Format:      formatNDJSON,
+		Workers:     1,
+		BulkMaxSize: 50,
+		MaxRetries:  3,
+		Backoff: backoffConfig{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		StatusCodes: statusCodesConfig{
+			Default: actionDrop,
+		},
+		Transport: transport,
+	}
+}
+
+func (c *httpConfig) Validate() error {
+	c.Method = strings.ToUpper(c.Method)
+	switch c.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("http method %v not supported", c.Method)
+	}
+
+	switch c.Format {
+	case formatNDJSON, formatJSONArray:
+	default:
+		return fmt.Errorf("http format %v not supported", c.Format)
+	}
+
+	if c.URL != nil && c.URL.IsConst() {
+		u, err := c.URL.Run(nil)
+		if err != nil {
+			return err
+		}
+		if err := validateURL(u); err != nil {
+			return err
+		}
+	}
+
+	if c.Username != "" && c.OAuth2 != nil {
+		return errors.New("username and oauth2 can not be used together")
+	}
+	return nil
+}
+
+func (c *statusCodesConfig) Validate() error {
+	codes := map[int]string{}
+	for _, list := range []struct {
+		action string
+		codes  []int
+	}{{actionRetry, c.Retry}, {actionDrop, c.Drop}} {
+		for _, code := range list.codes {
+			if code < 300 || code > 599 {
+				return fmt.Errorf("status code %d is not an HTTP error status code", code)
+			}
+			if action, ok := codes[code]; ok && action != list.action {
+				return fmt.Errorf("status code %d can not be both retried and dropped", code)
+			}
+			codes[code] = list.action
+		}
+	}
+
+	switch c.Default {
+	case actionRetry, actionDrop:
+	default:
+		return fmt.Errorf("status code action %v not supported", c.Default)
+	}
+	return nil
+}
+
+// action returns the action for a request that failed with status code.
+func (c *statusCodesConfig) action(code int) string {
+	// Drop is checked first so that it can override the default Retry
+	// status codes, Validate rejects codes listed in both.
+	for _, drop := range c.Drop {
+		if code == drop {
+			return actionDrop
+		}
+	}
+	retry := c.Retry
+	if retry == nil {
+		retry = defaultRetryStatusCodes
+	}
+	for _, r := range retry {
+		if code == r {
+			return actionRetry
+		}
+	}
+	return c.Default
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must use the http or https scheme", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url %q has no host", raw)
+	}
+	return nil
+}
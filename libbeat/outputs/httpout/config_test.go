@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"defaults": {
+			config: mapstr.M{"url": "http://localhost:8080/events"},
+		},
+		"url template": {
+			config: mapstr.M{"url": "https://collector/%{[tenant]}/events", "method": "put"},
+		},
+		"missing url": {
+			config:  mapstr.M{},
+			wantErr: "missing required field",
+		},
+		"url without scheme": {
+			config:  mapstr.M{"url": "localhost:8080/events"},
+			wantErr: "must use the http or https scheme",
+		},
+		"unsupported method": {
+			config:  mapstr.M{"url": "http://localhost", "method": "GET"},
+			wantErr: "http method GET not supported",
+		},
+		"unsupported format": {
+			config:  mapstr.M{"url": "http://localhost", "format": "xml"},
+			wantErr: "http format xml not supported",
+		},
+		"invalid compression level": {
+			config:  mapstr.M{"url": "http://localhost", "compression_level": 10},
+			wantErr: "requires value <= 9",
+		},
+		"username and oauth2": {
+			config: mapstr.M{
+				"url":      "http://localhost",
+				"username": "beats",
+				"oauth2": mapstr.M{
+					"client.id":     "beats",
+					"client.secret": "secret",
+					"token_url":     "http://localhost/token",
+				},
+			},
+			wantErr: "username and oauth2 can not be used together",
+		},
+		"oauth2 without token url": {
+			config: mapstr.M{
+				"url":    "http://localhost",
+				"oauth2": mapstr.M{"client.id": "beats", "client.secret": "secret"},
+			},
+			wantErr: "accessing 'oauth2.token_url'",
+		},
+		"success status code": {
+			config:  mapstr.M{"url": "http://localhost", "status_codes.retry": []int{200}},
+			wantErr: "status code 200 is not an HTTP error status code",
+		},
+		"status code retried and dropped": {
+			config:  mapstr.M{"url": "http://localhost", "status_codes.retry": []int{503}, "status_codes.drop": []int{503}},
+			wantErr: "status code 503 can not be both retried and dropped",
+		},
+		"unsupported default action": {
+			config:  mapstr.M{"url": "http://localhost", "status_codes.default": "ignore"},
+			wantErr: "status code action ignore not supported",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			err := config.MustNewConfigFrom(test.config).Unpack(&c)
+			if test.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
+
+func TestStatusCodesAction(t *testing.T) {
+	c := statusCodesConfig{
+		Retry:   []int{429, 503},
+		Drop:    []int{500},
+		Default: actionDrop,
+	}
+	assert.Equal(t, actionRetry, c.action(429))
+	assert.Equal(t, actionRetry, c.action(503))
+	assert.Equal(t, actionDrop, c.action(500))
+	assert.Equal(t, actionDrop, c.action(400))
+
+	c.Default = actionRetry
+	assert.Equal(t, actionRetry, c.action(400))
+	assert.Equal(t, actionDrop, c.action(500))
+
+	// Without a retry list the default status codes are retried, unless
+	// they are dropped.
+	c = statusCodesConfig{Drop: []int{500}, Default: actionDrop}
+	assert.Equal(t, actionRetry, c.action(503))
+	assert.Equal(t, actionDrop, c.action(500))
+	assert.Equal(t, actionDrop, c.action(401))
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+func init() {
+	outputs.RegisterType("http", makeHTTP)
+}
+
+func makeHTTP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := logp.NewLogger("http")
+
+	hConfig := defaultConfig()
+	if err := cfg.Unpack(&hConfig); err != nil {
+		return outputs.Fail(err)
+	}
+
+	// The raw URL is only used to identify the clients in logs.
+	rawURL, err := cfg.String("url", -1)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	clients := make([]outputs.NetworkClient, hConfig.Workers)
+	for i := range clients {
+		httpClient, err := newHTTPClient(log, observer, &hConfig)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		enc, err := codec.CreateEncoder(beat, hConfig.Codec)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		clients[i] = newClient(log, observer, httpClient, enc, beat, rawURL, &hConfig)
+	}
+
+	return outputs.SuccessNet(hConfig.Queue, true, hConfig.BulkMaxSize, hConfig.MaxRetries, nil, clients)
+}
+
+// newHTTPClient creates the HTTP client of an output worker. If OAuth2 is
+// configured, the client adds an access token to the requests, which it
+// fetches with the client credentials grant.
+func newHTTPClient(log *logp.Logger, observer outputs.Observer, config *httpConfig) (*http.Client, error) {
+	client, err := config.Transport.Client(
+		httpcommon.WithLogger(log),
+		httpcommon.WithIOStats(observer),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if config.OAuth2 == nil {
+		return client, nil
+	}
+
+	creds := clientcredentials.Config{
+		ClientID:       config.OAuth2.ClientID,
+		ClientSecret:   config.OAuth2.ClientSecret,
+		TokenURL:       config.OAuth2.TokenURL,
+		Scopes:         config.OAuth2.Scopes,
+		EndpointParams: config.OAuth2.EndpointParams,
+	}
+	// The token requests use the configured client. The client returned by
+	// creds.Client only keeps the transport of the context client, so the
+	// oauth2 transport is wrapped in a client with the configured timeout.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Base:   client.Transport,
+			Source: creds.TokenSource(ctx),
+		},
+		Timeout: client.Timeout,
+	}, nil
+}
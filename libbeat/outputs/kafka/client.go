@@ -29,6 +29,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/eapache/go-resiliency/breaker"
 
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
@@ -53,8 +54,21 @@ type client struct {
 
 	producer sarama.AsyncProducer
 
+	// transactional configures the transactional producer, which replaces
+	// the sarama producer if set.
+	transactional *transactionalConfig
+	txn           *txnProducer
+
 	recordHeaders []sarama.RecordHeader
 
+	// encodeBackoff delays publishing after events failed to be encoded
+	// because of a temporary failure of the codec.
+	encodeBackoff backoff.Backoff
+
+	// txnBackoff delays publishing and reconnecting after a transaction
+	// failed, as the output reconnects as soon as Publish returns an error.
+	txnBackoff backoff.Backoff
+
 	wg sync.WaitGroup
 }
 
@@ -81,6 +95,8 @@ func newKafkaClient(
 	headers []header,
 	writer codec.Codec,
 	cfg *sarama.Config,
+	encodeBackoff backoffConfig,
+	transactional *transactionalConfig,
 ) (*client, error) {
 	c := &client{
 		log:      logp.NewLogger(logSelector),
@@ -92,7 +108,11 @@ func newKafkaClient(
 		codec:    writer,
 		config:   *cfg,
 		done:     make(chan struct{}),
+
+		transactional: transactional,
 	}
+	c.encodeBackoff = backoff.NewEqualJitterBackoff(c.done, encodeBackoff.Init, encodeBackoff.Max)
+	c.txnBackoff = backoff.NewEqualJitterBackoff(c.done, encodeBackoff.Init, encodeBackoff.Max)
 
 	if len(headers) != 0 {
 		recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
@@ -114,6 +134,15 @@ func newKafkaClient(
 }
 
 func (c *client) Connect() error {
+	if c.transactional != nil {
+		err := c.connectTransactional()
+		if err != nil {
+			// Wait without holding the lock, so that Close isn't blocked.
+			c.txnBackoff.Wait()
+		}
+		return err
+	}
+
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
@@ -140,6 +169,13 @@ func (c *client) Close() error {
 	defer c.mux.Unlock()
 	c.log.Debug("closed kafka client")
 
+	if c.txn != nil {
+		close(c.done)
+		err := c.txn.Close()
+		c.txn = nil
+		return err
+	}
+
 	// producer was not created before the close() was called.
 	if c.producer == nil {
 		return nil
@@ -164,25 +200,158 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 		batch:  batch,
 	}
 
-	ch := c.producer.Input()
+	// Encode all the events before handing them to the producer, so that
+	// the events failing to be encoded are accounted for before the
+	// producer workers update ref.
+	var encodeErr error
+	msgs := make([]*message, 0, len(events))
 	for i := range events {
 		d := &events[i]
 		msg, err := c.getEventMessage(d)
+		if errors.Is(err, codec.ErrTemporary) {
+			if encodeErr == nil {
+				c.log.Errorf("Failed to encode events, retrying: %+v", err)
+				encodeErr = err
+			}
+			ref.fail(&message{data: *d}, err)
+			continue
+		}
 		if err != nil {
 			c.log.Errorf("Dropping event: %+v", err)
 			ref.done()
 			c.observer.PermanentErrors(1)
 			continue
 		}
+		msgs = append(msgs, msg)
+	}
+
+	if c.transactional != nil {
+		err := c.publishTransaction(ref, msgs)
+		backoff.WaitOnError(c.encodeBackoff, encodeErr)
+		return err
+	}
 
+	ch := c.producer.Input()
+	for _, msg := range msgs {
 		msg.ref = ref
 		msg.initProducerMessage()
 		ch <- &msg.msg
 	}
 
+	// Back off while the codec fails, e.g. while the schema registry is
+	// unavailable, instead of retrying the failed events immediately.
+	backoff.WaitOnError(c.encodeBackoff, encodeErr)
+
 	return nil
 }
 
+// connectTransactional creates a new transactional producer, replacing the
+// producer of a previous connection. The new producer fences the previous one
+// and aborts its pending transaction.
+func (c *client) connectTransactional() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.log.Debugf("connect: %v", c.hosts)
+
+	if c.txn != nil {
+		_ = c.txn.Close()
+		c.txn = nil
+	}
+
+	txn, err := newTxnProducer(c.log, c.hosts, &c.config, c.transactional.ID, c.transactional.Timeout)
+	if err != nil {
+		c.log.Errorf("Kafka connect fails with: %+v", err)
+		return err
+	}
+	c.txn = txn
+	return nil
+}
+
+// publishTransaction publishes msgs in a single transaction. The batch is
+// only ACKed once the transaction is committed. If the transaction fails, its
+// events are retried, or dropped if the error is permanent, and the error is
+// returned after a backoff, so that the output reconnects with a new
+// transactional producer. The events whose partition can't be selected are
+// retried without the transaction.
+func (c *client) publishTransaction(ref *msgRef, msgs []*message) error {
+	pending := make([]*message, 0, len(msgs))
+	for _, msg := range msgs {
+		msg.ref = ref
+		msg.initProducerMessage()
+		if len(msg.key)+len(msg.value) > c.config.Producer.MaxMessageBytes {
+			ref.fail(msg, sarama.ErrMessageSizeTooLarge)
+			continue
+		}
+		pending = append(pending, msg)
+	}
+
+	var partitionErr error
+	partitions := c.txn.partition(pending, func(msg *message, err error) {
+		if partitionErr == nil {
+			c.log.Errorf("Kafka (topic=%v): failed to select a partition: %+v", msg.topic, err)
+			partitionErr = err
+		}
+		ref.fail(msg, err)
+	})
+
+	err := c.txn.publish(partitions)
+	if err != nil {
+		c.log.Errorf("Kafka transaction failed: %+v", err)
+
+		// The error is not wrapped, so that the events are retried even if
+		// the transaction failed because of an error that drops the
+		// messages of the sarama producer.
+		retryErr := fmt.Errorf("transaction aborted: %v", err) //nolint:errorlint // see above
+
+		// Permanent errors drop the events of the topic the error is
+		// about, or of the whole transaction.
+		permanent := isPermanentTxnError(err)
+		var topicErr *topicError
+		topicOnly := errors.As(err, &topicErr)
+		for _, msgs := range partitions {
+			for _, msg := range msgs {
+				if permanent && (!topicOnly || msg.topic == topicErr.topic) {
+					ref.done()
+					c.observer.PermanentErrors(1)
+					continue
+				}
+				ref.fail(msg, retryErr)
+			}
+		}
+		c.txnBackoff.Wait()
+		return err
+	}
+
+	for _, msgs := range partitions {
+		for range msgs {
+			ref.done()
+		}
+	}
+	backoff.WaitOnError(c.txnBackoff, partitionErr)
+	return nil
+}
+
+// isPermanentTxnError tells whether the events of a failed transaction can't
+// be written by retrying them.
+func isPermanentTxnError(err error) bool {
+	for _, kerr := range []sarama.KError{
+		sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrTransactionalIDAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed,
+		sarama.ErrInvalidMessage,
+		sarama.ErrMessageSizeTooLarge,
+		sarama.ErrInvalidMessageSize,
+		sarama.ErrInvalidRecord,
+		sarama.ErrInvalidTopic,
+	} {
+		if errors.Is(err, kerr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *client) String() string {
 	return "kafka(" + strings.Join(c.hosts, ",") + ")"
 }
@@ -0,0 +1,271 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// errorCodec fails to encode the events with an "error" field, with the error
+// of the field.
+type errorCodec struct{}
+
+func (errorCodec) Encode(_ string, event *beat.Event) ([]byte, error) {
+	if err, ok := event.Fields["error"].(error); ok {
+		return nil, err
+	}
+	return []byte(event.Fields.StringToPrint()), nil
+}
+
+func TestPublishEncodingErrors(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+
+	c, err := newKafkaClient(
+		outputs.NewStats(reg),
+		[]string{"localhost:9092"},
+		"test",
+		nil,
+		outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorKeepCase)),
+		nil,
+		errorCodec{},
+		cfg,
+		backoffConfig{Init: time.Millisecond, Max: time.Millisecond},
+		nil,
+	)
+	require.NoError(t, err)
+
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	defer func() {
+		close(c.done)
+		producer.AsyncClose()
+		c.wg.Wait()
+	}()
+
+	temporary := fmt.Errorf("%w: registry unavailable", codec.ErrTemporary)
+	batch := outest.NewBatch(
+		beat.Event{Fields: mapstr.M{"message": "ok"}},
+		beat.Event{Fields: mapstr.M{"error": temporary}},
+		beat.Event{Fields: mapstr.M{"error": errors.New("incompatible")}},
+	)
+	signals := make(chan outest.BatchSignal, 1)
+	batch.OnSignal = func(sig outest.BatchSignal) { signals <- sig }
+
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	select {
+	case sig := <-signals:
+		// The event failing with a temporary error is retried, and the
+		// incompatible event is dropped.
+		require.Equal(t, outest.BatchRetryEvents, sig.Tag)
+		require.Len(t, sig.Events, 1)
+		assert.Equal(t, temporary, sig.Events[0].Content.Fields["error"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not completed")
+	}
+
+	assert.Equal(t, uint64(1), reg.Get("events.dropped").(*monitoring.Uint).Get())
+	assert.Equal(t, uint64(1), reg.Get("events.failed").(*monitoring.Uint).Get())
+}
+
+func TestPublishTransactional(t *testing.T) {
+	tests := map[string]struct {
+		produceErr  sarama.KError
+		topics      []string
+		wantErr     bool
+		wantSignal  outest.BatchSignalTag
+		wantRetried int
+		wantDropped uint64
+		wantTxn     bool
+	}{
+		"committed batch is ACKed": {
+			produceErr: sarama.ErrNoError,
+			wantSignal: outest.BatchACK,
+			wantTxn:    true,
+		},
+		"aborted batch is retried": {
+			produceErr:  sarama.ErrNotLeaderForPartition,
+			wantErr:     true,
+			wantSignal:  outest.BatchRetryEvents,
+			wantRetried: 2,
+			wantTxn:     true,
+		},
+		"batch aborted by a permanent error is dropped": {
+			produceErr:  sarama.ErrTopicAuthorizationFailed,
+			wantErr:     true,
+			wantSignal:  outest.BatchACK,
+			wantDropped: 2,
+			wantTxn:     true,
+		},
+		"events of an unknown topic don't block the batch": {
+			produceErr:  sarama.ErrNoError,
+			topics:      []string{"test", "unknown"},
+			wantSignal:  outest.BatchRetryEvents,
+			wantRetried: 1,
+			wantTxn:     true,
+		},
+		"batch of an unknown topic is retried": {
+			produceErr:  sarama.ErrNoError,
+			topics:      []string{"unknown", "unknown"},
+			wantSignal:  outest.BatchRetryEvents,
+			wantRetried: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			broker := sarama.NewMockBroker(t, 1)
+			defer broker.Close()
+			broker.SetHandlerByMap(map[string]sarama.MockResponse{
+				"MetadataRequest": sarama.NewMockMetadataResponse(t).
+					SetBroker(broker.Addr(), broker.BrokerID()).
+					SetController(broker.BrokerID()).
+					SetLeader("test", 0, broker.BrokerID()),
+				"FindCoordinatorRequest": sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{
+					Version:     1,
+					Coordinator: sarama.NewBroker(broker.Addr()),
+				}),
+				"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+					ProducerID:    1000,
+					ProducerEpoch: 1,
+				}),
+				"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+					Errors: map[string][]*sarama.PartitionError{"test": {{Partition: 0}}},
+				}),
+				"ProduceRequest": sarama.NewMockProduceResponse(t).
+					SetVersion(3).
+					SetError("test", 0, test.produceErr),
+				"EndTxnRequest": sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+			})
+
+			cfg := config.MustNewConfigFrom(mapstr.M{
+				"hosts":              []string{broker.Addr()},
+				"topic":              "%{[topic]}",
+				"version":            "2.0",
+				"transactional.id":   "beats",
+				"metadata.retry.max": 0,
+				"backoff.init":       "200ms",
+				"backoff.max":        "200ms",
+			})
+			kConfig, err := readConfig(cfg)
+			require.NoError(t, err)
+			libCfg, err := newSaramaConfig(logp.L(), kConfig)
+			require.NoError(t, err)
+			topic, err := buildTopicSelector(cfg)
+			require.NoError(t, err)
+
+			reg := monitoring.NewRegistry()
+			c, err := newKafkaClient(
+				outputs.NewStats(reg),
+				kConfig.Hosts,
+				"test",
+				nil,
+				topic,
+				nil,
+				errorCodec{},
+				libCfg,
+				kConfig.Backoff,
+				kConfig.Transactional,
+			)
+			require.NoError(t, err)
+			require.NoError(t, c.Connect())
+			defer c.Close()
+
+			topics := test.topics
+			if topics == nil {
+				topics = []string{"test", "test"}
+			}
+			batch := outest.NewBatch(
+				beat.Event{Fields: mapstr.M{"message": "first", "topic": topics[0]}},
+				beat.Event{Fields: mapstr.M{"message": "second", "topic": topics[1]}},
+			)
+			start := time.Now()
+			err = c.Publish(context.Background(), batch)
+			if test.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			if test.wantSignal == outest.BatchRetryEvents || test.wantDropped > 0 {
+				// The events must not be retried in a loop while the
+				// transactions fail.
+				assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "the retry must be delayed")
+			}
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.wantSignal, batch.Signals[0].Tag)
+			if test.wantSignal == outest.BatchRetryEvents {
+				require.Len(t, batch.Signals[0].Events, test.wantRetried)
+				if test.topics != nil {
+					for _, e := range batch.Signals[0].Events {
+						assert.Equal(t, "unknown", e.Content.Fields["topic"])
+					}
+				}
+			}
+			assert.Equal(t, test.wantDropped, reg.Get("events.dropped").(*monitoring.Uint).Get())
+
+			var produced, ended bool
+			for _, rr := range broker.History() {
+				switch req := rr.Request.(type) {
+				case *sarama.ProduceRequest:
+					produced = true
+					require.NotNil(t, req.TransactionalID)
+					assert.Equal(t, "beats", *req.TransactionalID)
+				case *sarama.EndTxnRequest:
+					ended = true
+					assert.Equal(t, !test.wantErr, req.TransactionResult, "the transaction must be committed only if all events were written")
+				}
+			}
+			assert.Equal(t, test.wantTxn, produced, "the events of known topics must be written to the partition leader")
+			assert.Equal(t, test.wantTxn, ended, "the transaction must be ended")
+		})
+	}
+}
+
+func TestNextSequence(t *testing.T) {
+	assert.Equal(t, int32(5), nextSequence(3, 2))
+	assert.Equal(t, int32(math.MaxInt32), nextSequence(math.MaxInt32-2, 2))
+	assert.Equal(t, int32(0), nextSequence(math.MaxInt32-2, 3))
+	assert.Equal(t, int32(4), nextSequence(math.MaxInt32, 5))
+}
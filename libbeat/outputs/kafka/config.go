@@ -79,6 +79,8 @@ type kafkaConfig struct {
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
 	Queue              config.Namespace          `config:"queue"`
+	Idempotent         bool                      `config:"idempotent"`
+	Transactional      *transactionalConfig      `config:"transactional"`
 
 	// Currently only used for validation. Those values are later
 	// unpacked into temporary structs whenever they're necessary.
@@ -86,6 +88,19 @@ type kafkaConfig struct {
 	Topics []any  `config:"topics"`
 }
 
+// transactionalConfig configures the transactional producer, publishing each
+// batch of events in a Kafka transaction.
+type transactionalConfig struct {
+	ID      string        `config:"id"      validate:"required"`
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+}
+
+// InitDefaults sets the default transaction timeout, which is the default of
+// the Kafka producers.
+func (c *transactionalConfig) InitDefaults() {
+	c.Timeout = time.Minute
+}
+
 type metaConfig struct {
 	Retry       metaRetryConfig `config:"retry"`
 	RefreshFreq time.Duration   `config:"refresh_frequency" validate:"min=0"`
@@ -186,6 +201,12 @@ func (c *kafkaConfig) Validate() error {
 		return errors.New("either 'topic' or 'topics' must be defined")
 	}
 
+	if c.Idempotent || c.Transactional != nil {
+		if err := c.validateIdempotence(); err != nil {
+			return err
+		}
+	}
+
 	// When running under Elastic-Agent we do not support dynamic topic
 	// selection, so `topics` is not supported and `topic` is treated as an
 	// plain string
@@ -202,6 +223,23 @@ func (c *kafkaConfig) Validate() error {
 	return nil
 }
 
+// validateIdempotence checks the settings the idempotent and transactional
+// producers depend on.
+func (c *kafkaConfig) validateIdempotence() error {
+	mode := "idempotent"
+	if c.Transactional != nil {
+		mode = "transactional"
+	}
+
+	if version, ok := c.Version.Get(); !ok || !version.IsAtLeast(sarama.V0_11_0_0) {
+		return fmt.Errorf("the %v producer requires kafka version 0.11 or newer, got '%v'", mode, c.Version)
+	}
+	if c.RequiredACKs != nil && sarama.RequiredAcks(*c.RequiredACKs) != sarama.WaitForAll {
+		return fmt.Errorf("the %v producer requires required_acks to be -1", mode)
+	}
+	return nil
+}
+
 func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, error) {
 	partitioner, err := makePartitioner(log, config.Partition)
 	if err != nil {
@@ -291,6 +329,14 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	k.Producer.Retry.Max = retryMax
 	k.Producer.Retry.BackoffFunc = makeBackoffFunc(config.Backoff)
 
+	// The transactional producer writes the records with the idempotent
+	// producer ID and sequence numbers assigned by the transaction coordinator.
+	if config.Idempotent || config.Transactional != nil {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+
 	// configure per broker go channel buffering
 	k.ChannelBufferSize = config.ChanBufferSize
 
@@ -43,6 +43,15 @@ func TestConfigAcceptValid(t *testing.T) {
 			"version":     "1.0.0",
 			"topic":       "foo",
 		},
+		"idempotent producer": mapstr.M{
+			"idempotent":    true,
+			"required_acks": -1,
+			"topic":         "foo",
+		},
+		"transactional producer": mapstr.M{
+			"transactional.id": "beats",
+			"topic":            "foo",
+		},
 		"Kerberos with keytab": mapstr.M{
 			"topic": "foo",
 			"kerberos": mapstr.M{
@@ -95,6 +104,20 @@ func TestConfigInvalid(t *testing.T) {
 				"realm":        "ELASTIC",
 			},
 		},
+		"idempotent producer with 0.10": mapstr.M{
+			"idempotent": true,
+			"version":    "0.10",
+			"topic":      "foo",
+		},
+		"idempotent producer without acks from all replicas": mapstr.M{
+			"idempotent":    true,
+			"required_acks": 1,
+			"topic":         "foo",
+		},
+		"transactional producer without id": mapstr.M{
+			"transactional.timeout": "10s",
+			"topic":                 "foo",
+		},
 		// The default config does not set `topic` nor `topics`.
 		"No topics or topic provided": mapstr.M{},
 	}
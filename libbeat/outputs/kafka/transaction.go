@@ -0,0 +1,455 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// recordBatchOverhead and recordOverhead are the upper bounds of the
+	// size of the headers of a record batch and of a record, as estimated by
+	// sarama when splitting messages into requests.
+	recordBatchOverhead = 49
+	recordOverhead      = 5*binary.MaxVarintLen32 + binary.MaxVarintLen64 + 1
+)
+
+// txnProducer publishes messages in Kafka transactions. Sarama does not
+// implement the transactional producer, so txnProducer drives the transaction
+// protocol itself: all messages of a batch are written with the producer ID
+// and epoch assigned by the transaction coordinator, and are committed or
+// aborted together.
+//
+// A txnProducer can not be used anymore once publish failed, as the state of
+// the transaction and of the sequence numbers is unknown. Creating a new
+// txnProducer with the same transactional ID fences the previous producer
+// and aborts its pending transaction.
+type txnProducer struct {
+	log     *logp.Logger
+	hosts   []string
+	config  *sarama.Config
+	id      string
+	timeout time.Duration
+
+	client      sarama.Client
+	coordinator *sarama.Broker
+
+	producerID int64
+	epoch      int16
+
+	// sequences holds the sequence number of the next record written to each
+	// partition.
+	sequences    map[topicPartition]int32
+	partitioners map[string]sarama.Partitioner
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// topicError is returned when the messages of a single topic can't be
+// written, so that the messages of the other topics can still be retried.
+type topicError struct {
+	topic string
+	err   error
+}
+
+func (e *topicError) Error() string {
+	return e.err.Error()
+}
+
+func (e *topicError) Unwrap() error {
+	return e.err
+}
+
+func newTxnProducer(
+	log *logp.Logger,
+	hosts []string,
+	config *sarama.Config,
+	id string,
+	timeout time.Duration,
+) (*txnProducer, error) {
+	client, err := sarama.NewClient(hosts, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &txnProducer{
+		log:          log,
+		hosts:        hosts,
+		config:       config,
+		id:           id,
+		timeout:      timeout,
+		client:       client,
+		sequences:    map[topicPartition]int32{},
+		partitioners: map[string]sarama.Partitioner{},
+	}
+	if err := p.initProducerID(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// initProducerID registers the transactional ID with its transaction
+// coordinator, which returns the producer ID and epoch to write the records
+// with.
+func (p *txnProducer) initProducerID() error {
+	coordinator, err := p.findCoordinator()
+	if err != nil {
+		return fmt.Errorf("failed to find the transaction coordinator: %w", err)
+	}
+	p.coordinator = coordinator
+
+	resp, err := p.coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+		TransactionalID:    &p.id,
+		TransactionTimeout: p.timeout,
+	})
+	if err == nil && !errors.Is(resp.Err, sarama.ErrNoError) {
+		err = resp.Err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize the transactional producer %q: %w", p.id, err)
+	}
+
+	p.log.Debugf("initialized transactional producer %q (producer ID: %v, epoch: %v)",
+		p.id, resp.ProducerID, resp.ProducerEpoch)
+	p.producerID = resp.ProducerID
+	p.epoch = resp.ProducerEpoch
+	return nil
+}
+
+// findCoordinator asks the configured hosts for the transaction coordinator of
+// the transactional ID, and connects to it.
+func (p *txnProducer) findCoordinator() (*sarama.Broker, error) {
+	var err error
+	for _, host := range p.hosts {
+		var coordinator *sarama.Broker
+		coordinator, err = p.findCoordinatorFrom(sarama.NewBroker(host))
+		if err == nil {
+			return coordinator, nil
+		}
+		p.log.Debugf("Failed to find the transaction coordinator from %v: %+v", host, err)
+	}
+	return nil, err
+}
+
+func (p *txnProducer) findCoordinatorFrom(broker *sarama.Broker) (*sarama.Broker, error) {
+	if err := broker.Open(p.config); err != nil {
+		return nil, err
+	}
+	defer broker.Close()
+
+	resp, err := broker.FindCoordinator(&sarama.FindCoordinatorRequest{
+		Version:         1,
+		CoordinatorKey:  p.id,
+		CoordinatorType: sarama.CoordinatorTransaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !errors.Is(resp.Err, sarama.ErrNoError) {
+		return nil, resp.Err
+	}
+
+	coordinator := resp.Coordinator
+	if err := coordinator.Open(p.config); err != nil {
+		return nil, err
+	}
+	return coordinator, nil
+}
+
+// Close closes the connections to the brokers. A pending transaction is
+// aborted by the transaction coordinator after the transaction timeout.
+func (p *txnProducer) Close() error {
+	if p.coordinator != nil {
+		_ = p.coordinator.Close()
+	}
+	return p.client.Close()
+}
+
+// publish writes the messages of partitions in a single transaction and
+// commits it. On error the transaction is aborted.
+func (p *txnProducer) publish(partitions map[topicPartition][]*message) error {
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	if err := p.addPartitions(partitions); err != nil {
+		return p.abort(err)
+	}
+	if err := p.produce(partitions); err != nil {
+		return p.abort(err)
+	}
+	return p.endTxn(true)
+}
+
+// partition groups msgs by the partition selected by the partitioner of their
+// topic, in the order of msgs. The messages whose partition can't be selected
+// are passed to fail instead. The partitions of each topic are only looked up
+// once, so that the messages of an unknown topic don't each wait for the
+// metadata to be refreshed.
+func (p *txnProducer) partition(msgs []*message, fail func(*message, error)) map[topicPartition][]*message {
+	partitions := map[topicPartition][]*message{}
+	ids := map[string][]int32{}
+	errs := map[string]error{}
+	for _, msg := range msgs {
+		partitioner := p.partitioners[msg.topic]
+		if partitioner == nil {
+			partitioner = p.config.Producer.Partitioner(msg.topic)
+			p.partitioners[msg.topic] = partitioner
+		}
+
+		topicIDs, known := ids[msg.topic]
+		err := errs[msg.topic]
+		if !known {
+			topicIDs, err = p.partitionIDs(msg.topic, partitioner)
+			ids[msg.topic], errs[msg.topic] = topicIDs, err
+		}
+		if err != nil {
+			fail(msg, err)
+			continue
+		}
+
+		choice, err := partitioner.Partition(&msg.msg, int32(len(topicIDs)))
+		if err == nil && (choice < 0 || int(choice) >= len(topicIDs)) {
+			err = sarama.ErrInvalidPartition
+		}
+		if err != nil {
+			fail(msg, err)
+			continue
+		}
+
+		tp := topicPartition{topic: msg.topic, partition: topicIDs[choice]}
+		partitions[tp] = append(partitions[tp], msg)
+	}
+	return partitions
+}
+
+// partitionIDs returns the partitions of topic the partitioner can select.
+func (p *txnProducer) partitionIDs(topic string, partitioner sarama.Partitioner) ([]int32, error) {
+	var ids []int32
+	var err error
+	if partitioner.RequiresConsistency() {
+		ids, err = p.client.Partitions(topic)
+	} else {
+		ids, err = p.client.WritablePartitions(topic)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, sarama.ErrLeaderNotAvailable
+	}
+	return ids, nil
+}
+
+// addPartitions adds the partitions written to the transaction.
+func (p *txnProducer) addPartitions(partitions map[topicPartition][]*message) error {
+	topics := map[string][]int32{}
+	for tp := range partitions {
+		topics[tp.topic] = append(topics[tp.topic], tp.partition)
+	}
+
+	resp, err := p.coordinator.AddPartitionsToTxn(&sarama.AddPartitionsToTxnRequest{
+		TransactionalID: p.id,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.epoch,
+		TopicPartitions: topics,
+	})
+	if err != nil {
+		return err
+	}
+	for topic, errs := range resp.Errors {
+		for _, partitionErr := range errs {
+			if !errors.Is(partitionErr.Err, sarama.ErrNoError) {
+				return &topicError{topic: topic, err: fmt.Errorf("failed to add partition %v of topic %v to the transaction: %w",
+					partitionErr.Partition, topic, partitionErr.Err)}
+			}
+		}
+	}
+	return nil
+}
+
+// produce writes the messages to the leaders of their partitions. Each
+// request contains at most one record batch per partition, so the messages
+// of a partition exceeding the maximum message size are split across
+// requests.
+func (p *txnProducer) produce(partitions map[topicPartition][]*message) error {
+	leaders := map[*sarama.Broker][]topicPartition{}
+	for tp := range partitions {
+		leader, err := p.client.Leader(tp.topic, tp.partition)
+		if err != nil {
+			return err
+		}
+		leaders[leader] = append(leaders[leader], tp)
+	}
+
+	for leader, tps := range leaders {
+		pending := make(map[topicPartition][]*message, len(tps))
+		for _, tp := range tps {
+			pending[tp] = partitions[tp]
+		}
+
+		for {
+			req := &sarama.ProduceRequest{
+				TransactionalID: &p.id,
+				RequiredAcks:    p.config.Producer.RequiredAcks,
+				Timeout:         int32(p.config.Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+			sent := map[topicPartition]int{}
+			for _, tp := range tps {
+				msgs := pending[tp]
+				if len(msgs) == 0 {
+					continue
+				}
+				n := p.batchLen(msgs)
+				req.AddBatch(tp.topic, tp.partition, p.recordBatch(tp, msgs[:n]))
+				pending[tp] = msgs[n:]
+				sent[tp] = n
+			}
+			if len(sent) == 0 {
+				break
+			}
+
+			resp, err := leader.Produce(req)
+			if err != nil {
+				return err
+			}
+			for tp, n := range sent {
+				block := resp.GetBlock(tp.topic, tp.partition)
+				if block == nil {
+					return sarama.ErrIncompleteResponse
+				}
+				if !errors.Is(block.Err, sarama.ErrNoError) {
+					return &topicError{topic: tp.topic, err: fmt.Errorf("failed to write to partition %v of topic %v: %w",
+						tp.partition, tp.topic, block.Err)}
+				}
+				p.sequences[tp] = nextSequence(p.sequences[tp], n)
+			}
+		}
+	}
+	return nil
+}
+
+// nextSequence returns the sequence number following n records written from
+// seq. Sequence numbers wrap to 0 after math.MaxInt32.
+func nextSequence(seq int32, n int) int32 {
+	return int32((int64(seq) + int64(n)) % (math.MaxInt32 + 1))
+}
+
+// batchLen returns the number of messages at the start of msgs fitting into a
+// single record batch.
+func (p *txnProducer) batchLen(msgs []*message) int {
+	size := recordBatchOverhead
+	for i, msg := range msgs {
+		size += recordOverhead + len(msg.key) + len(msg.value)
+		for _, h := range msg.msg.Headers {
+			size += len(h.Key) + len(h.Value) + 2*binary.MaxVarintLen32
+		}
+		if i > 0 && size > p.config.Producer.MaxMessageBytes {
+			return i
+		}
+	}
+	return len(msgs)
+}
+
+func (p *txnProducer) recordBatch(tp topicPartition, msgs []*message) *sarama.RecordBatch {
+	first := msgs[0].msg.Timestamp
+	if first.IsZero() {
+		first = time.Now()
+	}
+	first = first.Truncate(time.Millisecond)
+
+	batch := &sarama.RecordBatch{
+		Version:          2,
+		Codec:            p.config.Producer.Compression,
+		CompressionLevel: p.config.Producer.CompressionLevel,
+		FirstTimestamp:   first,
+		MaxTimestamp:     first,
+		LastOffsetDelta:  int32(len(msgs) - 1),
+		ProducerID:       p.producerID,
+		ProducerEpoch:    p.epoch,
+		FirstSequence:    p.sequences[tp],
+		IsTransactional:  true,
+		Records:          make([]*sarama.Record, len(msgs)),
+	}
+	for i, msg := range msgs {
+		ts := msg.msg.Timestamp
+		if ts.IsZero() {
+			ts = first
+		}
+		ts = ts.Truncate(time.Millisecond)
+		if ts.After(batch.MaxTimestamp) {
+			batch.MaxTimestamp = ts
+		}
+
+		record := &sarama.Record{
+			Key:            msg.key,
+			Value:          msg.value,
+			TimestampDelta: ts.Sub(first),
+			OffsetDelta:    int64(i),
+		}
+		if len(msg.msg.Headers) > 0 {
+			record.Headers = make([]*sarama.RecordHeader, len(msg.msg.Headers))
+			for j := range msg.msg.Headers {
+				record.Headers[j] = &msg.msg.Headers[j]
+			}
+		}
+		batch.Records[i] = record
+	}
+	return batch
+}
+
+// abort aborts the current transaction after err occurred, and returns err.
+func (p *txnProducer) abort(err error) error {
+	if abortErr := p.endTxn(false); abortErr != nil {
+		p.log.Debugf("Failed to abort the transaction: %+v", abortErr)
+	}
+	return err
+}
+
+func (p *txnProducer) endTxn(commit bool) error {
+	resp, err := p.coordinator.EndTxn(&sarama.EndTxnRequest{
+		TransactionalID:   p.id,
+		ProducerID:        p.producerID,
+		ProducerEpoch:     p.epoch,
+		TransactionResult: commit,
+	})
+	if err == nil && !errors.Is(resp.Err, sarama.ErrNoError) {
+		err = resp.Err
+	}
+	if err != nil {
+		action := "abort"
+		if commit {
+			action = "commit"
+		}
+		return fmt.Errorf("failed to %v the transaction: %w", action, err)
+	}
+	return nil
+}
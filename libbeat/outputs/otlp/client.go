@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// sender exports OTLP requests to a single endpoint. The export methods
+// return the number of log records or data points the endpoint rejected
+// in a partial success response.
+type sender interface {
+	connect() error
+	close() error
+	exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error)
+	exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error)
+	String() string
+}
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	mapper   *mapper
+	sender   sender
+}
+
+// permanentError marks export failures that will not succeed on retry.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func newClient(log *logp.Logger, observer outputs.Observer, mapper *mapper, sender sender) *client {
+	return &client{
+		log:      log,
+		observer: observer,
+		mapper:   mapper,
+		sender:   sender,
+	}
+}
+
+func (c *client) Connect() error {
+	return c.sender.connect()
+}
+
+func (c *client) Close() error {
+	return c.sender.close()
+}
+
+func (c *client) String() string {
+	return "otlp(" + c.sender.String() + ")"
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	requests := c.mapper.mapEvents(events)
+	start := time.Now()
+
+	var rejected int
+	if requests.logs != nil {
+		n, err := c.sender.exportLogs(ctx, requests.logs)
+		if err != nil {
+			return c.failed(batch, append(requests.logEvents, requests.metricEvents...), 0, err)
+		}
+		rejected += int(n)
+	}
+	if requests.metrics != nil {
+		n, err := c.sender.exportMetrics(ctx, requests.metrics)
+		if err != nil {
+			return c.failed(batch, requests.metricEvents, rejected, err)
+		}
+		// Rejections are reported per data point, an event can have several.
+		rejected += min(int(n), len(requests.metricEvents))
+	}
+	c.observer.ReportLatency(time.Since(start))
+
+	if rejected > 0 {
+		c.log.Warnf("OTLP endpoint %v rejected %d events", c.sender, rejected)
+		c.observer.PermanentErrors(rejected)
+	}
+	c.observer.AckedEvents(len(events) - rejected)
+	batch.ACK()
+	return nil
+}
+
+// failed handles an export error after all events but pending were either
+// sent, or rejected by the endpoint.
+func (c *client) failed(batch publisher.Batch, pending []publisher.Event, rejected int, err error) error {
+	total := len(batch.Events())
+	sent := total - len(pending) - rejected
+	if rejected > 0 {
+		c.observer.PermanentErrors(rejected)
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		c.log.Errorf("Dropping %d events that failed to export to %v: %v", len(pending), c.sender, err)
+		c.observer.PermanentErrors(len(pending))
+		c.observer.AckedEvents(sent)
+		batch.ACK()
+		return nil
+	}
+
+	c.observer.AckedEvents(sent)
+	c.observer.RetryableErrors(len(pending))
+	batch.RetryEvents(pending)
+	return fmt.Errorf("failed to export events to %v: %w", c.sender, err)
+}
@@ -0,0 +1,350 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	requests []*collogspb.ExportLogsServiceRequest
+	metadata []metadata.MD
+	resp     *collogspb.ExportLogsServiceResponse
+	err      error
+}
+
+func (s *logsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.requests = append(s.requests, req)
+	s.metadata = append(s.metadata, md)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.resp != nil {
+		return s.resp, nil
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	requests []*colmetricspb.ExportMetricsServiceRequest
+}
+
+func (s *metricsServer) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.requests = append(s.requests, req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func startGRPCServer(t *testing.T, logs *logsServer, metrics *metricsServer) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, logs)
+	colmetricspb.RegisterMetricsServiceServer(srv, metrics)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func newTestClient(t *testing.T, config *otlpConfig, s sender) *client {
+	t.Helper()
+
+	c := newClient(logp.NewLogger("otlp"), outputs.NewNilObserver(), newMapper(testInfo, config), s)
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testBatch(fields ...mapstr.M) *outest.Batch {
+	if len(fields) == 0 {
+		fields = []mapstr.M{
+			{"message": "one", "value": 1},
+			{"message": "two", "value": 2},
+		}
+	}
+	var events []beat.Event
+	for _, e := range testEvents(fields...) {
+		events = append(events, e.Content)
+	}
+	return outest.NewBatch(events...)
+}
+
+func TestGRPCPublish(t *testing.T) {
+	logs := &logsServer{}
+	metrics := &metricsServer{}
+	addr := startGRPCServer(t, logs, metrics)
+
+	config := defaultConfig()
+	config.Headers = map[string]string{"authorization": "Bearer secret"}
+	config.Metrics = []metricConfig{{Field: "value"}}
+	s, err := newGRPCSender("http://"+addr, &config, nil)
+	require.NoError(t, err)
+	c := newTestClient(t, &config, s)
+
+	batch := testBatch(mapstr.M{"message": "log"}, mapstr.M{"value": 3})
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	require.Len(t, logs.requests, 1)
+	assert.Equal(t, []string{"Bearer secret"}, logs.metadata[0].Get("authorization"))
+	records := logs.requests[0].ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 1)
+	assert.Equal(t, "log", records[0].Body.GetStringValue())
+
+	require.Len(t, metrics.requests, 1)
+	points := metrics.requests[0].ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetGauge().GetDataPoints()
+	require.Len(t, points, 1)
+	assert.Equal(t, int64(3), points[0].GetAsInt())
+}
+
+func TestGRPCPublishErrors(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		resp   *collogspb.ExportLogsServiceResponse
+		retry  bool
+		failed bool
+	}{
+		"partial success": {
+			resp: &collogspb.ExportLogsServiceResponse{
+				PartialSuccess: &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: 1},
+			},
+		},
+		"unavailable": {
+			err:    status.Error(codes.Unavailable, "try later"),
+			retry:  true,
+			failed: true,
+		},
+		"invalid argument": {
+			err: status.Error(codes.InvalidArgument, "bad request"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			logs := &logsServer{err: test.err, resp: test.resp}
+			addr := startGRPCServer(t, logs, &metricsServer{})
+
+			config := defaultConfig()
+			s, err := newGRPCSender(addr, &config, nil)
+			require.NoError(t, err)
+			c := newTestClient(t, &config, s)
+
+			batch := testBatch()
+			err = c.Publish(context.Background(), batch)
+			if test.failed {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			require.Len(t, batch.Signals, 1)
+			if test.retry {
+				assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+				assert.Len(t, batch.Signals[0].Events, 2)
+			} else {
+				assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+			}
+		})
+	}
+}
+
+func TestHTTPPublish(t *testing.T) {
+	var (
+		gotPath    string
+		gotHeaders http.Header
+		gotRequest collogspb.ExportLogsServiceRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotHeaders = r.Header
+
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(body, &gotRequest))
+
+		resp, err := proto.Marshal(&collogspb.ExportLogsServiceResponse{
+			PartialSuccess: &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: 1},
+		})
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", contentTypeProtobuf)
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	config := defaultConfig()
+	config.Protocol = protocolHTTP
+	config.Headers = map[string]string{"X-Tenant": "a"}
+	s, err := newHTTPSender(srv.URL, &config, srv.Client(), nil)
+	require.NoError(t, err)
+	c := newTestClient(t, &config, s)
+
+	batch := testBatch()
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, "/v1/logs", gotPath)
+	assert.Equal(t, contentTypeProtobuf, gotHeaders.Get("Content-Type"))
+	assert.Equal(t, "gzip", gotHeaders.Get("Content-Encoding"))
+	assert.Equal(t, "a", gotHeaders.Get("X-Tenant"))
+	assert.Len(t, gotRequest.ResourceLogs[0].ScopeLogs[0].LogRecords, 2)
+}
+
+func TestHTTPPublishErrors(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		retry  bool
+	}{
+		"too many requests":   {status: http.StatusTooManyRequests, retry: true},
+		"service unavailable": {status: http.StatusServiceUnavailable, retry: true},
+		"bad request":         {status: http.StatusBadRequest},
+		"unauthorized":        {status: http.StatusUnauthorized},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "failed", test.status)
+			}))
+			defer srv.Close()
+
+			config := defaultConfig()
+			config.Protocol = protocolHTTP
+			config.Compression = "none"
+			s, err := newHTTPSender(srv.URL, &config, srv.Client(), nil)
+			require.NoError(t, err)
+			c := newTestClient(t, &config, s)
+
+			batch := testBatch()
+			err = c.Publish(context.Background(), batch)
+
+			require.Len(t, batch.Signals, 1)
+			if test.retry {
+				assert.Error(t, err)
+				assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+				assert.Len(t, batch.Signals[0].Events, 2)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+			}
+		})
+	}
+}
+
+func TestHTTPPublishTLS(t *testing.T) {
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", contentTypeProtobuf)
+	}))
+	defer srv.Close()
+
+	// A host without a scheme uses https when ssl settings are configured.
+	config := defaultConfig()
+	config.Protocol = protocolHTTP
+	s, err := newHTTPSender(srv.Listener.Addr().String(), &config, srv.Client(), &tlscommon.TLSConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://"+srv.Listener.Addr().String()+"/v1/logs", s.logsURL)
+	c := newTestClient(t, &config, s)
+
+	batch := testBatch()
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, 1, requests)
+}
+
+func TestNewSenderHosts(t *testing.T) {
+	config := defaultConfig()
+
+	s, err := newGRPCSender("collector", &config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "collector:4317", s.target)
+
+	_, err = newGRPCSender("ftp://collector", &config, nil)
+	assert.Error(t, err)
+
+	h, err := newHTTPSender("collector", &config, http.DefaultClient, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://collector:4318/v1/logs", h.logsURL)
+	assert.Equal(t, "http://collector:4318/v1/metrics", h.metricsURL)
+}
+
+type failingMetricsSender struct {
+	sender
+}
+
+func (failingMetricsSender) exportMetrics(context.Context, *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	return 0, status.Error(codes.Unavailable, "metrics backend down")
+}
+
+func TestPublishRetriesOnlyUnsentEvents(t *testing.T) {
+	logs := &logsServer{}
+	addr := startGRPCServer(t, logs, &metricsServer{})
+
+	config := defaultConfig()
+	config.Metrics = []metricConfig{{Field: "value"}}
+	s, err := newGRPCSender(addr, &config, nil)
+	require.NoError(t, err)
+	c := newTestClient(t, &config, failingMetricsSender{s})
+
+	batch := testBatch(mapstr.M{"message": "log"}, mapstr.M{"value": 3})
+	assert.Error(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, logs.requests, 1)
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, 3, batch.Signals[0].Events[0].Content.Fields["value"])
+}
@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+
+	metricTypeGauge = "gauge"
+	metricTypeSum   = "sum"
+)
+
+type otlpConfig struct {
+	// Protocol is either "grpc" or "http" (HTTP/protobuf).
+	Protocol string `config:"protocol"`
+
+	// Paths used by the HTTP protocol, relative to each host.
+	LogsPath    string `config:"logs_path"`
+	MetricsPath string `config:"metrics_path"`
+
+	Headers     map[string]string `config:"headers"`
+	Compression string            `config:"compression"`
+	LoadBalance bool              `config:"loadbalance"`
+	BulkMaxSize int               `config:"bulk_max_size"`
+	MaxRetries  int               `config:"max_retries" validate:"min=-1"`
+	Backoff     backoff           `config:"backoff"`
+	Queue       config.Namespace  `config:"queue"`
+
+	// Event fields that are sent as resource attributes instead of log
+	// record or data point attributes.
+	ResourceFields []string `config:"resource_fields"`
+
+	// Metrics maps numeric event fields to OTLP metrics. Events with at
+	// least one mapped field are sent as metrics, all others as logs.
+	Metrics []metricConfig `config:"metrics"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+// metricConfig maps one event field to an OTLP metric.
+type metricConfig struct {
+	Field string `config:"field" validate:"required"`
+
+	// Name of the metric, defaults to Field.
+	Name        string `config:"name"`
+	Description string `config:"description"`
+	Unit        string `config:"unit"`
+
+	// Type is "gauge" or "sum". Sums are cumulative.
+	Type      string `config:"type"`
+	Monotonic bool   `config:"monotonic"`
+
+	// Event fields added as data point attributes.
+	Attributes []string `config:"attributes"`
+}
+
+func defaultConfig() otlpConfig {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 30 * time.Second
+	return otlpConfig{
+		Protocol:    protocolGRPC,
+		LogsPath:    "/v1/logs",
+		MetricsPath: "/v1/metrics",
+		Compression: "gzip",
+		LoadBalance: true,
+		BulkMaxSize: 1024,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		ResourceFields: []string{
+			"service.name",
+			"service.version",
+			"service.environment",
+			"host.name",
+			"host.hostname",
+			"agent.type",
+			"agent.version",
+		},
+		Transport: transport,
+	}
+}
+
+func (c *otlpConfig) Validate() error {
+	switch c.Protocol {
+	case protocolGRPC, protocolHTTP:
+	default:
+		return fmt.Errorf("otlp protocol %v not supported", c.Protocol)
+	}
+
+	switch c.Compression {
+	case "", "none", "gzip":
+	default:
+		return fmt.Errorf("otlp compression %v not supported", c.Compression)
+	}
+
+	names := map[string]bool{}
+	for _, m := range c.Metrics {
+		name := m.metricName()
+		if names[name] {
+			return fmt.Errorf("otlp metric %v is defined more than once", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+func (c *otlpConfig) useGzip() bool {
+	return c.Compression == "gzip"
+}
+
+func (c *metricConfig) Validate() error {
+	switch c.Type {
+	case "", metricTypeGauge:
+		if c.Monotonic {
+			return errors.New("otlp gauge metrics can not be monotonic")
+		}
+	case metricTypeSum:
+	default:
+		return fmt.Errorf("otlp metric type %v not supported", c.Type)
+	}
+	return nil
+}
+
+func (c *metricConfig) metricName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Field
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"default": {
+			config: map[string]interface{}{},
+			valid:  true,
+		},
+		"http protocol": {
+			config: map[string]interface{}{"protocol": "http", "compression": "none"},
+			valid:  true,
+		},
+		"unknown protocol": {
+			config: map[string]interface{}{"protocol": "thrift"},
+		},
+		"unknown compression": {
+			config: map[string]interface{}{"compression": "zstd"},
+		},
+		"metrics": {
+			config: map[string]interface{}{
+				"metrics": []map[string]interface{}{
+					{"field": "system.cpu.total.pct", "unit": "1"},
+					{"field": "system.network.in.bytes", "type": "sum", "monotonic": true},
+				},
+			},
+			valid: true,
+		},
+		"metric without field": {
+			config: map[string]interface{}{
+				"metrics": []map[string]interface{}{{"name": "cpu"}},
+			},
+		},
+		"duplicate metric name": {
+			config: map[string]interface{}{
+				"metrics": []map[string]interface{}{
+					{"field": "a", "name": "value"},
+					{"field": "b", "name": "value"},
+				},
+			},
+		},
+		"monotonic gauge": {
+			config: map[string]interface{}{
+				"metrics": []map[string]interface{}{{"field": "a", "monotonic": true}},
+			},
+		},
+		"unknown metric type": {
+			config: map[string]interface{}{
+				"metrics": []map[string]interface{}{{"field": "a", "type": "histogram"}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := config.NewConfigFrom(test.config)
+			require.NoError(t, err)
+
+			c := defaultConfig()
+			err = cfg.Unpack(&c)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
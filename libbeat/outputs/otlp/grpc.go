@@ -0,0 +1,184 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const defaultGRPCPort = "4317"
+
+type grpcSender struct {
+	target   string
+	creds    credentials.TransportCredentials
+	config   *otlpConfig
+	metadata metadata.MD
+
+	mu      sync.Mutex
+	conn    *grpc.ClientConn
+	logs    collogspb.LogsServiceClient
+	metrics colmetricspb.MetricsServiceClient
+}
+
+// newGRPCSender creates a sender for host, which is either host:port or a
+// URL. The http scheme disables TLS, https enables it even if no ssl
+// settings are configured.
+func newGRPCSender(host string, config *otlpConfig, tls *tlscommon.TLSConfig) (*grpcSender, error) {
+	target := host
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, err
+		}
+		switch u.Scheme {
+		case "http":
+			tls = nil
+		case "https":
+			if tls == nil {
+				tls = &tlscommon.TLSConfig{}
+			}
+		default:
+			return nil, fmt.Errorf("invalid otlp grpc url scheme %s", u.Scheme)
+		}
+		target = u.Host
+	}
+	if target == "" {
+		return nil, fmt.Errorf("invalid otlp grpc host %q", host)
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, defaultGRPCPort)
+	}
+
+	creds := insecure.NewCredentials()
+	if tls != nil {
+		serverName, _, _ := net.SplitHostPort(target)
+		creds = credentials.NewTLS(tls.BuildModuleClientConfig(serverName))
+	}
+
+	return &grpcSender{
+		target:   target,
+		creds:    creds,
+		config:   config,
+		metadata: metadata.New(config.Headers),
+	}, nil
+}
+
+func (s *grpcSender) connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		return nil
+	}
+
+	var callOpts []grpc.CallOption
+	if s.config.useGzip() {
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+	conn, err := grpc.NewClient(s.target,
+		grpc.WithTransportCredentials(s.creds),
+		grpc.WithDefaultCallOptions(callOpts...),
+	)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.logs = collogspb.NewLogsServiceClient(conn)
+	s.metrics = colmetricspb.NewMetricsServiceClient(conn)
+	return nil
+}
+
+func (s *grpcSender) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.logs, s.metrics = nil, nil, nil
+	return err
+}
+
+func (s *grpcSender) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	resp, err := s.logs.Export(ctx, req)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+	return resp.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (s *grpcSender) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	resp, err := s.metrics.Export(ctx, req)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+	return resp.GetPartialSuccess().GetRejectedDataPoints(), nil
+}
+
+func (s *grpcSender) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if len(s.metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, s.metadata)
+	}
+	if timeout := s.config.Transport.Timeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (s *grpcSender) String() string {
+	return "grpc://" + s.target
+}
+
+// grpcError marks errors with status codes the OTLP specification does
+// not list as retryable as permanent.
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return err
+	}
+	return &permanentError{err: err}
+}
@@ -0,0 +1,180 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	defaultHTTPPort = 4318
+
+	contentTypeProtobuf = "application/x-protobuf"
+
+	// Limit how much of an error response is read into error messages.
+	maxErrorBodySize = 1024
+)
+
+type httpSender struct {
+	client     *http.Client
+	base       string
+	logsURL    string
+	metricsURL string
+	config     *otlpConfig
+}
+
+// httpStatusError is returned for unsuccessful HTTP responses.
+type httpStatusError struct {
+	code int
+	body string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected HTTP status %d", e.code)
+	}
+	return fmt.Sprintf("unexpected HTTP status %d: %s", e.code, e.body)
+}
+
+// newHTTPSender creates a sender for host, which is either host:port or a
+// URL. Hosts without a scheme use https if ssl settings are configured.
+func newHTTPSender(host string, config *otlpConfig, client *http.Client, tls *tlscommon.TLSConfig) (*httpSender, error) {
+	scheme := "http"
+	if tls != nil {
+		scheme = "https"
+	}
+	base, err := common.MakeURL(scheme, "", host, defaultHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	return &httpSender{
+		client:     client,
+		base:       base,
+		logsURL:    base + config.LogsPath,
+		metricsURL: base + config.MetricsPath,
+		config:     config,
+	}, nil
+}
+
+func (s *httpSender) connect() error {
+	return nil
+}
+
+func (s *httpSender) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *httpSender) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	var resp collogspb.ExportLogsServiceResponse
+	if err := s.export(ctx, s.logsURL, req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (s *httpSender) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	var resp colmetricspb.ExportMetricsServiceResponse
+	if err := s.export(ctx, s.metricsURL, req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.GetPartialSuccess().GetRejectedDataPoints(), nil
+}
+
+func (s *httpSender) export(ctx context.Context, url string, req, resp proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to encode request: %w", err)}
+	}
+
+	if s.config.useGzip() {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for k, v := range s.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", contentTypeProtobuf)
+	if s.config.useGzip() {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBodySize))
+		return httpError(&httpStatusError{code: httpResp.StatusCode, body: string(msg)})
+	}
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	// The request was accepted. Responses that can't be decoded carry no
+	// partial success information, so all records count as accepted.
+	if httpResp.Header.Get("Content-Type") == contentTypeProtobuf {
+		_ = proto.Unmarshal(data, resp)
+	}
+	return nil
+}
+
+func (s *httpSender) String() string {
+	return s.base
+}
+
+// httpError marks responses with status codes the OTLP specification does
+// not list as retryable as permanent.
+func httpError(err *httpStatusError) error {
+	switch err.code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	return &permanentError{err: err}
+}
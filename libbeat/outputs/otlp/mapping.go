@@ -0,0 +1,418 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Event fields that are mapped to dedicated log record fields, and so are
+// not added as attributes.
+const (
+	messageField  = "message"
+	logLevelField = "log.level"
+	traceIDField  = "trace.id"
+	spanIDField   = "span.id"
+)
+
+// mapper converts beat events into OTLP export requests.
+type mapper struct {
+	scope          *commonpb.InstrumentationScope
+	defaultService string
+	resourceFields []string
+	metrics        []metricConfig
+}
+
+// exportRequests holds the OTLP requests for a batch of events, along
+// with the events mapped into each.
+type exportRequests struct {
+	logs      *collogspb.ExportLogsServiceRequest
+	logEvents []publisher.Event
+
+	metrics      *colmetricspb.ExportMetricsServiceRequest
+	metricEvents []publisher.Event
+}
+
+func newMapper(info beat.Info, config *otlpConfig) *mapper {
+	return &mapper{
+		scope: &commonpb.InstrumentationScope{
+			Name:    info.Beat,
+			Version: info.Version,
+		},
+		defaultService: "unknown_service:" + info.Beat,
+		resourceFields: config.ResourceFields,
+		metrics:        config.Metrics,
+	}
+}
+
+// mapEvents converts events into OTLP requests. Events with at least one
+// configured metric field are converted to metrics, all others to log
+// records. Events sharing the same resource attributes are grouped under
+// a single resource. A request is nil if no event was mapped to it.
+func (m *mapper) mapEvents(events []publisher.Event) exportRequests {
+	var requests exportRequests
+	logResources := resourceGroups[*logspb.ResourceLogs]{}
+	metricResources := resourceGroups[*metricResource]{}
+	observed := uint64(time.Now().UnixNano())
+
+	for i := range events {
+		event := &events[i].Content
+		resource := m.resource(event)
+
+		if points := m.dataPoints(event); len(points) > 0 {
+			rm := metricResources.get(resource, func() *metricResource {
+				return newMetricResource(resource, m.scope)
+			})
+			for _, p := range points {
+				rm.add(p.config, p.point)
+			}
+			requests.metricEvents = append(requests.metricEvents, events[i])
+			continue
+		}
+
+		rl := logResources.get(resource, func() *logspb.ResourceLogs {
+			return &logspb.ResourceLogs{
+				Resource:  resource.proto(),
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: m.scope}},
+			}
+		})
+		scopeLogs := rl.ScopeLogs[0]
+		scopeLogs.LogRecords = append(scopeLogs.LogRecords, m.logRecord(event, observed))
+		requests.logEvents = append(requests.logEvents, events[i])
+	}
+
+	if len(requests.logEvents) > 0 {
+		requests.logs = &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: logResources.values,
+		}
+	}
+	if len(requests.metricEvents) > 0 {
+		resourceMetrics := make([]*metricspb.ResourceMetrics, len(metricResources.values))
+		for i, rm := range metricResources.values {
+			resourceMetrics[i] = rm.proto
+		}
+		requests.metrics = &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: resourceMetrics,
+		}
+	}
+	return requests
+}
+
+func (m *mapper) logRecord(event *beat.Event, observed uint64) *logspb.LogRecord {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(event.Timestamp.UnixNano()),
+		ObservedTimeUnixNano: observed,
+	}
+
+	flat := event.Fields.Flatten()
+	for _, field := range m.resourceFields {
+		delete(flat, field)
+	}
+
+	if msg, ok := flat[messageField]; ok {
+		record.Body = anyValue(msg)
+		delete(flat, messageField)
+	}
+	if level, ok := flat[logLevelField].(string); ok {
+		record.SeverityText = level
+		record.SeverityNumber = severityNumber(level)
+		delete(flat, logLevelField)
+	}
+	if id, ok := hexID(flat[traceIDField], 16); ok {
+		record.TraceId = id
+		delete(flat, traceIDField)
+	}
+	if id, ok := hexID(flat[spanIDField], 8); ok {
+		record.SpanId = id
+		delete(flat, spanIDField)
+	}
+
+	record.Attributes = keyValues(flat)
+	return record
+}
+
+type mappedDataPoint struct {
+	config *metricConfig
+	point  *metricspb.NumberDataPoint
+}
+
+// dataPoints returns a data point for every configured metric whose field
+// holds a number in the event.
+func (m *mapper) dataPoints(event *beat.Event) []mappedDataPoint {
+	var points []mappedDataPoint
+	for i := range m.metrics {
+		config := &m.metrics[i]
+		raw, err := event.Fields.GetValue(config.Field)
+		if err != nil {
+			continue
+		}
+		point := &metricspb.NumberDataPoint{
+			TimeUnixNano: uint64(event.Timestamp.UnixNano()),
+		}
+		switch v := numberValue(raw).(type) {
+		case int64:
+			point.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			point.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+		default:
+			continue
+		}
+
+		attrs := mapstr.M{}
+		for _, field := range config.Attributes {
+			if v, err := event.Fields.GetValue(field); err == nil {
+				attrs[field] = v
+			}
+		}
+		point.Attributes = keyValues(attrs)
+		points = append(points, mappedDataPoint{config: config, point: point})
+	}
+	return points
+}
+
+// resourceAttrs holds the resource attributes of an event, and a key that
+// identifies events with the same attributes.
+type resourceAttrs struct {
+	key   string
+	attrs []*commonpb.KeyValue
+}
+
+func (m *mapper) resource(event *beat.Event) resourceAttrs {
+	fields := mapstr.M{}
+	for _, field := range m.resourceFields {
+		if v, err := event.Fields.GetValue(field); err == nil {
+			fields[field] = v
+		}
+	}
+	if _, ok := fields["service.name"]; !ok {
+		// Every OTLP resource should have a service name.
+		fields["service.name"] = m.defaultService
+	}
+
+	attrs := keyValues(fields)
+	var key strings.Builder
+	for _, kv := range attrs {
+		fmt.Fprintf(&key, "%s=%v;", kv.Key, kv.Value)
+	}
+	return resourceAttrs{key: key.String(), attrs: attrs}
+}
+
+func (r resourceAttrs) proto() *resourcepb.Resource {
+	return &resourcepb.Resource{Attributes: r.attrs}
+}
+
+// resourceGroups collects per-resource values in the order the resources
+// were first seen.
+type resourceGroups[T any] struct {
+	index  map[string]int
+	values []T
+}
+
+func (g *resourceGroups[T]) get(r resourceAttrs, create func() T) T {
+	if i, ok := g.index[r.key]; ok {
+		return g.values[i]
+	}
+	if g.index == nil {
+		g.index = map[string]int{}
+	}
+	v := create()
+	g.index[r.key] = len(g.values)
+	g.values = append(g.values, v)
+	return v
+}
+
+// metricResource collects the data points of one resource, merging points
+// for the same metric into a single Metric message.
+type metricResource struct {
+	proto   *metricspb.ResourceMetrics
+	metrics map[string]*metricspb.Metric
+}
+
+func newMetricResource(resource resourceAttrs, scope *commonpb.InstrumentationScope) *metricResource {
+	return &metricResource{
+		proto: &metricspb.ResourceMetrics{
+			Resource:     resource.proto(),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: scope}},
+		},
+		metrics: map[string]*metricspb.Metric{},
+	}
+}
+
+func (r *metricResource) add(config *metricConfig, point *metricspb.NumberDataPoint) {
+	name := config.metricName()
+	metric, ok := r.metrics[name]
+	if !ok {
+		metric = &metricspb.Metric{
+			Name:        name,
+			Description: config.Description,
+			Unit:        config.Unit,
+		}
+		if config.Type == metricTypeSum {
+			metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            config.Monotonic,
+			}}
+		} else {
+			metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+		}
+		r.metrics[name] = metric
+		scopeMetrics := r.proto.ScopeMetrics[0]
+		scopeMetrics.Metrics = append(scopeMetrics.Metrics, metric)
+	}
+
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Sum:
+		data.Sum.DataPoints = append(data.Sum.DataPoints, point)
+	case *metricspb.Metric_Gauge:
+		data.Gauge.DataPoints = append(data.Gauge.DataPoints, point)
+	}
+}
+
+// severityNumber maps common log level names to OTLP severity numbers.
+func severityNumber(level string) logspb.SeverityNumber {
+	switch strings.ToLower(level) {
+	case "trace":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case "debug":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case "info", "informational", "notice":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case "warn", "warning":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case "error", "err":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "critical", "crit", "alert", "fatal", "emergency", "emerg":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
+
+// hexID decodes a hex encoded trace or span ID of the given byte length.
+func hexID(v interface{}, size int) ([]byte, bool) {
+	s, ok := v.(string)
+	if !ok || len(s) != 2*size {
+		return nil, false
+	}
+	id, err := hex.DecodeString(s)
+	return id, err == nil
+}
+
+// keyValues converts a map into OTLP attributes, sorted by key.
+func keyValues(m map[string]interface{}) []*commonpb.KeyValue {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]*commonpb.KeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i] = &commonpb.KeyValue{Key: k, Value: anyValue(m[k])}
+	}
+	return kvs
+}
+
+// numberValue returns v as an int64 or float64, or nil if it isn't a number.
+func numberValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= 1<<63-1 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return nil
+}
+
+// anyValue converts an event field value into an OTLP value.
+func anyValue(v interface{}) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.UTC().Format(time.RFC3339Nano)}}
+	case mapstr.M:
+		return kvListValue(v)
+	case map[string]interface{}:
+		return kvListValue(v)
+	case fmt.Stringer:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+	}
+
+	switch n := numberValue(v).(type) {
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: n}}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]*commonpb.AnyValue, rv.Len())
+		for i := range values {
+			values[i] = anyValue(rv.Index(i).Interface())
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{
+			ArrayValue: &commonpb.ArrayValue{Values: values},
+		}}
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return &commonpb.AnyValue{}
+		}
+		return anyValue(rv.Elem().Interface())
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+}
+
+func kvListValue(m map[string]interface{}) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{
+		KvlistValue: &commonpb.KeyValueList{Values: keyValues(m)},
+	}}
+}
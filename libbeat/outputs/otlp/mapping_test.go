@@ -0,0 +1,180 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var testInfo = beat.Info{Beat: "testbeat", Version: "9.9.9"}
+
+func testEvents(fields ...mapstr.M) []publisher.Event {
+	events := make([]publisher.Event, len(fields))
+	for i, f := range fields {
+		events[i] = publisher.Event{Content: beat.Event{
+			Timestamp: time.Unix(1700000000, int64(i)),
+			Fields:    f,
+		}}
+	}
+	return events
+}
+
+func attrMap(kvs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	m := map[string]*commonpb.AnyValue{}
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestMapLogs(t *testing.T) {
+	config := defaultConfig()
+	m := newMapper(testInfo, &config)
+
+	requests := m.mapEvents(testEvents(
+		mapstr.M{
+			"message": "hello",
+			"log":     mapstr.M{"level": "WARNING"},
+			"service": mapstr.M{"name": "checkout"},
+			"trace":   mapstr.M{"id": "0102030405060708090a0b0c0d0e0f10"},
+			"span":    mapstr.M{"id": "not-a-span-id"},
+			"http":    mapstr.M{"response": mapstr.M{"status_code": 200}},
+			"tags":    []string{"a", "b"},
+		},
+		mapstr.M{"message": "second", "service": mapstr.M{"name": "checkout"}},
+		mapstr.M{"message": "other"},
+	))
+
+	assert.Nil(t, requests.metrics)
+	assert.Len(t, requests.logEvents, 3)
+	require.NotNil(t, requests.logs)
+	require.Len(t, requests.logs.ResourceLogs, 2)
+
+	checkout := requests.logs.ResourceLogs[0]
+	assert.Equal(t, "checkout", attrMap(checkout.Resource.Attributes)["service.name"].GetStringValue())
+	require.Len(t, checkout.ScopeLogs, 1)
+	assert.Equal(t, "testbeat", checkout.ScopeLogs[0].Scope.Name)
+	assert.Equal(t, "9.9.9", checkout.ScopeLogs[0].Scope.Version)
+	require.Len(t, checkout.ScopeLogs[0].LogRecords, 2)
+
+	record := checkout.ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, uint64(time.Unix(1700000000, 0).UnixNano()), record.TimeUnixNano)
+	assert.NotZero(t, record.ObservedTimeUnixNano)
+	assert.Equal(t, "hello", record.Body.GetStringValue())
+	assert.Equal(t, "WARNING", record.SeverityText)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, record.SeverityNumber)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, record.TraceId)
+	assert.Nil(t, record.SpanId)
+
+	attrs := attrMap(record.Attributes)
+	assert.Len(t, attrs, 3)
+	assert.Equal(t, int64(200), attrs["http.response.status_code"].GetIntValue())
+	assert.Equal(t, "not-a-span-id", attrs["span.id"].GetStringValue())
+	tags := attrs["tags"].GetArrayValue().GetValues()
+	require.Len(t, tags, 2)
+	assert.Equal(t, "b", tags[1].GetStringValue())
+
+	other := requests.logs.ResourceLogs[1]
+	assert.Equal(t, "unknown_service:testbeat", attrMap(other.Resource.Attributes)["service.name"].GetStringValue())
+	assert.Len(t, other.ScopeLogs[0].LogRecords, 1)
+}
+
+func TestMapMetrics(t *testing.T) {
+	config := defaultConfig()
+	config.Metrics = []metricConfig{
+		{Field: "system.cpu.total.pct", Name: "system.cpu.utilization", Unit: "1", Attributes: []string{"system.cpu.state"}},
+		{Field: "system.network.in.bytes", Type: metricTypeSum, Monotonic: true, Unit: "By"},
+	}
+	m := newMapper(testInfo, &config)
+
+	requests := m.mapEvents(testEvents(
+		mapstr.M{"system": mapstr.M{"cpu": mapstr.M{"total": mapstr.M{"pct": 0.5}, "state": "user"}}},
+		mapstr.M{"system": mapstr.M{"cpu": mapstr.M{"total": mapstr.M{"pct": 0.25}}}},
+		mapstr.M{"system": mapstr.M{"network": mapstr.M{"in": mapstr.M{"bytes": uint64(1024)}}}},
+		mapstr.M{"system": mapstr.M{"cpu": mapstr.M{"total": mapstr.M{"pct": "n/a"}}}},
+	))
+
+	assert.Len(t, requests.metricEvents, 3)
+	assert.Len(t, requests.logEvents, 1)
+	require.NotNil(t, requests.metrics)
+	require.Len(t, requests.metrics.ResourceMetrics, 1)
+
+	metrics := requests.metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 2)
+
+	cpu := metrics[0]
+	assert.Equal(t, "system.cpu.utilization", cpu.Name)
+	assert.Equal(t, "1", cpu.Unit)
+	points := cpu.GetGauge().GetDataPoints()
+	require.Len(t, points, 2)
+	assert.Equal(t, 0.5, points[0].GetAsDouble())
+	assert.Equal(t, "user", attrMap(points[0].Attributes)["system.cpu.state"].GetStringValue())
+	assert.Equal(t, 0.25, points[1].GetAsDouble())
+	assert.Empty(t, points[1].Attributes)
+
+	network := metrics[1]
+	assert.Equal(t, "system.network.in.bytes", network.Name)
+	sum := network.GetSum()
+	require.NotNil(t, sum)
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.AggregationTemporality)
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1024), sum.DataPoints[0].GetAsInt())
+}
+
+func TestAnyValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, "x", anyValue("x").GetStringValue())
+	assert.Equal(t, true, anyValue(true).GetBoolValue())
+	assert.Equal(t, int64(-3), anyValue(int8(-3)).GetIntValue())
+	assert.Equal(t, 1.5, anyValue(float32(1.5)).GetDoubleValue())
+	assert.Equal(t, []byte("raw"), anyValue([]byte("raw")).GetBytesValue())
+	assert.Equal(t, "2024-01-02T03:04:05Z", anyValue(ts).GetStringValue())
+	assert.Nil(t, anyValue(nil).Value)
+
+	kvs := anyValue(mapstr.M{"b": 1, "a": "x"}).GetKvlistValue().GetValues()
+	require.Len(t, kvs, 2)
+	assert.Equal(t, "a", kvs[0].Key)
+	assert.Equal(t, "b", kvs[1].Key)
+
+	values := anyValue([]interface{}{1, "two"}).GetArrayValue().GetValues()
+	require.Len(t, values, 2)
+	assert.Equal(t, int64(1), values[0].GetIntValue())
+	assert.Equal(t, "two", values[1].GetStringValue())
+}
+
+func TestSeverityNumber(t *testing.T) {
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_TRACE, severityNumber("trace"))
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG, severityNumber("DEBUG"))
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, severityNumber("info"))
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, severityNumber("err"))
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, severityNumber("critical"))
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, severityNumber("verbose"))
+}
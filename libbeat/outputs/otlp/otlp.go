@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := logp.NewLogger("otlp")
+
+	oConfig := defaultConfig()
+	if err := cfg.Unpack(&oConfig); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(oConfig.Transport.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	mapper := newMapper(beat, &oConfig)
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		var s sender
+		switch oConfig.Protocol {
+		case protocolGRPC:
+			s, err = newGRPCSender(host, &oConfig, tls)
+		case protocolHTTP:
+			httpClient, clientErr := oConfig.Transport.Client(
+				httpcommon.WithLogger(log),
+				httpcommon.WithIOStats(observer),
+			)
+			if clientErr != nil {
+				return outputs.Fail(clientErr)
+			}
+			s, err = newHTTPSender(host, &oConfig, httpClient, tls)
+		}
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		client := newClient(log, observer, mapper, s)
+		clients[i] = outputs.WithBackoff(client, oConfig.Backoff.Init, oConfig.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(oConfig.Queue, oConfig.LoadBalance, oConfig.BulkMaxSize, oConfig.MaxRetries, nil, clients)
+}
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -59,6 +60,14 @@ type client struct {
 	publish  publishFn
 	codec    codec.Codec
 	timeout  time.Duration
+	stream   streamConfig
+
+	// Names of stream.Fields in the order they are added to stream entries.
+	streamFieldNames []string
+
+	// Streams known to have the configured consumer group. Reset on
+	// every connect.
+	streamGroups map[string]bool
 }
 
 type redisDataType uint16
@@ -66,6 +75,7 @@ type redisDataType uint16
 const (
 	redisListType redisDataType = iota
 	redisChannelType
+	redisStreamType
 )
 
 func newClient(
@@ -74,8 +84,14 @@ func newClient(
 	timeout time.Duration,
 	pass string,
 	db int, key outil.Selector, dt redisDataType,
-	index string, codec codec.Codec,
+	index string, codec codec.Codec, stream streamConfig,
 ) *client {
+	streamFieldNames := make([]string, 0, len(stream.Fields))
+	for name := range stream.Fields {
+		streamFieldNames = append(streamFieldNames, name)
+	}
+	sort.Strings(streamFieldNames)
+
 	return &client{
 		log:      logp.NewLogger("redis"),
 		Client:   tc,
@@ -87,6 +103,9 @@ func newClient(
 		dataType: dt,
 		key:      key,
 		codec:    codec,
+		stream:   stream,
+
+		streamFieldNames: streamFieldNames,
 	}
 }
 
@@ -164,8 +183,11 @@ func (c *client) String() string {
 func (c *client) makePublish(
 	conn redis.Conn,
 ) (publishFn, error) {
-	if c.dataType == redisChannelType {
+	switch c.dataType {
+	case redisChannelType:
 		return c.makePublishPUBLISH(conn)
+	case redisStreamType:
+		return c.makePublishXADD(conn)
 	}
 	return c.makePublishRPUSH(conn)
 }
@@ -173,7 +195,7 @@ func (c *client) makePublish(
 func (c *client) makePublishRPUSH(conn redis.Conn) (publishFn, error) {
 	if !c.key.IsConst() {
 		// TODO: more clever bulk handling batching events with same key
-		return c.publishEventsPipeline(conn, "RPUSH"), nil
+		return c.publishEventsPipeline(conn, "RPUSH", keyValueArgs), nil
 	}
 
 	var major, minor int
@@ -214,11 +236,89 @@ func (c *client) makePublishRPUSH(conn redis.Conn) (publishFn, error) {
 	if multiValue {
 		return c.publishEventsBulk(conn, "RPUSH"), nil
 	}
-	return c.publishEventsPipeline(conn, "RPUSH"), nil
+	return c.publishEventsPipeline(conn, "RPUSH", keyValueArgs), nil
 }
 
 func (c *client) makePublishPUBLISH(conn redis.Conn) (publishFn, error) {
-	return c.publishEventsPipeline(conn, "PUBLISH"), nil
+	return c.publishEventsPipeline(conn, "PUBLISH", keyValueArgs), nil
+}
+
+func (c *client) makePublishXADD(conn redis.Conn) (publishFn, error) {
+	publish := c.publishEventsPipeline(conn, "XADD", c.streamArgs)
+	if c.stream.ConsumerGroup == "" {
+		return publish, nil
+	}
+
+	c.streamGroups = map[string]bool{}
+	return func(key outil.Selector, data []publisher.Event) ([]publisher.Event, error) {
+		if err := c.ensureStreamGroups(conn, key, data); err != nil {
+			return data, err
+		}
+		return publish(key, data)
+	}, nil
+}
+
+// commandArgsFn returns the arguments for publishing a serialized event
+// to the given key.
+type commandArgsFn func(key string, event *beat.Event, serialized interface{}) ([]interface{}, error)
+
+func keyValueArgs(key string, _ *beat.Event, serialized interface{}) ([]interface{}, error) {
+	return []interface{}{key, serialized}, nil
+}
+
+// streamArgs builds the XADD arguments for an event from the stream
+// settings.
+func (c *client) streamArgs(key string, event *beat.Event, serialized interface{}) ([]interface{}, error) {
+	args := make([]interface{}, 0, 6+2*len(c.streamFieldNames))
+	args = append(args, key)
+	switch {
+	case c.stream.MaxLen > 0:
+		args = append(args, "MAXLEN")
+		if c.stream.Approximate {
+			args = append(args, "~")
+		}
+		args = append(args, c.stream.MaxLen)
+	case c.stream.MaxAge > 0:
+		// Stream IDs start with the entry's Unix time in milliseconds.
+		args = append(args, "MINID")
+		if c.stream.Approximate {
+			args = append(args, "~")
+		}
+		args = append(args, time.Now().Add(-c.stream.MaxAge).UnixMilli())
+	}
+	args = append(args, "*", c.stream.Field, serialized)
+
+	for _, name := range c.streamFieldNames {
+		value, err := c.stream.Fields[name].Run(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format stream field %v: %w", name, err)
+		}
+		args = append(args, name, value)
+	}
+	return args, nil
+}
+
+// ensureStreamGroups creates the configured consumer group on every stream
+// the events will be added to that hasn't been seen on this connection yet.
+// Streams are created if they don't exist, so consumers can attach before
+// the first event arrives.
+func (c *client) ensureStreamGroups(conn redis.Conn, key outil.Selector, data []publisher.Event) error {
+	for i := range data {
+		// Events with invalid keys are dropped when publishing.
+		stream, err := key.Select(&data[i].Content)
+		if err != nil || c.streamGroups[stream] {
+			continue
+		}
+
+		_, err = conn.Do("XGROUP", "CREATE", stream, c.stream.ConsumerGroup, "$", "MKSTREAM")
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			c.log.Errorf("Failed to create consumer group %v on stream %v with: %+v",
+				c.stream.ConsumerGroup, stream, err)
+			return err
+		}
+		c.streamGroups[stream] = true
+	}
+	return nil
 }
 
 func (c *client) publishEventsBulk(conn redis.Conn, command string) publishFn {
@@ -250,7 +350,7 @@ func (c *client) publishEventsBulk(conn redis.Conn, command string) publishFn {
 	}
 }
 
-func (c *client) publishEventsPipeline(conn redis.Conn, command string) publishFn {
+func (c *client) publishEventsPipeline(conn redis.Conn, command string, makeArgs commandArgsFn) publishFn {
 	return func(key outil.Selector, data []publisher.Event) ([]publisher.Event, error) {
 		var okEvents []publisher.Event
 		serialized := make([]interface{}, 0, len(data))
@@ -270,8 +370,15 @@ func (c *client) publishEventsPipeline(conn redis.Conn, command string) publishF
 				continue
 			}
 
+			args, err := makeArgs(eventKey, &okEvents[i].Content, serializedEvent)
+			if err != nil {
+				c.log.Errorf("Failed to build %v arguments: %+v", command, err)
+				dropped++
+				continue
+			}
+
 			data = append(data, okEvents[i])
-			if err := conn.Send(command, eventKey, serializedEvent); err != nil {
+			if err := conn.Send(command, args...); err != nil {
 				c.log.Errorf("Failed to execute %v: %+v", command, err)
 				return okEvents, err
 			}
@@ -284,7 +391,7 @@ func (c *client) publishEventsPipeline(conn redis.Conn, command string) publishF
 
 		failed := data[:0]
 		var lastErr error
-		for i := range serialized {
+		for i := range data {
 			_, err := conn.Receive()
 			if err != nil {
 				if _, ok := err.(redis.Error); ok { //nolint:errorlint //this line checks against a type, not an instance of an error
@@ -302,7 +409,7 @@ func (c *client) publishEventsPipeline(conn redis.Conn, command string) publishF
 			}
 		}
 
-		c.observer.AckedEvents(len(okEvents) - len(failed))
+		c.observer.AckedEvents(len(data) - len(failed))
 		return failed, lastErr
 	}
 }
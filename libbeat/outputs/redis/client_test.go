@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// fakeConn records the commands sent to it and replies to each with the
+// next error from errs, or OK once errs is exhausted.
+type fakeConn struct {
+	commands [][]interface{}
+	errs     []error
+	received int
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Do(command string, args ...interface{}) (interface{}, error) {
+	if err := c.Send(command, args...); err != nil {
+		return nil, err
+	}
+	return c.Receive()
+}
+
+func (c *fakeConn) Send(command string, args ...interface{}) error {
+	c.commands = append(c.commands, append([]interface{}{command}, args...))
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	i := c.received
+	c.received++
+	if i < len(c.errs) && c.errs[i] != nil {
+		return nil, c.errs[i]
+	}
+	return "OK", nil
+}
+
+func newStreamTestClient(t *testing.T, key string, stream streamConfig) *client {
+	selector, err := buildKeySelector(config.MustNewConfigFrom(map[string]interface{}{"key": key}))
+	require.NoError(t, err)
+	enc := json.New("1.2.3", json.Config{})
+	return newClient(nil, outputs.NewNilObserver(), time.Second, "", 0,
+		selector, redisStreamType, "test", enc, stream)
+}
+
+func streamTestEvents(hosts ...string) []publisher.Event {
+	events := make([]publisher.Event, len(hosts))
+	for i, host := range hosts {
+		events[i] = publisher.Event{Content: beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"host": mapstr.M{"name": host}},
+		}}
+	}
+	return events
+}
+
+func TestPublishStream(t *testing.T) {
+	c := newStreamTestClient(t, "logs-%{[host.name]}", streamConfig{
+		Field:       "event",
+		MaxLen:      1000,
+		Approximate: true,
+		Fields: map[string]*fmtstr.EventFormatString{
+			"host": fmtstr.MustCompileEvent("%{[host.name]}"),
+		},
+	})
+	conn := &fakeConn{}
+	publish, err := c.makePublish(conn)
+	require.NoError(t, err)
+
+	rest, err := publish(c.key, streamTestEvents("a", "b"))
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	require.Len(t, conn.commands, 2)
+	for i, stream := range []string{"logs-a", "logs-b"} {
+		cmd := conn.commands[i]
+		require.Len(t, cmd, 10)
+		assert.Equal(t, []interface{}{"XADD", stream, "MAXLEN", "~", int64(1000), "*", "event"}, cmd[:7])
+		assert.Contains(t, string(cmd[7].([]byte)), `"host":{"name":"`)
+		assert.Equal(t, []interface{}{"host", stream[len("logs-"):]}, cmd[8:])
+	}
+}
+
+func TestPublishStreamMaxAge(t *testing.T) {
+	c := newStreamTestClient(t, "logs", streamConfig{
+		Field:  "event",
+		MaxAge: time.Hour,
+	})
+	conn := &fakeConn{}
+	publish, err := c.makePublish(conn)
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Hour).UnixMilli()
+	_, err = publish(c.key, streamTestEvents("a"))
+	require.NoError(t, err)
+
+	require.Len(t, conn.commands, 1)
+	cmd := conn.commands[0]
+	assert.Equal(t, []interface{}{"XADD", "logs", "MINID"}, cmd[:3])
+	assert.GreaterOrEqual(t, cmd[3].(int64), before)
+	assert.Equal(t, []interface{}{"*", "event"}, cmd[4:6])
+}
+
+func TestPublishStreamConsumerGroup(t *testing.T) {
+	c := newStreamTestClient(t, "logs-%{[host.name]}", streamConfig{
+		Field:         "event",
+		ConsumerGroup: "workers",
+	})
+	conn := &fakeConn{
+		// The group already exists on the second stream.
+		errs: []error{nil, redis.Error("BUSYGROUP Consumer Group name already exists")},
+	}
+	publish, err := c.makePublish(conn)
+	require.NoError(t, err)
+
+	_, err = publish(c.key, streamTestEvents("a", "b", "a"))
+	require.NoError(t, err)
+	_, err = publish(c.key, streamTestEvents("b"))
+	require.NoError(t, err)
+
+	var commands []string
+	for _, cmd := range conn.commands {
+		commands = append(commands, cmd[0].(string)+" "+cmd[1].(string))
+	}
+	assert.Equal(t, []string{
+		"XGROUP CREATE", "XGROUP CREATE",
+		"XADD logs-a", "XADD logs-b", "XADD logs-a",
+		"XADD logs-b",
+	}, commands)
+	assert.Equal(t, []interface{}{"XGROUP", "CREATE", "logs-a", "workers", "$", "MKSTREAM"}, conn.commands[0])
+}
+
+func TestPublishStreamRetry(t *testing.T) {
+	c := newStreamTestClient(t, "logs", streamConfig{Field: "event"})
+	conn := &fakeConn{
+		errs: []error{nil, redis.Error("OOM command not allowed")},
+	}
+	publish, err := c.makePublish(conn)
+	require.NoError(t, err)
+
+	events := streamTestEvents("a", "b", "c")
+	rest, err := publish(c.key, events)
+	assert.Error(t, err)
+	require.Len(t, rest, 1, "only the rejected event should be retried")
+	assert.Equal(t, "b", rest[0].Content.Fields["host"].(mapstr.M)["name"])
+}
+
+func TestPublishStreamDropsUnformattableFields(t *testing.T) {
+	c := newStreamTestClient(t, "logs", streamConfig{
+		Field: "event",
+		Fields: map[string]*fmtstr.EventFormatString{
+			"user": fmtstr.MustCompileEvent("%{[user.name]}"),
+		},
+	})
+	conn := &fakeConn{}
+	publish, err := c.makePublish(conn)
+	require.NoError(t, err)
+
+	events := streamTestEvents("a", "b")
+	events[1].Content.Fields["user"] = mapstr.M{"name": "alice"}
+	rest, err := publish(c.key, events)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	require.Len(t, conn.commands, 1)
+	assert.Equal(t, []interface{}{"user", "alice"}, conn.commands[0][5:])
+}
@@ -18,9 +18,11 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/transport"
@@ -40,10 +42,34 @@ type redisConfig struct {
 	Codec       codec.Config          `config:"codec"`
 	Db          int                   `config:"db"`
 	DataType    string                `config:"datatype"`
+	Stream      streamConfig          `config:"stream"`
 	Backoff     backoff               `config:"backoff"`
 	Queue       config.Namespace      `config:"queue"`
 }
 
+// streamConfig holds the settings used when datatype is "stream".
+type streamConfig struct {
+	// Field is the name of the stream entry field holding the encoded event.
+	Field string `config:"field"`
+
+	// Fields adds further fields to each stream entry, with values
+	// formatted from the event.
+	Fields map[string]*fmtstr.EventFormatString `config:"fields"`
+
+	// MaxLen trims the stream to about this many entries (XADD MAXLEN).
+	MaxLen int64 `config:"max_len" validate:"min=0"`
+
+	// MaxAge trims entries with IDs older than this (XADD MINID).
+	MaxAge time.Duration `config:"max_age" validate:"min=0"`
+
+	// Approximate lets Redis trim lazily, which is much more efficient.
+	Approximate bool `config:"approximate"`
+
+	// ConsumerGroup is created on each stream before events are added
+	// to it, if it doesn't exist yet.
+	ConsumerGroup string `config:"consumer_group"`
+}
+
 type backoff struct {
 	Init time.Duration
 	Max  time.Duration
@@ -58,6 +84,10 @@ var (
 		TLS:         nil,
 		Db:          0,
 		DataType:    "list",
+		Stream: streamConfig{
+			Field:       "event",
+			Approximate: true,
+		},
 		Backoff: backoff{
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
@@ -67,10 +97,23 @@ var (
 
 func (c *redisConfig) Validate() error {
 	switch c.DataType {
-	case "", "list", "channel":
+	case "", "list", "channel", "stream":
 	default:
 		return fmt.Errorf("redis data type %v not supported", c.DataType)
 	}
 
 	return nil
 }
+
+func (c *streamConfig) Validate() error {
+	if c.Field == "" {
+		return errors.New("redis stream field must not be empty")
+	}
+	if _, exists := c.Fields[c.Field]; exists {
+		return fmt.Errorf("redis stream field %v is already used for the encoded event", c.Field)
+	}
+	if c.MaxLen > 0 && c.MaxAge > 0 {
+		return errors.New("redis stream max_len and max_age can not be used together")
+	}
+	return nil
+}
@@ -19,8 +19,11 @@ package redis
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 )
 
 func TestValidate(t *testing.T) {
@@ -37,6 +40,29 @@ func TestValidate(t *testing.T) {
 		{"Invalid Datatype", redisConfig{Key: "test", DataType: "something"}, false},
 		{"List Datatype", redisConfig{Key: "test", DataType: "list"}, true},
 		{"Channel Datatype", redisConfig{Key: "test", DataType: "channel"}, true},
+		{"Stream Datatype", redisConfig{Key: "test", DataType: "stream"}, true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.Input.Validate() == nil, test.Valid, test.Name)
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Input streamConfig
+		Valid bool
+	}{
+		{"Default", defaultConfig.Stream, true},
+		{"No field", streamConfig{}, false},
+		{"Max length", streamConfig{Field: "event", MaxLen: 1000}, true},
+		{"Max age", streamConfig{Field: "event", MaxAge: time.Hour}, true},
+		{"Max length and age", streamConfig{Field: "event", MaxLen: 1000, MaxAge: time.Hour}, false},
+		{"Duplicate field", streamConfig{
+			Field:  "event",
+			Fields: map[string]*fmtstr.EventFormatString{"event": fmtstr.MustCompileEvent("x")},
+		}, false},
 	}
 
 	for _, test := range tests {
@@ -300,6 +300,67 @@ func testPublishChannel(t *testing.T, cfg map[string]interface{}) {
 	}
 }
 
+func TestPublishStreamTCP(t *testing.T) {
+	key := "test_publish_stream_tcp"
+	group := "test_group"
+	total := 100
+
+	conn, err := redis.Dial("tcp", getRedisAddr())
+	if err != nil {
+		t.Fatalf("redis.Dial failed %v", err)
+	}
+	defer conn.Close()
+	conn.Do("DEL", key)
+
+	out := newRedisTestingOutput(t, map[string]interface{}{
+		"hosts":    []string{getRedisAddr()},
+		"key":      key,
+		"datatype": "stream",
+		"stream": map[string]interface{}{
+			"max_len":        total,
+			"approximate":    false,
+			"consumer_group": group,
+			"fields": map[string]interface{}{
+				"test": "%{[@metadata.test]}",
+			},
+		},
+	})
+	err = sendTestEvents(out, 2, total)
+	assert.NoError(t, err)
+
+	// The stream is trimmed to the latest batch.
+	length, err := redis.Int(conn.Do("XLEN", key))
+	assert.NoError(t, err)
+	assert.Equal(t, total, length)
+
+	// The consumer group was created before the first event, so it
+	// sees every event that is still in the stream.
+	reply, err := redis.Values(conn.Do("XREADGROUP", "GROUP", group, "test-consumer",
+		"COUNT", total, "STREAMS", key, ">"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	streams, err := redis.Values(reply[0], nil)
+	assert.NoError(t, err)
+	entries, err := redis.Values(streams[1], nil)
+	assert.NoError(t, err)
+	assert.Len(t, entries, total)
+
+	for i, entry := range entries {
+		parts, err := redis.Values(entry, nil)
+		assert.NoError(t, err)
+		fields, err := redis.StringMap(parts[1], nil)
+		assert.NoError(t, err)
+		assert.Equal(t, testMetaValue, fields["test"])
+
+		evt := struct{ Message int }{}
+		err = json.Unmarshal([]byte(fields["event"]), &evt)
+		assert.NoError(t, err)
+		assert.Equal(t, total+i+1, evt.Message)
+		validateMeta(t, []byte(fields["event"]))
+	}
+}
+
 func getEnv(name, or string) string {
 	if x := os.Getenv(name); x != "" {
 		return x
@@ -24,6 +24,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/spillqueue"
 	"github.com/elastic/elastic-agent-libs/config"
 )
 
@@ -54,6 +55,15 @@ func Success(cfg config.Namespace, batchSize, retry int, encoderFactory queue.En
 				return Group{}, fmt.Errorf("unable to get disk queue settings: %w", err)
 			}
 			q = diskqueue.FactoryForSettings(settings)
+		case spillqueue.QueueType:
+			if management.UnderAgent() {
+				return Group{}, fmt.Errorf("spill queue not supported under agent")
+			}
+			settings, err := spillqueue.SettingsForUserConfig(cfg.Config())
+			if err != nil {
+				return Group{}, fmt.Errorf("unable to get spill queue settings: %w", err)
+			}
+			q = spillqueue.FactoryForSettings(settings)
 		default:
 			return Group{}, fmt.Errorf("unknown queue type: %s", cfg.Name())
 		}
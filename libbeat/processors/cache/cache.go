@@ -109,6 +109,28 @@ func getStoreFor(cfg config, log *logp.Logger) (Store, context.CancelFunc, error
 	}
 }
 
+// NewStore returns the shared backing store configured by the backend
+// settings in cfg, for processors that keep their state in the cache
+// processor stores. Entries put in the store expire after ttl. It is an
+// error if the store was already configured with another ttl by a cache
+// put operation or another NewStore call. The returned context.CancelFunc
+// must be called when the store is no longer required.
+func NewStore(cfg *conf.C, ttl time.Duration, log *logp.Logger) (Store, context.CancelFunc, error) {
+	var store storeConfig
+	if err := cfg.Unpack(&store); err != nil {
+		return nil, noop, fmt.Errorf("failed to unpack the %s backend configuration: %w", name, err)
+	}
+	s, cancel, err := getStoreFor(config{Put: &putConfig{TTL: &ttl}, Store: &store}, log)
+	if err != nil {
+		return nil, cancel, err
+	}
+	if t, ok := s.(interface{ putTTL() time.Duration }); ok && t.putTTL() != ttl {
+		cancel()
+		return nil, noop, fmt.Errorf("%s store is already used with a ttl of %v", s, t.putTTL())
+	}
+	return s, cancel, nil
+}
+
 // noop is a no-op context.CancelFunc.
 func noop() {}
 
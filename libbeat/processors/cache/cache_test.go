@@ -20,6 +20,7 @@ package cache
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -623,3 +624,50 @@ func TestCache(t *testing.T) {
 		})
 	}
 }
+
+func TestNewStore(t *testing.T) {
+	cfg := conf.MustNewConfigFrom(mapstr.M{"memory.id": "new_store"})
+	store, cancel, err := NewStore(cfg, time.Hour, logp.L())
+	if err != nil {
+		t.Fatalf("unexpected error from NewStore: %v", err)
+	}
+	defer cancel()
+
+	// The store is shared with cache processors using the same ID.
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"backend": mapstr.M{"memory.id": "new_store"},
+		"get":     mapstr.M{"key_field": "key", "target_field": "value"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error from New: %v", err)
+	}
+	defer p.(*cache).Close()
+
+	if err := store.Put("k", "v"); err != nil {
+		t.Fatalf("unexpected error from Put: %v", err)
+	}
+	got, err := p.Run(&beat.Event{Fields: mapstr.M{"key": "k"}})
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	want := mapstr.M{"key": "k", "value": "v"}
+	if !cmp.Equal(want, got.Fields) {
+		t.Errorf("unexpected result\n--- want\n+++ got\n%s", cmp.Diff(want, got.Fields))
+	}
+
+	// Processors sharing the store must use the same ttl.
+	_, cancelSame, err := NewStore(cfg, time.Hour, logp.L())
+	if err != nil {
+		t.Fatalf("unexpected error from NewStore with the same ttl: %v", err)
+	}
+	cancelSame()
+	_, _, err = NewStore(cfg, time.Minute, logp.L())
+	if err == nil {
+		t.Error("expected error for mismatched ttl")
+	}
+
+	_, _, err = NewStore(conf.MustNewConfigFrom(mapstr.M{}), time.Hour, logp.L())
+	if err == nil {
+		t.Error("expected error for missing backend")
+	}
+}
@@ -130,6 +130,14 @@ func (c *memStore) add(cfg config) {
 	}
 }
 
+// putTTL returns the TTL of the entries put in the store. putTTL is safe for
+// concurrent use.
+func (c *memStore) putTTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
 // dropFrom decreases the reference count for the memStore and removes it from
 // the stores map if the count is zero. dropFrom is safe for concurrent use.
 func (c *memStore) dropFrom(stores *memStoreSet) {
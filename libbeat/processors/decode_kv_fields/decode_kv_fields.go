@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv_fields
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	"github.com/elastic/beats/v7/libbeat/reader/kv"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type decodeKVFields struct {
+	kvConfig
+	decoder *kv.Decoder
+}
+
+type kvConfig struct {
+	kv.Config     `config:",inline"`
+	Fields        []string `config:"fields" validate:"required"`
+	Target        string   `config:"target"`
+	IgnoreMissing bool     `config:"ignore_missing"`
+	OverwriteKeys bool     `config:"overwrite_keys"`
+	FailOnError   bool     `config:"fail_on_error"`
+}
+
+func defaultKVConfig() kvConfig {
+	return kvConfig{
+		Config:      kv.DefaultConfig(),
+		FailOnError: true,
+	}
+}
+
+func init() {
+	processors.RegisterPlugin("decode_kv_fields",
+		checks.ConfigChecked(NewDecodeKVFields,
+			checks.RequireFields("fields"),
+			checks.AllowedFields("fields", "target", "ignore_missing", "overwrite_keys", "fail_on_error",
+				"field_split", "value_split", "quote_chars", "bare_keys", "prefix", "include_keys", "exclude_keys", "types", "when")))
+
+	jsprocessor.RegisterPlugin("DecodeKVFields", NewDecodeKVFields)
+}
+
+// NewDecodeKVFields constructs a new decode_kv_fields processor.
+func NewDecodeKVFields(c *config.C) (beat.Processor, error) {
+	config := defaultKVConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the decode_kv_fields configuration: %w", err)
+	}
+
+	d, err := kv.NewDecoder(config.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &decodeKVFields{kvConfig: config, decoder: d}, nil
+}
+
+// Run applies the decode_kv_fields processor to an event.
+func (f *decodeKVFields) Run(event *beat.Event) (*beat.Event, error) {
+	var saved *beat.Event
+	if f.FailOnError {
+		saved = event.Clone()
+	}
+	for _, field := range f.Fields {
+		if err := f.decodeKVField(field, event); err != nil && f.FailOnError {
+			return saved, err
+		}
+	}
+	return event, nil
+}
+
+func (f *decodeKVFields) decodeKVField(field string, event *beat.Event) error {
+	data, err := event.GetValue(field)
+	if err != nil {
+		if f.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("could not fetch value for field %s: %w", field, err)
+	}
+
+	text, ok := data.(string)
+	if !ok {
+		return fmt.Errorf("field %s is not of string type", field)
+	}
+
+	fields, err := f.decoder.Decode(text)
+	if err != nil {
+		return fmt.Errorf("error decoding key/value pairs from field %s: %w", field, err)
+	}
+
+	prefix := ""
+	if f.Target != "" {
+		prefix = f.Target + "."
+	}
+	for key, value := range fields.Flatten() {
+		key = prefix + key
+		if !f.OverwriteKeys {
+			if _, err = event.GetValue(key); err == nil {
+				return fmt.Errorf("target field %s already has a value. Set the overwrite_keys flag or drop/rename the field first", key)
+			}
+		}
+		if _, err = event.PutValue(key, value); err != nil {
+			return fmt.Errorf("failed setting field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// String returns a string representation of this processor.
+func (f decodeKVFields) String() string {
+	json, _ := json.Marshal(f.kvConfig)
+	return "decode_kv_fields=" + string(json)
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv_fields
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecodeKVFields(t *testing.T) {
+	tests := map[string]struct {
+		config   mapstr.M
+		input    mapstr.M
+		expected mapstr.M
+		fail     bool
+	}{
+		"root target": {
+			config: mapstr.M{"fields": []string{"message"}},
+			input:  mapstr.M{"message": `level=info msg="user logged in" user.id=42`},
+			expected: mapstr.M{
+				"message": `level=info msg="user logged in" user.id=42`,
+				"level":   "info",
+				"msg":     "user logged in",
+				"user":    mapstr.M{"id": "42"},
+			},
+		},
+		"target and types": {
+			config: mapstr.M{
+				"fields": []string{"message"},
+				"target": "kv",
+				"types":  mapstr.M{"user.id": "long"},
+			},
+			input: mapstr.M{"message": `user.id=42`},
+			expected: mapstr.M{
+				"message": `user.id=42`,
+				"kv":      mapstr.M{"user": mapstr.M{"id": int64(42)}},
+			},
+		},
+		"multiple fields": {
+			config: mapstr.M{
+				"fields":      []string{"a", "b"},
+				"field_split": ";",
+				"value_split": ":",
+				"prefix":      "p_",
+			},
+			input: mapstr.M{"a": "x:1;y:2", "b": "z:3"},
+			expected: mapstr.M{
+				"a":   "x:1;y:2",
+				"b":   "z:3",
+				"p_x": "1",
+				"p_y": "2",
+				"p_z": "3",
+			},
+		},
+		"include and exclude keys": {
+			config: mapstr.M{
+				"fields":       []string{"message"},
+				"target":       "kv",
+				"include_keys": []string{"a", "b"},
+				"exclude_keys": []string{"b"},
+			},
+			input:    mapstr.M{"message": "a=1 b=2 c=3"},
+			expected: mapstr.M{"message": "a=1 b=2 c=3", "kv": mapstr.M{"a": "1"}},
+		},
+		"bare keys": {
+			config:   mapstr.M{"fields": []string{"message"}, "target": "kv", "bare_keys": true},
+			input:    mapstr.M{"message": "a=1 debug"},
+			expected: mapstr.M{"message": "a=1 debug", "kv": mapstr.M{"a": "1", "debug": true}},
+		},
+		"conflicting keys": {
+			config:   mapstr.M{"fields": []string{"message"}, "target": "kv"},
+			input:    mapstr.M{"message": "a=1 a.b=2"},
+			expected: mapstr.M{"message": "a=1 a.b=2"},
+			fail:     true,
+		},
+		"existing key": {
+			config:   mapstr.M{"fields": []string{"message"}},
+			input:    mapstr.M{"message": "a=1 b=2", "b": "old"},
+			expected: mapstr.M{"message": "a=1 b=2", "b": "old"},
+			fail:     true,
+		},
+		"overwrite keys": {
+			config:   mapstr.M{"fields": []string{"message"}, "overwrite_keys": true},
+			input:    mapstr.M{"message": "a=1 b=2", "b": "old"},
+			expected: mapstr.M{"message": "a=1 b=2", "a": "1", "b": "2"},
+		},
+		"decoding error": {
+			config:   mapstr.M{"fields": []string{"message"}},
+			input:    mapstr.M{"message": `a=1 b="2`},
+			expected: mapstr.M{"message": `a=1 b="2`},
+			fail:     true,
+		},
+		"decoding error without fail_on_error": {
+			config:   mapstr.M{"fields": []string{"message", "other"}, "fail_on_error": false},
+			input:    mapstr.M{"message": `a=1 b="2`, "other": "c=3"},
+			expected: mapstr.M{"message": `a=1 b="2`, "other": "c=3", "c": "3"},
+		},
+		"missing field": {
+			config:   mapstr.M{"fields": []string{"message"}},
+			input:    mapstr.M{"other": "a=1"},
+			expected: mapstr.M{"other": "a=1"},
+			fail:     true,
+		},
+		"ignore missing": {
+			config:   mapstr.M{"fields": []string{"message"}, "ignore_missing": true},
+			input:    mapstr.M{"other": "a=1"},
+			expected: mapstr.M{"other": "a=1"},
+		},
+		"not a string": {
+			config:   mapstr.M{"fields": []string{"message"}},
+			input:    mapstr.M{"message": 5},
+			expected: mapstr.M{"message": 5},
+			fail:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			processor, err := NewDecodeKVFields(cfg.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			result, err := processor.Run(&beat.Event{Fields: test.input})
+			if test.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, result.Fields)
+		})
+	}
+}
+
+func TestDecodeKVFieldsConfig(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"no fields":       {"target": "kv"},
+		"same separators": {"fields": []string{"message"}, "field_split": "=", "value_split": "="},
+		"invalid type":    {"fields": []string{"message"}, "types": mapstr.M{"a": "date"}},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewDecodeKVFields(cfg.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
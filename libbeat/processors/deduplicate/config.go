@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"fmt"
+	"time"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+type action string
+
+const (
+	actionDrop action = "drop"
+	actionTag  action = "tag"
+)
+
+func (a *action) Unpack(s string) error {
+	switch action(s) {
+	case actionDrop, actionTag:
+		*a = action(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid action %q, must be one of drop or tag", s)
+	}
+}
+
+type config struct {
+	// Fields are the fields whose values identify duplicate events.
+	Fields []string `config:"fields" validate:"required"`
+
+	// TTL is how long an event is remembered.
+	TTL time.Duration `config:"ttl" validate:"required,positive"`
+
+	// Backend is the cache processor store holding the fingerprints.
+	Backend *conf.C `config:"backend" validate:"required"`
+
+	// Action is what happens to duplicate events.
+	Action action `config:"action"`
+
+	// Tag is the tag added to duplicate events by the tag action.
+	Tag string `config:"tag"`
+
+	// IgnoreMissing passes events without any of the fields through.
+	IgnoreMissing bool `config:"ignore_missing"`
+}
+
+func defaultConfig() config {
+	return config{
+		Action:        actionDrop,
+		Tag:           "duplicate",
+		IgnoreMissing: true,
+	}
+}
@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/cache"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const processorName = "deduplicate"
+
+var (
+	// errNoFields is returned when the event doesn't contain any of the
+	// configured fields.
+	errNoFields = errors.New("none of the fields found in the event")
+
+	instanceID atomic.Uint32
+)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("fields", "ttl", "backend"),
+			checks.AllowedFields("fields", "ttl", "backend", "action", "tag", "ignore_missing", "when")))
+}
+
+type deduplicate struct {
+	config config
+	fields []string
+	store  cache.Store
+	cancel func()
+	log    *logp.Logger
+
+	// mu makes the look up and insertion of fingerprints atomic.
+	mu sync.Mutex
+}
+
+// New constructs a new deduplicate processor. The processor implements
+// `Close()` to release the store.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %s configuration: %w", processorName, err)
+	}
+	// Logging (each processor instance has a unique ID).
+	id := int(instanceID.Inc())
+	log := logp.NewLogger(processorName).With("instance_id", id)
+
+	store, cancel, err := cache.NewStore(config.Backend, config.TTL, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the store for %s: %w", processorName, err)
+	}
+
+	p := &deduplicate{
+		config: config,
+		// The fields must be sorted so that the fingerprint doesn't depend
+		// on the order of the configuration.
+		fields: common.MakeStringSet(config.Fields...).ToSlice(),
+		store:  store,
+		cancel: cancel,
+		log:    log,
+	}
+	p.log.Infow("initialized deduplicate processor", "details", p)
+	return p, nil
+}
+
+// Run drops or tags the event if an event with the same values was seen
+// within the TTL.
+func (p *deduplicate) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.fingerprint(event)
+	if err != nil {
+		if errors.Is(err, errNoFields) && p.config.IgnoreMissing {
+			return event, nil
+		}
+		return event, fmt.Errorf("error applying %s processor: %w", processorName, err)
+	}
+
+	duplicate, err := p.seen(key)
+	if err != nil {
+		return event, fmt.Errorf("error applying %s processor: %w", processorName, err)
+	}
+	if !duplicate {
+		return event, nil
+	}
+
+	p.log.Debugw("duplicate event", "backend_id", p.store, "key", key)
+	if p.config.Action == actionTag {
+		if err := mapstr.AddTags(event.Fields, []string{p.config.Tag}); err != nil {
+			return event, fmt.Errorf("error applying %s processor: %w", processorName, err)
+		}
+		return event, nil
+	}
+	return nil, nil
+}
+
+// seen reports whether key is in the store, and adds it otherwise. The
+// expiry of keys isn't extended by duplicates, so the window starts at the
+// first event.
+func (p *deduplicate) seen(key string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.store.Get(key)
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.Is(err, cache.ErrNoData):
+		return false, err
+	}
+	return false, p.store.Put(key, true)
+}
+
+// fingerprint returns the hex encoded SHA-256 hash of the configured fields.
+func (p *deduplicate) fingerprint(event *beat.Event) (string, error) {
+	h := sha256.New()
+	found := false
+	for _, k := range p.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			if errors.Is(err, mapstr.ErrKeyNotFound) {
+				continue
+			}
+			return "", err
+		}
+		found = true
+		if t, ok := v.(time.Time); ok {
+			// Ensure we consistently hash times in UTC.
+			v = t.UTC()
+		}
+		fmt.Fprintf(h, "|%v|%v", k, v)
+	}
+	if !found {
+		return "", errNoFields
+	}
+	_, _ = io.WriteString(h, "|")
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (p *deduplicate) Close() error {
+	p.cancel()
+	return nil
+}
+
+// String returns the processor representation formatted as a string
+func (p *deduplicate) String() string {
+	return fmt.Sprintf("%s=[store_id=%s, fields=%v, ttl=%v, action=%s, tag=%s, ignore_missing=%t]",
+		processorName, p.store, p.fields, p.config.TTL, p.config.Action, p.config.Tag, p.config.IgnoreMissing)
+}
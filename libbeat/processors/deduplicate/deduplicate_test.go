@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func TestDeduplicate(t *testing.T) {
+	type step struct {
+		input mapstr.M
+		want  mapstr.M // nil if the event is dropped
+	}
+	tests := map[string]struct {
+		config  mapstr.M
+		steps   []step
+		wantErr error
+	}{
+		"drop": {
+			config: mapstr.M{"fields": []string{"message", "host.name"}, "ttl": "1m"},
+			steps: []step{
+				{
+					input: mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}},
+					want:  mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}},
+				},
+				{input: mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}, "other": 1}},
+				{
+					input: mapstr.M{"message": "hello", "host": mapstr.M{"name": "b"}},
+					want:  mapstr.M{"message": "hello", "host": mapstr.M{"name": "b"}},
+				},
+				{input: mapstr.M{"message": "hello"}, want: mapstr.M{"message": "hello"}},
+				{input: mapstr.M{"message": "hello"}},
+			},
+		},
+		"tag": {
+			config: mapstr.M{"fields": []string{"event.id"}, "ttl": "1m", "action": "tag"},
+			steps: []step{
+				{
+					input: mapstr.M{"event": mapstr.M{"id": "1"}},
+					want:  mapstr.M{"event": mapstr.M{"id": "1"}},
+				},
+				{
+					input: mapstr.M{"event": mapstr.M{"id": "1"}, "tags": []string{"web"}},
+					want:  mapstr.M{"event": mapstr.M{"id": "1"}, "tags": []string{"web", "duplicate"}},
+				},
+			},
+		},
+		"ignore missing fields": {
+			config: mapstr.M{"fields": []string{"event.id"}, "ttl": "1m"},
+			steps: []step{
+				{input: mapstr.M{"message": "a"}, want: mapstr.M{"message": "a"}},
+				{input: mapstr.M{"message": "a"}, want: mapstr.M{"message": "a"}},
+			},
+		},
+		"missing fields": {
+			config:  mapstr.M{"fields": []string{"event.id"}, "ttl": "1m", "ignore_missing": false},
+			steps:   []step{{input: mapstr.M{"message": "a"}}},
+			wantErr: errNoFields,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.config["backend"] = mapstr.M{"memory.id": t.Name()}
+			p, err := New(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+			defer processors.Close(p)
+
+			for i, step := range test.steps {
+				event, err := p.Run(&beat.Event{Fields: step.input})
+				if test.wantErr != nil {
+					assert.ErrorIs(t, err, test.wantErr)
+					continue
+				}
+				require.NoError(t, err)
+				if step.want == nil {
+					assert.Nil(t, event, "event %d", i)
+					continue
+				}
+				require.NotNil(t, event, "event %d", i)
+				assert.Equal(t, step.want, event.Fields, "event %d", i)
+			}
+		})
+	}
+}
+
+func run(t *testing.T, p beat.Processor, fields mapstr.M) *beat.Event {
+	t.Helper()
+	event, err := p.Run(&beat.Event{Fields: fields})
+	require.NoError(t, err)
+	return event
+}
+
+func TestDeduplicateTTL(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":  []string{"event.id"},
+		"ttl":     "50ms",
+		"backend": mapstr.M{"memory.id": t.Name()},
+	}))
+	require.NoError(t, err)
+	defer processors.Close(p)
+
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "1"}}))
+	assert.Nil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "1"}}))
+	time.Sleep(100 * time.Millisecond)
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "1"}}))
+}
+
+func TestDeduplicateFileBackend(t *testing.T) {
+	defer func(p *paths.Path) { paths.Paths = p }(paths.Paths)
+	paths.Paths = paths.New()
+	require.NoError(t, paths.InitPaths(&paths.Path{Home: t.TempDir()}))
+
+	cfg := mapstr.M{
+		"fields":  []string{"event.id"},
+		"ttl":     "1h",
+		"backend": mapstr.M{"file.id": "dedup"},
+	}
+	p, err := New(conf.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "1"}}))
+	require.NoError(t, processors.Close(p))
+
+	// The fingerprints are written out when the processor is closed, and
+	// read back by a new processor.
+	p, err = New(conf.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	defer processors.Close(p)
+	assert.Nil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "1"}}))
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "2"}}))
+}
+
+func TestDeduplicateSharedStore(t *testing.T) {
+	cfg := mapstr.M{
+		"fields":  []string{"event.id"},
+		"ttl":     "1m",
+		"backend": mapstr.M{"memory.id": t.Name()},
+	}
+	first, err := New(conf.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	defer processors.Close(first)
+	second, err := New(conf.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	defer processors.Close(second)
+
+	// Processors sharing a store deduplicate events across each other.
+	assert.NotNil(t, run(t, first, mapstr.M{"event": mapstr.M{"id": "1"}}))
+	assert.Nil(t, run(t, second, mapstr.M{"event": mapstr.M{"id": "1"}}))
+
+	// They must use the same ttl.
+	cfg["ttl"] = "1h"
+	_, err = New(conf.MustNewConfigFrom(cfg))
+	assert.ErrorContains(t, err, "already used with a ttl of 1m0s")
+}
+
+func TestDeduplicateConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"all options": {
+			config: mapstr.M{
+				"fields":         []string{"event.id"},
+				"ttl":            "1m",
+				"backend":        mapstr.M{"memory.id": t.Name()},
+				"action":         "tag",
+				"tag":            "dup",
+				"ignore_missing": false,
+			},
+		},
+		"unknown option": {
+			config: mapstr.M{
+				"fields":     []string{"event.id"},
+				"ttl":        "1m",
+				"backend":    mapstr.M{"memory.id": t.Name()},
+				"extraneous": "field",
+			},
+			wantErr: "unexpected extraneous option in deduplicate",
+		},
+		"missing backend": {
+			config:  mapstr.M{"fields": []string{"a"}, "ttl": "1m"},
+			wantErr: "missing backend option",
+		},
+		"missing ttl": {
+			config:  mapstr.M{"fields": []string{"a"}, "backend": mapstr.M{"memory.id": "x"}},
+			wantErr: "missing ttl option",
+		},
+		"invalid backend": {
+			config:  mapstr.M{"fields": []string{"a"}, "ttl": "1m", "backend": mapstr.M{"redis.id": "x"}},
+			wantErr: "must specify one of backend.memory.id or backend.file.id",
+		},
+		"invalid action": {
+			config:  mapstr.M{"fields": []string{"a"}, "ttl": "1m", "backend": mapstr.M{"memory.id": "x"}, "action": "delete"},
+			wantErr: "delete",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := processors.New(processors.PluginConfig([]*conf.C{
+				conf.MustNewConfigFrom(mapstr.M{"deduplicate": test.config}),
+			}))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
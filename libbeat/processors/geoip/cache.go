@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type lookupCacheEntry struct {
+	result     *lookupResult
+	err        error
+	expiration time.Time
+}
+
+type lookupProvider interface {
+	lookupDatabases(ip net.IP) (*lookupResult, error)
+}
+
+type lookupCache struct {
+	provider   lookupProvider
+	expiration time.Duration
+
+	cap    int // cap is the maximum number of elements the cache will hold.
+	effort int // effort is the number of entries to examine during expired element eviction.
+
+	rwMutex sync.RWMutex // rwMutex protects the cache map.
+	cache   map[string]lookupCacheEntry
+}
+
+func newLookupCache(expiration time.Duration, cap, effort int, provider lookupProvider) *lookupCache {
+	return &lookupCache{
+		cache:      make(map[string]lookupCacheEntry),
+		expiration: expiration,
+		cap:        cap,
+		effort:     effort,
+		provider:   provider,
+	}
+}
+
+func (lc *lookupCache) getEntryUnlocked(key string) (entry lookupCacheEntry, valid bool) {
+	if entry, valid = lc.cache[key]; valid {
+		valid = entry.expiration.After(time.Now())
+	}
+	return entry, valid
+}
+
+func (lc *lookupCache) lookup(ip net.IP) (*lookupResult, error) {
+	key := string(ip.To16())
+
+	lc.rwMutex.RLock()
+	entry, valid := lc.getEntryUnlocked(key)
+	lc.rwMutex.RUnlock()
+
+	if !valid {
+		lc.rwMutex.Lock()
+		defer lc.rwMutex.Unlock()
+
+		lc.tryEvictExpired()
+		if len(lc.cache) >= lc.cap {
+			lc.evictRandomEntry()
+		}
+
+		// Make sure someone else didn't look up this address while we were
+		// waiting for the write lock
+		if entry, valid = lc.getEntryUnlocked(key); !valid {
+			entry.result, entry.err = lc.provider.lookupDatabases(ip)
+			entry.expiration = time.Now().Add(lc.expiration)
+			lc.cache[key] = entry
+		}
+	}
+	return entry.result, entry.err
+}
+
+// clear removes all entries from the cache.
+func (lc *lookupCache) clear() {
+	lc.rwMutex.Lock()
+	defer lc.rwMutex.Unlock()
+	lc.cache = make(map[string]lookupCacheEntry)
+}
+
+// tryEvictExpired implements a random sampling expired element cache
+// eviction policy.
+func (lc *lookupCache) tryEvictExpired() {
+	now := time.Now()
+	n := 0
+	for key, entry := range lc.cache {
+		if n >= lc.effort {
+			return
+		}
+		if now.After(entry.expiration) {
+			delete(lc.cache, key)
+		}
+		n++
+	}
+}
+
+// evictRandomEntry implements a random cache eviction policy.
+func (lc *lookupCache) evictRandomEntry() {
+	for key := range lc.cache {
+		delete(lc.cache, key)
+		return
+	}
+}
@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"time"
+)
+
+type config struct {
+	// Databases is the list of MaxMind database files (.mmdb) to load. City,
+	// Country and ASN databases are supported.
+	Databases []string `config:"databases" validate:"required"`
+
+	// Fields is the list of fields containing the IP addresses to enrich. The
+	// results are added next to each field, so source.ip is enriched into
+	// source.geo and source.as.
+	Fields []string `config:"fields"`
+
+	// OverwriteKeys allows the processor to overwrite existing geo and as fields.
+	OverwriteKeys bool `config:"overwrite_keys"`
+
+	// IgnoreFailure ignores fields which don't contain a valid IP address.
+	IgnoreFailure bool `config:"ignore_failure"`
+
+	// ReloadPeriod is how often the database files are checked for changes.
+	// Set to 0 to disable reloading.
+	ReloadPeriod time.Duration `config:"reload_period" validate:"min=0"`
+}
+
+func defaultConfig() config {
+	return config{
+		Fields:       []string{"source.ip", "destination.ip", "client.ip", "server.ip"},
+		ReloadPeriod: time.Minute,
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Fields) == 0 {
+		return errors.New("at least one field is required")
+	}
+	for _, f := range c.Fields {
+		if f == "" {
+			return errors.New("field names cannot be empty")
+		}
+	}
+	return nil
+}
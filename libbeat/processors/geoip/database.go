@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type databaseKind int
+
+const (
+	geoDatabase databaseKind = iota // City and Country databases.
+	asnDatabase                     // ASN databases.
+)
+
+func (k databaseKind) String() string {
+	if k == asnDatabase {
+		return "asn"
+	}
+	return "geo"
+}
+
+// database is an open MaxMind database file.
+type database struct {
+	path    string
+	kind    databaseKind
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+type geoRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Code  string            `maxminddb:"code"`
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+func openDatabase(path string) (*database, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	dbType := reader.Metadata.DatabaseType
+	var kind databaseKind
+	switch {
+	case strings.HasSuffix(dbType, "-City"), strings.HasSuffix(dbType, "-Country"):
+		kind = geoDatabase
+	case strings.HasSuffix(dbType, "-ASN"):
+		kind = asnDatabase
+	default:
+		reader.Close()
+		return nil, fmt.Errorf("unsupported database type %q in %s", dbType, path)
+	}
+
+	return &database{
+		path:    path,
+		kind:    kind,
+		reader:  reader,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+// changed reports whether the database file has been modified since it was
+// opened.
+func (db *database) changed() (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(db.modTime) || info.Size() != db.size, nil
+}
+
+// lookup returns the ECS fields for ip, or nil if the database has no record
+// for it.
+func (db *database) lookup(ip net.IP) (mapstr.M, error) {
+	switch db.kind {
+	case asnDatabase:
+		var record asnRecord
+		_, ok, err := db.reader.LookupNetwork(ip, &record)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return asnFields(record), nil
+	default:
+		var record geoRecord
+		_, ok, err := db.reader.LookupNetwork(ip, &record)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return geoFields(record), nil
+	}
+}
+
+func (db *database) close() error {
+	return db.reader.Close()
+}
+
+func geoFields(r geoRecord) mapstr.M {
+	geo := mapstr.M{}
+	putString(geo, "continent_code", r.Continent.Code)
+	putString(geo, "continent_name", r.Continent.Names["en"])
+	putString(geo, "country_iso_code", r.Country.ISOCode)
+	putString(geo, "country_name", r.Country.Names["en"])
+	if len(r.Subdivisions) > 0 {
+		region := r.Subdivisions[0]
+		if region.ISOCode != "" && r.Country.ISOCode != "" {
+			geo["region_iso_code"] = r.Country.ISOCode + "-" + region.ISOCode
+		}
+		putString(geo, "region_name", region.Names["en"])
+	}
+	putString(geo, "city_name", r.City.Names["en"])
+	putString(geo, "postal_code", r.Postal.Code)
+	putString(geo, "timezone", r.Location.TimeZone)
+	if r.Location.Latitude != nil && r.Location.Longitude != nil {
+		geo["location"] = mapstr.M{
+			"lat": *r.Location.Latitude,
+			"lon": *r.Location.Longitude,
+		}
+	}
+	if len(geo) == 0 {
+		return nil
+	}
+	return geo
+}
+
+func asnFields(r asnRecord) mapstr.M {
+	if r.Number == 0 && r.Organization == "" {
+		return nil
+	}
+	as := mapstr.M{}
+	if r.Number != 0 {
+		as["number"] = r.Number
+	}
+	if r.Organization != "" {
+		as["organization"] = mapstr.M{"name": r.Organization}
+	}
+	return as
+}
+
+func putString(m mapstr.M, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
@@ -0,0 +1,250 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	processorName       = "geoip"
+	cacheExpiration     = time.Minute * 10
+	cacheCapacity       = 10 << 10 // maximum number of lookup cache entries.
+	cacheEvictionEffort = 10       // number of entries to sample for expiry eviction.
+)
+
+func init() {
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("databases"),
+			checks.AllowedFields("databases", "fields", "overwrite_keys", "ignore_failure", "reload_period", "when")))
+	jsprocessor.RegisterPlugin("GeoIP", New)
+}
+
+type lookupResult struct {
+	geo mapstr.M
+	as  mapstr.M
+}
+
+type geoIP struct {
+	config config
+	log    *logp.Logger
+	cache  *lookupCache
+
+	mu        sync.RWMutex // mu protects databases and lastCheck.
+	databases []*database
+	lastCheck time.Time
+}
+
+// New constructs a new geoip processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	return newGeoIP(config)
+}
+
+func newGeoIP(config config) (*geoIP, error) {
+	p := &geoIP{
+		config:    config,
+		log:       logp.NewLogger(processorName),
+		lastCheck: time.Now(),
+	}
+	p.cache = newLookupCache(cacheExpiration, cacheCapacity, cacheEvictionEffort, p)
+
+	for _, path := range config.Databases {
+		db, err := openDatabase(path)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("%v processor: %w", processorName, err)
+		}
+		p.log.Debugf("Loaded %v database %v", db.kind, path)
+		p.databases = append(p.databases, db)
+	}
+	return p, nil
+}
+
+// Run enriches the configured IP fields with geo and AS information.
+func (p *geoIP) Run(event *beat.Event) (*beat.Event, error) {
+	p.reloadIfChanged()
+
+	for _, field := range p.config.Fields {
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		var ip net.IP
+		if s, ok := v.(string); ok {
+			ip = net.ParseIP(s)
+		}
+		if ip == nil {
+			if p.config.IgnoreFailure {
+				continue
+			}
+			return event, fmt.Errorf("field %v doesn't contain a valid IP address: %v", field, v)
+		}
+
+		result, err := p.lookup(ip)
+		if err != nil {
+			return event, fmt.Errorf("failed to look up %v: %w", ip, err)
+		}
+
+		var prefix string
+		if idx := strings.LastIndexByte(field, '.'); idx >= 0 {
+			prefix = field[:idx+1]
+		}
+		if err := p.put(event, prefix+"geo", result.geo); err != nil {
+			return event, err
+		}
+		if err := p.put(event, prefix+"as", result.as); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+func (p *geoIP) put(event *beat.Event, key string, fields mapstr.M) error {
+	if fields == nil {
+		return nil
+	}
+	if !p.config.OverwriteKeys {
+		if found, _ := event.Fields.HasKey(key); found {
+			return fmt.Errorf("target field %v already exists", key)
+		}
+	}
+	_, err := event.PutValue(key, fields.Clone())
+	return err
+}
+
+func (p *geoIP) lookup(ip net.IP) (*lookupResult, error) {
+	// Hold the read lock across the cache so that entries can't be added from
+	// databases that are being replaced.
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cache.lookup(ip)
+}
+
+// lookupDatabases implements lookupProvider. It must be called with mu held.
+func (p *geoIP) lookupDatabases(ip net.IP) (*lookupResult, error) {
+	var result lookupResult
+	for _, db := range p.databases {
+		fields, err := db.lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			continue
+		}
+		switch db.kind {
+		case asnDatabase:
+			if result.as == nil {
+				result.as = fields
+			}
+		default:
+			if result.geo == nil {
+				result.geo = fields
+			}
+		}
+	}
+	return &result, nil
+}
+
+// reloadIfChanged reopens the database files that changed on disk, at most
+// once per reload_period.
+func (p *geoIP) reloadIfChanged() {
+	period := p.config.ReloadPeriod
+	if period <= 0 {
+		return
+	}
+
+	p.mu.RLock()
+	due := time.Since(p.lastCheck) >= period
+	p.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.lastCheck) < period {
+		return
+	}
+	p.lastCheck = time.Now()
+
+	reloaded := false
+	for i, db := range p.databases {
+		changed, err := db.changed()
+		if err != nil {
+			p.log.Warnf("Failed to check database %v for changes: %v", db.path, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		newDB, err := openDatabase(db.path)
+		if err != nil {
+			p.log.Warnf("Failed to reload database %v, keeping the previous version: %v", db.path, err)
+			continue
+		}
+		if err := db.close(); err != nil {
+			p.log.Warnf("Failed to close database %v: %v", db.path, err)
+		}
+		p.databases[i] = newDB
+		reloaded = true
+		p.log.Infof("Reloaded %v database %v", newDB.kind, db.path)
+	}
+	if reloaded {
+		p.cache.clear()
+	}
+}
+
+// Close releases the database files.
+func (p *geoIP) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, db := range p.databases {
+		if err := db.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.databases = nil
+	return errors.Join(errs...)
+}
+
+func (p *geoIP) String() string {
+	return fmt.Sprintf("%v=[databases=%v, fields=%v, overwrite_keys=%v, ignore_failure=%v, reload_period=%v]",
+		processorName, p.config.Databases, p.config.Fields, p.config.OverwriteKeys,
+		p.config.IgnoreFailure, p.config.ReloadPeriod)
+}
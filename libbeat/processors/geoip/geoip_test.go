@@ -0,0 +1,273 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	cityTestDatabase = "../../../testing/environments/GeoLite2-City.mmdb"
+	asnTestDatabase  = "../../../testing/environments/GeoLite2-ASN.mmdb"
+)
+
+var (
+	linkopingGeo = mapstr.M{
+		"continent_code":   "EU",
+		"continent_name":   "Europe",
+		"country_iso_code": "SE",
+		"country_name":     "Sweden",
+		"region_iso_code":  "SE-E",
+		"region_name":      "Östergötland County",
+		"city_name":        "Linköping",
+		"timezone":         "Europe/Stockholm",
+		"location":         mapstr.M{"lat": 58.4167, "lon": 15.6167},
+	}
+	londonGeo = mapstr.M{
+		"continent_code":   "EU",
+		"continent_name":   "Europe",
+		"country_iso_code": "GB",
+		"country_name":     "United Kingdom",
+		"region_iso_code":  "GB-ENG",
+		"region_name":      "England",
+		"city_name":        "London",
+		"timezone":         "Europe/London",
+		"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+	}
+)
+
+func TestGeoIP(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		input   mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"city and asn databases": {
+			config: mapstr.M{"databases": []string{cityTestDatabase, asnTestDatabase}},
+			input: mapstr.M{
+				"source":      mapstr.M{"ip": "89.160.20.112"},
+				"destination": mapstr.M{"ip": "81.2.69.142"},
+				"client":      mapstr.M{"ip": "10.0.0.1"},
+			},
+			want: mapstr.M{
+				"source": mapstr.M{
+					"ip":  "89.160.20.112",
+					"geo": linkopingGeo,
+					"as": mapstr.M{
+						"number":       uint(29518),
+						"organization": mapstr.M{"name": "Bredband2 AB"},
+					},
+				},
+				"destination": mapstr.M{"ip": "81.2.69.142", "geo": londonGeo},
+				"client":      mapstr.M{"ip": "10.0.0.1"},
+			},
+		},
+		"custom fields": {
+			config: mapstr.M{
+				"databases": []string{asnTestDatabase},
+				"fields":    []string{"ip", "related.address"},
+			},
+			input: mapstr.M{
+				"ip":      "12.81.92.0",
+				"related": mapstr.M{"address": "89.160.20.112"},
+			},
+			want: mapstr.M{
+				"ip": "12.81.92.0",
+				"as": mapstr.M{
+					"number":       uint(7018),
+					"organization": mapstr.M{"name": "AT&T Services"},
+				},
+				"related": mapstr.M{
+					"address": "89.160.20.112",
+					"as": mapstr.M{
+						"number":       uint(29518),
+						"organization": mapstr.M{"name": "Bredband2 AB"},
+					},
+				},
+			},
+		},
+		"invalid ip": {
+			config:  mapstr.M{"databases": []string{cityTestDatabase}},
+			input:   mapstr.M{"source": mapstr.M{"ip": "not an ip"}},
+			wantErr: "doesn't contain a valid IP address",
+		},
+		"ignore_failure": {
+			config: mapstr.M{
+				"databases":      []string{cityTestDatabase},
+				"ignore_failure": true,
+			},
+			input: mapstr.M{
+				"source":      mapstr.M{"ip": "not an ip"},
+				"destination": mapstr.M{"ip": "81.2.69.142"},
+			},
+			want: mapstr.M{
+				"source":      mapstr.M{"ip": "not an ip"},
+				"destination": mapstr.M{"ip": "81.2.69.142", "geo": londonGeo},
+			},
+		},
+		"existing target": {
+			config: mapstr.M{"databases": []string{cityTestDatabase}},
+			input: mapstr.M{
+				"source": mapstr.M{"ip": "81.2.69.142", "geo": mapstr.M{"name": "office"}},
+			},
+			wantErr: "target field source.geo already exists",
+		},
+		"overwrite_keys": {
+			config: mapstr.M{
+				"databases":      []string{cityTestDatabase},
+				"overwrite_keys": true,
+			},
+			input: mapstr.M{
+				"source": mapstr.M{"ip": "81.2.69.142", "geo": mapstr.M{"name": "office"}},
+			},
+			want: mapstr.M{
+				"source": mapstr.M{"ip": "81.2.69.142", "geo": londonGeo},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+			defer processors.Close(p)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestGeoIPConfig(t *testing.T) {
+	unsupported := filepath.Join(t.TempDir(), "empty.mmdb")
+	require.NoError(t, os.WriteFile(unsupported, []byte("not a database"), 0o644))
+
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"all options": {
+			config: mapstr.M{
+				"databases":      []string{cityTestDatabase},
+				"fields":         []string{"source.ip"},
+				"overwrite_keys": true,
+				"ignore_failure": true,
+				"reload_period":  "1h",
+			},
+		},
+		"unknown option": {
+			config:  mapstr.M{"databases": []string{cityTestDatabase}, "extraneous": "field"},
+			wantErr: "unexpected extraneous option in geoip",
+		},
+		"missing databases": {
+			config:  mapstr.M{"fields": []string{"source.ip"}},
+			wantErr: "databases",
+		},
+		"unsupported database": {
+			config:  mapstr.M{"databases": []string{unsupported}},
+			wantErr: unsupported,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The processor is created through its registered constructor,
+			// which checks the allowed options.
+			p, err := processors.New(processors.PluginConfig([]*conf.C{
+				conf.MustNewConfigFrom(mapstr.M{"geoip": test.config}),
+			}))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
+
+func TestGeoIPReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoIP.mmdb")
+	copyFile(t, asnTestDatabase, path)
+
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"databases":     []string{path},
+		"reload_period": "1h",
+	}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*geoIP)
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "89.160.20.112"}}})
+	require.NoError(t, err)
+	found, _ := event.HasKey("source.as")
+	assert.True(t, found)
+
+	// Replace the database and pretend the reload period has elapsed.
+	tmp := path + ".tmp"
+	copyFile(t, cityTestDatabase, tmp)
+	require.NoError(t, os.Rename(tmp, path))
+	p.mu.Lock()
+	p.lastCheck = time.Now().Add(-2 * time.Hour)
+	p.mu.Unlock()
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "89.160.20.112"}}})
+	require.NoError(t, err)
+	found, _ = event.HasKey("source.as")
+	assert.False(t, found, "cached result from the previous database was used")
+	city, _ := event.GetValue("source.geo.city_name")
+	assert.Equal(t, "Linköping", city)
+}
+
+func TestLookupCache(t *testing.T) {
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{"databases": []string{cityTestDatabase}}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*geoIP)
+	p.cache.cap = 2
+
+	for _, ip := range []string{"81.2.69.142", "89.160.20.112", "175.16.199.0", "81.2.69.142"} {
+		_, err := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": ip}}})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(p.cache.cache), 2)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, data, 0o644))
+}
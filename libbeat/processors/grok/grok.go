@@ -0,0 +1,306 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed patterns
+var patternFiles embed.FS
+
+var (
+	// referenceRegexp matches pattern references in the %{NAME},
+	// %{NAME:field} and %{NAME:field:type} forms.
+	referenceRegexp = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::(\w+))?\}`)
+
+	// namedGroupRegexp matches named groups in both the Oniguruma (?<name>)
+	// and the Go (?P<name>) syntax.
+	namedGroupRegexp = regexp.MustCompile(`\(\?P?<([^>=!][^>]*)>`)
+
+	// errNoMatch is returned when none of the patterns match.
+	errNoMatch = errors.New("provided grok expressions do not match field value")
+
+	// defaultPatterns is the built-in pattern library.
+	defaultPatterns = mustLoadPatterns(patternFiles)
+)
+
+type dataType uint8
+
+const (
+	typeString dataType = iota
+	typeInt
+	typeLong
+	typeFloat
+	typeDouble
+	typeBoolean
+)
+
+var dataTypes = map[string]dataType{
+	"int":     typeInt,
+	"long":    typeLong,
+	"float":   typeFloat,
+	"double":  typeDouble,
+	"boolean": typeBoolean,
+}
+
+func (t dataType) convert(s string) (interface{}, error) {
+	switch t {
+	case typeInt:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case typeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case typeDouble:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// capture describes where a named group of a compiled pattern is stored.
+type capture struct {
+	field string
+	typ   dataType
+}
+
+type pattern struct {
+	re       *regexp.Regexp
+	captures []capture // indexed by subexpression number
+}
+
+// Grok matches text against an ordered list of grok expressions.
+type Grok struct {
+	patterns []pattern
+}
+
+// New compiles the given grok expressions. References to patterns are
+// resolved from definitions first, then from the built-in pattern library.
+func New(patterns []string, definitions map[string]string) (*Grok, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no grok patterns configured")
+	}
+
+	g := &Grok{}
+	for _, raw := range patterns {
+		p, err := compile(raw, definitions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile grok pattern '%s': %w", raw, err)
+		}
+		g.patterns = append(g.patterns, p)
+	}
+	return g, nil
+}
+
+// Match tries all patterns in order and returns the captures of the first
+// one that matches, keyed by field name.
+func (g *Grok) Match(text string) (map[string]interface{}, error) {
+	for i := range g.patterns {
+		fields, matched, err := g.patterns[i].match(text)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			return fields, nil
+		}
+	}
+	return nil, errNoMatch
+}
+
+func (p *pattern) match(text string) (map[string]interface{}, bool, error) {
+	loc := p.re.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return nil, false, nil
+	}
+
+	fields := map[string]interface{}{}
+	for i, c := range p.captures {
+		if c.field == "" {
+			continue
+		}
+		start, end := loc[2*i], loc[2*i+1]
+		if start < 0 || start == end {
+			// Group did not participate in the match or captured nothing.
+			continue
+		}
+		if _, found := fields[c.field]; found {
+			// The first non-empty capture wins for repeated field names.
+			continue
+		}
+		v, err := c.typ.convert(text[start:end])
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to convert field '%s': %w", c.field, err)
+		}
+		fields[c.field] = v
+	}
+	return fields, true, nil
+}
+
+type compiler struct {
+	definitions map[string]string
+	groups      map[string]capture
+}
+
+func compile(raw string, definitions map[string]string) (pattern, error) {
+	c := &compiler{
+		definitions: definitions,
+		groups:      map[string]capture{},
+	}
+	expanded, err := c.expand(raw, nil)
+	if err != nil {
+		return pattern{}, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return pattern{}, err
+	}
+
+	captures := make([]capture, re.NumSubexp()+1)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			captures[i] = c.groups[name]
+		}
+	}
+	return pattern{re: re, captures: captures}, nil
+}
+
+// expand replaces all pattern references and named groups in expr. Named
+// groups are renamed, so the same field can be captured more than once and
+// fields can use names that are not valid group names.
+func (c *compiler) expand(expr string, stack []string) (string, error) {
+	expr = namedGroupRegexp.ReplaceAllStringFunc(expr, func(group string) string {
+		field := namedGroupRegexp.FindStringSubmatch(group)[1]
+		return "(?P<" + c.addGroup(field, typeString) + ">"
+	})
+
+	var err error
+	expr = referenceRegexp.ReplaceAllStringFunc(expr, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := referenceRegexp.FindStringSubmatch(ref)
+		name, field, typeName := m[1], m[2], m[3]
+
+		for _, s := range stack {
+			if s == name {
+				err = fmt.Errorf("circular reference in pattern %%{%s}", name)
+				return ""
+			}
+		}
+
+		def, found := c.definitions[name]
+		if !found {
+			def, found = defaultPatterns[name]
+		}
+		if !found {
+			err = fmt.Errorf("pattern %%{%s} not defined", name)
+			return ""
+		}
+
+		typ := typeString
+		if typeName != "" {
+			if typ, found = dataTypes[typeName]; !found {
+				err = fmt.Errorf("unsupported type '%s' in %s", typeName, ref)
+				return ""
+			}
+		}
+
+		var expanded string
+		expanded, err = c.expand(def, append(stack, name))
+		if err != nil {
+			return ""
+		}
+		if field == "" {
+			return "(?:" + expanded + ")"
+		}
+		return "(?P<" + c.addGroup(field, typ) + ">" + expanded + ")"
+	})
+	return expr, err
+}
+
+func (c *compiler) addGroup(field string, typ dataType) string {
+	name := "g" + strconv.Itoa(len(c.groups))
+	c.groups[name] = capture{field: fieldName(field), typ: typ}
+	return name
+}
+
+// fieldName converts field references in the [a][b] form to the dotted form.
+func fieldName(field string) string {
+	if !strings.HasPrefix(field, "[") || !strings.HasSuffix(field, "]") {
+		return field
+	}
+	return strings.ReplaceAll(field[1:len(field)-1], "][", ".")
+}
+
+// loadPatterns reads all pattern files in fsys. Each line defines a pattern
+// as a name followed by whitespace and the pattern itself. Empty lines and
+// lines starting with # are ignored.
+func loadPatterns(fsys fs.FS) (map[string]string, error) {
+	files, err := fs.Glob(fsys, "patterns/*")
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := map[string]string{}
+	for _, file := range files {
+		f, err := fsys.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, def, found := strings.Cut(line, " ")
+			if !found {
+				f.Close()
+				return nil, fmt.Errorf("invalid pattern definition in %s: %s", file, line)
+			}
+			patterns[name] = strings.TrimSpace(def)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+func mustLoadPatterns(fsys fs.FS) map[string]string {
+	patterns, err := loadPatterns(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return patterns
+}
@@ -0,0 +1,182 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPatternsCompile(t *testing.T) {
+	require.NotEmpty(t, defaultPatterns)
+	for name := range defaultPatterns {
+		_, err := compile("%{"+name+"}", nil)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestGrokMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		patterns    []string
+		definitions map[string]string
+		text        string
+		want        map[string]interface{}
+	}{
+		{
+			name:     "simple",
+			patterns: []string{"%{IP:client} %{WORD:method} %{URIPATHPARAM:request}"},
+			text:     "55.3.244.1 GET /index.html?a=1",
+			want: map[string]interface{}{
+				"client":  "55.3.244.1",
+				"method":  "GET",
+				"request": "/index.html?a=1",
+			},
+		},
+		{
+			name:     "typed captures",
+			patterns: []string{"%{NUMBER:bytes:int} %{NUMBER:duration:double} %{NUMBER:id:long} %{NUMBER:ratio:float} %{WORD:ok:boolean}"},
+			text:     "15824 0.043 9007199254740993 0.5 true",
+			want: map[string]interface{}{
+				"bytes":    int32(15824),
+				"duration": 0.043,
+				"id":       int64(9007199254740993),
+				"ratio":    float32(0.5),
+				"ok":       true,
+			},
+		},
+		{
+			name:     "nested fields",
+			patterns: []string{"%{IP:source.ip}:%{POSINT:[source][port]:long}"},
+			text:     "10.0.0.1:8080",
+			want: map[string]interface{}{
+				"source.ip":   "10.0.0.1",
+				"source.port": int64(8080),
+			},
+		},
+		{
+			name:     "first matching pattern wins",
+			patterns: []string{"%{NUMBER:num}", "%{WORD:word}", "%{GREEDYDATA:all}"},
+			text:     "hello",
+			want:     map[string]interface{}{"word": "hello"},
+		},
+		{
+			name:        "custom definitions",
+			patterns:    []string{"%{LEVEL:level} %{ID:id}"},
+			definitions: map[string]string{"LEVEL": "(?:INFO|WARN)", "ID": "%{WORD}-%{INT}"},
+			text:        "WARN abc-123",
+			want:        map[string]interface{}{"level": "WARN", "id": "abc-123"},
+		},
+		{
+			name:        "definitions override library",
+			patterns:    []string{"%{WORD:w}"},
+			definitions: map[string]string{"WORD": "[a-z]+"},
+			text:        "ABC def",
+			want:        map[string]interface{}{"w": "def"},
+		},
+		{
+			name:     "named groups",
+			patterns: []string{`(?<user.name>\w+) (?P<id>\d+)`},
+			text:     "alice 42",
+			want:     map[string]interface{}{"user.name": "alice", "id": "42"},
+		},
+		{
+			name:     "optional captures are omitted",
+			patterns: []string{`%{WORD:a}(?: %{WORD:b})?`},
+			text:     "one",
+			want:     map[string]interface{}{"a": "one"},
+		},
+		{
+			name:     "repeated field uses participating capture",
+			patterns: []string{`%{HTTPD_ERRORLOG}`},
+			text:     "[Mon Aug 31 09:30:48.958285 2020] [proxy_fcgi:error] [pid 32128:tid 140010199639808] [client 1.1.1.1:8080] AH01071: Got error 'Primary script unknown'",
+			want: map[string]interface{}{
+				"timestamp":  "Mon Aug 31 09:30:48.958285 2020",
+				"module":     "proxy_fcgi",
+				"loglevel":   "error",
+				"pid":        "32128",
+				"tid":        "140010199639808",
+				"clientip":   "1.1.1.1",
+				"clientport": "8080",
+				"errorcode":  "AH01071",
+				"message":    "Got error 'Primary script unknown'",
+			},
+		},
+		{
+			name:     "syslog",
+			patterns: []string{`%{SYSLOGLINE}`},
+			text:     "Dec 23 14:30:01 localhost CRON[6517]: pam_unix(cron:session): session closed for user root",
+			want: map[string]interface{}{
+				"timestamp": "Dec 23 14:30:01",
+				"logsource": "localhost",
+				"program":   "CRON",
+				"pid":       "6517",
+				"message":   "pam_unix(cron:session): session closed for user root",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := New(test.patterns, test.definitions)
+			require.NoError(t, err)
+
+			fields, err := g.Match(test.text)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, fields)
+		})
+	}
+}
+
+func TestGrokNoMatch(t *testing.T) {
+	g, err := New([]string{"^%{IP:ip}$", "^%{NUMBER:n}$"}, nil)
+	require.NoError(t, err)
+
+	_, err = g.Match("not an address")
+	assert.ErrorIs(t, err, errNoMatch)
+}
+
+func TestGrokConversionError(t *testing.T) {
+	g, err := New([]string{"%{NUMBER:n:int}"}, nil)
+	require.NoError(t, err)
+
+	_, err = g.Match("1.5")
+	assert.Error(t, err)
+}
+
+func TestGrokCompileErrors(t *testing.T) {
+	tests := map[string]struct {
+		patterns    []string
+		definitions map[string]string
+	}{
+		"no patterns":        {},
+		"undefined pattern":  {patterns: []string{"%{DOES_NOT_EXIST:x}"}},
+		"unsupported type":   {patterns: []string{"%{NUMBER:x:decimal}"}},
+		"circular reference": {patterns: []string{"%{A}"}, definitions: map[string]string{"A": "a%{B}", "B": "b%{A}"}},
+		"invalid regexp":     {patterns: []string{"%{WORD:x}("}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(test.patterns, test.definitions)
+			assert.Error(t, err)
+		})
+	}
+}
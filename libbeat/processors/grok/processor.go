@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type processor struct {
+	config config
+	grok   *Grok
+}
+
+func init() {
+	processors.RegisterPlugin("grok", NewProcessor)
+	jsprocessor.RegisterPlugin("Grok", NewProcessor)
+}
+
+// NewProcessor constructs a new grok processor.
+func NewProcessor(c *cfg.C) (beat.Processor, error) {
+	config := defaultConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the grok configuration: %w", err)
+	}
+
+	g, err := New(config.Patterns, config.PatternDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	return &processor{config: config, grok: g}, nil
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return p.fail(event, fmt.Errorf("could not fetch value for field '%s': %w", p.config.Field, err))
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return p.fail(event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field))
+	}
+
+	fields, err := p.grok.Match(s)
+	if err != nil {
+		return p.fail(event, err)
+	}
+
+	backup := event.Clone()
+	if err := p.mapper(event, fields); err != nil {
+		return p.fail(backup, err)
+	}
+	return event, nil
+}
+
+func (p *processor) mapper(event *beat.Event, fields map[string]interface{}) error {
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	for k, v := range fields {
+		key := prefix + k
+		if _, err := event.GetValue(key); errors.Is(err, mapstr.ErrKeyNotFound) || p.config.OverwriteKeys {
+			if _, err := event.PutValue(key, v); err != nil {
+				return fmt.Errorf("cannot set key `%s`: %w", key, err)
+			}
+		} else {
+			// When the target key exists but is a string instead of a map.
+			if err != nil {
+				return fmt.Errorf("cannot override existing key with `%s`: %w", key, err)
+			}
+			return fmt.Errorf("cannot override existing key with `%s`", key)
+		}
+	}
+	return nil
+}
+
+// fail tags the event and returns err, unless ignore_failure is set.
+func (p *processor) fail(event *beat.Event, err error) (*beat.Event, error) {
+	if len(p.config.TagOnFailure) > 0 {
+		if tagErr := mapstr.AddTags(event.Fields, p.config.TagOnFailure); tagErr != nil {
+			return event, fmt.Errorf("cannot add tags to the event: %w", tagErr)
+		}
+	}
+	if p.config.IgnoreFailure {
+		return event, nil
+	}
+	return event, err
+}
+
+func (p *processor) String() string {
+	return "grok=[" + strings.Join(p.config.Patterns, ", ") + "]" +
+		",field=" + p.config.Field +
+		",target_prefix=" + p.config.TargetPrefix
+}
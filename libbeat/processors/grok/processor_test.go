@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       map[string]interface{}
+		fields  mapstr.M
+		want    mapstr.M
+		wantErr bool
+	}{
+		{
+			name:   "default field/target root",
+			c:      map[string]interface{}{"patterns": []string{"%{WORD:verb} %{NUMBER:status:int}"}},
+			fields: mapstr.M{"message": "GET 200"},
+			want:   mapstr.M{"message": "GET 200", "verb": "GET", "status": int32(200)},
+		},
+		{
+			name: "specific field/specific target",
+			c: map[string]interface{}{
+				"patterns":      []string{"%{IP:ip}"},
+				"field":         "raw",
+				"target_prefix": "parsed",
+			},
+			fields: mapstr.M{"raw": "10.1.1.1"},
+			want:   mapstr.M{"raw": "10.1.1.1", "parsed": mapstr.M{"ip": "10.1.1.1"}},
+		},
+		{
+			name: "pattern definitions",
+			c: map[string]interface{}{
+				"patterns":            []string{"%{NUMBER:code:long}", "%{STATUS:status}"},
+				"pattern_definitions": map[string]interface{}{"STATUS": "(?:up|down)"},
+			},
+			fields: mapstr.M{"message": "down"},
+			want:   mapstr.M{"message": "down", "status": "down"},
+		},
+		{
+			name: "overwrite keys",
+			c: map[string]interface{}{
+				"patterns":       []string{"%{WORD:message}"},
+				"overwrite_keys": true,
+			},
+			fields: mapstr.M{"message": "hello world"},
+			want:   mapstr.M{"message": "hello"},
+		},
+		{
+			name:    "existing key",
+			c:       map[string]interface{}{"patterns": []string{"%{WORD:message} %{WORD:other}"}},
+			fields:  mapstr.M{"message": "hello world"},
+			want:    mapstr.M{"message": "hello world", "tags": []string{"_grokparsefailure"}},
+			wantErr: true,
+		},
+		{
+			name:    "no match",
+			c:       map[string]interface{}{"patterns": []string{"^%{NUMBER:n}$"}},
+			fields:  mapstr.M{"message": "hello", "tags": []string{"foo"}},
+			want:    mapstr.M{"message": "hello", "tags": []string{"foo", "_grokparsefailure"}},
+			wantErr: true,
+		},
+		{
+			name: "no match/custom tags ignore failure",
+			c: map[string]interface{}{
+				"patterns":       []string{"^%{NUMBER:n}$"},
+				"tag_on_failure": []string{"_nonumber"},
+				"ignore_failure": true,
+			},
+			fields: mapstr.M{"message": "hello"},
+			want:   mapstr.M{"message": "hello", "tags": []string{"_nonumber"}},
+		},
+		{
+			name:    "conversion error",
+			c:       map[string]interface{}{"patterns": []string{"%{NOTSPACE:n:int}"}},
+			fields:  mapstr.M{"message": "abc"},
+			want:    mapstr.M{"message": "abc", "tags": []string{"_grokparsefailure"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing field",
+			c:       map[string]interface{}{"patterns": []string{"%{WORD:w}"}},
+			fields:  mapstr.M{"other": "hello"},
+			want:    mapstr.M{"other": "hello", "tags": []string{"_grokparsefailure"}},
+			wantErr: true,
+		},
+		{
+			name:   "missing field/ignore missing",
+			c:      map[string]interface{}{"patterns": []string{"%{WORD:w}"}, "ignore_missing": true},
+			fields: mapstr.M{"other": "hello"},
+			want:   mapstr.M{"other": "hello"},
+		},
+		{
+			name:    "not a string",
+			c:       map[string]interface{}{"patterns": []string{"%{WORD:w}"}},
+			fields:  mapstr.M{"message": 42},
+			want:    mapstr.M{"message": 42, "tags": []string{"_grokparsefailure"}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(test.c)
+			require.NoError(t, err)
+
+			p, err := NewProcessor(c)
+			require.NoError(t, err)
+
+			e, err := p.Run(&beat.Event{Fields: test.fields})
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, e.Fields)
+		})
+	}
+}
+
+func TestProcessorConfigErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no patterns":       {"field": "message"},
+		"undefined pattern": {"patterns": []string{"%{NOPE:x}"}},
+	}
+
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(c)
+			require.NoError(t, err)
+
+			_, err = NewProcessor(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"fmt"
+	"time"
+)
+
+type format string
+
+const (
+	formatCSV  format = "csv"
+	formatJSON format = "json"
+)
+
+func (f *format) Unpack(s string) error {
+	switch format(s) {
+	case formatCSV, formatJSON:
+		*f = format(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q, must be one of csv or json", s)
+	}
+}
+
+type matchType string
+
+const (
+	matchExact  matchType = "exact"
+	matchCIDR   matchType = "cidr"
+	matchPrefix matchType = "prefix"
+)
+
+func (m *matchType) Unpack(s string) error {
+	switch matchType(s) {
+	case matchExact, matchCIDR, matchPrefix:
+		*m = matchType(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid match %q, must be one of exact, cidr or prefix", s)
+	}
+}
+
+type config struct {
+	// Path is the path of the lookup table file.
+	Path string `config:"path" validate:"required"`
+
+	// Format is the format of the file. Defaults to the file extension.
+	Format format `config:"format"`
+
+	// Key is the column, or JSON property, holding the keys of the table.
+	Key string `config:"key" validate:"required"`
+
+	// Match is how the keys are compared to the event values.
+	Match matchType `config:"match"`
+
+	// Field is the event field holding the value to look up.
+	Field string `config:"field" validate:"required"`
+
+	// Target is the field the matching row is written to.
+	Target string `config:"target_field" validate:"required"`
+
+	// Fields is the list of columns copied to the target. All the columns
+	// are copied by default.
+	Fields []string `config:"fields"`
+
+	// ReloadPeriod is how often the file is checked for changes. Set to 0 to
+	// disable reloading.
+	ReloadPeriod time.Duration `config:"reload_period" validate:"min=0"`
+
+	// IgnoreMissing: Ignore errors if event has no matching field.
+	IgnoreMissing bool `config:"ignore_missing"`
+
+	// OverwriteKeys allow target_field to overwrite an existing field.
+	OverwriteKeys bool `config:"overwrite_keys"`
+}
+
+func defaultConfig() config {
+	return config{
+		Match:         matchExact,
+		ReloadPeriod:  time.Minute,
+		IgnoreMissing: true,
+	}
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const name = "lookup"
+
+var instanceID atomic.Uint32
+
+func init() {
+	processors.RegisterPlugin(name,
+		checks.ConfigChecked(New,
+			checks.RequireFields("path", "key", "field", "target_field"),
+			checks.AllowedFields("path", "format", "key", "match", "field", "target_field",
+				"fields", "reload_period", "ignore_missing", "overwrite_keys", "when")))
+	jsprocessor.RegisterPlugin("Lookup", New)
+}
+
+// lookup is an enrichment processor using a table read from a file.
+type lookup struct {
+	config config
+	log    *logp.Logger
+
+	mu        sync.RWMutex // mu protects table and lastCheck.
+	table     *table
+	lastCheck time.Time
+}
+
+// New constructs a new lookup processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %s configuration: %w", name, err)
+	}
+	// Logging (each processor instance has a unique ID).
+	id := int(instanceID.Inc())
+	log := logp.NewLogger(name).With("instance_id", id)
+
+	t, err := loadTable(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the %s table: %w", name, err)
+	}
+
+	p := &lookup{
+		config:    config,
+		log:       log,
+		table:     t,
+		lastCheck: time.Now(),
+	}
+	p.log.Infow("initialized lookup processor", "details", p)
+	return p, nil
+}
+
+// Run enriches the event with the table row matching the field value.
+func (p *lookup) Run(event *beat.Event) (*beat.Event, error) {
+	p.reloadIfChanged()
+
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if errors.Is(err, mapstr.ErrKeyNotFound) && p.config.IgnoreMissing {
+			return event, nil
+		}
+		return event, fmt.Errorf("error applying %s processor: %w", name, err)
+	}
+
+	p.mu.RLock()
+	row, found := p.table.lookup(fmt.Sprint(v))
+	p.mu.RUnlock()
+	if !found {
+		return event, nil
+	}
+
+	if !p.config.OverwriteKeys {
+		if _, err := event.GetValue(p.config.Target); err == nil {
+			return event, fmt.Errorf("target field '%s' already exists and overwrite_keys is false", p.config.Target)
+		}
+	}
+
+	if _, err := event.PutValue(p.config.Target, row.Clone()); err != nil {
+		return event, fmt.Errorf("error applying %s processor: %w", name, err)
+	}
+	return event, nil
+}
+
+// reloadIfChanged loads the table again if the file changed, at most once per
+// reload_period.
+func (p *lookup) reloadIfChanged() {
+	period := p.config.ReloadPeriod
+	if period <= 0 {
+		return
+	}
+
+	p.mu.RLock()
+	due := time.Since(p.lastCheck) >= period
+	p.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	p.mu.Lock()
+	if time.Since(p.lastCheck) < period {
+		p.mu.Unlock()
+		return
+	}
+	p.lastCheck = time.Now()
+	current := p.table
+	p.mu.Unlock()
+
+	// Load the table without holding the lock, so lookups continue with the
+	// previous table in the meantime.
+	changed, err := current.changed()
+	if err != nil {
+		p.log.Warnw("failed to check the lookup table for changes", "path", p.config.Path, "error", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	t, err := loadTable(p.config)
+	if err != nil {
+		p.log.Warnw("failed to reload the lookup table, keeping the previous version", "path", p.config.Path, "error", err)
+		return
+	}
+
+	p.mu.Lock()
+	p.table = t
+	p.mu.Unlock()
+	p.log.Infow("reloaded lookup table", "path", p.config.Path)
+}
+
+// String returns the processor representation formatted as a string
+func (p *lookup) String() string {
+	return fmt.Sprintf("%s=[path=%s, key=%s, match=%s, field=%s, target_field=%s, fields=%v, reload_period=%v, ignore_missing=%t, overwrite_keys=%t]",
+		name, p.config.Path, p.config.Key, p.config.Match, p.config.Field, p.config.Target,
+		p.config.Fields, p.config.ReloadPeriod, p.config.IgnoreMissing, p.config.OverwriteKeys)
+}
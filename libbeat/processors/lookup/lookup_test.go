@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestLookup(t *testing.T) {
+	assets := writeFile(t, "assets.csv", "ip,owner,criticality\n10.0.0.0/8,it,low\n10.0.5.0/24,payments,high\n")
+	users := writeFile(t, "users.json", `[{"name": "alice", "department": "finance"}]`)
+
+	cidrConfig := mapstr.M{
+		"path":         assets,
+		"key":          "ip",
+		"match":        "cidr",
+		"field":        "source.ip",
+		"target_field": "source.asset",
+		"fields":       []string{"owner", "criticality"},
+	}
+	usersConfig := func(overrides mapstr.M) mapstr.M {
+		c := mapstr.M{
+			"path":         users,
+			"key":          "name",
+			"field":        "user.name",
+			"target_field": "user.department",
+			"fields":       []string{"department"},
+		}
+		c.DeepUpdate(overrides)
+		return c
+	}
+
+	tests := map[string]struct {
+		config  mapstr.M
+		input   mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"longest cidr match": {
+			config: cidrConfig,
+			input:  mapstr.M{"source": mapstr.M{"ip": "10.0.5.20"}},
+			want: mapstr.M{
+				"source": mapstr.M{
+					"ip":    "10.0.5.20",
+					"asset": mapstr.M{"owner": "payments", "criticality": "high"},
+				},
+			},
+		},
+		"no match": {
+			config: cidrConfig,
+			input:  mapstr.M{"source": mapstr.M{"ip": "192.168.0.1"}},
+			want:   mapstr.M{"source": mapstr.M{"ip": "192.168.0.1"}},
+		},
+		"missing field": {
+			config: usersConfig(nil),
+			input:  mapstr.M{"message": "no user"},
+			want:   mapstr.M{"message": "no user"},
+		},
+		"missing field without ignore_missing": {
+			config:  usersConfig(mapstr.M{"ignore_missing": false}),
+			input:   mapstr.M{"message": "no user"},
+			wantErr: "key not found",
+		},
+		"existing target": {
+			config:  usersConfig(nil),
+			input:   mapstr.M{"user": mapstr.M{"name": "alice", "department": "sales"}},
+			wantErr: "target field 'user.department' already exists",
+		},
+		"existing target without match": {
+			config: usersConfig(nil),
+			input:  mapstr.M{"user": mapstr.M{"name": "mallory", "department": "sales"}},
+			want:   mapstr.M{"user": mapstr.M{"name": "mallory", "department": "sales"}},
+		},
+		"existing target with missing field": {
+			config: usersConfig(nil),
+			input:  mapstr.M{"user": mapstr.M{"department": "sales"}},
+			want:   mapstr.M{"user": mapstr.M{"department": "sales"}},
+		},
+		"overwrite_keys": {
+			config: usersConfig(mapstr.M{"overwrite_keys": true}),
+			input:  mapstr.M{"user": mapstr.M{"name": "alice", "department": "sales"}},
+			want: mapstr.M{
+				"user": mapstr.M{"name": "alice", "department": mapstr.M{"department": "finance"}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestLookupCopiesRows(t *testing.T) {
+	path := writeFile(t, "hosts.csv", "host,team\nweb-01,frontend\n")
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"path":         path,
+		"key":          "host",
+		"field":        "host.name",
+		"target_field": "host.owner",
+	}))
+	require.NoError(t, err)
+
+	// Events must not share the table rows.
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"host": mapstr.M{"name": "web-01"}}})
+	require.NoError(t, err)
+	event.PutValue("host.owner.team", "changed")
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"host": mapstr.M{"name": "web-01"}}})
+	require.NoError(t, err)
+	team, _ := event.GetValue("host.owner.team")
+	assert.Equal(t, "frontend", team)
+}
+
+func TestLookupReload(t *testing.T) {
+	path := writeFile(t, "hosts.csv", "host,team\nweb-01,frontend\n")
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"path":          path,
+		"key":           "host",
+		"field":         "host.name",
+		"target_field":  "host.owner",
+		"reload_period": "1h",
+	}))
+	require.NoError(t, err)
+	p := processor.(*lookup)
+
+	run := func() interface{} {
+		t.Helper()
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"host": mapstr.M{"name": "web-01"}}})
+		require.NoError(t, err)
+		team, _ := event.GetValue("host.owner.team")
+		return team
+	}
+	expire := func() {
+		p.mu.Lock()
+		p.lastCheck = time.Now().Add(-2 * time.Hour)
+		p.mu.Unlock()
+	}
+
+	assert.Equal(t, "frontend", run())
+
+	require.NoError(t, os.WriteFile(path, []byte("host,team\nweb-01,platform\n"), 0o644))
+	assert.Equal(t, "frontend", run(), "reloaded before the reload period elapsed")
+	expire()
+	assert.Equal(t, "platform", run())
+
+	// An invalid file keeps the previous table.
+	require.NoError(t, os.WriteFile(path, []byte("team\nplatform,extra\n"), 0o644))
+	expire()
+	assert.Equal(t, "platform", run())
+}
+
+func TestLookupConfig(t *testing.T) {
+	path := writeFile(t, "hosts.csv", "host,team\nweb-01,frontend\n")
+	base := func(extra mapstr.M) mapstr.M {
+		cfg := mapstr.M{
+			"path":         path,
+			"key":          "host",
+			"field":        "host.name",
+			"target_field": "host.owner",
+		}
+		cfg.DeepUpdate(extra)
+		return cfg
+	}
+
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"all options": {
+			config: base(mapstr.M{
+				"format":         "csv",
+				"match":          "exact",
+				"fields":         []string{"team"},
+				"reload_period":  "1m",
+				"ignore_missing": false,
+				"overwrite_keys": true,
+			}),
+		},
+		"unknown option": {
+			config:  base(mapstr.M{"extraneous": "field"}),
+			wantErr: "unexpected extraneous option in lookup",
+		},
+		"missing target_field": {
+			config:  mapstr.M{"path": path, "key": "host", "field": "host.name"},
+			wantErr: "missing target_field option",
+		},
+		"invalid match": {
+			config:  base(mapstr.M{"match": "regex"}),
+			wantErr: `invalid match "regex"`,
+		},
+		"invalid format": {
+			config:  base(mapstr.M{"format": "xml"}),
+			wantErr: `invalid format "xml"`,
+		},
+		"missing key column": {
+			config:  base(mapstr.M{"key": "name"}),
+			wantErr: "failed to load the lookup table",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := processors.New(processors.PluginConfig([]*conf.C{
+				conf.MustNewConfigFrom(mapstr.M{"lookup": test.config}),
+			}))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// table is a lookup table loaded from a file.
+type table struct {
+	path    string
+	modTime time.Time
+	size    int64
+
+	match matchType
+
+	// rows holds the rows by key for the exact and prefix matches.
+	rows map[string]mapstr.M
+	// lengths are the distinct lengths of the keys, longest first, for the
+	// prefix match.
+	lengths []int
+
+	// ipv4 and ipv6 hold the rows for the cidr match.
+	ipv4, ipv6 cidrTable
+}
+
+// cidrTable holds the networks of one address family by prefix length.
+type cidrTable struct {
+	// networks holds the rows by prefix length and network address.
+	networks map[int]map[string]mapstr.M
+	// lengths are the distinct prefix lengths, longest first.
+	lengths []int
+}
+
+func loadTable(cfg config) (*table, error) {
+	info, err := os.Stat(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := cfg.Format
+	if f == "" {
+		switch strings.ToLower(filepath.Ext(cfg.Path)) {
+		case ".csv":
+			f = formatCSV
+		case ".json":
+			f = formatJSON
+		default:
+			return nil, fmt.Errorf("cannot detect the format of %s, set the format option", cfg.Path)
+		}
+	}
+	var rows []mapstr.M
+	switch f {
+	case formatCSV:
+		rows, err = readCSV(data)
+	case formatJSON:
+		rows, err = readJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", cfg.Path, err)
+	}
+
+	t := &table{
+		path:    cfg.Path,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		match:   cfg.Match,
+		rows:    make(map[string]mapstr.M),
+	}
+	for i, row := range rows {
+		v, found := row[cfg.Key]
+		if !found || v == nil {
+			return nil, fmt.Errorf("row %d of %s has no %s key", i+1, cfg.Path, cfg.Key)
+		}
+		key := fmt.Sprint(v)
+		if len(cfg.Fields) != 0 {
+			selected := make(mapstr.M, len(cfg.Fields))
+			for _, f := range cfg.Fields {
+				if v, found := row[f]; found {
+					selected[f] = v
+				}
+			}
+			row = selected
+		}
+		if err := t.add(key, row); err != nil {
+			return nil, fmt.Errorf("row %d of %s: %w", i+1, cfg.Path, err)
+		}
+	}
+	t.ipv4.sort()
+	t.ipv6.sort()
+	t.lengths = sortedLengths(t.lengths)
+	return t, nil
+}
+
+func (t *table) add(key string, row mapstr.M) error {
+	if t.match != matchCIDR {
+		if t.match == matchPrefix {
+			t.lengths = append(t.lengths, len(key))
+		}
+		t.rows[key] = row
+		return nil
+	}
+
+	var network *net.IPNet
+	if strings.Contains(key, "/") {
+		var err error
+		_, network, err = net.ParseCIDR(key)
+		if err != nil {
+			return err
+		}
+	} else {
+		ip := net.ParseIP(key)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address or CIDR %q", key)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+	ones, _ := network.Mask.Size()
+	if ip4 := network.IP.To4(); ip4 != nil {
+		t.ipv4.add(ones, ip4, row)
+	} else {
+		t.ipv6.add(ones, network.IP, row)
+	}
+	return nil
+}
+
+func (c *cidrTable) add(ones int, ip net.IP, row mapstr.M) {
+	if c.networks == nil {
+		c.networks = make(map[int]map[string]mapstr.M)
+	}
+	networks, found := c.networks[ones]
+	if !found {
+		networks = make(map[string]mapstr.M)
+		c.networks[ones] = networks
+		c.lengths = append(c.lengths, ones)
+	}
+	networks[string(ip)] = row
+}
+
+func (c *cidrTable) sort() {
+	c.lengths = sortedLengths(c.lengths)
+}
+
+// sortedLengths sorts lengths in decreasing order and removes duplicates.
+func sortedLengths(lengths []int) []int {
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	distinct := lengths[:0]
+	for _, n := range lengths {
+		if len(distinct) == 0 || n != distinct[len(distinct)-1] {
+			distinct = append(distinct, n)
+		}
+	}
+	return distinct
+}
+
+// lookup returns the row matching value. CIDR and prefix matches return the
+// most specific row.
+func (t *table) lookup(value string) (mapstr.M, bool) {
+	switch t.match {
+	case matchPrefix:
+		for _, n := range t.lengths {
+			if n > len(value) {
+				continue
+			}
+			if row, found := t.rows[value[:n]]; found {
+				return row, true
+			}
+		}
+		return nil, false
+	case matchCIDR:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, false
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return t.ipv4.lookup(ip4)
+		}
+		return t.ipv6.lookup(ip)
+	default:
+		row, found := t.rows[value]
+		return row, found
+	}
+}
+
+func (c *cidrTable) lookup(ip net.IP) (mapstr.M, bool) {
+	bits := len(ip) * 8
+	for _, ones := range c.lengths {
+		masked := ip.Mask(net.CIDRMask(ones, bits))
+		if row, found := c.networks[ones][string(masked)]; found {
+			return row, true
+		}
+	}
+	return nil, false
+}
+
+// changed reports whether the file has been modified since the table was
+// loaded.
+func (t *table) changed() (bool, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(t.modTime) || info.Size() != t.size, nil
+}
+
+// readCSV reads the records of a CSV file with a header line.
+func readCSV(data []byte) ([]mapstr.M, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing header")
+		}
+		return nil, err
+	}
+	var rows []mapstr.M
+	for {
+		record, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			return nil, err
+		}
+		row := make(mapstr.M, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readJSON reads a JSON array of objects.
+func readJSON(data []byte) ([]mapstr.M, error) {
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+	rows := make([]mapstr.M, len(objects))
+	for i, o := range objects {
+		rows[i] = mapstr.M(o)
+	}
+	return rows, nil
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestTableExact(t *testing.T) {
+	path := writeFile(t, "users.csv", "user,department,manager\nalice,finance,carol\nbob,\"research, labs\",dave\n")
+	tbl, err := loadTable(config{Path: path, Key: "user", Match: matchExact})
+	require.NoError(t, err)
+
+	row, found := tbl.lookup("bob")
+	assert.True(t, found)
+	assert.Equal(t, mapstr.M{"user": "bob", "department": "research, labs", "manager": "dave"}, row)
+
+	_, found = tbl.lookup("bo")
+	assert.False(t, found)
+}
+
+func TestTablePrefix(t *testing.T) {
+	path := writeFile(t, "hosts.json", `[
+		{"prefix": "web-", "service": "frontend"},
+		{"prefix": "web-eu-", "service": "frontend", "region": "eu"},
+		{"prefix": "db-", "service": "database"}
+	]`)
+	tbl, err := loadTable(config{Path: path, Key: "prefix", Match: matchPrefix, Fields: []string{"service", "region"}})
+	require.NoError(t, err)
+
+	row, found := tbl.lookup("web-eu-01")
+	assert.True(t, found)
+	assert.Equal(t, mapstr.M{"service": "frontend", "region": "eu"}, row)
+
+	row, found = tbl.lookup("web-us-01")
+	assert.True(t, found)
+	assert.Equal(t, mapstr.M{"service": "frontend"}, row)
+
+	_, found = tbl.lookup("cache-01")
+	assert.False(t, found)
+}
+
+func TestTableCIDR(t *testing.T) {
+	path := writeFile(t, "networks.csv", "network,owner\n10.0.0.0/8,corp\n10.1.0.0/16,lab\n10.1.2.3,printer\n2001:db8::/32,ipv6-corp\n")
+	tbl, err := loadTable(config{Path: path, Key: "network", Match: matchCIDR})
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"10.200.0.1":      "corp",
+		"10.1.9.9":        "lab",
+		"10.1.2.3":        "printer",
+		"2001:db8::1":     "ipv6-corp",
+		"::ffff:10.1.0.1": "lab",
+	}
+	for ip, owner := range tests {
+		row, found := tbl.lookup(ip)
+		if assert.True(t, found, ip) {
+			assert.Equal(t, owner, row["owner"], ip)
+		}
+	}
+
+	for _, value := range []string{"192.168.0.1", "2001:db9::1", "not an ip"} {
+		_, found := tbl.lookup(value)
+		assert.False(t, found, value)
+	}
+}
+
+func TestTableErrors(t *testing.T) {
+	tests := map[string]struct {
+		name, content string
+		cfg           config
+	}{
+		"unknown format": {
+			name:    "table.txt",
+			content: "a,b\n",
+			cfg:     config{Key: "a"},
+		},
+		"missing key": {
+			name:    "table.json",
+			content: `[{"a": 1}, {"b": 2}]`,
+			cfg:     config{Key: "a"},
+		},
+		"invalid cidr": {
+			name:    "table.csv",
+			content: "net\n10.0.0.0/33\n",
+			cfg:     config{Key: "net", Match: matchCIDR},
+		},
+		"ragged csv": {
+			name:    "table.csv",
+			content: "a,b\n1,2,3\n",
+			cfg:     config{Key: "a"},
+		},
+		"invalid json": {
+			name:    "table.json",
+			content: `{"a": 1}`,
+			cfg:     config{Key: "a"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.cfg.Path = writeFile(t, test.name, test.content)
+			_, err := loadTable(test.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
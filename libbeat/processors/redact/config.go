@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+type action string
+
+const (
+	actionMask action = "mask"
+	actionHash action = "hash"
+	actionDrop action = "drop"
+)
+
+func (a *action) Unpack(s string) error {
+	switch action(s) {
+	case actionMask, actionHash, actionDrop:
+		*a = action(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid action %q, must be one of mask, hash or drop", s)
+	}
+}
+
+const defaultMask = "[REDACTED]"
+
+type config struct {
+	// Fields is the list of string fields to scan.
+	Fields []string `config:"fields"`
+
+	// Detectors is the list of detectors applied to each field, in order.
+	Detectors []detectorConfig `config:"detectors" validate:"required"`
+
+	// HMACKey is the secret used by the hash action. It's typically
+	// referenced from the keystore.
+	HMACKey string `config:"hmac_key"`
+
+	// Tag identifies the processor in the monitoring metrics.
+	Tag string `config:"tag"`
+}
+
+type detectorConfig struct {
+	// Name is the name of a built-in detector, or the name of a custom
+	// detector when Pattern is set.
+	Name string `config:"name" validate:"required"`
+
+	// Pattern is the regular expression of a custom detector.
+	Pattern *regexp.Regexp `config:"pattern"`
+
+	// Action is what happens to the matches, or to the field for drop.
+	// Defaults to mask.
+	Action action `config:"action"`
+
+	// Mask is the text that replaces the matches of the mask action. Defaults
+	// to defaultMask.
+	Mask string `config:"mask"`
+}
+
+func defaultConfig() config {
+	return config{
+		Fields: []string{"message"},
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Fields) == 0 {
+		return errors.New("at least one field is required")
+	}
+	names := make(map[string]bool, len(c.Detectors))
+	for _, d := range c.Detectors {
+		if names[d.Name] {
+			return fmt.Errorf("duplicate detector %q", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.Pattern == nil {
+			if _, found := builtinDetectors[d.Name]; !found {
+				return fmt.Errorf("unknown detector %q, set a pattern to define a custom detector", d.Name)
+			}
+		}
+		if d.Action == actionHash && c.HMACKey == "" {
+			return fmt.Errorf("detector %q uses the hash action but hmac_key is not set", d.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	processorName = "redact"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("detectors"),
+			checks.AllowedFields("fields", "detectors", "hmac_key", "tag", "when")))
+	jsprocessor.RegisterPlugin("Redact", New)
+}
+
+// redactor is a configured detector.
+type redactor struct {
+	detector
+	name   string
+	action action
+	mask   string
+
+	// redactions counts the redacted values, or the dropped fields for the
+	// drop action.
+	redactions *monitoring.Int
+}
+
+type redact struct {
+	config    config
+	log       *logp.Logger
+	redactors []redactor
+
+	// registryName is the name of the monitoring registry of the processor.
+	registryName string
+
+	// hmacPool holds HMAC hashes keyed with hmac_key.
+	hmacPool sync.Pool
+}
+
+// New constructs a new redact processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	id := int(instanceID.Inc())
+	log := logp.NewLogger(logName).With("instance_id", id)
+	registryName := logName + "." + strconv.Itoa(id)
+	if config.Tag != "" {
+		log = log.With("tag", config.Tag)
+		registryName = logName + "." + config.Tag + "-" + strconv.Itoa(id)
+	}
+	registry := monitoring.Default.NewRegistry(registryName, monitoring.DoNotReport)
+	redactions := registry.NewRegistry("redactions")
+
+	p := &redact{config: config, log: log, registryName: registryName}
+	for _, d := range config.Detectors {
+		r := redactor{
+			name:       d.Name,
+			action:     d.Action,
+			mask:       d.Mask,
+			redactions: monitoring.NewInt(redactions, d.Name),
+		}
+		if d.Pattern != nil {
+			r.detector = detector{regex: d.Pattern}
+		} else {
+			r.detector = builtinDetectors[d.Name]
+		}
+		if r.action == "" {
+			r.action = actionMask
+		}
+		if r.mask == "" {
+			r.mask = defaultMask
+		}
+		p.redactors = append(p.redactors, r)
+	}
+
+	key := []byte(config.HMACKey)
+	p.hmacPool.New = func() interface{} {
+		return hmac.New(sha256.New, key)
+	}
+	return p, nil
+}
+
+// Run redacts the sensitive values found in the configured fields.
+func (p *redact) Run(event *beat.Event) (*beat.Event, error) {
+	for _, field := range p.config.Fields {
+		v, err := event.GetValue(field)
+		if err != nil {
+			if errors.Is(err, mapstr.ErrKeyNotFound) {
+				continue
+			}
+			return event, fmt.Errorf("could not fetch value for key: %v, Error: %w", field, err)
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		redacted, drop := p.redact(s)
+		if drop {
+			if err := event.Delete(field); err != nil {
+				return event, fmt.Errorf("failed to drop field %v: %w", field, err)
+			}
+			continue
+		}
+		if redacted != s {
+			if _, err := event.PutValue(field, redacted); err != nil {
+				return event, fmt.Errorf("failed to put field %v: %w", field, err)
+			}
+		}
+	}
+	return event, nil
+}
+
+// redact applies the redactors to s. It returns true if the field must be
+// dropped.
+func (p *redact) redact(s string) (string, bool) {
+	for i := range p.redactors {
+		r := &p.redactors[i]
+		if r.action == actionDrop {
+			if r.matches(s) {
+				r.redactions.Inc()
+				return "", true
+			}
+			continue
+		}
+
+		var count int64
+		s = r.regex.ReplaceAllStringFunc(s, func(match string) string {
+			if r.valid != nil && !r.valid(match) {
+				return match
+			}
+			count++
+			if r.action == actionHash {
+				return p.hash(match)
+			}
+			return r.mask
+		})
+		if count > 0 {
+			r.redactions.Add(count)
+		}
+	}
+	return s, false
+}
+
+func (r *redactor) matches(s string) bool {
+	if r.valid == nil {
+		return r.regex.MatchString(s)
+	}
+	for _, match := range r.regex.FindAllString(s, -1) {
+		if r.valid(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns the hex encoded HMAC-SHA256 of s.
+func (p *redact) hash(s string) string {
+	h := p.hmacPool.Get().(hash.Hash)
+	defer p.hmacPool.Put(h)
+	h.Reset()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *redact) String() string {
+	detectors := make([]string, len(p.redactors))
+	for i, r := range p.redactors {
+		detectors[i] = r.name + ":" + string(r.action)
+	}
+	return fmt.Sprintf("%v=[fields=%v, detectors=[%v]]",
+		processorName, p.config.Fields, strings.Join(detectors, ", "))
+}
+
+// Close removes the monitoring registry of the processor.
+func (p *redact) Close() error {
+	monitoring.Default.Remove(p.registryName)
+	return nil
+}
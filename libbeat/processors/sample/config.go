@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type mode string
+
+const (
+	modeProbabilistic mode = "probabilistic"
+	modeHash          mode = "hash"
+	modeReservoir     mode = "reservoir"
+)
+
+func (m *mode) Unpack(s string) error {
+	switch mode(s) {
+	case modeProbabilistic, modeHash, modeReservoir:
+		*m = mode(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid mode %q, must be one of probabilistic, hash or reservoir", s)
+	}
+}
+
+type config struct {
+	// Mode is the sampling method.
+	Mode mode `config:"mode"`
+
+	// Rate is the probability of keeping an event in the probabilistic and
+	// hash modes.
+	Rate float64 `config:"rate"`
+
+	// Fields are the fields hashed in the hash mode, or the fields making up
+	// the key in the reservoir mode.
+	Fields []string `config:"fields"`
+
+	// Limit is the maximum number of events kept per key and interval in the
+	// reservoir mode.
+	Limit int `config:"limit"`
+
+	// Interval is the length of the reservoir mode windows.
+	Interval time.Duration `config:"interval"`
+
+	// MaxKeys is the maximum number of keys tracked per interval in the
+	// reservoir mode. The events of the other keys share a single reservoir.
+	MaxKeys int `config:"max_keys"`
+
+	// RateField is the field kept events are annotated with.
+	RateField string `config:"rate_field"`
+}
+
+func defaultConfig() config {
+	return config{
+		Mode:      modeProbabilistic,
+		Interval:  time.Minute,
+		MaxKeys:   10000,
+		RateField: "sample.rate",
+	}
+}
+
+func (c *config) Validate() error {
+	switch c.Mode {
+	case modeProbabilistic, modeHash:
+		if c.Rate <= 0 || c.Rate > 1 {
+			return fmt.Errorf("rate must be greater than 0 and at most 1 in %v mode", c.Mode)
+		}
+		if c.Mode == modeHash && len(c.Fields) == 0 {
+			return errors.New("fields are required in hash mode")
+		}
+	case modeReservoir:
+		if c.Limit <= 0 {
+			return errors.New("limit must be greater than 0 in reservoir mode")
+		}
+		if c.Interval <= 0 {
+			return errors.New("interval must be greater than 0 in reservoir mode")
+		}
+		if c.MaxKeys <= 0 {
+			return errors.New("max_keys must be greater than 0 in reservoir mode")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const (
+	processorName = "sample"
+	logName       = "processor." + processorName
+)
+
+func init() {
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields("mode", "rate", "fields", "limit", "interval", "max_keys", "rate_field", "when")))
+}
+
+type metrics struct {
+	Kept    *monitoring.Int
+	Dropped *monitoring.Int
+}
+
+type sample struct {
+	config  config
+	logger  *logp.Logger
+	metrics metrics
+	// registryName is the name of the monitoring registry of the processor.
+	registryName string
+
+	// random returns a number in [0, 1).
+	random func() float64
+	// now returns the current time.
+	now func() time.Time
+
+	// mu protects the reservoir mode state.
+	mu          sync.Mutex
+	windowStart time.Time
+	keys        map[string]*reservoirKey
+	// overflow is shared by the keys that aren't tracked once the number of
+	// keys reaches max_keys.
+	overflow *reservoirKey
+}
+
+// reservoirKey holds the reservoir mode counts of a key.
+type reservoirKey struct {
+	// The number of events seen and kept in the current interval.
+	seen, kept int
+	// The number of events seen in the previous interval.
+	prevSeen int
+	// The number of events dropped at the limit, that the next kept event
+	// accounts for.
+	carried int
+}
+
+// next returns the counts the key starts the next interval with, or nil if
+// the key had no events. The counts of the interval are only an estimate of
+// the next one if it directly follows, but carried events are kept.
+func (s *reservoirKey) next(follows bool) *reservoirKey {
+	if s == nil || s.seen == 0 {
+		return nil
+	}
+	n := &reservoirKey{carried: s.carried}
+	if follows {
+		n.prevSeen = s.seen
+	}
+	return n
+}
+
+// New constructs a new sample processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id           = int(instanceID.Inc())
+		log          = logp.NewLogger(logName).With("instance_id", id)
+		registryName = logName + "." + strconv.Itoa(id)
+		reg          = monitoring.Default.NewRegistry(registryName, monitoring.DoNotReport)
+	)
+
+	return &sample{
+		config: config,
+		logger: log,
+		metrics: metrics{
+			Kept:    monitoring.NewInt(reg, "kept"),
+			Dropped: monitoring.NewInt(reg, "dropped"),
+		},
+		registryName: registryName,
+		random:       rand.Float64,
+		now:          time.Now,
+		keys:         map[string]*reservoirKey{},
+	}, nil
+}
+
+// Run keeps or drops the event. Kept events are annotated with the
+// probability they had of being kept.
+func (p *sample) Run(event *beat.Event) (*beat.Event, error) {
+	var (
+		rate float64
+		keep bool
+		err  error
+	)
+	switch p.config.Mode {
+	case modeHash:
+		rate = p.config.Rate
+		keep, err = p.sampleHash(event)
+	case modeReservoir:
+		rate, keep, err = p.sampleReservoir(event)
+	default:
+		rate = p.config.Rate
+		keep = p.random() < rate
+	}
+	if err != nil {
+		return event, err
+	}
+
+	if !keep {
+		p.metrics.Dropped.Inc()
+		return nil, nil
+	}
+	p.metrics.Kept.Inc()
+	if _, err := event.PutValue(p.config.RateField, rate); err != nil {
+		return event, fmt.Errorf("failed to put field %v: %w", p.config.RateField, err)
+	}
+	return event, nil
+}
+
+// sampleHash keeps the events whose fields hash below the rate, so events
+// with the same values are all kept or all dropped. Events without any of
+// the fields are sampled randomly.
+func (p *sample) sampleHash(event *beat.Event) (bool, error) {
+	key, found, err := p.key(event)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return p.random() < p.config.Rate, nil
+	}
+	// Map the 53 most significant bits of the hash to [0, 1).
+	h := float64(xxhash.Sum64String(key)>>11) / (1 << 53)
+	return h < p.config.Rate, nil
+}
+
+// sampleReservoir keeps at most limit events per key and interval. The rate
+// of a key is estimated from the number of its events in the previous
+// interval, so that the kept events are spread over the interval. Keys
+// without a previous interval keep their first limit events. The events
+// dropped because a key reached its limit are accounted for by the rate of
+// the next event kept for the key.
+func (p *sample) sampleReservoir(event *beat.Event) (float64, bool, error) {
+	key, _, err := p.key(event)
+	if err != nil {
+		return 0, false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if elapsed := now.Sub(p.windowStart); elapsed >= p.config.Interval {
+		follows := elapsed < 2*p.config.Interval
+		prev := p.keys
+		p.keys = map[string]*reservoirKey{}
+		for k, s := range prev {
+			if n := s.next(follows); n != nil {
+				p.keys[k] = n
+			}
+		}
+		p.overflow = p.overflow.next(follows)
+		p.windowStart = now
+	}
+
+	s := p.keys[key]
+	if s == nil {
+		if len(p.keys) < p.config.MaxKeys {
+			s = &reservoirKey{}
+			p.keys[key] = s
+		} else {
+			if p.overflow == nil {
+				p.overflow = &reservoirKey{}
+			}
+			s = p.overflow
+		}
+	}
+	s.seen++
+
+	rate := 1.0
+	if s.prevSeen > p.config.Limit {
+		rate = float64(p.config.Limit) / float64(s.prevSeen)
+	}
+	if s.kept >= p.config.Limit {
+		s.carried++
+		return rate, false, nil
+	}
+	if rate < 1 && p.random() >= rate {
+		return rate, false, nil
+	}
+	s.kept++
+	if s.carried > 0 {
+		// The event stands for itself, the events it was sampled from, and
+		// the events dropped at the limit since the last kept event.
+		rate = 1 / (1/rate + float64(s.carried))
+		s.carried = 0
+	}
+	return rate, true, nil
+}
+
+// key joins the values of the configured fields. It also reports whether
+// any of the fields was found.
+func (p *sample) key(event *beat.Event) (string, bool, error) {
+	var (
+		b     strings.Builder
+		found bool
+	)
+	for i, field := range p.config.Fields {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		v, err := event.GetValue(field)
+		if err != nil {
+			if errors.Is(err, mapstr.ErrKeyNotFound) {
+				continue
+			}
+			return "", false, fmt.Errorf("error getting value of field '%v': %w", field, err)
+		}
+		found = true
+		fmt.Fprint(&b, v)
+	}
+	return b.String(), found, nil
+}
+
+func (p *sample) String() string {
+	switch p.config.Mode {
+	case modeReservoir:
+		return fmt.Sprintf("%v=[mode=%v, fields=%v, limit=%v, interval=%v, max_keys=%v]",
+			processorName, p.config.Mode, p.config.Fields, p.config.Limit, p.config.Interval, p.config.MaxKeys)
+	default:
+		return fmt.Sprintf("%v=[mode=%v, rate=%v, fields=%v]",
+			processorName, p.config.Mode, p.config.Rate, p.config.Fields)
+	}
+}
+
+// Close removes the monitoring registry of the processor.
+func (p *sample) Close() error {
+	monitoring.Default.Remove(p.registryName)
+	return nil
+}
@@ -0,0 +1,318 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestSample(t *testing.T) {
+	tests := map[string]struct {
+		config mapstr.M
+		random float64
+		input  mapstr.M
+		want   mapstr.M // nil if the event is dropped
+	}{
+		"probabilistic kept": {
+			config: mapstr.M{"rate": 0.1},
+			random: 0.05,
+			input:  mapstr.M{"message": "kept"},
+			want:   mapstr.M{"message": "kept", "sample": mapstr.M{"rate": 0.1}},
+		},
+		"probabilistic dropped": {
+			config: mapstr.M{"rate": 0.1},
+			random: 0.1,
+			input:  mapstr.M{"message": "dropped"},
+		},
+		"rate_field": {
+			config: mapstr.M{"rate": 0.5, "rate_field": "event.sample_rate"},
+			random: 0.2,
+			input:  mapstr.M{},
+			want:   mapstr.M{"event": mapstr.M{"sample_rate": 0.5}},
+		},
+		"hash without the fields kept": {
+			config: mapstr.M{"mode": "hash", "rate": 0.5, "fields": []string{"trace.id"}},
+			random: 0.4,
+			input:  mapstr.M{},
+			want:   mapstr.M{"sample": mapstr.M{"rate": 0.5}},
+		},
+		"hash without the fields dropped": {
+			config: mapstr.M{"mode": "hash", "rate": 0.5, "fields": []string{"trace.id"}},
+			random: 0.6,
+			input:  mapstr.M{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+			defer processors.Close(p)
+			p.(*sample).random = func() float64 { return test.random }
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			require.NoError(t, err)
+			if test.want == nil {
+				assert.Nil(t, event)
+				assert.Equal(t, int64(1), p.(*sample).metrics.Dropped.Get())
+				return
+			}
+			require.NotNil(t, event)
+			assert.Equal(t, test.want, event.Fields)
+			assert.Equal(t, int64(1), p.(*sample).metrics.Kept.Get())
+		})
+	}
+}
+
+func TestSampleHash(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"mode":       "hash",
+		"rate":       0.25,
+		"fields":     []string{"trace.id"},
+		"rate_field": "event.sample_rate",
+	}))
+	require.NoError(t, err)
+	defer processors.Close(p)
+
+	const traces = 10000
+	kept := 0
+	for i := 0; i < traces; i++ {
+		id := fmt.Sprintf("trace-%d", i)
+		first, err := p.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": id}}})
+		require.NoError(t, err)
+		second, err := p.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": id}, "span": "child"}})
+		require.NoError(t, err)
+		require.Equal(t, first == nil, second == nil, "events of trace %v were sampled differently", id)
+
+		if first != nil {
+			kept++
+			rate, _ := first.GetValue("event.sample_rate")
+			assert.Equal(t, 0.25, rate)
+		}
+	}
+	assert.InDelta(t, 0.25, float64(kept)/traces, 0.02)
+}
+
+func TestSampleReservoir(t *testing.T) {
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"mode":     "reservoir",
+		"limit":    2,
+		"fields":   []string{"host.name"},
+		"interval": "1m",
+	}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*sample)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.random = func() float64 { return 0.3 }
+
+	run := func(host string) interface{} {
+		t.Helper()
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"host": mapstr.M{"name": host}}})
+		require.NoError(t, err)
+		if event == nil {
+			return nil
+		}
+		rate, _ := event.GetValue("sample.rate")
+		return rate
+	}
+
+	assert.Equal(t, 1.0, run("a"))
+	assert.Equal(t, 1.0, run("a"))
+	assert.Nil(t, run("a"), "events over the limit are dropped")
+	assert.Nil(t, run("a"))
+	assert.Equal(t, 1.0, run("b"), "keys are sampled independently")
+
+	// The rate of a is estimated from the 4 events of the previous interval,
+	// and the first kept event also stands for the 2 events dropped at the
+	// limit.
+	now = now.Add(time.Minute)
+	assert.Equal(t, 0.25, run("a"))
+	p.random = func() float64 { return 0.7 }
+	assert.Nil(t, run("a"))
+	assert.Equal(t, 1.0, run("b"), "b was under the limit")
+
+	// Counts are forgotten if a whole interval passes without events.
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1.0, run("a"))
+}
+
+func TestSampleReservoirLimit(t *testing.T) {
+	const limit = 10
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{"mode": "reservoir", "limit": limit}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*sample)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.random = rand.New(rand.NewSource(1)).Float64
+
+	// However many events are seen, at most limit events are kept in each
+	// interval.
+	for _, n := range []int{100000, 100000, 1000} {
+		var kept int
+		for i := 0; i < n; i++ {
+			event, err := p.Run(&beat.Event{Fields: mapstr.M{}})
+			require.NoError(t, err)
+			if event != nil {
+				kept++
+			}
+		}
+		assert.LessOrEqual(t, kept, limit, "events kept out of %d", n)
+		assert.Greater(t, kept, 0, "events kept out of %d", n)
+		now = now.Add(time.Minute)
+	}
+	assert.LessOrEqual(t, p.metrics.Kept.Get(), int64(3*limit))
+}
+
+func TestSampleReservoirEstimate(t *testing.T) {
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{"mode": "reservoir", "limit": 100}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*sample)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.random = rand.New(rand.NewSource(1)).Float64
+
+	// Summing 1 / rate over the kept events estimates the number of events,
+	// including in the first interval and when the number of events grows.
+	var seen, estimate float64
+	for _, n := range []int{5000, 20000, 8000, 50000, 50000} {
+		for i := 0; i < n; i++ {
+			event, err := p.Run(&beat.Event{Fields: mapstr.M{}})
+			require.NoError(t, err)
+			if event != nil {
+				rate, _ := event.GetValue("sample.rate")
+				estimate += 1 / rate.(float64)
+			}
+		}
+		seen += float64(n)
+		now = now.Add(time.Minute)
+	}
+	assert.InEpsilon(t, seen, estimate, 0.1)
+}
+
+func TestSampleReservoirMaxKeys(t *testing.T) {
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"mode":     "reservoir",
+		"limit":    1,
+		"fields":   []string{"host.name"},
+		"max_keys": 2,
+	}))
+	require.NoError(t, err)
+	defer processors.Close(processor)
+	p := processor.(*sample)
+	p.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	kept := func(host string) bool {
+		t.Helper()
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"host": mapstr.M{"name": host}}})
+		require.NoError(t, err)
+		return event != nil
+	}
+
+	assert.True(t, kept("a"))
+	assert.True(t, kept("b"))
+	assert.True(t, kept("c"), "keys over max_keys share a reservoir")
+	assert.False(t, kept("d"), "keys over max_keys share a reservoir")
+	assert.False(t, kept("a"))
+	assert.Len(t, p.keys, 2)
+}
+
+func TestSampleConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"all options": {
+			config: mapstr.M{
+				"mode":       "reservoir",
+				"fields":     []string{"host.name"},
+				"limit":      10,
+				"interval":   "1m",
+				"max_keys":   100,
+				"rate_field": "event.sample_rate",
+			},
+		},
+		"unknown option": {
+			config:  mapstr.M{"rate": 0.5, "extraneous": "field"},
+			wantErr: "unexpected extraneous option in sample",
+		},
+		"missing rate": {
+			config:  mapstr.M{},
+			wantErr: "rate must be greater than 0",
+		},
+		"rate too high": {
+			config:  mapstr.M{"rate": 1.5},
+			wantErr: "rate must be greater than 0",
+		},
+		"invalid mode": {
+			config:  mapstr.M{"mode": "systematic", "rate": 0.5},
+			wantErr: "invalid mode",
+		},
+		"hash without fields": {
+			config:  mapstr.M{"mode": "hash", "rate": 0.5},
+			wantErr: "fields are required",
+		},
+		"reservoir no limit": {
+			config:  mapstr.M{"mode": "reservoir"},
+			wantErr: "limit must be greater than 0",
+		},
+		"reservoir no keys": {
+			config:  mapstr.M{"mode": "reservoir", "limit": 1, "max_keys": 0},
+			wantErr: "max_keys must be greater than 0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := processors.New(processors.PluginConfig([]*conf.C{
+				conf.MustNewConfigFrom(mapstr.M{"sample": test.config}),
+			}))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
+
+func TestSampleClose(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{"rate": 0.5}))
+	require.NoError(t, err)
+	name := p.(*sample).registryName
+	assert.NotNil(t, monitoring.Default.Get(name))
+
+	require.NoError(t, processors.Close(p))
+	assert.Nil(t, monitoring.Default.Get(name), "the monitoring registry is removed")
+}
@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultRegexes are the bundled parsing rules in the uap-core format.
+//
+//go:embed regexes.yaml
+var defaultRegexes []byte
+
+const other = "Other"
+
+// replacementRegexp matches the capture group references in replacements.
+var replacementRegexp = regexp.MustCompile(`\$(\d)`)
+
+// client is the result of parsing a user agent string.
+type client struct {
+	UserAgent agent
+	OS        operatingSystem
+	Device    device
+}
+
+type agent struct {
+	Family              string
+	Major, Minor, Patch string
+}
+
+type operatingSystem struct {
+	Family                          string
+	Major, Minor, Patch, PatchMinor string
+}
+
+type device struct {
+	Family, Brand, Model string
+}
+
+// regexesFile is the layout of a uap-core regexes.yaml file.
+type regexesFile struct {
+	UserAgentParsers []ruleConfig `yaml:"user_agent_parsers"`
+	OSParsers        []ruleConfig `yaml:"os_parsers"`
+	DeviceParsers    []ruleConfig `yaml:"device_parsers"`
+}
+
+type ruleConfig struct {
+	Regex     string `yaml:"regex"`
+	RegexFlag string `yaml:"regex_flag"`
+
+	FamilyReplacement string `yaml:"family_replacement"`
+	V1Replacement     string `yaml:"v1_replacement"`
+	V2Replacement     string `yaml:"v2_replacement"`
+	V3Replacement     string `yaml:"v3_replacement"`
+
+	OSReplacement   string `yaml:"os_replacement"`
+	OSV1Replacement string `yaml:"os_v1_replacement"`
+	OSV2Replacement string `yaml:"os_v2_replacement"`
+	OSV3Replacement string `yaml:"os_v3_replacement"`
+	OSV4Replacement string `yaml:"os_v4_replacement"`
+
+	DeviceReplacement string `yaml:"device_replacement"`
+	BrandReplacement  string `yaml:"brand_replacement"`
+	ModelReplacement  string `yaml:"model_replacement"`
+}
+
+// rule is a compiled parsing rule. Replacements are listed in the order of
+// the fields they produce, with the defaults of the uap-core specification
+// applied.
+type rule struct {
+	regex        *regexp.Regexp
+	replacements []string
+}
+
+// parser parses user agent strings with uap-core rules.
+type parser struct {
+	userAgents []rule
+	os         []rule
+	devices    []rule
+}
+
+func newParser(data []byte) (*parser, error) {
+	var file regexesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode regexes: %w", err)
+	}
+	if len(file.UserAgentParsers) == 0 && len(file.OSParsers) == 0 && len(file.DeviceParsers) == 0 {
+		return nil, fmt.Errorf("no rules found in regexes")
+	}
+
+	var (
+		p   parser
+		err error
+	)
+	p.userAgents, err = compileRules("user_agent_parsers", file.UserAgentParsers, func(c ruleConfig) []string {
+		return []string{
+			or(c.FamilyReplacement, "$1"),
+			or(c.V1Replacement, "$2"),
+			or(c.V2Replacement, "$3"),
+			or(c.V3Replacement, "$4"),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.os, err = compileRules("os_parsers", file.OSParsers, func(c ruleConfig) []string {
+		return []string{
+			or(c.OSReplacement, "$1"),
+			or(c.OSV1Replacement, "$2"),
+			or(c.OSV2Replacement, "$3"),
+			or(c.OSV3Replacement, "$4"),
+			or(c.OSV4Replacement, "$5"),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.devices, err = compileRules("device_parsers", file.DeviceParsers, func(c ruleConfig) []string {
+		return []string{
+			or(c.DeviceReplacement, "$1"),
+			c.BrandReplacement,
+			or(c.ModelReplacement, "$1"),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func compileRules(section string, configs []ruleConfig, replacements func(ruleConfig) []string) ([]rule, error) {
+	rules := make([]rule, 0, len(configs))
+	for i, c := range configs {
+		expr := c.Regex
+		if c.RegexFlag == "i" {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %d in %s: %w", i, section, err)
+		}
+		rules = append(rules, rule{regex: re, replacements: replacements(c)})
+	}
+	return rules, nil
+}
+
+// match returns the values produced by the first rule matching s, or nil if
+// none matches.
+func match(rules []rule, s string) []string {
+	for _, r := range rules {
+		groups := r.regex.FindStringSubmatch(s)
+		if groups == nil {
+			continue
+		}
+		values := make([]string, len(r.replacements))
+		for i, replacement := range r.replacements {
+			values[i] = expand(replacement, groups)
+		}
+		return values
+	}
+	return nil
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// expand replaces the capture group references in replacement.
+func expand(replacement string, groups []string) string {
+	if !strings.Contains(replacement, "$") {
+		return replacement
+	}
+	s := replacementRegexp.ReplaceAllStringFunc(replacement, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		if n < len(groups) {
+			return groups[n]
+		}
+		return ""
+	})
+	return strings.TrimSpace(s)
+}
+
+func (p *parser) parse(s string) *client {
+	c := client{
+		UserAgent: agent{Family: other},
+		OS:        operatingSystem{Family: other},
+		Device:    device{Family: other},
+	}
+	if v := match(p.userAgents, s); v != nil && v[0] != "" {
+		c.UserAgent = agent{Family: v[0], Major: v[1], Minor: v[2], Patch: v[3]}
+	}
+	if v := match(p.os, s); v != nil && v[0] != "" {
+		c.OS = operatingSystem{Family: v[0], Major: v[1], Minor: v[2], Patch: v[3], PatchMinor: v[4]}
+	}
+	if v := match(p.devices, s); v != nil && v[0] != "" {
+		c.Device = device{Family: v[0], Brand: v[1], Model: v[2]}
+	}
+	return &c
+}
+
+// version joins the non-empty leading version parts with dots.
+func version(parts ...string) string {
+	var n int
+	for n < len(parts) && parts[n] != "" {
+		n++
+	}
+	return strings.Join(parts[:n], ".")
+}
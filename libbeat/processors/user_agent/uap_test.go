@@ -0,0 +1,228 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestParseDefaultRegexes(t *testing.T) {
+	p, err := newParser(defaultRegexes)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		userAgent string
+		expected  mapstr.M
+	}{
+		"chrome windows": {
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			expected: mapstr.M{
+				"name":    "Chrome",
+				"version": "120.0.0",
+				"os":      mapstr.M{"name": "Windows", "version": "10", "full": "Windows 10"},
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"edge": {
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			expected: mapstr.M{
+				"name":    "Edge",
+				"version": "120.0.2210",
+				"os":      mapstr.M{"name": "Windows", "version": "10", "full": "Windows 10"},
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"safari mac": {
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			expected: mapstr.M{
+				"name":    "Safari",
+				"version": "17.2",
+				"os":      mapstr.M{"name": "Mac OS X", "version": "10.15.7", "full": "Mac OS X 10.15.7"},
+				"device":  mapstr.M{"name": "Mac"},
+			},
+		},
+		"mobile safari": {
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			expected: mapstr.M{
+				"name":    "Mobile Safari",
+				"version": "17.2",
+				"os":      mapstr.M{"name": "iOS", "version": "17.2.1", "full": "iOS 17.2.1"},
+				"device":  mapstr.M{"name": "iPhone"},
+			},
+		},
+		"samsung internet": {
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			expected: mapstr.M{
+				"name":    "Samsung Internet",
+				"version": "23.0",
+				"os":      mapstr.M{"name": "Android", "version": "13", "full": "Android 13"},
+				"device":  mapstr.M{"name": "Samsung SM-S918B"},
+			},
+		},
+		"chrome mobile": {
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8 Build/UD1A.230803.041) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			expected: mapstr.M{
+				"name":    "Chrome Mobile",
+				"version": "120.0.6099",
+				"os":      mapstr.M{"name": "Android", "version": "14", "full": "Android 14"},
+				"device":  mapstr.M{"name": "Pixel 8"},
+			},
+		},
+		"firefox linux": {
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			expected: mapstr.M{
+				"name":    "Firefox",
+				"version": "121.0",
+				"os":      mapstr.M{"name": "Ubuntu", "full": "Ubuntu"},
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"internet explorer": {
+			userAgent: "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			expected: mapstr.M{
+				"name":    "IE",
+				"version": "11.0",
+				"os":      mapstr.M{"name": "Windows", "version": "7", "full": "Windows 7"},
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"crawler": {
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected: mapstr.M{
+				"name":    "Googlebot",
+				"version": "2.1",
+				"device":  mapstr.M{"name": "Spider"},
+			},
+		},
+		"http client": {
+			userAgent: "curl/7.68.0",
+			expected: mapstr.M{
+				"name":    "curl",
+				"version": "7.68.0",
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"unknown": {
+			userAgent: "something else",
+			expected: mapstr.M{
+				"name":   "Other",
+				"device": mapstr.M{"name": "Other"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, p.parse(test.userAgent).toMap())
+		})
+	}
+}
+
+// uapCoreTestCase is a test case in the uap-core tests format.
+type uapCoreTestCase struct {
+	UserAgent  string `yaml:"user_agent_string"`
+	Family     string `yaml:"family"`
+	Major      string `yaml:"major"`
+	Minor      string `yaml:"minor"`
+	Patch      string `yaml:"patch"`
+	PatchMinor string `yaml:"patch_minor"`
+	Brand      string `yaml:"brand"`
+	Model      string `yaml:"model"`
+}
+
+// TestParseUAPCoreTests runs a sample of the uap-core test cases against the
+// bundled regexes.
+func TestParseUAPCoreTests(t *testing.T) {
+	p, err := newParser(defaultRegexes)
+	require.NoError(t, err)
+
+	tests := map[string]func(c *client) uapCoreTestCase{
+		// The user agent patch_minor isn't part of the uap-core specification,
+		// and isn't parsed.
+		"test_ua.yaml": func(c *client) uapCoreTestCase {
+			return uapCoreTestCase{Family: c.UserAgent.Family, Major: c.UserAgent.Major, Minor: c.UserAgent.Minor, Patch: c.UserAgent.Patch}
+		},
+		"test_os.yaml": func(c *client) uapCoreTestCase {
+			return uapCoreTestCase{Family: c.OS.Family, Major: c.OS.Major, Minor: c.OS.Minor, Patch: c.OS.Patch, PatchMinor: c.OS.PatchMinor}
+		},
+		"test_device.yaml": func(c *client) uapCoreTestCase {
+			return uapCoreTestCase{Family: c.Device.Family, Brand: c.Device.Brand, Model: c.Device.Model}
+		},
+	}
+
+	for name, result := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "uap-core", name))
+			require.NoError(t, err)
+			var file struct {
+				TestCases []uapCoreTestCase `yaml:"test_cases"`
+			}
+			require.NoError(t, yaml.Unmarshal(data, &file))
+			require.NotEmpty(t, file.TestCases)
+
+			for _, test := range file.TestCases {
+				expected := test
+				expected.UserAgent = ""
+				if name == "test_ua.yaml" {
+					expected.PatchMinor = ""
+				}
+				assert.Equal(t, expected, result(p.parse(test.UserAgent)), test.UserAgent)
+			}
+		})
+	}
+}
+
+func TestParseReplacements(t *testing.T) {
+	p, err := newParser([]byte(`
+user_agent_parsers:
+  - regex: '(MyApp)/(\d+)\.(\d+)'
+    family_replacement: 'My App'
+    v2_replacement: '$3-beta'
+os_parsers:
+  - regex: 'MyOS (\d+)'
+    os_replacement: 'MyOS'
+    os_v1_replacement: '$1'
+device_parsers:
+  - regex: 'model=(\w+)'
+    regex_flag: 'i'
+    device_replacement: 'Device $1'
+    brand_replacement: 'Acme'
+`))
+	require.NoError(t, err)
+
+	c := p.parse("MyApp/3.1 (MyOS 12; MODEL=x200)")
+	assert.Equal(t, agent{Family: "My App", Major: "3", Minor: "1-beta"}, c.UserAgent)
+	assert.Equal(t, operatingSystem{Family: "MyOS", Major: "12"}, c.OS)
+	assert.Equal(t, device{Family: "Device x200", Brand: "Acme", Model: "x200"}, c.Device)
+}
+
+func TestParseInvalidRegexes(t *testing.T) {
+	_, err := newParser([]byte(`user_agent_parsers: [{regex: '(?<=x)'}]`))
+	assert.ErrorContains(t, err, "invalid regex 0 in user_agent_parsers")
+
+	_, err = newParser([]byte(`foo: bar`))
+	assert.ErrorContains(t, err, "no rules found")
+}
@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const processorName = "user_agent"
+
+func init() {
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields("field", "target", "regexes_file", "ignore_missing", "cache_size", "when")))
+	jsprocessor.RegisterPlugin("UserAgent", New)
+}
+
+type userAgent struct {
+	config config
+	parser *parser
+	cache  *lru.Cache
+}
+
+// New constructs a new user_agent processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	regexes := defaultRegexes
+	if config.RegexesFile != "" {
+		var err error
+		regexes, err = os.ReadFile(config.RegexesFile)
+		if err != nil {
+			return nil, fmt.Errorf("%v processor: failed to read regexes file: %w", processorName, err)
+		}
+	}
+	parser, err := newParser(regexes)
+	if err != nil {
+		return nil, fmt.Errorf("%v processor: %w", processorName, err)
+	}
+
+	p := &userAgent{config: config, parser: parser}
+	if config.CacheSize > 0 {
+		p.cache, err = lru.New(config.CacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("%v processor: %w", processorName, err)
+		}
+	}
+	return p, nil
+}
+
+// Run parses the user agent string of the event.
+func (p *userAgent) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, fmt.Errorf("could not fetch value for key: %v, Error: %w", p.config.Field, err)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field %v is not a string", p.config.Field)
+	}
+
+	prefix := p.config.Target
+	if prefix != "" {
+		prefix += "."
+	}
+	for k, v := range p.parse(s).toMap().Flatten() {
+		if _, err := event.PutValue(prefix+k, v); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+func (p *userAgent) parse(s string) *client {
+	if p.cache == nil {
+		return p.parser.parse(s)
+	}
+	if c, ok := p.cache.Get(s); ok {
+		return c.(*client)
+	}
+	c := p.parser.parse(s)
+	p.cache.Add(s, c)
+	return c
+}
+
+func (p *userAgent) String() string {
+	return fmt.Sprintf("%v=[field=%v, target=%v, regexes_file=%v, ignore_missing=%v, cache_size=%v]",
+		processorName, p.config.Field, p.config.Target, p.config.RegexesFile,
+		p.config.IgnoreMissing, p.config.CacheSize)
+}
+
+// toMap returns the ECS user_agent fields of the client.
+func (c *client) toMap() mapstr.M {
+	m := mapstr.M{
+		"name":   c.UserAgent.Family,
+		"device": mapstr.M{"name": c.Device.Family},
+	}
+	if v := version(c.UserAgent.Major, c.UserAgent.Minor, c.UserAgent.Patch); v != "" {
+		m["version"] = v
+	}
+	if c.OS.Family != other {
+		osFields := mapstr.M{
+			"name": c.OS.Family,
+			"full": c.OS.Family,
+		}
+		if v := version(c.OS.Major, c.OS.Minor, c.OS.Patch, c.OS.PatchMinor); v != "" {
+			osFields["version"] = v
+			osFields["full"] = c.OS.Family + " " + v
+		}
+		m["os"] = osFields
+	}
+	return m
+}
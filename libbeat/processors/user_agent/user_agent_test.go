@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const firefox = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+func TestUserAgent(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		input   mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"defaults": {
+			config: mapstr.M{},
+			input:  mapstr.M{"user_agent": mapstr.M{"original": firefox}},
+			want: mapstr.M{
+				"user_agent": mapstr.M{
+					"original": firefox,
+					"name":     "Firefox",
+					"version":  "121.0",
+					"os":       mapstr.M{"name": "Ubuntu", "full": "Ubuntu"},
+					"device":   mapstr.M{"name": "Other"},
+				},
+			},
+		},
+		"field and target": {
+			config: mapstr.M{
+				"field":  "http.user_agent",
+				"target": "client.user_agent",
+			},
+			input: mapstr.M{"http": mapstr.M{"user_agent": "curl/8.4.0"}},
+			want: mapstr.M{
+				"http": mapstr.M{"user_agent": "curl/8.4.0"},
+				"client": mapstr.M{
+					"user_agent": mapstr.M{
+						"name":    "curl",
+						"version": "8.4.0",
+						"device":  mapstr.M{"name": "Other"},
+					},
+				},
+			},
+		},
+		"missing field": {
+			config:  mapstr.M{},
+			input:   mapstr.M{},
+			wantErr: "could not fetch value for key: user_agent.original",
+		},
+		"ignore_missing": {
+			config: mapstr.M{"ignore_missing": true},
+			input:  mapstr.M{},
+			want:   mapstr.M{},
+		},
+		"not a string": {
+			config:  mapstr.M{"ignore_missing": true},
+			input:   mapstr.M{"user_agent": mapstr.M{"original": 42}},
+			wantErr: "is not a string",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestUserAgentRegexesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regexes.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+user_agent_parsers:
+  - regex: '(Internal)/(\d+)'
+    family_replacement: 'Internal Tool'
+`), 0o644))
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{"regexes_file": path}))
+	require.NoError(t, err)
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"user_agent": mapstr.M{"original": "Internal/7"},
+	}})
+	require.NoError(t, err)
+	name, _ := event.GetValue("user_agent.name")
+	assert.Equal(t, "Internal Tool", name)
+}
+
+func TestUserAgentConfig(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte(`user_agent_parsers: [{regex: '('}]`), 0o644))
+
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"all options": {
+			config: mapstr.M{
+				"field":          "http.user_agent",
+				"target":         "client.user_agent",
+				"ignore_missing": true,
+				"cache_size":     10,
+			},
+		},
+		"unknown option": {
+			config:  mapstr.M{"extraneous": "field"},
+			wantErr: "unexpected extraneous option in user_agent",
+		},
+		"negative cache size": {
+			config:  mapstr.M{"cache_size": -1},
+			wantErr: "cache_size",
+		},
+		"missing regexes file": {
+			config:  mapstr.M{"regexes_file": filepath.Join(dir, "missing.yaml")},
+			wantErr: "failed to read regexes file",
+		},
+		"invalid regexes file": {
+			config:  mapstr.M{"regexes_file": invalid},
+			wantErr: "invalid regex 0 in user_agent_parsers",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := processors.New(processors.PluginConfig([]*conf.C{
+				conf.MustNewConfigFrom(mapstr.M{"user_agent": test.config}),
+			}))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
+
+func TestUserAgentCache(t *testing.T) {
+	processor, err := New(conf.MustNewConfigFrom(mapstr.M{"cache_size": 1}))
+	require.NoError(t, err)
+	p := processor.(*userAgent)
+
+	for _, ua := range []string{firefox, firefox, "curl/8.4.0"} {
+		_, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": ua}}})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, p.cache.Len())
+	assert.True(t, p.cache.Contains("curl/8.4.0"))
+
+	// Events must not share the cached fields.
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": "curl/8.4.0"}}})
+	require.NoError(t, err)
+	event.PutValue("user_agent.device.name", "changed")
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": "curl/8.4.0"}}})
+	require.NoError(t, err)
+	device, _ := event.GetValue("user_agent.device.name")
+	assert.Equal(t, "Other", device)
+
+	processor, err = New(conf.MustNewConfigFrom(mapstr.M{"cache_size": 0}))
+	require.NoError(t, err)
+	assert.Nil(t, processor.(*userAgent).cache)
+}
@@ -23,10 +23,12 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 // client connects a beat with the processors and pipeline queue.
@@ -40,6 +42,11 @@ type client struct {
 	eventFlags publisher.EventFlags
 	canDrop    bool
 
+	// routes are the routed outputs of the pipeline. The ACKs of the events
+	// published to them are aggregated by routedACKer.
+	routes      []clientRoute
+	routedACKer *routedACKer
+
 	// Open state, signaling, and sync primitives for coordinating client Close.
 	isOpen    atomic.Bool // set to false during shutdown, such that no new events will be accepted anymore.
 	closeOnce sync.Once   // closeOnce ensure that the client shutdown sequence is only executed once
@@ -49,6 +56,34 @@ type client struct {
 	clientListener beat.ClientListener
 }
 
+// clientRoute is the queue producer of a routed output.
+type clientRoute struct {
+	condition conditions.Condition
+	exclusive bool
+	producer  queue.Producer
+
+	// block is set if publishing waits for the queue to accept the events.
+	// Otherwise the events are buffered in events, and published to the
+	// queue by forwardRoute, so that a full queue doesn't block the client.
+	// The events that don't fit in the buffer are dropped, and counted in
+	// queueFull.
+	block     bool
+	events    chan routedEvent
+	done      chan struct{}
+	queueFull *monitoring.Uint
+}
+
+// routedEvent is an event buffered for a routed output, with its sequence
+// number in the client's routedACKer.
+type routedEvent struct {
+	event publisher.Event
+	seq   uint64
+}
+
+// routedEventsBuffer is the number of events buffered for each routed output
+// that doesn't block, while its queue is full.
+const routedEventsBuffer = 64
+
 type clientCloseWaiter struct {
 	events  atomic.Uint32
 	closing atomic.Bool
@@ -117,10 +152,10 @@ func (c *client) publish(e beat.Event) {
 	}
 
 	var published bool
-	if c.canDrop {
-		_, published = c.producer.TryPublish(pubEvent)
+	if len(c.routes) > 0 {
+		published = c.publishRouted(pubEvent)
 	} else {
-		_, published = c.producer.Publish(pubEvent)
+		published = c.publishTo(c.producer, pubEvent)
 	}
 
 	if published {
@@ -130,6 +165,118 @@ func (c *client) publish(e beat.Event) {
 	}
 }
 
+func (c *client) publishTo(producer queue.Producer, event publisher.Event) bool {
+	if c.canDrop {
+		_, published := producer.TryPublish(event)
+		return published
+	}
+	_, published := producer.Publish(event)
+	return published
+}
+
+// publishRouted publishes an event to the routed outputs whose condition it
+// matches, and to the main output unless one of them is exclusive. The event
+// is reported as published if any of the outputs accepted it.
+//
+// Routed outputs hold up the client unless their overflow policy is to drop
+// events and the client can drop events, in which case they drop the events
+// their queue can't accept.
+func (c *client) publishRouted(event publisher.Event) bool {
+	var targets []int
+	exclusive := false
+	for i, route := range c.routes {
+		if route.condition == nil || route.condition.Check(&event.Content) {
+			targets = append(targets, i+1)
+			exclusive = exclusive || route.exclusive
+		}
+	}
+	if !exclusive {
+		targets = append([]int{0}, targets...)
+	}
+
+	// Every output but the first gets its own copy of the event, made before
+	// it's published to any output, as outputs may modify the events they
+	// publish.
+	events := make([]publisher.Event, len(targets))
+	for i := range targets {
+		events[i] = event
+		if i > 0 {
+			events[i].Content = *event.Content.Clone()
+		}
+	}
+
+	seq := c.routedACKer.add(targets)
+	published := false
+	for i, target := range targets {
+		var ok bool
+		if target == 0 {
+			ok = c.publishTo(c.producer, events[i])
+		} else {
+			ok = c.publishToRoute(c.routes[target-1], events[i], seq)
+		}
+		if ok {
+			published = true
+		} else if c.canDrop {
+			// Events can only be rejected for clients that don't guarantee
+			// their delivery, or when the client is closing. The event is
+			// ACKed once the outputs that accepted it ACKed it, and not at
+			// all if none of them accepted it.
+			c.routedACKer.cancel(target, seq)
+		}
+	}
+	return published
+}
+
+// publishToRoute publishes an event to a routed output, or buffers it for
+// forwardRoute if the output doesn't block.
+func (c *client) publishToRoute(route clientRoute, event publisher.Event, seq uint64) bool {
+	if route.block {
+		return c.publishTo(route.producer, event)
+	}
+	select {
+	case route.events <- routedEvent{event: event, seq: seq}:
+		return true
+	default:
+		route.queueFull.Inc()
+		return false
+	}
+}
+
+// forwardRoute publishes the events buffered for the routed output with the
+// given index to its queue, until the client is closed. Events are only
+// buffered for clients that can drop events, so the events that can't be
+// published are cancelled, like the events that don't fit in the buffer.
+func (c *client) forwardRoute(output int, route clientRoute) {
+	for {
+		select {
+		case e := <-route.events:
+			if _, published := route.producer.Publish(e.event); !published {
+				c.routedACKer.cancel(output, e.seq)
+			}
+		case <-route.done:
+			for {
+				select {
+				case e := <-route.events:
+					c.routedACKer.cancel(output, e.seq)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// closeProducers closes the queue producers of the main and routed outputs.
+func (c *client) closeProducers() {
+	c.producer.Close()
+	for _, route := range c.routes {
+		route.producer.Close()
+		if route.done != nil {
+			close(route.done)
+		}
+	}
+}
+
 func (c *client) Close() error {
 	if c.isOpen.Swap(false) {
 		// Only do shutdown handling the first time Close is called
@@ -143,7 +290,7 @@ func (c *client) Close() error {
 		c.logger.Debug("client: done closing acker")
 
 		c.logger.Debug("client: close queue producer")
-		c.producer.Close()
+		c.closeProducers()
 		c.onClosed()
 		c.logger.Debug("client: done producer close")
 
@@ -20,8 +20,10 @@ package pipeline
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -35,6 +37,61 @@ type Config struct {
 
 	// Event queue
 	Queue config.Namespace `config:"queue"`
+
+	// Outputs receiving the events matching their condition, in addition
+	// to the main output.
+	Outputs []RoutedOutputConfig `config:"outputs"`
+}
+
+// RoutedOutputConfig configures a named output, with its own queue, that
+// receives the events matching its condition.
+type RoutedOutputConfig struct {
+	Name      string             `config:"name" validate:"required"`
+	When      *conditions.Config `config:"when"`
+	Exclusive bool               `config:"exclusive"`
+	Queue     config.Namespace   `config:"queue"`
+	Overflow  string             `config:"overflow"`
+	Output    config.Namespace   `config:"output"`
+}
+
+func (c *RoutedOutputConfig) Validate() error {
+	if strings.Contains(c.Name, ".") {
+		return fmt.Errorf("output name %q must not contain dots", c.Name)
+	}
+	if !c.Output.IsSet() {
+		return fmt.Errorf("output %q has no output configured", c.Name)
+	}
+	switch OverflowPolicy(c.Overflow) {
+	case "", OverflowDrop, OverflowBlock:
+	default:
+		return fmt.Errorf("output %q has an invalid overflow policy %q", c.Name, c.Overflow)
+	}
+	if _, err := c.QueueConfig(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueConfig returns the queue settings of the output, which are either set
+// next to the output or in the output settings, like the queue of the main
+// output.
+func (c *RoutedOutputConfig) QueueConfig() (config.Namespace, error) {
+	if !c.Output.IsSet() {
+		return c.Queue, nil
+	}
+	var outputQueue struct {
+		Queue config.Namespace `config:"queue"`
+	}
+	if err := c.Output.Config().Unpack(&outputQueue); err != nil {
+		return config.Namespace{}, fmt.Errorf("error unpacking the queue settings of output %q: %w", c.Name, err)
+	}
+	if !outputQueue.Queue.IsSet() {
+		return c.Queue, nil
+	}
+	if c.Queue.IsSet() {
+		return config.Namespace{}, fmt.Errorf("output %q has queue and output level queue settings defined, only one is allowed", c.Name)
+	}
+	return outputQueue.Queue, nil
 }
 
 // validateClientConfig checks a ClientConfig can be used with (*Pipeline).ConnectWith.
@@ -30,9 +30,14 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/spillqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 
 	//"github.com/elastic/beats/v7/libbeat/tests/resources"
 
@@ -243,3 +248,42 @@ func TestQueueProducerBlocksUntilOutputIsSet(t *testing.T) {
 	})
 	assert.True(t, allFinished, "All queueProducer requests should be unblocked once an output is set")
 }
+
+func TestQueueMetricsReportedUnderPipeline(t *testing.T) {
+	diskSettings := diskqueue.DefaultSettings()
+	diskSettings.Path = t.TempDir()
+	reg := monitoring.NewRegistry()
+	controller := outputController{
+		queueFactory: spillqueue.FactoryForSettings(spillqueue.Settings{
+			Memory:    memqueue.Settings{Events: 10, MaxGetRequest: 10},
+			Disk:      diskSettings,
+			Watermark: 0.5,
+		}),
+		consumer: &eventConsumer{
+			targetChan:    make(chan consumerTarget, 4),
+			retryObserver: nilObserver,
+		},
+		monitors: Monitors{
+			Metrics: reg,
+		},
+	}
+	controller.Set(outputs.Group{
+		Clients: []outputs.Client{newMockClient(nil)},
+	})
+	require.NotNil(t, controller.queue, "Queue should be created after setting nonempty output")
+	defer controller.queue.Close()
+
+	// Nothing consumes the queue, so the events above the watermark of the
+	// memory buffer are spilled to disk.
+	producer := controller.queueProducer(queue.ProducerConfig{})
+	for i := 0; i < 8; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"id": i}))
+		require.True(t, ok, "publish should succeed")
+	}
+
+	assert.Equal(t, uint64(10), reg.Get("pipeline.queue.max_events").(*monitoring.Uint).Get())
+	assert.Eventually(t, func() bool {
+		return reg.Get("pipeline.queue.spilled.events").(*monitoring.Uint).Get() == 3
+	}, time.Second, 10*time.Millisecond, "3 events should be reported as spilled")
+	assert.Equal(t, uint64(0), reg.Get("pipeline.queue.drained.events").(*monitoring.Uint).Get())
+}
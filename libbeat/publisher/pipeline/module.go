@@ -97,6 +97,12 @@ func LoadWithSettings(
 		return nil, err
 	}
 
+	routed, err := loadRoutedOutputs(monitors, config.Outputs, settings.OutputFactory)
+	if err != nil {
+		return nil, err
+	}
+	settings.RoutedOutputs = append(settings.RoutedOutputs, routed...)
+
 	p, err := New(beatInfo, monitors, config.Queue, out, settings)
 	if err != nil {
 		return nil, err
@@ -22,6 +22,7 @@ package pipeline
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -34,8 +35,10 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/spillqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 // Pipeline implementation providint all beats publisher functionality.
@@ -61,6 +64,10 @@ type Pipeline struct {
 
 	outputController *outputController
 
+	// routedOutputs receive the events matching their condition, in
+	// addition to the main output.
+	routedOutputs []routedOutput
+
 	observer observer
 
 	// If waitCloseTimeout is positive, then the pipeline will wait up to the
@@ -81,6 +88,14 @@ type Settings struct {
 	Processors processing.Supporter
 
 	InputQueueSize int
+
+	// OutputFactory creates the routed outputs configured in the pipeline
+	// Config. Routed outputs are not supported if it's nil.
+	OutputFactory func(outputs.Observer, conf.Namespace) (outputs.Group, error)
+
+	// RoutedOutputs are the outputs receiving the events matching their
+	// condition, in addition to the main output.
+	RoutedOutputs []RoutedOutput
 }
 
 // WaitCloseMode enumerates the possible behaviors of WaitClose in a pipeline.
@@ -154,6 +169,44 @@ func New(
 	p.outputController = output
 	p.outputController.Set(out)
 
+	for _, routed := range settings.RoutedOutputs {
+		queueFactory, err := routedQueueFactory(routed.Name, routed.Queue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue for output %q: %w", routed.Name, err)
+		}
+
+		// The retries and queue of each routed output are reported under
+		// outputs.<name>, apart from the ones of the main output.
+		routedMonitors := Monitors{
+			Logger: monitors.Logger.With("output", routed.Name),
+			Tracer: monitors.Tracer,
+		}
+		routedObserver := nilObserver
+		queueFull := &monitoring.Uint{}
+		if monitors.Metrics != nil {
+			metrics := routedOutputMetrics(monitors.Metrics, routed.Name)
+			routedMonitors.Metrics = metrics
+			routedObserver = newMetricsObserver(metrics)
+			queueFull = monitoring.NewUint(metrics, "events.queue_full")
+		}
+
+		controller, err := newOutputController(beat, routedMonitors, routedObserver, queueFactory, settings.InputQueueSize)
+		if err != nil {
+			return nil, err
+		}
+		controller.Set(routed.Output)
+
+		p.routedOutputs = append(p.routedOutputs, routedOutput{
+			name:       routed.Name,
+			condition:  routed.Condition,
+			exclusive:  routed.Exclusive,
+			block:      routed.Overflow != OverflowDrop,
+			queueFull:  queueFull,
+			observer:   routedObserver,
+			controller: controller,
+		})
+	}
+
 	return p, nil
 }
 
@@ -167,9 +220,21 @@ func (p *Pipeline) Close() error {
 	log.Debug("close pipeline")
 
 	// Note: active clients are not closed / disconnected.
+	var wg sync.WaitGroup
+	for _, routed := range p.routedOutputs {
+		wg.Add(1)
+		go func(controller *outputController) {
+			defer wg.Done()
+			controller.WaitClose(p.waitCloseTimeout)
+		}(routed.controller)
+	}
 	p.outputController.WaitClose(p.waitCloseTimeout)
+	wg.Wait()
 
 	p.observer.cleanup()
+	for _, routed := range p.routedOutputs {
+		routed.observer.cleanup()
+	}
 	return nil
 }
 
@@ -231,13 +296,18 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		}
 	}
 
-	producerCfg := queue.ProducerConfig{
-		ACK: func(count int) {
-			client.observer.eventsACKed(count)
-			if ackHandler != nil {
-				ackHandler.ACKEvents(count)
-			}
-		},
+	ackFn := func(count int) {
+		client.observer.eventsACKed(count)
+		if ackHandler != nil {
+			ackHandler.ACKEvents(count)
+		}
+	}
+	producerCfg := queue.ProducerConfig{ACK: ackFn}
+	if len(p.routedOutputs) > 0 {
+		// Events published to routed outputs are ACKed once all the outputs
+		// they were published to have ACKed them. The main output is output 0.
+		client.routedACKer = newRoutedACKer(len(p.routedOutputs)+1, ackFn)
+		producerCfg.ACK = client.routedACKer.ackFunc(0)
 	}
 
 	if ackHandler == nil {
@@ -252,6 +322,28 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		// were still waiting to connect.
 		return nil, fmt.Errorf("client failed to connect because the pipeline is shutting down")
 	}
+	for i, routed := range p.routedOutputs {
+		producer := routed.controller.queueProducer(queue.ProducerConfig{
+			ACK: client.routedACKer.ackFunc(i + 1),
+		})
+		if producer == nil {
+			client.closeProducers()
+			return nil, fmt.Errorf("client failed to connect because the pipeline is shutting down")
+		}
+		route := clientRoute{
+			condition: routed.condition,
+			exclusive: routed.exclusive,
+			producer:  producer,
+			block:     routed.block || !client.canDrop,
+			queueFull: routed.queueFull,
+		}
+		if !route.block {
+			route.events = make(chan routedEvent, routedEventsBuffer)
+			route.done = make(chan struct{})
+			go client.forwardRoute(i+1, route)
+		}
+		client.routes = append(client.routes, route)
+	}
 
 	p.observer.clientConnected()
 	return client, nil
@@ -287,6 +379,12 @@ func queueFactoryForUserConfig(queueType string, userConfig *conf.C) (queue.Queu
 			return nil, err
 		}
 		return diskqueue.FactoryForSettings(settings), nil
+	case spillqueue.QueueType:
+		settings, err := spillqueue.SettingsForUserConfig(userConfig)
+		if err != nil {
+			return nil, err
+		}
+		return spillqueue.FactoryForSettings(settings), nil
 	default:
 		return nil, fmt.Errorf("unrecognized queue type '%v'", queueType)
 	}
@@ -0,0 +1,316 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/spillqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// RoutedOutput is an output that receives the events matching its condition,
+// in addition to the main output of the pipeline. Each routed output has its
+// own queue, and its own retry and ACK state.
+type RoutedOutput struct {
+	Name string
+
+	// Condition selects the events published to the output. If nil, all
+	// events are published to it.
+	Condition conditions.Condition
+
+	// Exclusive is set if the events published to the output are not
+	// published to the main output.
+	Exclusive bool
+
+	// Queue is the queue configuration of the output. The memory queue
+	// with its default settings is used if it's not set.
+	Queue conf.Namespace
+
+	// Overflow sets what happens to the events published while the queue
+	// of the output is full. Publishing blocks if it's not set.
+	Overflow OverflowPolicy
+
+	Output outputs.Group
+}
+
+// OverflowPolicy sets what happens to the events published to a routed
+// output while its queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop drops the events, and counts them in the
+	// outputs.<name>.events.queue_full metric. It only applies to clients
+	// that can drop events, the other clients block, so that events are
+	// never acknowledged before all their outputs received them.
+	OverflowDrop OverflowPolicy = "drop"
+
+	// OverflowBlock waits for the queue to accept the events, blocking the
+	// publishing client, and with it the other outputs.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// routedOutput is the pipeline side of a RoutedOutput.
+type routedOutput struct {
+	name       string
+	condition  conditions.Condition
+	exclusive  bool
+	block      bool
+	queueFull  *monitoring.Uint
+	observer   observer
+	controller *outputController
+}
+
+// loadRoutedOutputs creates the routed outputs configured in cfgs, using
+// makeOutput to create the output clients.
+func loadRoutedOutputs(
+	monitors Monitors,
+	cfgs []RoutedOutputConfig,
+	makeOutput func(outputs.Observer, conf.Namespace) (outputs.Group, error),
+) ([]RoutedOutput, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	if makeOutput == nil {
+		return nil, fmt.Errorf("outputs are not supported by this pipeline")
+	}
+
+	names := make(map[string]bool, len(cfgs))
+	routed := make([]RoutedOutput, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("output %q is configured more than once", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		var condition conditions.Condition
+		if cfg.When != nil {
+			var err error
+			condition, err = conditions.NewCondition(cfg.When)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create condition of output %q: %w", cfg.Name, err)
+			}
+		}
+
+		queue, err := cfg.QueueConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := loadRoutedOutput(monitors, cfg, makeOutput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output %q: %w", cfg.Name, err)
+		}
+		routed = append(routed, RoutedOutput{
+			Name:      cfg.Name,
+			Condition: condition,
+			Exclusive: cfg.Exclusive,
+			Queue:     queue,
+			Overflow:  OverflowPolicy(cfg.Overflow),
+			Output:    out,
+		})
+	}
+	return routed, nil
+}
+
+// loadRoutedOutput creates a routed output, reporting its metrics under
+// outputs.<name>, with the same layout as the main output metrics.
+func loadRoutedOutput(
+	monitors Monitors,
+	cfg RoutedOutputConfig,
+	makeOutput func(outputs.Observer, conf.Namespace) (outputs.Group, error),
+) (outputs.Group, error) {
+	if publishDisabled {
+		return outputs.Group{}, nil
+	}
+
+	var outStats outputs.Observer
+	if monitors.Metrics != nil {
+		metrics := routedOutputMetrics(monitors.Metrics, cfg.Name)
+		if err := metrics.Clear(); err != nil {
+			return outputs.Group{}, err
+		}
+		outStats = outputs.NewStats(metrics)
+		monitoring.NewString(metrics, "type").Set(cfg.Output.Name())
+	}
+
+	out, err := makeOutput(outStats, cfg.Output)
+	if err != nil {
+		return outputs.Group{}, err
+	}
+
+	// The queue of the output settings is created by the pipeline from
+	// RoutedOutputConfig.QueueConfig, in the directory of the output.
+	out.QueueFactory = nil
+	return out, nil
+}
+
+// routedOutputMetrics returns the registry of the metrics of a routed output,
+// creating it if needed.
+func routedOutputMetrics(metrics *monitoring.Registry, name string) *monitoring.Registry {
+	routedMetrics := metrics.GetRegistry("outputs")
+	if routedMetrics == nil {
+		routedMetrics = metrics.NewRegistry("outputs")
+	}
+	if m := routedMetrics.GetRegistry(name); m != nil {
+		return m
+	}
+	return routedMetrics.NewRegistry(name)
+}
+
+// routedQueueFactory creates the queue of a routed output. Disk and spill
+// queues without a path are stored in a directory named after the output, so
+// that they don't share the directory of the main output's queue.
+func routedQueueFactory(name string, cfg conf.Namespace) (queue.QueueFactory, error) {
+	switch cfg.Name() {
+	case diskqueue.QueueType:
+		settings, err := diskqueue.SettingsForUserConfig(cfg.Config())
+		if err != nil {
+			return nil, err
+		}
+		if settings.Path == "" {
+			settings.Path = paths.Resolve(paths.Data, "diskqueue-"+name)
+		}
+		return diskqueue.FactoryForSettings(settings), nil
+	case spillqueue.QueueType:
+		settings, err := spillqueue.SettingsForUserConfig(cfg.Config())
+		if err != nil {
+			return nil, err
+		}
+		// The spill queue sets its own default path, so look for the path
+		// in the user config instead.
+		if hasPath, _ := cfg.Config().Has("disk.path", -1); !hasPath {
+			settings.Disk.Path = paths.Resolve(paths.Data, "spillqueue-"+name)
+		}
+		return spillqueue.FactoryForSettings(settings), nil
+	case "":
+		return queueFactoryForUserConfig(defaultQueueType, nil)
+	default:
+		return queueFactoryForUserConfig(cfg.Name(), cfg.Config())
+	}
+}
+
+// routedACKer aggregates the ACKs of the outputs events are published to.
+// Events are reported as ACKed, in publishing order, once all of the outputs
+// they were published to have ACKed them. Like events dropped by the queue of
+// the main output, events cancelled by all their outputs are not reported.
+type routedACKer struct {
+	mu sync.Mutex
+
+	// pending holds the state of each event, in publishing order. first is
+	// the sequence number of pending[0].
+	pending []routedEventState
+	first   uint64
+
+	// published holds, for each output, the sequence numbers of the events
+	// published to the output that it has not ACKed yet.
+	published [][]uint64
+
+	// ackMu serializes the calls to ack, so that they are made in the order
+	// the events are collected.
+	ackMu sync.Mutex
+	ack   func(count int)
+}
+
+// routedEventState holds the number of outputs yet to ACK or cancel an
+// event, and whether any of them ACKed it.
+type routedEventState struct {
+	outputs int
+	acked   bool
+}
+
+func newRoutedACKer(outputs int, ack func(count int)) *routedACKer {
+	return &routedACKer{
+		published: make([][]uint64, outputs),
+		ack:       ack,
+	}
+}
+
+// add registers an event published to the given outputs, and returns its
+// sequence number.
+func (a *routedACKer) add(outputs []int) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seq := a.first + uint64(len(a.pending))
+	a.pending = append(a.pending, routedEventState{outputs: len(outputs)})
+	for _, output := range outputs {
+		a.published[output] = append(a.published[output], seq)
+	}
+	return seq
+}
+
+// cancel removes an event from the events an output has to ACK, when the
+// output failed to accept it.
+func (a *routedACKer) cancel(output int, seq uint64) {
+	a.mu.Lock()
+	published := a.published[output]
+	for i := len(published) - 1; i >= 0; i-- {
+		if published[i] == seq {
+			a.published[output] = append(published[:i], published[i+1:]...)
+			break
+		}
+	}
+	a.pending[seq-a.first].outputs--
+	a.collect()
+}
+
+// ackFunc returns the ACK callback of an output.
+func (a *routedACKer) ackFunc(output int) func(count int) {
+	return func(count int) {
+		a.mu.Lock()
+		published := a.published[output]
+		for _, seq := range published[:count] {
+			state := &a.pending[seq-a.first]
+			state.outputs--
+			state.acked = true
+		}
+		a.published[output] = published[count:]
+		a.collect()
+	}
+}
+
+// collect removes the events ACKed by all their outputs from the head of
+// pending, and reports them. It must be called with mu held, and releases it.
+func (a *routedACKer) collect() {
+	n, acked := 0, 0
+	for n < len(a.pending) && a.pending[n].outputs == 0 {
+		if a.pending[n].acked {
+			acked++
+		}
+		n++
+	}
+	a.pending = a.pending[n:]
+	a.first += uint64(n)
+	if acked == 0 {
+		a.mu.Unlock()
+		return
+	}
+
+	a.ackMu.Lock()
+	a.mu.Unlock()
+	defer a.ackMu.Unlock()
+	a.ack(acked)
+}
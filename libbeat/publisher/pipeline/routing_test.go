@@ -0,0 +1,623 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func TestRoutedACKer(t *testing.T) {
+	t.Run("events are ACKed once all their outputs ACKed them", func(t *testing.T) {
+		var acked []int
+		a := newRoutedACKer(3, func(count int) { acked = append(acked, count) })
+		ack0, ack1, ack2 := a.ackFunc(0), a.ackFunc(1), a.ackFunc(2)
+
+		a.add([]int{0, 1})
+		a.add([]int{0})
+		a.add([]int{0, 1, 2})
+
+		ack0(3)
+		assert.Empty(t, acked)
+
+		ack1(1)
+		assert.Equal(t, []int{2}, acked)
+
+		ack2(1)
+		assert.Equal(t, []int{2}, acked)
+
+		ack1(1)
+		assert.Equal(t, []int{2, 1}, acked)
+	})
+
+	t.Run("cancelled events are not waited for", func(t *testing.T) {
+		var acked []int
+		a := newRoutedACKer(2, func(count int) { acked = append(acked, count) })
+
+		seq := a.add([]int{0, 1})
+		a.ackFunc(0)(1)
+		assert.Empty(t, acked)
+
+		a.cancel(1, seq)
+		assert.Equal(t, []int{1}, acked)
+
+		seq = a.add([]int{0, 1})
+		a.ackFunc(1)(1)
+		a.cancel(0, seq)
+		assert.Equal(t, []int{1, 1}, acked)
+	})
+
+	t.Run("events cancelled by all their outputs are not ACKed", func(t *testing.T) {
+		var acked []int
+		a := newRoutedACKer(2, func(count int) { acked = append(acked, count) })
+		ack0 := a.ackFunc(0)
+
+		dropped := a.add([]int{0, 1})
+		a.add([]int{0})
+		a.cancel(0, dropped)
+		a.cancel(1, dropped)
+		assert.Empty(t, acked)
+
+		// Only the event accepted by an output is reported.
+		ack0(1)
+		assert.Equal(t, []int{1}, acked)
+	})
+
+	t.Run("events can be cancelled after later events were added", func(t *testing.T) {
+		var acked []int
+		a := newRoutedACKer(2, func(count int) { acked = append(acked, count) })
+		ack0, ack1 := a.ackFunc(0), a.ackFunc(1)
+
+		first := a.add([]int{0, 1})
+		a.add([]int{0, 1})
+		ack0(2)
+		a.cancel(1, first)
+		assert.Equal(t, []int{1}, acked)
+
+		// The remaining event of output 1 is the second one.
+		ack1(1)
+		assert.Equal(t, []int{1, 1}, acked)
+	})
+}
+
+func TestRoutedOutputs(t *testing.T) {
+	logp.TestingSetup()
+
+	var (
+		mu       sync.Mutex
+		main     []beat.Event
+		routed   []beat.Event
+		acked    int
+		released = make(chan struct{})
+	)
+	record := func(events *[]beat.Event) func(publisher.Batch) error {
+		return func(batch publisher.Batch) error {
+			mu.Lock()
+			for _, e := range batch.Events() {
+				*events = append(*events, e.Content)
+			}
+			mu.Unlock()
+			batch.ACK()
+			return nil
+		}
+	}
+	recordRouted := record(&routed)
+
+	condition, err := conditions.NewCondition(mustConditionConfig(t, map[string]interface{}{
+		"equals.level": "error",
+	}))
+	require.NoError(t, err)
+
+	queueConfig := testQueueConfig(t)
+	p, err := New(beat.Info{}, Monitors{}, queueConfig,
+		outputs.Group{Clients: []outputs.Client{newMockClient(record(&main))}},
+		Settings{
+			RoutedOutputs: []RoutedOutput{{
+				Name:      "errors",
+				Condition: condition,
+				Queue:     queueConfig,
+				Output: outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+					<-released
+					return recordRouted(batch)
+				})}},
+			}},
+		},
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	client, err := p.ConnectWith(beat.ClientConfig{
+		EventListener: acker.RawCounting(func(n int) {
+			mu.Lock()
+			acked += n
+			mu.Unlock()
+		}),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	client.PublishAll([]beat.Event{
+		{Fields: mapstr.M{"level": "info", "n": 1}},
+		{Fields: mapstr.M{"level": "error", "n": 2}},
+		{Fields: mapstr.M{"level": "info", "n": 3}},
+	})
+
+	// The second event is held by the routed output, and the events are
+	// ACKed in order, so only the first event can be ACKed.
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(main) == 3 && acked == 1
+	}), "events were not published to the main output")
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, 1, acked)
+	mu.Unlock()
+
+	close(released)
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return acked == 3
+	}), "events were not ACKed after the routed output ACKed them")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, routed, 1)
+	assert.Equal(t, mapstr.M{"level": "error", "n": 2}, routed[0].Fields)
+}
+
+func TestExclusiveRoutedOutput(t *testing.T) {
+	logp.TestingSetup()
+
+	var (
+		mu     sync.Mutex
+		main   []beat.Event
+		routed []beat.Event
+		acked  int
+	)
+	record := func(events *[]beat.Event) outputs.Group {
+		return outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+			mu.Lock()
+			for _, e := range batch.Events() {
+				*events = append(*events, e.Content)
+			}
+			mu.Unlock()
+			batch.ACK()
+			return nil
+		})}}
+	}
+
+	condition, err := conditions.NewCondition(mustConditionConfig(t, map[string]interface{}{
+		"equals.level": "error",
+	}))
+	require.NoError(t, err)
+
+	queueConfig := testQueueConfig(t)
+	p, err := New(beat.Info{}, Monitors{}, queueConfig, record(&main), Settings{
+		RoutedOutputs: []RoutedOutput{{
+			Name:      "errors",
+			Condition: condition,
+			Exclusive: true,
+			Queue:     queueConfig,
+			Output:    record(&routed),
+		}},
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	client, err := p.ConnectWith(beat.ClientConfig{
+		EventListener: acker.RawCounting(func(n int) {
+			mu.Lock()
+			acked += n
+			mu.Unlock()
+		}),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	client.PublishAll([]beat.Event{
+		{Fields: mapstr.M{"level": "info", "n": 1}},
+		{Fields: mapstr.M{"level": "error", "n": 2}},
+	})
+
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return acked == 2
+	}), "events were not ACKed")
+
+	// The events sent to the exclusive output are not sent to the main
+	// output.
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, main, 1)
+	assert.Equal(t, mapstr.M{"level": "info", "n": 1}, main[0].Fields)
+	require.Len(t, routed, 1)
+	assert.Equal(t, mapstr.M{"level": "error", "n": 2}, routed[0].Fields)
+}
+
+func TestRoutedOutputMetrics(t *testing.T) {
+	logp.TestingSetup()
+
+	var (
+		mu    sync.Mutex
+		acked int
+	)
+	reg := monitoring.NewRegistry()
+	queueConfig := testQueueConfig(t)
+	p, err := New(beat.Info{}, Monitors{Metrics: reg}, queueConfig,
+		outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+			batch.ACK()
+			return nil
+		})}},
+		Settings{
+			RoutedOutputs: []RoutedOutput{{
+				Name:  "failing",
+				Queue: queueConfig,
+				Output: outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+					// Events without delivery guarantees are dropped once
+					// they ran out of retries.
+					batch.Retry()
+					return nil
+				})}},
+			}},
+		},
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	client, err := p.ConnectWith(beat.ClientConfig{
+		EventListener: acker.RawCounting(func(n int) {
+			mu.Lock()
+			acked += n
+			mu.Unlock()
+		}),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	client.Publish(beat.Event{Fields: mapstr.M{"n": 1}})
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return acked == 1
+	}), "the event was not ACKed")
+
+	// The event dropped by the routed output is only reported in its own
+	// metrics.
+	assert.Equal(t, uint64(1), reg.Get("outputs.failing.pipeline.events.dropped").(*monitoring.Uint).Get())
+	assert.Equal(t, uint64(0), reg.Get("pipeline.events.dropped").(*monitoring.Uint).Get())
+}
+
+func TestRoutedOutputOverflow(t *testing.T) {
+	logp.TestingSetup()
+
+	const events = 500
+
+	type result struct {
+		// received and acked are the number of events the main output
+		// received, and that were ACKed, while the routed output was blocked.
+		received, acked int
+		queueFull       uint64
+	}
+
+	// run publishes events to a pipeline whose routed output is blocked
+	// until it's released.
+	run := func(t *testing.T, overflow OverflowPolicy, mode beat.PublishMode) result {
+		var (
+			mu       sync.Mutex
+			main     int
+			acked    int
+			released = make(chan struct{})
+		)
+		reg := monitoring.NewRegistry()
+
+		var routedQueue struct {
+			Queue conf.Namespace `config:"queue"`
+		}
+		require.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{
+			"queue.mem.events":           32,
+			"queue.mem.flush.min_events": 1,
+			"queue.mem.flush.timeout":    0,
+		}).Unpack(&routedQueue))
+
+		p, err := New(beat.Info{}, Monitors{Metrics: reg}, testQueueConfig(t),
+			outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+				mu.Lock()
+				main += len(batch.Events())
+				mu.Unlock()
+				batch.ACK()
+				return nil
+			})}},
+			Settings{
+				RoutedOutputs: []RoutedOutput{{
+					Name:     "blocked",
+					Queue:    routedQueue.Queue,
+					Overflow: overflow,
+					Output: outputs.Group{Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+						<-released
+						batch.ACK()
+						return nil
+					})}},
+				}},
+			},
+		)
+		require.NoError(t, err)
+		defer p.Close()
+
+		clientConfig := beat.ClientConfig{PublishMode: mode}
+		if mode != beat.DropIfFull {
+			clientConfig.EventListener = acker.RawCounting(func(n int) {
+				mu.Lock()
+				acked += n
+				mu.Unlock()
+			})
+		}
+		client, err := p.ConnectWith(clientConfig)
+		require.NoError(t, err)
+		defer client.Close()
+
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			for i := 0; i < events; i++ {
+				client.Publish(beat.Event{Fields: mapstr.M{"n": i}})
+			}
+		}()
+
+		select {
+		case <-published:
+		case <-time.After(time.Second):
+		}
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		res := result{received: main, acked: acked}
+		mu.Unlock()
+		res.queueFull = reg.Get("outputs.blocked.events.queue_full").(*monitoring.Uint).Get()
+
+		close(released)
+		<-published
+		if mode != beat.DropIfFull {
+			require.True(t, waitUntilTrue(5*time.Second, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return acked == events
+			}), "events were not ACKed after the routed output was released")
+		}
+		return res
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		res := run(t, OverflowDrop, beat.DropIfFull)
+		assert.Equal(t, events, res.received, "the blocked output should not hold up the main output")
+		assert.Greater(t, res.queueFull, uint64(0), "dropped events should be counted")
+	})
+
+	t.Run("drop with guaranteed delivery", func(t *testing.T) {
+		// Events of clients that guarantee delivery are never dropped, or
+		// ACKed before the routed output ACKed them.
+		res := run(t, OverflowDrop, beat.DefaultGuarantees)
+		assert.Less(t, res.received, events, "the blocked output should hold up the client")
+		assert.Zero(t, res.acked, "events should not be ACKed while the routed output is blocked")
+		assert.Zero(t, res.queueFull)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		res := run(t, "", beat.DefaultGuarantees)
+		assert.Less(t, res.received, events, "the blocked output should hold up the client")
+		assert.Zero(t, res.acked, "events should not be ACKed while the routed output is blocked")
+		assert.Zero(t, res.queueFull)
+	})
+}
+
+func TestLoadRoutedOutputs(t *testing.T) {
+	var cfg Config
+	require.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []interface{}{
+			map[string]interface{}{
+				"name":             "errors",
+				"when.equals":      map[string]interface{}{"level": "error"},
+				"exclusive":        true,
+				"output.discard":   map[string]interface{}{},
+				"queue.mem.events": 64,
+			},
+			map[string]interface{}{
+				"name":           "all",
+				"overflow":       "block",
+				"output.discard": map[string]interface{}{},
+			},
+		},
+	}).Unpack(&cfg))
+
+	var created []string
+	makeOutput := func(_ outputs.Observer, cfg conf.Namespace) (outputs.Group, error) {
+		created = append(created, cfg.Name())
+		return outputs.Group{}, nil
+	}
+
+	routed, err := loadRoutedOutputs(Monitors{}, cfg.Outputs, makeOutput)
+	require.NoError(t, err)
+	require.Len(t, routed, 2)
+	assert.Equal(t, []string{"discard", "discard"}, created)
+	assert.Equal(t, "errors", routed[0].Name)
+	assert.NotNil(t, routed[0].Condition)
+	assert.True(t, routed[0].Exclusive)
+	assert.Equal(t, "mem", routed[0].Queue.Name())
+	assert.Equal(t, "all", routed[1].Name)
+	assert.Nil(t, routed[1].Condition)
+	assert.False(t, routed[1].Exclusive)
+	assert.Equal(t, OverflowBlock, routed[1].Overflow)
+
+	_, err = loadRoutedOutputs(Monitors{}, append(cfg.Outputs, cfg.Outputs[0]), makeOutput)
+	assert.ErrorContains(t, err, `output "errors" is configured more than once`)
+
+	_, err = loadRoutedOutputs(Monitors{}, cfg.Outputs, nil)
+	assert.Error(t, err)
+
+	err = conf.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []interface{}{map[string]interface{}{"name": "errors"}},
+	}).Unpack(&Config{})
+	assert.ErrorContains(t, err, `output "errors" has no output configured`)
+
+	err = conf.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []interface{}{map[string]interface{}{
+			"name":           "errors",
+			"overflow":       "retry",
+			"output.discard": map[string]interface{}{},
+		}},
+	}).Unpack(&Config{})
+	assert.ErrorContains(t, err, `output "errors" has an invalid overflow policy "retry"`)
+
+	err = conf.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []interface{}{map[string]interface{}{
+			"name":                            "errors",
+			"queue.mem.events":                64,
+			"output.discard.queue.mem.events": 128,
+		}},
+	}).Unpack(&Config{})
+	assert.ErrorContains(t, err, `output "errors" has queue and output level queue settings defined, only one is allowed`)
+}
+
+func TestRoutedQueueDirectory(t *testing.T) {
+	defer func(p *paths.Path) { paths.Paths = p }(paths.Paths)
+	paths.Paths = paths.New()
+	require.NoError(t, paths.InitPaths(&paths.Path{Home: t.TempDir()}))
+	explicit := t.TempDir()
+
+	tests := map[string]struct {
+		queue map[string]interface{}
+		dir   string
+	}{
+		"disk": {
+			queue: map[string]interface{}{"queue.disk.max_size": "100MB"},
+			dir:   paths.Resolve(paths.Data, "diskqueue-archive"),
+		},
+		"spill": {
+			queue: map[string]interface{}{"queue.spill.disk.max_size": "100MB"},
+			dir:   paths.Resolve(paths.Data, "spillqueue-archive"),
+		},
+		"spill with path": {
+			queue: map[string]interface{}{
+				"queue.spill.disk.max_size": "100MB",
+				"queue.spill.disk.path":     explicit,
+			},
+			dir: explicit,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cfg struct {
+				Queue conf.Namespace `config:"queue"`
+			}
+			require.NoError(t, conf.MustNewConfigFrom(test.queue).Unpack(&cfg))
+
+			factory, err := routedQueueFactory("archive", cfg.Queue)
+			require.NoError(t, err)
+			q, err := factory(logp.NewLogger("test"), nil, 0, nil)
+			require.NoError(t, err)
+			defer q.Close()
+
+			_, err = os.Stat(filepath.Join(test.dir, "state.dat"))
+			assert.NoError(t, err, "the queue should be stored in %v", test.dir)
+		})
+	}
+}
+
+func TestRoutedOutputQueueDirectory(t *testing.T) {
+	defer func(p *paths.Path) { paths.Paths = p }(paths.Paths)
+	paths.Paths = paths.New()
+	require.NoError(t, paths.InitPaths(&paths.Path{Home: t.TempDir()}))
+
+	var cfg Config
+	require.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []interface{}{
+			map[string]interface{}{
+				"name":                               "archive",
+				"output.discard.queue.disk.max_size": "100MB",
+			},
+		},
+	}).Unpack(&cfg))
+
+	// Create the output group like outputs.Success does, with the queue
+	// of the output settings.
+	makeOutput := func(_ outputs.Observer, cfg conf.Namespace) (outputs.Group, error) {
+		var settings struct {
+			Queue conf.Namespace `config:"queue"`
+		}
+		if err := cfg.Config().Unpack(&settings); err != nil {
+			return outputs.Group{}, err
+		}
+		return outputs.Success(settings.Queue, 0, 0, nil)
+	}
+
+	routed, err := loadRoutedOutputs(Monitors{}, cfg.Outputs, makeOutput)
+	require.NoError(t, err)
+	require.Len(t, routed, 1)
+	assert.Nil(t, routed[0].Output.QueueFactory, "the queue must be created from the routed output settings")
+	assert.Equal(t, "disk", routed[0].Queue.Name())
+
+	factory, err := routedQueueFactory(routed[0].Name, routed[0].Queue)
+	require.NoError(t, err)
+	q, err := factory(logp.NewLogger("test"), nil, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = os.Stat(filepath.Join(paths.Resolve(paths.Data, "diskqueue-archive"), "state.dat"))
+	assert.NoError(t, err, "the queue should be stored in the directory of the output")
+	_, err = os.Stat(paths.Resolve(paths.Data, "diskqueue"))
+	assert.True(t, os.IsNotExist(err), "the queue should not use the directory of the main output")
+}
+
+func mustConditionConfig(t *testing.T, fields map[string]interface{}) *conditions.Config {
+	t.Helper()
+	var c conditions.Config
+	require.NoError(t, conf.MustNewConfigFrom(fields).Unpack(&c))
+	return &c
+}
+
+// testQueueConfig returns a memory queue configuration flushing events
+// immediately.
+func testQueueConfig(t *testing.T) conf.Namespace {
+	t.Helper()
+	var cfg struct {
+		Queue conf.Namespace `config:"queue"`
+	}
+	require.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{
+		"queue.mem.flush.timeout": 0,
+	}).Unpack(&cfg))
+	return cfg.Queue
+}
@@ -36,6 +36,12 @@ type Observer interface {
 	AddEvent(byteCount int)
 	ConsumeEvents(eventCount int, byteCount int)
 	RemoveEvents(eventCount int, byteCount int)
+
+	// Used by queues that combine memory and disk storage to report events
+	// that were written to disk because memory was full or the output
+	// stalled, and events that were later read back from disk.
+	SpillEvents(eventCount int)
+	DrainEvents(eventCount int)
 }
 
 type queueObserver struct {
@@ -53,6 +59,9 @@ type queueObserver struct {
 	filledBytes  *monitoring.Uint  // gauge
 	filledPct    *monitoring.Float // gauge
 
+	spilledEvents *monitoring.Uint
+	drainedEvents *monitoring.Uint
+
 	// backwards compatibility: the metric "acked" is the old name for
 	// "removed.events". Ideally we would like to define an alias in the
 	// monitoring API, but until that's possible we shadow it with this
@@ -93,6 +102,9 @@ func NewQueueObserver(metrics *monitoring.Registry) Observer {
 		filledBytes:  monitoring.NewUint(queueMetrics, "filled.bytes"),  // gauge
 		filledPct:    monitoring.NewFloat(queueMetrics, "filled.pct"),   // gauge
 
+		spilledEvents: monitoring.NewUint(queueMetrics, "spilled.events"),
+		drainedEvents: monitoring.NewUint(queueMetrics, "drained.events"),
+
 		// backwards compatibility: "acked" is an alias for "removed.events".
 		acked: monitoring.NewUint(queueMetrics, "acked"),
 	}
@@ -137,6 +149,14 @@ func (ob *queueObserver) RemoveEvents(eventCount int, byteCount int) {
 	ob.updateFilledPct()
 }
 
+func (ob *queueObserver) SpillEvents(eventCount int) {
+	ob.spilledEvents.Add(uint64(eventCount))
+}
+
+func (ob *queueObserver) DrainEvents(eventCount int) {
+	ob.drainedEvents.Add(uint64(eventCount))
+}
+
 func (ob *queueObserver) updateFilledPct() {
 	if maxBytes := ob.maxBytes.Get(); maxBytes > 0 {
 		ob.filledPct.Set(float64(ob.filledBytes.Get()) / float64(maxBytes))
@@ -151,3 +171,5 @@ func (nilObserver) Restore(_ int, _ int)       {}
 func (nilObserver) AddEvent(_ int)             {}
 func (nilObserver) ConsumeEvents(_ int, _ int) {}
 func (nilObserver) RemoveEvents(_ int, _ int)  {}
+func (nilObserver) SpillEvents(_ int)          {}
+func (nilObserver) DrainEvents(_ int)          {}
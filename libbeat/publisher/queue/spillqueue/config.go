@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spillqueue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// Settings contains the configuration fields to create a new spill queue.
+type Settings struct {
+	// Settings for the in-memory buffer that holds events during normal
+	// operation.
+	Memory memqueue.Settings
+
+	// Settings for the disk queue that events are spilled to when the
+	// memory buffer can't keep up.
+	Disk diskqueue.Settings
+
+	// Watermark is the fraction of the memory buffer that may be filled
+	// before new events are written to disk instead.
+	Watermark float64
+
+	// If positive, StallTimeout is how long the memory buffer may hold
+	// events without any of them being consumed or acknowledged before
+	// the output is considered stalled and new events are written to disk.
+	StallTimeout time.Duration
+}
+
+// userConfig holds the parameters for a spill queue that are configurable
+// by the end user in the beats yml file. The "mem" and "disk" sections
+// accept the same options as queue.mem and queue.disk.
+type userConfig struct {
+	Memory *c.C `config:"mem"`
+	Disk   *c.C `config:"disk"`
+
+	Watermark    float64       `config:"watermark"`
+	StallTimeout time.Duration `config:"stall_timeout" validate:"min=0"`
+}
+
+var defaultUserConfig = userConfig{
+	Watermark:    0.8,
+	StallTimeout: 30 * time.Second,
+}
+
+func (c *userConfig) Validate() error {
+	if c.Disk == nil {
+		return errors.New("spill queue requires a disk section with max_size")
+	}
+	if c.Watermark <= 0 || c.Watermark > 1 {
+		return fmt.Errorf(
+			"spill queue watermark (%v) must be greater than 0 and at most 1",
+			c.Watermark)
+	}
+	return nil
+}
+
+// SettingsForUserConfig returns a Settings struct initialized with the
+// end-user-configurable settings in the given config tree.
+func SettingsForUserConfig(cfg *c.C) (Settings, error) {
+	config := defaultUserConfig
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return Settings{}, fmt.Errorf("couldn't unpack spill queue config: %w", err)
+		}
+	}
+	// Validate is called by Unpack, but an empty config never reaches it.
+	if err := config.Validate(); err != nil {
+		return Settings{}, err
+	}
+
+	memSettings, err := memqueue.SettingsForUserConfig(config.Memory)
+	if err != nil {
+		return Settings{}, err
+	}
+	diskSettings, err := diskqueue.SettingsForUserConfig(config.Disk)
+	if err != nil {
+		return Settings{}, err
+	}
+	if diskSettings.Path == "" {
+		// Don't share a directory with a standalone disk queue from a
+		// previous configuration.
+		diskSettings.Path = paths.Resolve(paths.Data, "spillqueue")
+	}
+
+	return Settings{
+		Memory:       memSettings,
+		Disk:         diskSettings,
+		Watermark:    config.Watermark,
+		StallTimeout: config.StallTimeout,
+	}, nil
+}
+
+// memoryThreshold returns the number of events the memory buffer can hold
+// before new events are spilled to disk.
+func (settings Settings) memoryThreshold() int64 {
+	threshold := int64(float64(settings.Memory.Events) * settings.Watermark)
+	if threshold < 1 {
+		threshold = 1
+	}
+	return threshold
+}
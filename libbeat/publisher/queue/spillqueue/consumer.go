@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spillqueue
+
+import (
+	"io"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// batchReader reads batches from one of the spill queue's underlying
+// queues in its own goroutine, so (*spillQueue).Get can wait on both
+// queues at once. A batchReader only reads when it has been asked to,
+// so at most one batch per queue is ever waiting to be returned by Get.
+type batchReader struct {
+	queue queue.Queue
+
+	// Get requests, holding the requested event count, are sent to
+	// requestChan. Only one request is outstanding at a time.
+	requestChan chan int
+
+	// Batches read in response to a request are sent to responseChan.
+	// It's closed when the underlying queue can't return more batches.
+	responseChan chan queue.Batch
+
+	// pending is true if a request has been sent and its response hasn't
+	// been received yet. Only accessed by (*spillQueue).Get.
+	pending bool
+
+	// closed is true once responseChan has been closed. Only accessed by
+	// (*spillQueue).Get.
+	closed bool
+}
+
+func newBatchReader(q queue.Queue) *batchReader {
+	return &batchReader{
+		queue:        q,
+		requestChan:  make(chan int, 1),
+		responseChan: make(chan queue.Batch, 1),
+	}
+}
+
+func (r *batchReader) run() {
+	defer close(r.responseChan)
+	for {
+		select {
+		case count := <-r.requestChan:
+			batch, err := r.queue.Get(count)
+			if err != nil {
+				return
+			}
+			r.responseChan <- batch
+		case <-r.queue.Done():
+			return
+		}
+	}
+}
+
+// request asks the reader for a batch of up to eventCount events, unless
+// it is already working on one.
+func (r *batchReader) request(eventCount int) {
+	if !r.pending && !r.closed {
+		r.pending = true
+		r.requestChan <- eventCount
+	}
+}
+
+// channel returns the reader's response channel, or nil if it has no
+// pending request.
+func (r *batchReader) channel() chan queue.Batch {
+	if !r.pending {
+		return nil
+	}
+	return r.responseChan
+}
+
+// receive updates the reader's state after a read from its response
+// channel, and returns the batch if there was one.
+func (r *batchReader) receive(batch queue.Batch, ok bool) (queue.Batch, bool) {
+	r.pending = false
+	if !ok {
+		r.closed = true
+		return nil, false
+	}
+	return batch, true
+}
+
+func (sq *spillQueue) Get(eventCount int) (queue.Batch, error) {
+	sq.getLock.Lock()
+	defer sq.getLock.Unlock()
+
+	for {
+		sq.diskReader.request(eventCount)
+		sq.memReader.request(eventCount)
+		if sq.diskReader.closed && sq.memReader.closed {
+			return nil, io.EOF
+		}
+
+		// Spilled events take priority, so the disk queue doesn't fall
+		// further behind while the memory queue is busy.
+		select {
+		case batch, ok := <-sq.diskReader.channel():
+			if batch, ok := sq.diskReader.receive(batch, ok); ok {
+				return batch, nil
+			}
+			continue
+		default:
+		}
+
+		select {
+		case batch, ok := <-sq.diskReader.channel():
+			if batch, ok := sq.diskReader.receive(batch, ok); ok {
+				return batch, nil
+			}
+		case batch, ok := <-sq.memReader.channel():
+			if batch, ok := sq.memReader.receive(batch, ok); ok {
+				return batch, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spillqueue
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// spillProducer publishes to the memory queue's producer unless the spill
+// queue says to spill, in which case it publishes to the disk queue's.
+type spillProducer struct {
+	queue *spillQueue
+
+	memProducer  queue.Producer
+	diskProducer queue.Producer
+
+	acks *producerACKs
+}
+
+func newProducer(sq *spillQueue, cfg queue.ProducerConfig) *spillProducer {
+	acks := &producerACKs{callback: cfg.ACK}
+	return &spillProducer{
+		queue: sq,
+		memProducer: sq.memQueue.Producer(queue.ProducerConfig{
+			ACK: func(count int) { acks.ack(false, count) },
+		}),
+		diskProducer: sq.diskQueue.Producer(queue.ProducerConfig{
+			ACK: func(count int) { acks.ack(true, count) },
+		}),
+		acks: acks,
+	}
+}
+
+func (p *spillProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, true)
+}
+
+func (p *spillProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, false)
+}
+
+func (p *spillProducer) publish(entry queue.Entry, shouldBlock bool) (queue.EntryID, bool) {
+	if !p.queue.shouldSpill() {
+		// The memory queue can still fill up between the watermark check
+		// and the insert, so use TryPublish and fall through to disk if the
+		// memory queue doesn't accept the event.
+		p.acks.add(false)
+		if id, ok := p.memProducer.TryPublish(entry); ok {
+			return id, true
+		}
+		p.acks.cancel()
+	}
+
+	p.acks.add(true)
+	var id queue.EntryID
+	var ok bool
+	if shouldBlock {
+		id, ok = p.diskProducer.Publish(entry)
+	} else {
+		id, ok = p.diskProducer.TryPublish(entry)
+	}
+	if !ok {
+		p.acks.cancel()
+	}
+	return id, ok
+}
+
+func (p *spillProducer) Close() {
+	p.memProducer.Close()
+	p.diskProducer.Close()
+}
+
+// producerACKs merges the acknowledgments from a spillProducer's memory
+// and disk producers. Each underlying queue acknowledges its own events in
+// order, but the two queues progress independently, while the pipeline
+// expects a producer's events to be acknowledged in the order they were
+// published. producerACKs records which queue received each run of
+// consecutive events, and only forwards an acknowledgment once every
+// earlier event has been acknowledged as well.
+type producerACKs struct {
+	sync.Mutex
+
+	// The ACK callback from the producer's configuration, may be nil.
+	callback func(count int)
+
+	// Runs of consecutive published events in publish order. The first
+	// run is the oldest one with events that haven't been forwarded to
+	// callback yet.
+	runs []publishRun
+
+	// Acknowledgments received from each queue that haven't been
+	// forwarded to callback yet.
+	pendingMem  int
+	pendingDisk int
+}
+
+type publishRun struct {
+	disk bool
+
+	// The number of events in this run, and how many of them have been
+	// forwarded to callback.
+	count int
+	acked int
+}
+
+// add records an event that is about to be published to the given queue.
+// It must be called before the event is published, since the queue could
+// acknowledge it before Publish returns.
+func (a *producerACKs) add(disk bool) {
+	a.Lock()
+	defer a.Unlock()
+	if n := len(a.runs); n > 0 && a.runs[n-1].disk == disk {
+		a.runs[n-1].count++
+		return
+	}
+	a.runs = append(a.runs, publishRun{disk: disk, count: 1})
+}
+
+// cancel undoes the most recent add, after a failed publish.
+func (a *producerACKs) cancel() {
+	a.Lock()
+	defer a.Unlock()
+	// The failed event is never acknowledged, so the run containing it
+	// can't have been completed and is still the last one.
+	n := len(a.runs)
+	a.runs[n-1].count--
+	if a.runs[n-1].count == 0 {
+		a.runs = a.runs[:n-1]
+	}
+	// Removing the event may have completed the oldest runs.
+	a.forward()
+}
+
+// ack handles an acknowledgment of count events from the given queue.
+func (a *producerACKs) ack(disk bool, count int) {
+	a.Lock()
+	defer a.Unlock()
+	if disk {
+		a.pendingDisk += count
+	} else {
+		a.pendingMem += count
+	}
+	a.forward()
+}
+
+// forward sends every acknowledgment that is now in publish order to the
+// callback. The caller must hold the lock.
+func (a *producerACKs) forward() {
+	total := 0
+	for len(a.runs) > 0 {
+		run := &a.runs[0]
+		pending := &a.pendingMem
+		if run.disk {
+			pending = &a.pendingDisk
+		}
+		n := run.count - run.acked
+		if *pending < n {
+			n = *pending
+		}
+		run.acked += n
+		*pending -= n
+		total += n
+		if run.acked < run.count {
+			break
+		}
+		a.runs = a.runs[1:]
+	}
+	if total > 0 && a.callback != nil {
+		a.callback(total)
+	}
+}
@@ -0,0 +1,244 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spillqueue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// The string used to specify this queue in beats configurations.
+const QueueType = "spill"
+
+// spillQueue is a queue.Queue that keeps events in a memory queue during
+// normal operation, and writes them to a disk queue when the memory queue
+// passes its watermark or the output stops consuming events. Consumers
+// read from both queues, preferring events from disk so that spilled
+// events drain back out as soon as the output recovers.
+//
+// Events are delivered in order within each of the underlying queues, but
+// spilled events may be delivered before or after newer events that were
+// kept in memory.
+type spillQueue struct {
+	logger   *logp.Logger
+	settings Settings
+
+	memQueue  queue.Queue
+	diskQueue queue.Queue
+
+	// Tracks the memory queue's occupancy to decide when to spill.
+	memObserver *memObserver
+
+	// Helpers that read batches from the underlying queues on behalf of
+	// (*spillQueue).Get.
+	memReader  *batchReader
+	diskReader *batchReader
+
+	// getLock serializes calls to Get.
+	getLock sync.Mutex
+
+	// Closed by (*spillQueue).Done when both underlying queues are done.
+	done chan struct{}
+}
+
+// FactoryForSettings is a simple wrapper around NewQueue so a concrete
+// Settings object can be wrapped in a queue-agnostic interface for
+// later use by the pipeline.
+func FactoryForSettings(settings Settings) queue.QueueFactory {
+	return func(
+		logger *logp.Logger,
+		observer queue.Observer,
+		inputQueueSize int,
+		encoderFactory queue.EncoderFactory,
+	) (queue.Queue, error) {
+		return NewQueue(logger, observer, settings, inputQueueSize, encoderFactory)
+	}
+}
+
+// NewQueue creates a spill queue with the given settings, creating or
+// reopening its disk queue. Events left in the disk queue by a previous
+// run are delivered before it is used for spilling again.
+func NewQueue(
+	logger *logp.Logger,
+	observer queue.Observer,
+	settings Settings,
+	inputQueueSize int,
+	encoderFactory queue.EncoderFactory,
+) (*spillQueue, error) {
+	if logger == nil {
+		logger = logp.NewLogger("spillqueue")
+	} else {
+		logger = logger.Named("spillqueue")
+	}
+	if observer == nil {
+		observer = queue.NewQueueObserver(nil)
+	}
+
+	// The inner queues report their own limits, which would overwrite each
+	// other's, so the spill queue reports the combined limits instead: the
+	// events held in memory, and the bytes held on disk.
+	observer.MaxEvents(settings.Memory.Events)
+	observer.MaxBytes(int(settings.Disk.MaxBufferSize))
+
+	memObserver := newMemObserver(observer)
+	diskQueue, err := diskqueue.NewQueue(
+		logger, diskObserver{observer}, settings.Disk, encoderFactory)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create spill queue: %w", err)
+	}
+	memQueue := memqueue.NewQueue(
+		logger, memObserver, settings.Memory, inputQueueSize, encoderFactory)
+
+	sq := &spillQueue{
+		logger:   logger,
+		settings: settings,
+
+		memQueue:  memQueue,
+		diskQueue: diskQueue,
+
+		memObserver: memObserver,
+
+		memReader:  newBatchReader(memQueue),
+		diskReader: newBatchReader(diskQueue),
+
+		done: make(chan struct{}),
+	}
+
+	go sq.memReader.run()
+	go sq.diskReader.run()
+	go func() {
+		<-memQueue.Done()
+		<-diskQueue.Done()
+		close(sq.done)
+	}()
+
+	return sq, nil
+}
+
+//
+// spillQueue implementation of the queue.Queue interface
+//
+
+func (sq *spillQueue) Close() error {
+	memErr := sq.memQueue.Close()
+	diskErr := sq.diskQueue.Close()
+	if memErr != nil {
+		return memErr
+	}
+	return diskErr
+}
+
+func (sq *spillQueue) Done() <-chan struct{} {
+	return sq.done
+}
+
+func (sq *spillQueue) QueueType() string {
+	return QueueType
+}
+
+func (sq *spillQueue) BufferConfig() queue.BufferConfig {
+	// Like the disk queue, the spill queue has no fixed event limit.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (sq *spillQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(sq, cfg)
+}
+
+// shouldSpill returns true if new events should be written to disk rather
+// than the memory queue.
+func (sq *spillQueue) shouldSpill() bool {
+	count := sq.memObserver.eventCount.Load()
+	if count >= sq.settings.memoryThreshold() {
+		return true
+	}
+	if sq.settings.StallTimeout > 0 && count > 0 {
+		lastProgress := time.Unix(0, sq.memObserver.lastProgress.Load())
+		return time.Since(lastProgress) > sq.settings.StallTimeout
+	}
+	return false
+}
+
+// memObserver forwards the memory queue's metrics to the spill queue's
+// observer, and tracks the state needed to decide when to spill.
+type memObserver struct {
+	queue.Observer
+
+	// The number of events currently stored in the memory queue.
+	eventCount atomic.Int64
+
+	// The time, in Unix nanoseconds, when events were last consumed or
+	// acknowledged from the memory queue, or when it last became nonempty.
+	lastProgress atomic.Int64
+}
+
+func newMemObserver(observer queue.Observer) *memObserver {
+	ob := &memObserver{Observer: observer}
+	ob.lastProgress.Store(time.Now().UnixNano())
+	return ob
+}
+
+// MaxEvents and MaxBytes are reported by the spill queue itself.
+func (ob *memObserver) MaxEvents(int) {}
+func (ob *memObserver) MaxBytes(int)  {}
+
+func (ob *memObserver) AddEvent(byteCount int) {
+	if ob.eventCount.Add(1) == 1 {
+		ob.lastProgress.Store(time.Now().UnixNano())
+	}
+	ob.Observer.AddEvent(byteCount)
+}
+
+func (ob *memObserver) ConsumeEvents(eventCount int, byteCount int) {
+	ob.lastProgress.Store(time.Now().UnixNano())
+	ob.Observer.ConsumeEvents(eventCount, byteCount)
+}
+
+func (ob *memObserver) RemoveEvents(eventCount int, byteCount int) {
+	ob.eventCount.Add(-int64(eventCount))
+	ob.lastProgress.Store(time.Now().UnixNano())
+	ob.Observer.RemoveEvents(eventCount, byteCount)
+}
+
+// diskObserver forwards the disk queue's metrics to the spill queue's
+// observer, reporting every event it accepts as spilled and every event
+// read back out as drained.
+type diskObserver struct {
+	queue.Observer
+}
+
+// MaxEvents and MaxBytes are reported by the spill queue itself.
+func (ob diskObserver) MaxEvents(int) {}
+func (ob diskObserver) MaxBytes(int)  {}
+
+func (ob diskObserver) AddEvent(byteCount int) {
+	ob.Observer.AddEvent(byteCount)
+	ob.Observer.SpillEvents(1)
+}
+
+func (ob diskObserver) ConsumeEvents(eventCount int, byteCount int) {
+	ob.Observer.ConsumeEvents(eventCount, byteCount)
+	ob.Observer.DrainEvents(eventCount)
+}
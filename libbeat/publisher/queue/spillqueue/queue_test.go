@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spillqueue
+
+import (
+	"flag"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+var seed int64
+
+func init() {
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "test random seed")
+}
+
+func TestProduceConsumer(t *testing.T) {
+	maxEvents := 1024
+	minEvents := 32
+
+	randGen := rand.New(rand.NewSource(seed))
+	events := randGen.Intn(maxEvents-minEvents) + minEvents
+	batchSize := randGen.Intn(events-8) + 4
+	bufferSize := randGen.Intn(batchSize*2) + 4
+
+	t.Log("seed: ", seed)
+	t.Log("events: ", events)
+	t.Log("batchSize: ", batchSize)
+	t.Log("bufferSize: ", bufferSize)
+
+	testWith := func(factory queuetest.QueueFactory) func(t *testing.T) {
+		return func(t *testing.T) {
+			t.Run("single", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestSingleProducerConsumer(t, events, batchSize, factory)
+			})
+			t.Run("multi", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestMultiProducerConsumer(t, events, batchSize, factory)
+			})
+		}
+	}
+
+	// A small memory queue makes the queue spill under load, a large one
+	// keeps everything in memory.
+	t.Run("spill", testWith(makeTestQueue(bufferSize, 0.5)))
+	t.Run("memory", testWith(makeTestQueue(maxEvents*2, 1)))
+}
+
+func makeTestQueue(memEvents int, watermark float64) queuetest.QueueFactory {
+	return func(t *testing.T) queue.Queue {
+		q, err := NewQueue(logp.L(), nil, testSettings(t, memEvents, watermark), 0, nil)
+		require.NoError(t, err)
+		return q
+	}
+}
+
+func testSettings(t *testing.T, memEvents int, watermark float64) Settings {
+	diskSettings := diskqueue.DefaultSettings()
+	diskSettings.Path = t.TempDir()
+	return Settings{
+		Memory: memqueue.Settings{
+			Events:        memEvents,
+			MaxGetRequest: memEvents,
+		},
+		Disk:      diskSettings,
+		Watermark: watermark,
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	settings := testSettings(t, 10, 0.5)
+	settings.Disk.MaxBufferSize = 1 << 30
+	q, err := NewQueue(logp.L(), queue.NewQueueObserver(reg), settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	// The limits of both inner queues are reported, neither overwrites the
+	// other's.
+	assert.Equal(t, uint64(10), reg.Get("queue.max_events").(*monitoring.Uint).Get())
+	assert.Equal(t, uint64(1<<30), reg.Get("queue.max_bytes").(*monitoring.Uint).Get())
+}
+
+func TestSpillAboveWatermark(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	q, err := NewQueue(logp.L(), queue.NewQueueObserver(reg), testSettings(t, 10, 0.5), 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	var acked int
+	ackChan := make(chan int, 20)
+	producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { ackChan <- count }})
+	for i := 0; i < 8; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"id": i}))
+		require.True(t, ok, "publish should succeed")
+	}
+
+	// The first 5 events fill the memory queue to its watermark, the rest
+	// go to disk.
+	assert.Equal(t, int64(5), q.memObserver.eventCount.Load())
+	assert.Eventually(t, func() bool {
+		return reg.Get("queue.spilled.events").(*monitoring.Uint).Get() == 3
+	}, time.Second, 10*time.Millisecond, "3 events should be reported as spilled")
+
+	// Read everything back out, spilled events included.
+	received := 0
+	for received < 8 {
+		batch, err := q.Get(8)
+		require.NoError(t, err)
+		received += batch.Count()
+		batch.Done()
+	}
+	assert.Equal(t, uint64(3), reg.Get("queue.drained.events").(*monitoring.Uint).Get(),
+		"spilled events should be reported as drained when they are read")
+
+	for acked < 8 {
+		select {
+		case count := <-ackChan:
+			acked += count
+		case <-time.After(time.Second):
+			t.Fatalf("expected 8 acknowledged events, got %v", acked)
+		}
+	}
+}
+
+func TestSpillWhenStalled(t *testing.T) {
+	settings := testSettings(t, 100, 1)
+	settings.StallTimeout = 50 * time.Millisecond
+	q, err := NewQueue(logp.L(), nil, settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	producer := q.Producer(queue.ProducerConfig{})
+	producer.Publish(queuetest.MakeEvent(mapstr.M{"id": 0}))
+	assert.False(t, q.shouldSpill(), "a new event shouldn't count as a stalled output")
+
+	// Nothing is consuming the queue, so after the timeout the output
+	// should be considered stalled.
+	assert.Eventually(t, q.shouldSpill, time.Second, 10*time.Millisecond)
+
+	// Consuming events clears the stall.
+	batch, err := q.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, batch.Count())
+	assert.False(t, q.shouldSpill(), "consuming events should reset the stall timeout")
+}
+
+func TestProducerACKsInPublishOrder(t *testing.T) {
+	var forwarded []int
+	acks := &producerACKs{callback: func(count int) { forwarded = append(forwarded, count) }}
+
+	// Publish 2 events to memory, 3 to disk, then 1 more to memory.
+	acks.add(false)
+	acks.add(false)
+	acks.add(true)
+	acks.add(true)
+	acks.add(true)
+	acks.add(false)
+
+	// Disk events can't be acknowledged before the memory events
+	// published ahead of them.
+	acks.ack(true, 3)
+	assert.Empty(t, forwarded)
+
+	// Acknowledging the first memory event releases only that one.
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1}, forwarded)
+
+	// The second releases the disk events queued behind it.
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1, 4}, forwarded)
+
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1, 4, 1}, forwarded)
+	assert.Empty(t, acks.runs)
+}
+
+func TestProducerACKsCancel(t *testing.T) {
+	var total int
+	acks := &producerACKs{callback: func(count int) { total += count }}
+
+	acks.add(false)
+	acks.add(true)
+	acks.ack(true, 1)
+
+	// A memory publish that fails and falls through to disk.
+	acks.add(false)
+	acks.cancel()
+	acks.add(true)
+
+	acks.ack(false, 1)
+	assert.Equal(t, 2, total)
+	acks.ack(true, 1)
+	assert.Equal(t, 3, total)
+	assert.Empty(t, acks.runs)
+}
+
+func TestSettingsForUserConfig(t *testing.T) {
+	_, err := SettingsForUserConfig(nil)
+	assert.Error(t, err, "disk settings should be required")
+
+	cfg := mapstr.M{
+		"mem.events":    2048,
+		"disk.max_size": "100MB",
+		"disk.path":     t.TempDir(),
+		"watermark":     0.5,
+	}
+	settings, err := SettingsForUserConfig(config.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	assert.Equal(t, 2048, settings.Memory.Events)
+	assert.Equal(t, uint64(100*1000*1000), settings.Disk.MaxBufferSize)
+	assert.Equal(t, int64(1024), settings.memoryThreshold())
+	assert.Equal(t, 30*time.Second, settings.StallTimeout)
+
+	cfg["watermark"] = 1.5
+	_, err = SettingsForUserConfig(config.MustNewConfigFrom(cfg))
+	assert.Error(t, err, "watermark above 1 should be rejected")
+}
@@ -0,0 +1,348 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package kv decodes key/value formatted strings, such as logfmt.
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var (
+	// ErrUnterminatedQuote indicates a quoted key or value is missing its
+	// closing quote.
+	ErrUnterminatedQuote = errors.New("unterminated quoted string")
+	// ErrEmptyKey indicates a value that is not preceded by a key.
+	ErrEmptyKey = errors.New("empty key")
+)
+
+type dataType uint8
+
+const (
+	typeString dataType = iota
+	typeInteger
+	typeLong
+	typeFloat
+	typeDouble
+	typeBoolean
+)
+
+func (t *dataType) Unpack(s string) error {
+	switch strings.ToLower(s) {
+	case "string":
+		*t = typeString
+	case "integer":
+		*t = typeInteger
+	case "long":
+		*t = typeLong
+	case "float":
+		*t = typeFloat
+	case "double":
+		*t = typeDouble
+	case "boolean":
+		*t = typeBoolean
+	default:
+		return fmt.Errorf("unsupported type %q. Must be one of [string, integer, long, float, double, boolean]", s)
+	}
+	return nil
+}
+
+func (t dataType) convert(s string) (interface{}, error) {
+	switch t {
+	case typeInteger:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case typeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case typeDouble:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// Config holds the options shared by the kv parser and the decode_kv_fields
+// processor.
+type Config struct {
+	// Separator between key/value pairs.
+	FieldSplit string `config:"field_split"`
+	// Separator between a key and its value.
+	ValueSplit string `config:"value_split"`
+	// Characters that can be used to quote keys and values.
+	QuoteChars string `config:"quote_chars"`
+	// Prefix added to all decoded keys.
+	Prefix string `config:"prefix"`
+	// If set, only these keys are kept.
+	IncludeKeys []string `config:"include_keys"`
+	// Keys that are dropped.
+	ExcludeKeys []string `config:"exclude_keys"`
+	// Types to convert values of the given keys to.
+	Types mapstr.M `config:"types"`
+	// If true, keys without a value separator are decoded with the value
+	// true, as in logfmt. They are ignored otherwise.
+	BareKeys bool `config:"bare_keys"`
+}
+
+// DefaultConfig returns the default configuration, which splits space
+// separated key=value pairs and ignores bare keys.
+func DefaultConfig() Config {
+	return Config{
+		FieldSplit: " ",
+		ValueSplit: "=",
+		QuoteChars: `"`,
+	}
+}
+
+// LogfmtConfig returns the configuration decoding logfmt, in which a bare
+// key such as debug is short for debug=true.
+func LogfmtConfig() Config {
+	c := DefaultConfig()
+	c.BareKeys = true
+	return c
+}
+
+// Validate validates the Config.
+func (c *Config) Validate() error {
+	if c.FieldSplit == "" {
+		return errors.New("field_split must not be empty")
+	}
+	if c.ValueSplit == "" {
+		return errors.New("value_split must not be empty")
+	}
+	if c.FieldSplit == c.ValueSplit {
+		return errors.New("field_split and value_split must be different")
+	}
+	if strings.ContainsAny(c.QuoteChars, c.FieldSplit+c.ValueSplit+`\`) {
+		return errors.New("quote_chars must not contain separators or the escape character")
+	}
+	_, err := c.types()
+	return err
+}
+
+// types returns the configured types by key. Keys containing dots are
+// unpacked as nested objects, so the map is flattened first.
+func (c *Config) types() (map[string]dataType, error) {
+	types := map[string]dataType{}
+	for key, v := range c.Types.Flatten() {
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("type of key '%s' must be a string, got %T", key, v)
+		}
+		var t dataType
+		if err := t.Unpack(name); err != nil {
+			return nil, fmt.Errorf("invalid type of key '%s': %w", key, err)
+		}
+		types[key] = t
+	}
+	return types, nil
+}
+
+// Decoder splits strings into key/value pairs.
+type Decoder struct {
+	cfg     Config
+	types   map[string]dataType
+	include map[string]struct{}
+	exclude map[string]struct{}
+}
+
+// NewDecoder creates a Decoder from a Config.
+func NewDecoder(cfg Config) (*Decoder, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	types, err := cfg.types()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{cfg: cfg, types: types}
+	if len(cfg.IncludeKeys) > 0 {
+		d.include = makeSet(cfg.IncludeKeys)
+	}
+	if len(cfg.ExcludeKeys) > 0 {
+		d.exclude = makeSet(cfg.ExcludeKeys)
+	}
+	return d, nil
+}
+
+// Decode splits s into key/value pairs. Dotted keys are expanded into
+// objects, and values of repeated keys are collected in a list. Keys
+// without a value separator are decoded as true if BareKeys is set, and
+// ignored otherwise.
+func (d *Decoder) Decode(s string) (mapstr.M, error) {
+	fields := mapstr.M{}
+	sc := scanner{s: s, cfg: &d.cfg}
+	for {
+		key, value, bare, ok, err := sc.next()
+		if err != nil {
+			return fields, err
+		}
+		if !ok {
+			return fields, nil
+		}
+		if (bare && !d.cfg.BareKeys) || !d.keep(key) {
+			continue
+		}
+
+		var v interface{} = true
+		if !bare {
+			v, err = d.types[key].convert(value)
+			if err != nil {
+				return fields, fmt.Errorf("failed to convert value of key '%s': %w", key, err)
+			}
+		}
+
+		key = d.cfg.Prefix + key
+		if prev, err := fields.GetValue(key); err == nil {
+			if list, isList := prev.([]interface{}); isList {
+				v = append(list, v)
+			} else {
+				v = []interface{}{prev, v}
+			}
+		}
+		if _, err = fields.Put(key, v); err != nil {
+			return fields, fmt.Errorf("failed to set key '%s': %w", key, err)
+		}
+	}
+}
+
+func (d *Decoder) keep(key string) bool {
+	if d.include != nil {
+		if _, found := d.include[key]; !found {
+			return false
+		}
+	}
+	_, excluded := d.exclude[key]
+	return !excluded
+}
+
+// scanner tokenizes a key/value string. Keys and values can be quoted with
+// any of the quote characters, and backslash escapes are processed inside
+// quoted strings.
+type scanner struct {
+	s   string
+	pos int
+	cfg *Config
+}
+
+// next returns the next key and its value. bare is true if the key has no
+// value separator, in which case value is empty.
+func (sc *scanner) next() (key, value string, bare, ok bool, err error) {
+	for {
+		sc.skip(sc.cfg.FieldSplit)
+		if sc.pos >= len(sc.s) {
+			return "", "", false, false, nil
+		}
+
+		key, err = sc.token(sc.cfg.ValueSplit, sc.cfg.FieldSplit)
+		if err != nil {
+			return "", "", false, false, err
+		}
+		if !strings.HasPrefix(sc.s[sc.pos:], sc.cfg.ValueSplit) {
+			if key == "" {
+				// An empty quoted string.
+				continue
+			}
+			return key, "", true, true, nil
+		}
+		sc.pos += len(sc.cfg.ValueSplit)
+		if key == "" {
+			return "", "", false, false, fmt.Errorf("%w at position %d", ErrEmptyKey, sc.pos)
+		}
+
+		value, err = sc.token(sc.cfg.FieldSplit)
+		if err != nil {
+			return "", "", false, false, err
+		}
+		return key, value, false, true, nil
+	}
+}
+
+// skip advances past all consecutive occurrences of sep.
+func (sc *scanner) skip(sep string) {
+	for strings.HasPrefix(sc.s[sc.pos:], sep) {
+		sc.pos += len(sep)
+	}
+}
+
+// token reads a quoted string, or an unquoted string up to the first of the
+// terminators.
+func (sc *scanner) token(terminators ...string) (string, error) {
+	if sc.pos < len(sc.s) && strings.IndexByte(sc.cfg.QuoteChars, sc.s[sc.pos]) >= 0 {
+		return sc.quoted()
+	}
+
+	end := len(sc.s)
+	for _, t := range terminators {
+		if i := strings.Index(sc.s[sc.pos:], t); i >= 0 && sc.pos+i < end {
+			end = sc.pos + i
+		}
+	}
+	tok := sc.s[sc.pos:end]
+	sc.pos = end
+	return tok, nil
+}
+
+func (sc *scanner) quoted() (string, error) {
+	start := sc.pos
+	quote := sc.s[sc.pos]
+	sc.pos++
+
+	var b strings.Builder
+	for sc.pos < len(sc.s) {
+		c := sc.s[sc.pos]
+		sc.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && sc.pos < len(sc.s):
+			c = sc.s[sc.pos]
+			sc.pos++
+			switch c {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("%w starting at position %d", ErrUnterminatedQuote, start)
+}
+
+func makeSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+	return set
+}
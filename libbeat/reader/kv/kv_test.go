@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		in     string
+		want   mapstr.M
+	}{
+		"logfmt": {
+			in: `level=info msg="request done" path=/api/v1 duration=12ms`,
+			want: mapstr.M{
+				"level":    "info",
+				"msg":      "request done",
+				"path":     "/api/v1",
+				"duration": "12ms",
+			},
+		},
+		"escapes": {
+			in:   `msg="say \"hi\"\tnow" path="C:\\tmp"`,
+			want: mapstr.M{"msg": "say \"hi\"\tnow", "path": `C:\tmp`},
+		},
+		"quoted keys and empty values": {
+			in:   `"the key"=1 empty= quoted=""`,
+			want: mapstr.M{"the key": "1", "empty": "", "quoted": ""},
+		},
+		"bare keys are ignored": {
+			in:   `debug a=1  b=2 `,
+			want: mapstr.M{"a": "1", "b": "2"},
+		},
+		"bare keys": {
+			config: map[string]interface{}{"bare_keys": true},
+			in:     `debug a=1 "dry run" b=2 tag tag`,
+			want:   mapstr.M{"debug": true, "a": "1", "dry run": true, "b": "2", "tag": []interface{}{true, true}},
+		},
+		"custom separators": {
+			config: map[string]interface{}{"field_split": ", ", "value_split": ":", "quote_chars": `"'`},
+			in:     `user:alice, role:'super user', note:a b`,
+			want:   mapstr.M{"user": "alice", "role": "super user", "note": "a b"},
+		},
+		"dotted keys and prefix": {
+			config: map[string]interface{}{"prefix": "app."},
+			in:     `http.method=GET http.status=200`,
+			want:   mapstr.M{"app": mapstr.M{"http": mapstr.M{"method": "GET", "status": "200"}}},
+		},
+		"repeated keys": {
+			in:   `tag=a tag=b tag=c`,
+			want: mapstr.M{"tag": []interface{}{"a", "b", "c"}},
+		},
+		"include keys": {
+			config: map[string]interface{}{"include_keys": []string{"a", "c"}},
+			in:     `a=1 b=2 c=3`,
+			want:   mapstr.M{"a": "1", "c": "3"},
+		},
+		"exclude keys": {
+			config: map[string]interface{}{"exclude_keys": []string{"password"}},
+			in:     `user=bob password=secret`,
+			want:   mapstr.M{"user": "bob"},
+		},
+		"types": {
+			config: map[string]interface{}{"types": map[string]interface{}{
+				"count":       "integer",
+				"bytes":       "long",
+				"ratio":       "float",
+				"duration":    "double",
+				"ok":          "boolean",
+				"http.status": "integer",
+			}},
+			in: `count=3 bytes=5000000000 ratio=0.5 duration=1.25 ok=true http.status=404`,
+			want: mapstr.M{
+				"count":    int32(3),
+				"bytes":    int64(5000000000),
+				"ratio":    float32(0.5),
+				"duration": 1.25,
+				"ok":       true,
+				"http":     mapstr.M{"status": int32(404)},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDecoder(t, test.config)
+			fields, err := d.Decode(test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, fields)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		in     string
+		want   error
+	}{
+		"unterminated quote": {in: `a=1 msg="oops`, want: ErrUnterminatedQuote},
+		"empty key":          {in: `a=1 =2`, want: ErrEmptyKey},
+		"conflicting keys":   {in: `a=1 a.b=2`},
+		"conversion": {
+			config: map[string]interface{}{"types": map[string]interface{}{"a": "integer"}},
+			in:     `a=x`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDecoder(t, test.config)
+			_, err := d.Decode(test.in)
+			require.Error(t, err)
+			if test.want != nil {
+				assert.ErrorIs(t, err, test.want)
+			}
+		})
+	}
+}
+
+func TestLogfmtConfig(t *testing.T) {
+	d, err := NewDecoder(LogfmtConfig())
+	require.NoError(t, err)
+	fields, err := d.Decode(`level=debug msg="cache miss" retry key=""`)
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"level": "debug", "msg": "cache miss", "retry": true, "key": ""}, fields)
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"empty field_split":    {"field_split": ""},
+		"same separators":      {"field_split": "=", "value_split": "="},
+		"quote is a separator": {"quote_chars": " "},
+		"unknown type":         {"types": map[string]interface{}{"a": "ip"}},
+	}
+
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig()
+			err := conf.MustNewConfigFrom(c).Unpack(&config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func newTestDecoder(t *testing.T, c map[string]interface{}) *Decoder {
+	t.Helper()
+	config := DefaultConfig()
+	if c != nil {
+		require.NoError(t, conf.MustNewConfigFrom(c).Unpack(&config))
+	}
+	d, err := NewDecoder(config)
+	require.NoError(t, err)
+	return d
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// ParserConfig holds the options of the kv and logfmt parsers.
+type ParserConfig struct {
+	Config `config:",inline"`
+	// The field the decoded keys are stored under. Keys are added to the
+	// root of the event if empty.
+	Target string `config:"target"`
+	// If true, decoded keys overwrite existing fields.
+	OverwriteKeys bool `config:"overwrite_keys"`
+	// If true, errors will be logged.
+	LogErrors bool `config:"log_errors"`
+	// If true, errors will be added to the message fields under the error.message field.
+	AddErrorKey bool `config:"add_error_key"`
+}
+
+// DefaultParserConfig returns the default kv parser configuration.
+func DefaultParserConfig() ParserConfig {
+	return ParserConfig{
+		Config:      DefaultConfig(),
+		AddErrorKey: true,
+	}
+}
+
+// DefaultLogfmtParserConfig returns the default logfmt parser configuration,
+// which decodes bare keys.
+func DefaultLogfmtParserConfig() ParserConfig {
+	c := DefaultParserConfig()
+	c.Config = LogfmtConfig()
+	return c
+}
+
+// Parser decodes the content of messages as key/value pairs and adds them
+// to the message fields. The content is left unchanged.
+type Parser struct {
+	cfg     *ParserConfig
+	decoder *Decoder
+	reader  reader.Reader
+	logger  *logp.Logger
+}
+
+// NewParser creates a new key/value parser.
+func NewParser(r reader.Reader, cfg *ParserConfig) (*Parser, error) {
+	d, err := NewDecoder(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{
+		cfg:     cfg,
+		decoder: d,
+		reader:  r,
+		logger:  logp.NewLogger("reader_kv"),
+	}, nil
+}
+
+func (p *Parser) Next() (reader.Message, error) {
+	msg, err := p.reader.Next()
+	if err != nil {
+		return msg, err
+	}
+
+	fields, err := p.decoder.Decode(strings.TrimRight(string(msg.Content), "\r\n"))
+	if msg.Fields == nil {
+		msg.Fields = mapstr.M{}
+	}
+	if err != nil {
+		if p.cfg.LogErrors {
+			p.logger.Errorf("Error decoding key/value pairs: %v", err)
+		}
+		if p.cfg.AddErrorKey {
+			msg.Fields.DeepUpdate(mapstr.M{
+				"error": mapstr.M{"message": "Error decoding key/value pairs: " + err.Error(), "type": "kv"},
+			})
+		}
+		return msg, nil
+	}
+
+	if p.cfg.Target != "" {
+		decoded := fields
+		fields = mapstr.M{}
+		_, _ = fields.Put(p.cfg.Target, decoded)
+	}
+	if p.cfg.OverwriteKeys {
+		msg.Fields.DeepUpdate(fields)
+	} else {
+		msg.Fields.DeepUpdateNoOverwrite(fields)
+	}
+	return msg, nil
+}
+
+func (p *Parser) Close() error {
+	return p.reader.Close()
+}
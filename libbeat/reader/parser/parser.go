@@ -27,7 +27,9 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/reader"
 	"github.com/elastic/beats/v7/libbeat/reader/filter"
+	"github.com/elastic/beats/v7/libbeat/reader/kv"
 	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readcsv"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readjson"
 	"github.com/elastic/beats/v7/libbeat/reader/syslog"
@@ -45,6 +47,13 @@ type Parser interface {
 	Next() (reader.Message, error)
 }
 
+// State holds the state of the parsers of a single source that inputs can
+// persist, so parsing can be resumed after a restart.
+type State struct {
+	// CSVHeader holds the column names read by the csv parser.
+	CSVHeader []string
+}
+
 type CommonConfig struct {
 	MaxBytes       cfgtype.ByteSize        `config:"max_bytes"`
 	LineTerminator readfile.LineTerminator `config:"line_terminator"`
@@ -128,6 +137,23 @@ func NewConfig(pCfg CommonConfig, parsers []config.Namespace) (*Config, error) {
 			if err != nil {
 				return nil, fmt.Errorf("error while parsing include_message parser config: %w", err)
 			}
+		case "kv", "logfmt":
+			config := kv.DefaultParserConfig()
+			if name == "logfmt" {
+				config = kv.DefaultLogfmtParserConfig()
+			}
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing %s parser config: %w", name, err)
+			}
+		case "csv":
+			config := readcsv.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing csv parser config: %w", err)
+			}
 		default:
 			return nil, fmt.Errorf("%s: %w", name, ErrNoSuchParser)
 		}
@@ -142,6 +168,13 @@ func NewConfig(pCfg CommonConfig, parsers []config.Namespace) (*Config, error) {
 }
 
 func (c *Config) Create(in reader.Reader) Parser {
+	return c.CreateWithState(in, nil)
+}
+
+// CreateWithState creates the parsers, restoring their state from state
+// and keeping it up to date as messages are parsed. The state is not
+// persisted if nil.
+func (c *Config) CreateWithState(in reader.Reader, state *State) Parser {
 	p := in
 	for _, ns := range c.parsers {
 		name := ns.Name()
@@ -189,6 +222,37 @@ func (c *Config) Create(in reader.Reader) Parser {
 				return p
 			}
 			p = filter.NewParser(p, &config)
+		case "kv", "logfmt":
+			config := kv.DefaultParserConfig()
+			if name == "logfmt" {
+				config = kv.DefaultLogfmtParserConfig()
+			}
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			kvParser, err := kv.NewParser(p, &config)
+			if err != nil {
+				return p
+			}
+			p = kvParser
+		case "csv":
+			config := readcsv.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			var header *[]string
+			if state != nil {
+				header = &state.CSVHeader
+			}
+			csvParser, err := readcsv.NewParser(p, &config, header)
+			if err != nil {
+				return p
+			}
+			p = csvParser
 		default:
 			return p
 		}
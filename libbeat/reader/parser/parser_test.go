@@ -768,6 +768,97 @@ func TestParserIncludeMessages(t *testing.T) {
 	require.Equal(t, expectedMessages, readMsgs, "fii")
 }
 
+func TestKVParser(t *testing.T) {
+	tests := map[string]struct {
+		parser         map[string]interface{}
+		lines          string
+		expectedFields []mapstr.M
+	}{
+		"logfmt to root": {
+			parser: map[string]interface{}{"logfmt": map[string]interface{}{}},
+			lines:  "level=info msg=\"started server\" port=8080\nlevel=warn msg=slow retry\n",
+			expectedFields: []mapstr.M{
+				{"level": "info", "msg": "started server", "port": "8080"},
+				{"level": "warn", "msg": "slow", "retry": true},
+			},
+		},
+		"kv ignores bare keys": {
+			parser: map[string]interface{}{"kv": map[string]interface{}{}},
+			lines:  "level=warn retry\n",
+			expectedFields: []mapstr.M{
+				{"level": "warn"},
+			},
+		},
+		"kv with target and types": {
+			parser: map[string]interface{}{"kv": map[string]interface{}{
+				"target":      "kv",
+				"field_split": "&",
+				"types":       map[string]interface{}{"port": "integer"},
+			}},
+			lines: "host=a&port=80\n",
+			expectedFields: []mapstr.M{
+				{"kv": mapstr.M{"host": "a", "port": int32(80)}},
+			},
+		},
+		"decoding error": {
+			parser: map[string]interface{}{"kv": map[string]interface{}{}},
+			lines:  "msg=\"unterminated\n",
+			expectedFields: []mapstr.M{
+				{"error": mapstr.M{"message": "Error decoding key/value pairs: unterminated quoted string starting at position 4", "type": "kv"}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(map[string]interface{}{
+				"parsers": []map[string]interface{}{test.parser},
+			})
+			var c inputParsersConfig
+			require.NoError(t, cfg.Unpack(&c))
+
+			p := c.Parsers.Create(testReader(test.lines))
+
+			var fields []mapstr.M
+			msg, err := p.Next()
+			for err == nil {
+				fields = append(fields, msg.Fields)
+				msg, err = p.Next()
+			}
+			require.Equal(t, test.expectedFields, fields)
+		})
+	}
+}
+
+func TestKVParserConfigError(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"parsers": []map[string]interface{}{
+			{"kv": map[string]interface{}{"value_split": " "}},
+		},
+	})
+	var c inputParsersConfig
+	require.Error(t, cfg.Unpack(&c))
+}
+
+func TestCSVParserWithState(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"parsers": []map[string]interface{}{
+			{"csv": map[string]interface{}{"header": true, "types": map[string]interface{}{"age": "integer"}}},
+		},
+	})
+	var c inputParsersConfig
+	require.NoError(t, cfg.Unpack(&c))
+
+	var state State
+	p := c.Parsers.CreateWithState(testReader("name,age\nalice,30\n"), &state)
+
+	msg, err := p.Next()
+	require.NoError(t, err)
+	require.Equal(t, mapstr.M{"csv": mapstr.M{"name": "alice", "age": int32(30)}}, msg.Fields)
+	require.Equal(t, len("name,age\n"), msg.Offset)
+	require.Equal(t, []string{"name", "age"}, state.CSVHeader)
+}
+
 type testParsersConfig struct {
 	Parsers []config.Namespace `struct:"parsers"`
 }
@@ -0,0 +1,191 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readcsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Parser decodes messages as CSV records and adds the columns to the
+// message fields. The content of the message is left unchanged.
+//
+// Quoted columns can contain line breaks, in which case the lines of a
+// record are joined into a single message. If header is enabled, the first
+// record is consumed as the list of column names.
+type Parser struct {
+	cfg       *Config
+	reader    reader.Reader
+	header    *[]string
+	types     map[string]dataType
+	separator rune
+	logger    *logp.Logger
+}
+
+// NewParser creates a new csv parser. If the header option is enabled, the
+// column names are stored in header once read, and the first record is only
+// consumed as the header if header is empty. This allows inputs to persist
+// the header of each source, and to resume reading after it.
+func NewParser(r reader.Reader, cfg *Config, header *[]string) (*Parser, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	types, err := cfg.types()
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		header = new([]string)
+	}
+	separator, _ := utf8.DecodeRuneInString(cfg.Separator)
+
+	return &Parser{
+		cfg:       cfg,
+		reader:    r,
+		header:    header,
+		types:     types,
+		separator: separator,
+		logger:    logp.NewLogger("reader_csv"),
+	}, nil
+}
+
+func (p *Parser) Next() (reader.Message, error) {
+	// skipped accounts for the bytes of the header, so inputs can track the
+	// offset of the messages correctly.
+	var skipped int
+	for {
+		msg, err := p.readRecord()
+		msg.Offset += skipped
+		if err != nil {
+			return msg, err
+		}
+		if len(msg.Content) == 0 {
+			return msg, nil
+		}
+
+		record, err := p.parse(msg.Content)
+		if err == nil && p.cfg.Header && len(*p.header) == 0 {
+			*p.header = record
+			skipped = msg.Offset + msg.Bytes
+			continue
+		}
+
+		var fields mapstr.M
+		if err == nil {
+			fields, err = p.columns(record)
+		}
+		if msg.Fields == nil {
+			msg.Fields = mapstr.M{}
+		}
+		if err != nil {
+			if p.cfg.LogErrors {
+				p.logger.Errorf("Error decoding CSV record: %v", err)
+			}
+			if p.cfg.AddErrorKey {
+				msg.Fields.DeepUpdate(mapstr.M{
+					"error": mapstr.M{"message": "Error decoding CSV record: " + err.Error(), "type": "csv"},
+				})
+			}
+			return msg, nil
+		}
+
+		if p.cfg.Target != "" {
+			decoded := fields
+			fields = mapstr.M{}
+			_, _ = fields.Put(p.cfg.Target, decoded)
+		}
+		if p.cfg.OverwriteKeys {
+			msg.Fields.DeepUpdate(fields)
+		} else {
+			msg.Fields.DeepUpdateNoOverwrite(fields)
+		}
+		return msg, nil
+	}
+}
+
+// readRecord reads lines until all quoted columns are terminated, or
+// max_lines is reached. If reading a line fails, the lines read so far are
+// returned with the error, so the caller can account for their bytes.
+func (p *Parser) readRecord() (reader.Message, error) {
+	msg, err := p.reader.Next()
+	if err != nil {
+		return msg, err
+	}
+
+	for lines := 1; lines < p.cfg.MaxLines && bytes.Count(msg.Content, []byte{'"'})%2 != 0; lines++ {
+		next, err := p.reader.Next()
+		if err != nil && next.Bytes == 0 {
+			return msg, err
+		}
+		content := make([]byte, 0, len(msg.Content)+1+len(next.Content))
+		content = append(content, msg.Content...)
+		content = append(content, '\n')
+		msg.Content = append(content, next.Content...)
+		msg.Bytes += next.Bytes
+		msg.Offset += next.Offset
+		if err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+func (p *Parser) parse(content []byte) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = p.separator
+	r.TrimLeadingSpace = p.cfg.TrimLeadingSpace
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
+
+func (p *Parser) columns(record []string) (mapstr.M, error) {
+	names := p.cfg.Columns
+	if p.cfg.Header {
+		names = *p.header
+	}
+
+	fields := mapstr.M{}
+	for i, value := range record {
+		name := "column" + strconv.Itoa(i+1)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		typ := p.types[name]
+		if value == "" && typ != typeString {
+			continue
+		}
+		v, err := typ.convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert column '%s': %w", name, err)
+		}
+		_, _ = fields.Put(name, v)
+	}
+	return fields, nil
+}
+
+func (p *Parser) Close() error {
+	return p.reader.Close()
+}
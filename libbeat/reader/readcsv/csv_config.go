@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readcsv
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type dataType uint8
+
+const (
+	typeString dataType = iota
+	typeInteger
+	typeLong
+	typeFloat
+	typeDouble
+	typeBoolean
+)
+
+var dataTypes = map[string]dataType{
+	"string":  typeString,
+	"integer": typeInteger,
+	"long":    typeLong,
+	"float":   typeFloat,
+	"double":  typeDouble,
+	"boolean": typeBoolean,
+}
+
+func (t dataType) convert(s string) (interface{}, error) {
+	switch t {
+	case typeInteger:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case typeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case typeDouble:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// Config holds the options of the csv parser.
+type Config struct {
+	// Character separating columns.
+	Separator string `config:"separator"`
+	// If true, leading white space in a column is ignored.
+	TrimLeadingSpace bool `config:"trim_leading_space"`
+	// If true, column names are read from the first line of each file.
+	Header bool `config:"header"`
+	// Column names, used when header is false.
+	Columns []string `config:"columns"`
+	// Types to convert the values of the given columns to.
+	Types mapstr.M `config:"types"`
+	// The field the columns are stored under. Columns are added to the
+	// root of the event if empty.
+	Target string `config:"target"`
+	// If true, columns overwrite existing fields.
+	OverwriteKeys bool `config:"overwrite_keys"`
+	// Maximum number of lines a single quoted record can span.
+	MaxLines int `config:"max_lines" validate:"min=1"`
+	// If true, errors will be logged.
+	LogErrors bool `config:"log_errors"`
+	// If true, errors will be added to the message fields under the error.message field.
+	AddErrorKey bool `config:"add_error_key"`
+}
+
+// DefaultConfig returns the default csv parser configuration.
+func DefaultConfig() Config {
+	return Config{
+		Separator:   ",",
+		Target:      "csv",
+		MaxLines:    500,
+		AddErrorKey: true,
+	}
+}
+
+// Validate validates the Config.
+func (c *Config) Validate() error {
+	if utf8.RuneCountInString(c.Separator) != 1 {
+		return fmt.Errorf("separator must be a single character, got '%s'", c.Separator)
+	}
+	if sep, _ := utf8.DecodeRuneInString(c.Separator); sep == '"' || sep == '\r' || sep == '\n' {
+		return errors.New("separator must not be a quote or a line break")
+	}
+	if c.Header && len(c.Columns) > 0 {
+		return errors.New("header and columns can't be used together")
+	}
+	_, err := c.types()
+	return err
+}
+
+// types returns the configured types by column name. Column names
+// containing dots are unpacked as nested objects, so the map is flattened
+// first.
+func (c *Config) types() (map[string]dataType, error) {
+	types := map[string]dataType{}
+	for column, v := range c.Types.Flatten() {
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("type of column '%s' must be a string, got %T", column, v)
+		}
+		t, found := dataTypes[strings.ToLower(name)]
+		if !found {
+			return nil, fmt.Errorf("unsupported type '%s' of column '%s'. Must be one of [string, integer, long, float, double, boolean]", name, column)
+		}
+		types[column] = t
+	}
+	return types, nil
+}
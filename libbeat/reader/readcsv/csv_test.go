@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readcsv
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestParser(t *testing.T) {
+	tests := map[string]struct {
+		config   map[string]interface{}
+		lines    []string
+		expected []reader.Message
+	}{
+		"header": {
+			config: map[string]interface{}{"header": true},
+			lines:  []string{"name,age", "alice,30", "bob,"},
+			expected: []reader.Message{
+				{Content: []byte("alice,30"), Bytes: 9, Offset: 9, Fields: mapstr.M{"csv": mapstr.M{"name": "alice", "age": "30"}}},
+				{Content: []byte("bob,"), Bytes: 5, Fields: mapstr.M{"csv": mapstr.M{"name": "bob", "age": ""}}},
+			},
+		},
+		"columns and types": {
+			config: map[string]interface{}{
+				"columns": []string{"host.name", "port", "ratio", "up"},
+				"types":   map[string]interface{}{"port": "integer", "ratio": "double", "up": "boolean"},
+				"target":  "",
+			},
+			lines: []string{"a,80,0.5,true,extra", "b,,,false"},
+			expected: []reader.Message{
+				{Content: []byte("a,80,0.5,true,extra"), Bytes: 20, Fields: mapstr.M{
+					"host": mapstr.M{"name": "a"}, "port": int32(80), "ratio": 0.5, "up": true, "column5": "extra",
+				}},
+				{Content: []byte("b,,,false"), Bytes: 10, Fields: mapstr.M{
+					"host": mapstr.M{"name": "b"}, "up": false,
+				}},
+			},
+		},
+		"quoted multi-line record": {
+			config: map[string]interface{}{"separator": ";"},
+			lines:  []string{`1;"first`, `second;`, `third ""quoted"""`, "2;x"},
+			expected: []reader.Message{
+				{Content: []byte("1;\"first\nsecond;\nthird \"\"quoted\"\"\""), Bytes: 35, Fields: mapstr.M{
+					"csv": mapstr.M{"column1": "1", "column2": "first\nsecond;\nthird \"quoted\""},
+				}},
+				{Content: []byte("2;x"), Bytes: 4, Fields: mapstr.M{"csv": mapstr.M{"column1": "2", "column2": "x"}}},
+			},
+		},
+		"max lines": {
+			config: map[string]interface{}{"max_lines": 2},
+			lines:  []string{`1,"a`, "b", "2,c"},
+			expected: []reader.Message{
+				{Content: []byte("1,\"a\nb"), Bytes: 7, Fields: mapstr.M{"error": mapstr.M{
+					"message": "Error decoding CSV record: record on line 1; parse error on line 2, column 2: extraneous or missing \" in quoted-field",
+					"type":    "csv",
+				}}},
+				{Content: []byte("2,c"), Bytes: 4, Fields: mapstr.M{"csv": mapstr.M{"column1": "2", "column2": "c"}}},
+			},
+		},
+		"conversion error": {
+			config: map[string]interface{}{"columns": []string{"n"}, "types": map[string]interface{}{"n": "long"}},
+			lines:  []string{"x"},
+			expected: []reader.Message{
+				{Content: []byte("x"), Bytes: 2, Fields: mapstr.M{"error": mapstr.M{
+					"message": "Error decoding CSV record: failed to convert column 'n': strconv.ParseInt: parsing \"x\": invalid syntax",
+					"type":    "csv",
+				}}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig()
+			require.NoError(t, conf.MustNewConfigFrom(test.config).Unpack(&config))
+
+			p, err := NewParser(newLinesReader(test.lines...), &config, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, readAll(t, p))
+		})
+	}
+}
+
+func TestParserRestoredHeader(t *testing.T) {
+	config := DefaultConfig()
+	config.Header = true
+
+	var header []string
+	p, err := NewParser(newLinesReader("a,b", "1,2"), &config, &header)
+	require.NoError(t, err)
+	readAll(t, p)
+	require.Equal(t, []string{"a", "b"}, header)
+
+	// Resuming after the header uses the stored column names.
+	p, err = NewParser(newLinesReader("3,4"), &config, &header)
+	require.NoError(t, err)
+	assert.Equal(t, []reader.Message{
+		{Content: []byte("3,4"), Bytes: 4, Fields: mapstr.M{"csv": mapstr.M{"a": "3", "b": "4"}}},
+	}, readAll(t, p))
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"long separator":      {"separator": ",,"},
+		"quote separator":     {"separator": `"`},
+		"header and columns":  {"header": true, "columns": []string{"a"}},
+		"unknown type":        {"types": map[string]interface{}{"a": "ip"}},
+		"non positive max":    {"max_lines": 0},
+		"non string type def": {"types": map[string]interface{}{"a": 1}},
+	}
+
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig()
+			assert.Error(t, conf.MustNewConfigFrom(c).Unpack(&config))
+		})
+	}
+}
+
+func readAll(t *testing.T, p *Parser) []reader.Message {
+	t.Helper()
+	var msgs []reader.Message
+	for {
+		msg, err := p.Next()
+		if err == io.EOF {
+			return msgs
+		}
+		require.NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+}
+
+// linesReader returns each line as a message, as if read by a line reader
+// stripping the newline.
+type linesReader struct {
+	lines []string
+}
+
+func newLinesReader(lines ...string) *linesReader {
+	return &linesReader{lines: lines}
+}
+
+func (r *linesReader) Next() (reader.Message, error) {
+	if len(r.lines) == 0 {
+		return reader.Message{}, io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return reader.Message{Content: []byte(line), Bytes: len(line) + 1}, nil
+}
+
+func (r *linesReader) Close() error {
+	return nil
+}
+
+func TestParserReadError(t *testing.T) {
+	config := DefaultConfig()
+	config.Header = true
+
+	p, err := NewParser(newLinesReader("a,b", `1,"x`, "y"), &config, nil)
+	require.NoError(t, err)
+
+	// The lines of the unterminated record are returned with the error, with
+	// the offset of the header.
+	msg, err := p.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, reader.Message{Content: []byte("1,\"x\ny"), Bytes: 7, Offset: 4}, msg)
+}
@@ -32,5 +32,5 @@ func init() {
 // AssetHttp returns asset data.
 // This is the base64 encoded zlib format compressed contents of protos/http.
 func AssetHttp() string {
-	return "eJzUVMuOlUAQ3fMVJ7N2+AAWJm6MszEubuJyUkAB7dCP6a72yt+b5nEdoKMxNy5kBfU451T1aR7xwlOFQcQVgCgZucLDp8vly0MBtBwar5woayqk4GNw3KhONeDvbASd4rENZYH1rSoA4BGGNN9Q0yOT4wq9t3GL7LCfTGe9pvQBqm0UyMAzIzy/Rg4CMi08B2dN4HLFeEv6lnjtucUzk2RqzhpzHLsBmVr2YZfbcGz9jRs5pJbg81LxwtPV+vZQslP6/pAEPkCTQ2ONkDLK9POiGnISPberoFUzOm/1nF9nLU9oXwfVDNsYELshQYXE0ak+eqpHLvHU3cquSoYZNpDmE+QqIS0I5BnOc0hWUWbu0RwC9fwufUy4qnFEzQjsyJNwi3o6ITZWawplkT2C1KfzJ0CjomNGq97Tslvx8ajekQwVoh/L18h+KjLGWgz4B2ediv7eWkFIYnh2g6dwlLmjvGwXZenA0nE8av5B2qW7/dkKPtpo2vw6/x9H7/8Ev567LH1CSxa/09InzHr6vaUb2x6F3Gfo9B8ubxtbnTWz5K9UznP/QMHK8zMAAP//lgPSsQ=="
+	return "eJzUVcFu2zAMvesriJ5XD9jRhwHDhq69tMWWYceClmhbq2yplNzMfz/IkYPYVgqs6A5DLglFvvcoPiqX8EhjCW0ITgAEHQyVcHG9291fCABFXrJ2Qdu+hBi89I6krrUEeqY+QK3JKF8ISN9KAQBwCT12dESNoTA6KqFhO8yRBfZNX1vuMBIBVnYIEFqaGIHpaSAfAHsFTN7Z3lORME5JT4lTzTGe6SSTs9WY41g0SKiI/eJsxrHVL5Kn8PFzCD4cMh5p3FtWq5SF0o+rQ4BP0KEDafuAutd9M12URBcGJpUEJc1Qs+2m89RrIRZQAPCz1bKd24BgZyTQPnLUuhkYK0MF3NTHtL0O7QTrsaMNZJIQLwiQCRyTj1bR/VTTkffY0Lv4Y4S9NgYqAk8OGQMpqMYNorRdh74Q2RHEui4/ATQa1yedbniyWQmBh7V6h6EtYWBTPA3EoxBrttmA4sy8krM2SX9vLR8wDP7BtYyeXrLIbl6UQwUcKtajpt/YubjbtzbAlR16lb/ONOP/wNHLl+CNLL1BixZPWa+19AazGl+2tLSK3tTQ8R0ujjeWnDWxZPmznvsHChLP4i+jYSfFuZ1ZGKn5dv8ZJBrjQSKzJgX2mXjahfcfCpFfsZnHEz9reSr2nIMXpHHZ6sGYEZ4GNLqOrBEQbD1ZYRKVsAuRWb+WjLF7y0YVX5koEIuNto5Ca9VrpG2kHKCySr7jeB3FbPlPDbIWYWzfvKRgYk0vUXTYrCYOqjhH9SatniXN9H57t3u4uvtx+2WrKC3zayQlBQkhikOoURtSINGYQvwZAFwjqiw="
 }
@@ -77,6 +77,9 @@ type httpConnectionData struct {
 	streams   [2]*stream
 	requests  messageList
 	responses messageList
+
+	// h2 is set once the connection switched to HTTP/2.
+	h2 *http2Conn
 }
 
 type messageList struct {
@@ -305,6 +308,10 @@ func (http *httpPlugin) doParse(
 		detailedf("Payload received: [%s]", pkt.Payload)
 	}
 
+	if conn.h2 != nil {
+		return http.doParseHTTP2(conn, pkt.Ts, pkt.Payload, tcptuple, dir)
+	}
+
 	extraMsgSize := 0 // size of a "seen" packet for which we don't store the actual bytes
 
 	st := conn.streams[dir]
@@ -333,6 +340,23 @@ func (http *httpPlugin) doParse(
 			st.message = &message{ts: pkt.Ts}
 		}
 
+		if st.parseState == stateStart && extraMsgSize == 0 {
+			// Switch to HTTP/2 after an upgrade, or when the client
+			// sends the HTTP/2 connection preface.
+			found, more := http2PrefaceState(st.data)
+			if more {
+				break
+			}
+			if found && conn.h2 == nil {
+				conn.h2 = newHTTP2Conn(dir, http.maxMessageSize)
+			}
+			if conn.h2 != nil {
+				data := st.data
+				conn.streams = [2]*stream{}
+				return http.doParseHTTP2(conn, pkt.Ts, data, tcptuple, dir)
+			}
+		}
+
 		parser := newParser(&http.parserConfig)
 		ok, complete := parser.parse(st, extraMsgSize)
 		extraMsgSize = 0
@@ -403,6 +427,13 @@ func (http *httpPlugin) GapInStream(tcptuple *common.TCPTuple, dir uint8,
 		return private, false
 	}
 
+	if conn.h2 != nil {
+		// The frame boundaries and the header compression state are
+		// lost.
+		http.dropHTTP2(conn, errors.New("gap in HTTP/2 stream"))
+		return nil, true
+	}
+
 	stream := conn.streams[dir]
 	if stream == nil || stream.message == nil {
 		// nothing to do
@@ -437,13 +468,16 @@ func (http *httpPlugin) handleHTTP(
 	m.tcpTuple = *tcptuple
 	m.direction = dir
 	m.cmdlineTuple = http.watcher.FindProcessesTupleTCP(tcptuple.IPPort())
+	http.redactMessage(m)
 
-	if !http.redactAuthorization {
-		m.username = extractBasicAuthUser(m.headers)
+	if isHTTP2Upgrade(m) {
+		if isDebug {
+			debugf("Upgrade to HTTP/2 with tuple: %s", m.tcpTuple)
+		}
+		http.upgradeHTTP2(conn, m)
+		return
 	}
 
-	http.hideHeaders(m)
-
 	if m.isRequest {
 		if isDebug {
 			debugf("Received request with tuple: %s", m.tcpTuple)
@@ -458,6 +492,16 @@ func (http *httpPlugin) handleHTTP(
 	}
 }
 
+// redactMessage extracts the user name of a message and hides the
+// configured headers.
+func (http *httpPlugin) redactMessage(m *message) {
+	if !http.redactAuthorization {
+		m.username = extractBasicAuthUser(m.headers)
+	}
+
+	http.hideHeaders(m)
+}
+
 func (http *httpPlugin) flushResponses(conn *httpConnectionData) {
 	for !conn.responses.empty() {
 		unmatchedResponses.Add(1)
@@ -886,6 +930,10 @@ func (http *httpPlugin) Expired(tuple *common.TCPTuple, private protos.ProtocolD
 	if isDebug {
 		debugf("expired connection %s", tuple)
 	}
+	if conn.h2 != nil {
+		http.flushHTTP2(conn.h2)
+		return
+	}
 	// terminate streams
 	for dir, s := range conn.streams {
 		// Do not send incomplete or empty messages
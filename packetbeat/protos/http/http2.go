@@ -0,0 +1,687 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// http2Preface is sent by clients at the start of HTTP/2 connections,
+// either directly or after upgrading an HTTP/1.1 connection.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const http2FrameHeaderLen = 9
+
+// Frame types, as defined in RFC 9113 section 6.
+const (
+	http2FrameData         uint8 = 0x0
+	http2FrameHeaders      uint8 = 0x1
+	http2FrameRSTStream    uint8 = 0x3
+	http2FrameSettings     uint8 = 0x4
+	http2FramePushPromise  uint8 = 0x5
+	http2FrameContinuation uint8 = 0x9
+)
+
+// Frame flags.
+const (
+	http2FlagEndStream  uint8 = 0x1
+	http2FlagAck        uint8 = 0x1
+	http2FlagEndHeaders uint8 = 0x4
+	http2FlagPadded     uint8 = 0x8
+	http2FlagPriority   uint8 = 0x20
+)
+
+const (
+	http2SettingHeaderTableSize = 0x1
+
+	// http2DefaultHeaderTableSize is the initial size of the HPACK dynamic
+	// table of both endpoints.
+	http2DefaultHeaderTableSize = 4096
+
+	// http2MaxStreams is the number of streams tracked per connection.
+	// Streams whose request or response is never seen are published once
+	// the limit is reached, oldest first.
+	http2MaxStreams = 1000
+)
+
+var http2ErrorNames = []string{
+	"NO_ERROR",
+	"PROTOCOL_ERROR",
+	"INTERNAL_ERROR",
+	"FLOW_CONTROL_ERROR",
+	"SETTINGS_TIMEOUT",
+	"STREAM_CLOSED",
+	"FRAME_SIZE_ERROR",
+	"REFUSED_STREAM",
+	"CANCEL",
+	"COMPRESSION_ERROR",
+	"CONNECT_ERROR",
+	"ENHANCE_YOUR_CALM",
+	"INADEQUATE_SECURITY",
+	"HTTP_1_1_REQUIRED",
+}
+
+var (
+	errHTTP2FrameSize    = errors.New("invalid HTTP/2 frame size")
+	errHTTP2Continuation = errors.New("unexpected HTTP/2 CONTINUATION frame")
+	errHTTP2Preface      = errors.New("invalid HTTP/2 connection preface")
+)
+
+// http2Conn holds the state of an HTTP/2 connection.
+type http2Conn struct {
+	// clientDir is the TCP direction of the client to server traffic.
+	clientDir uint8
+	dirs      [2]http2Direction
+	streams   map[uint32]*http2Stream
+}
+
+// http2Direction holds the state of one direction of an HTTP/2 connection.
+type http2Direction struct {
+	data []byte
+
+	// expectPreface is set until the client connection preface is read.
+	expectPreface bool
+
+	// decoder holds the HPACK state of the header blocks sent in this
+	// direction.
+	decoder *hpack.Decoder
+
+	// header block split across HEADERS or PUSH_PROMISE and CONTINUATION
+	// frames.
+	headerStream    uint32
+	headerBlock     []byte
+	headerSize      int
+	headerEndStream bool
+	headerPromise   bool
+}
+
+// http2Stream holds a request and its response.
+type http2Stream struct {
+	request, response         *message
+	requestDone, responseDone bool
+}
+
+type http2Frame struct {
+	typ      uint8
+	flags    uint8
+	streamID uint32
+	payload  []byte
+}
+
+func (f *http2Frame) has(flag uint8) bool {
+	return f.flags&flag != 0
+}
+
+func (f *http2Frame) size() int {
+	return http2FrameHeaderLen + len(f.payload)
+}
+
+// http2PrefaceState tells whether data starts with the HTTP/2 client
+// connection preface. more is set if data is a prefix of the preface.
+func http2PrefaceState(data []byte) (found, more bool) {
+	if len(data) < len(http2Preface) {
+		return false, len(data) > 0 && bytes.HasPrefix([]byte(http2Preface), data)
+	}
+	return bytes.HasPrefix(data, []byte(http2Preface)), false
+}
+
+func newHTTP2Conn(clientDir uint8, maxStringLength int) *http2Conn {
+	h2 := &http2Conn{
+		clientDir: clientDir,
+		streams:   map[uint32]*http2Stream{},
+	}
+	for i := range h2.dirs {
+		d := &h2.dirs[i]
+		d.decoder = hpack.NewDecoder(http2DefaultHeaderTableSize, nil)
+		d.decoder.SetMaxStringLength(maxStringLength)
+	}
+	h2.dirs[clientDir].expectPreface = true
+	return h2
+}
+
+// isHTTP2Upgrade tells whether m is the response accepting an upgrade of an
+// HTTP/1.1 connection to cleartext HTTP/2.
+func isHTTP2Upgrade(m *message) bool {
+	return !m.isRequest && m.statusCode == 101 && bytes.EqualFold(trim(m.upgrade), []byte("h2c"))
+}
+
+// upgradeHTTP2 switches a connection to HTTP/2 after the server accepted an
+// upgrade. The request that asked for the upgrade is answered on stream 1.
+func (http *httpPlugin) upgradeHTTP2(conn *httpConnectionData, resp *message) {
+	clientDir := 1 - resp.direction
+	h2 := newHTTP2Conn(clientDir, http.maxMessageSize)
+	if requ := conn.requests.pop(); requ != nil {
+		h2.streams[1] = &http2Stream{request: requ, requestDone: true}
+	}
+	http.flushRequests(conn)
+
+	// The client may already have sent the connection preface.
+	if st := conn.streams[clientDir]; st != nil {
+		h2.dirs[clientDir].data = st.data
+	}
+	conn.streams = [2]*stream{}
+	conn.h2 = h2
+}
+
+// doParseHTTP2 parses the HTTP/2 frames of a connection.
+func (http *httpPlugin) doParseHTTP2(
+	conn *httpConnectionData,
+	ts time.Time,
+	payload []byte,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) *httpConnectionData {
+	h2 := conn.h2
+	d := &h2.dirs[dir]
+	d.data = append(d.data, payload...)
+
+	if d.expectPreface {
+		found, more := http2PrefaceState(d.data)
+		if more {
+			return conn
+		}
+		if !found {
+			return http.dropHTTP2(conn, errHTTP2Preface)
+		}
+		d.data = d.data[len(http2Preface):]
+		d.expectPreface = false
+	}
+
+	for len(d.data) >= http2FrameHeaderLen {
+		length := int(d.data[0])<<16 | int(d.data[1])<<8 | int(d.data[2])
+		if length > http.maxMessageSize {
+			return http.dropHTTP2(conn, errHTTP2FrameSize)
+		}
+		if len(d.data) < http2FrameHeaderLen+length {
+			break
+		}
+
+		f := http2Frame{
+			typ:      d.data[3],
+			flags:    d.data[4],
+			streamID: binary.BigEndian.Uint32(d.data[5:9]) & 0x7fffffff,
+			payload:  d.data[http2FrameHeaderLen : http2FrameHeaderLen+length],
+		}
+		d.data = d.data[f.size():]
+		if err := http.handleHTTP2Frame(h2, d, &f, ts, tcptuple, dir); err != nil {
+			return http.dropHTTP2(conn, err)
+		}
+	}
+	if len(d.data) == 0 {
+		d.data = nil
+	}
+
+	return conn
+}
+
+// dropHTTP2 publishes the pending transactions of a connection whose state
+// can't be recovered.
+func (http *httpPlugin) dropHTTP2(conn *httpConnectionData, err error) *httpConnectionData {
+	if isDebug {
+		debugf("%v, dropping HTTP/2 connection", err)
+	}
+	http.flushHTTP2(conn.h2)
+	return nil
+}
+
+func (http *httpPlugin) handleHTTP2Frame(
+	h2 *http2Conn,
+	d *http2Direction,
+	f *http2Frame,
+	ts time.Time,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) error {
+	if d.headerBlock != nil && f.typ != http2FrameContinuation {
+		return errHTTP2Continuation
+	}
+
+	switch f.typ {
+	case http2FrameData:
+		data, err := http2FramePayload(f, 0)
+		if err != nil {
+			return err
+		}
+		s := h2.streams[f.streamID]
+		if s == nil {
+			return nil
+		}
+		if m := s.message(h2, dir); m != nil {
+			m.size += uint64(f.size())
+			http.appendHTTP2Body(m, data)
+		}
+		if f.has(http2FlagEndStream) {
+			http.http2MessageDone(h2, f.streamID, s, dir)
+		}
+
+	case http2FrameHeaders:
+		skip := 0
+		if f.has(http2FlagPriority) {
+			skip = 5
+		}
+		block, err := http2FramePayload(f, skip)
+		if err != nil {
+			return err
+		}
+		d.startHeaderBlock(f, block, false)
+
+	case http2FramePushPromise:
+		block, err := http2FramePayload(f, 4)
+		if err != nil {
+			return err
+		}
+		d.startHeaderBlock(f, block, true)
+
+	case http2FrameContinuation:
+		if d.headerBlock == nil || f.streamID != d.headerStream {
+			return errHTTP2Continuation
+		}
+		// The frame size limit applies to the whole header block, so that
+		// a peer can't grow it without bound with CONTINUATION frames.
+		if d.headerSize+f.size() > http.maxMessageSize {
+			return errHTTP2FrameSize
+		}
+		d.headerBlock = append(d.headerBlock, f.payload...)
+		d.headerSize += f.size()
+		if f.has(http2FlagEndHeaders) {
+			break
+		}
+		return nil
+
+	case http2FrameRSTStream:
+		if len(f.payload) != 4 {
+			return errHTTP2FrameSize
+		}
+		if s := h2.streams[f.streamID]; s != nil {
+			code := binary.BigEndian.Uint32(f.payload)
+			note := fmt.Sprintf("Stream reset by %s with error %s", h2.peerName(dir), http2ErrorName(code))
+			if m := s.request; m != nil {
+				m.notes = append(m.notes, note)
+			} else if m := s.response; m != nil {
+				m.notes = append(m.notes, note)
+			}
+			http.publishHTTP2(h2, f.streamID, s)
+		}
+
+	case http2FrameSettings:
+		if f.has(http2FlagAck) {
+			return nil
+		}
+		if len(f.payload)%6 != 0 {
+			return errHTTP2FrameSize
+		}
+		for p := f.payload; len(p) > 0; p = p[6:] {
+			if binary.BigEndian.Uint16(p) == http2SettingHeaderTableSize {
+				// The sender of the setting decodes the header blocks
+				// sent in the opposite direction.
+				size := binary.BigEndian.Uint32(p[2:])
+				h2.dirs[1-dir].decoder.SetAllowedMaxDynamicTableSize(size)
+			}
+		}
+	}
+
+	if (f.typ == http2FrameHeaders || f.typ == http2FramePushPromise || f.typ == http2FrameContinuation) &&
+		f.has(http2FlagEndHeaders) {
+		return http.endHeaderBlock(h2, d, ts, tcptuple, dir)
+	}
+	return nil
+}
+
+// http2FramePayload returns the payload of a DATA, HEADERS or PUSH_PROMISE
+// frame, without padding and the skip bytes following the pad length.
+func http2FramePayload(f *http2Frame, skip int) ([]byte, error) {
+	payload := f.payload
+	pad := 0
+	if f.has(http2FlagPadded) {
+		if len(payload) == 0 {
+			return nil, errHTTP2FrameSize
+		}
+		pad = int(payload[0])
+		payload = payload[1:]
+	}
+	if len(payload) < skip+pad {
+		return nil, errHTTP2FrameSize
+	}
+	return payload[skip : len(payload)-pad], nil
+}
+
+func (d *http2Direction) startHeaderBlock(f *http2Frame, block []byte, promise bool) {
+	d.headerStream = f.streamID
+	d.headerBlock = append([]byte{}, block...)
+	d.headerSize = f.size()
+	d.headerEndStream = f.has(http2FlagEndStream)
+	d.headerPromise = promise
+}
+
+func (d *http2Direction) resetHeaderBlock() {
+	d.headerBlock = nil
+	d.headerSize = 0
+}
+
+// endHeaderBlock decodes a complete header block. Header blocks must be
+// decoded in order to keep the HPACK state in sync, even if the stream is
+// not tracked.
+func (http *httpPlugin) endHeaderBlock(
+	h2 *http2Conn,
+	d *http2Direction,
+	ts time.Time,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) error {
+	defer d.resetHeaderBlock()
+
+	fields, err := d.decoder.DecodeFull(d.headerBlock)
+	if err != nil {
+		return err
+	}
+	if d.headerPromise {
+		// Pushed streams are not tracked.
+		return nil
+	}
+
+	id := d.headerStream
+	s := h2.streams[id]
+	if s == nil {
+		if len(h2.streams) >= http2MaxStreams {
+			http.publishOldestHTTP2(h2)
+		}
+		s = &http2Stream{}
+		h2.streams[id] = s
+	}
+
+	isRequest := dir == h2.clientDir
+	m := s.message(h2, dir)
+	switch {
+	case m == nil:
+		m = &message{
+			ts:        ts,
+			isRequest: isRequest,
+			version:   version{major: 2},
+			tcpTuple:  *tcptuple,
+			direction: dir,
+		}
+		m.cmdlineTuple = http.watcher.FindProcessesTupleTCP(tcptuple.IPPort())
+		http.applyHTTP2Headers(m, fields)
+		if !isRequest && m.statusCode >= 100 && m.statusCode < 200 {
+			// informational responses precede the final response
+			return nil
+		}
+		http.initHTTP2Body(m)
+		if isRequest {
+			s.request = m
+		} else {
+			s.response = m
+		}
+	default:
+		// trailers
+		http.applyHTTP2Headers(m, fields)
+	}
+	m.size += uint64(d.headerSize)
+
+	if d.headerEndStream {
+		http.http2MessageDone(h2, id, s, dir)
+	}
+	return nil
+}
+
+// applyHTTP2Headers stores the decoded header fields of a message.
+func (http *httpPlugin) applyHTTP2Headers(m *message, fields []hpack.HeaderField) {
+	if m.headers == nil {
+		m.headers = make(map[string]common.NetString)
+	}
+
+	parser := newParser(&http.parserConfig)
+	var raw bytes.Buffer
+	raw.Write(m.rawHeaders)
+	for _, f := range fields {
+		raw.WriteString(f.Name)
+		raw.WriteString(": ")
+		raw.WriteString(f.Value)
+		raw.Write(constCRLF)
+
+		switch f.Name {
+		case ":method":
+			m.method = common.NetString(f.Value)
+		case ":path":
+			m.requestURI = common.NetString(f.Value)
+		case ":authority":
+			m.host = common.NetString(f.Value)
+		case ":status":
+			status, _ := strconv.Atoi(f.Value)
+			m.statusCode = uint16(status)
+		case "grpc-status":
+			if status, err := strconv.Atoi(f.Value); err == nil {
+				m.grpcStatus = status
+				m.hasGRPCStatus = true
+			}
+		case "grpc-message":
+			m.grpcMessage = decodeGRPCMessage(f.Value)
+		}
+		if !strings.HasPrefix(f.Name, ":") {
+			parser.processHeader(m, []byte(f.Name), []byte(f.Value))
+		}
+	}
+	m.rawHeaders = raw.Bytes()
+}
+
+func (http *httpPlugin) initHTTP2Body(m *message) {
+	parser := newParser(&http.parserConfig)
+	if m.isRequest {
+		m.sendBody = parser.shouldIncludeInBody(m.contentType, http.parserConfig.includeRequestBodyFor)
+	} else {
+		m.sendBody = parser.shouldIncludeInBody(m.contentType, http.parserConfig.includeResponseBodyFor)
+	}
+	m.saveBody = m.sendBody || bytes.Contains(m.contentType, []byte("urlencoded"))
+}
+
+func (http *httpPlugin) appendHTTP2Body(m *message, data []byte) {
+	if !m.hasContentLength {
+		m.contentLength += len(data)
+	}
+	if m.saveBody && len(m.body)+len(data) <= http.maxMessageSize {
+		m.body = append(m.body, data...)
+	}
+}
+
+// message returns the message sent in direction dir.
+func (s *http2Stream) message(h2 *http2Conn, dir uint8) *message {
+	if dir == h2.clientDir {
+		return s.request
+	}
+	return s.response
+}
+
+func (h2 *http2Conn) peerName(dir uint8) string {
+	if dir == h2.clientDir {
+		return "client"
+	}
+	return "server"
+}
+
+// http2MessageDone is called when the sender of a message ends a stream.
+func (http *httpPlugin) http2MessageDone(h2 *http2Conn, id uint32, s *http2Stream, dir uint8) {
+	if dir == h2.clientDir {
+		if s.request != nil && !s.requestDone {
+			http.redactMessage(s.request)
+		}
+		s.requestDone = true
+		return
+	}
+
+	if s.response != nil && !s.responseDone {
+		http.redactMessage(s.response)
+	}
+	s.responseDone = true
+	http.publishHTTP2(h2, id, s)
+}
+
+// publishHTTP2 publishes the transaction of a stream and stops tracking it.
+func (http *httpPlugin) publishHTTP2(h2 *http2Conn, id uint32, s *http2Stream) {
+	delete(h2.streams, id)
+
+	requ, resp := s.request, s.response
+	if requ != nil && !s.requestDone {
+		http.redactMessage(requ)
+	}
+	if resp != nil && !s.responseDone {
+		http.redactMessage(resp)
+	}
+	switch {
+	case requ == nil && resp == nil:
+		return
+	case requ == nil:
+		unmatchedResponses.Add(1)
+	case resp == nil:
+		unmatchedRequests.Add(1)
+	}
+
+	event := http.newTransaction(requ, resp)
+	addGRPCFields(event.Fields, requ, resp)
+	http.publishTransaction(event)
+}
+
+// publishOldestHTTP2 publishes the stream with the lowest identifier, which
+// is the oldest one as stream identifiers only increase.
+func (http *httpPlugin) publishOldestHTTP2(h2 *http2Conn) {
+	var (
+		oldest uint32
+		found  bool
+	)
+	for id := range h2.streams {
+		if !found || id < oldest {
+			oldest, found = id, true
+		}
+	}
+	if found {
+		http.publishHTTP2(h2, oldest, h2.streams[oldest])
+	}
+}
+
+// flushHTTP2 publishes the transactions of all streams.
+func (http *httpPlugin) flushHTTP2(h2 *http2Conn) {
+	for id, s := range h2.streams {
+		http.publishHTTP2(h2, id, s)
+	}
+}
+
+func http2ErrorName(code uint32) string {
+	if int(code) < len(http2ErrorNames) {
+		return http2ErrorNames[code]
+	}
+	return "0x" + strconv.FormatUint(uint64(code), 16)
+}
+
+// grpcStatusNames holds the names of the gRPC status codes.
+var grpcStatusNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+func isGRPC(m *message) bool {
+	return m != nil && bytes.HasPrefix(m.contentType, []byte("application/grpc"))
+}
+
+// parseGRPCPath splits the path of a gRPC request, like
+// /package.Service/Method, into the service and method names.
+func parseGRPCPath(path string) (service, method string, ok bool) {
+	path, ok = strings.CutPrefix(path, "/")
+	if !ok {
+		return "", "", false
+	}
+	service, method, ok = strings.Cut(path, "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+	return service, method, true
+}
+
+// decodeGRPCMessage decodes the percent-encoding of grpc-message values.
+func decodeGRPCMessage(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// addGRPCFields adds the gRPC method and status of a transaction. The
+// status of a failed call is Error, even though its HTTP status is 200.
+func addGRPCFields(fields mapstr.M, requ, resp *message) {
+	if !isGRPC(requ) && !isGRPC(resp) {
+		return
+	}
+
+	grpc := mapstr.M{}
+	if requ != nil {
+		if service, method, ok := parseGRPCPath(string(requ.requestURI)); ok {
+			grpc["service"] = service
+			grpc["method"] = method
+		}
+	}
+	if resp != nil && resp.hasGRPCStatus {
+		grpc["status_code"] = resp.grpcStatus
+		if resp.grpcStatus >= 0 && resp.grpcStatus < len(grpcStatusNames) {
+			grpc["status"] = grpcStatusNames[resp.grpcStatus]
+		}
+		if resp.grpcMessage != "" {
+			grpc["message"] = resp.grpcMessage
+		}
+		if resp.grpcStatus != 0 {
+			fields["status"] = common.ERROR_STATUS
+		}
+	}
+	if len(grpc) > 0 {
+		fields["grpc"] = grpc
+	}
+}
@@ -0,0 +1,406 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package http
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/packetbeat/protos"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// http2Writer encodes the frames sent in one direction of a connection.
+type http2Writer struct {
+	buf    bytes.Buffer
+	framer *http2.Framer
+	hbuf   bytes.Buffer
+	enc    *hpack.Encoder
+}
+
+func newHTTP2Writer() *http2Writer {
+	w := &http2Writer{}
+	w.framer = http2.NewFramer(&w.buf, nil)
+	w.enc = hpack.NewEncoder(&w.hbuf)
+	return w
+}
+
+func (w *http2Writer) headerBlock(fields ...string) []byte {
+	w.hbuf.Reset()
+	for i := 0; i < len(fields); i += 2 {
+		_ = w.enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	return append([]byte{}, w.hbuf.Bytes()...)
+}
+
+func (w *http2Writer) headers(streamID uint32, endStream bool, fields ...string) {
+	_ = w.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: w.headerBlock(fields...),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	})
+}
+
+func (w *http2Writer) data(streamID uint32, endStream bool, data string) {
+	_ = w.framer.WriteData(streamID, endStream, []byte(data))
+}
+
+// take returns the frames written so far.
+func (w *http2Writer) take() []byte {
+	b := append([]byte{}, w.buf.Bytes()...)
+	w.buf.Reset()
+	return b
+}
+
+type http2TestConn struct {
+	http    *httpPlugin
+	tuple   *common.TCPTuple
+	private protos.ProtocolData
+}
+
+func newHTTP2TestConn(http *httpPlugin) *http2TestConn {
+	return &http2TestConn{
+		http:    http,
+		tuple:   testCreateTCPTuple(),
+		private: protos.ProtocolData(&httpConnectionData{}),
+	}
+}
+
+func (c *http2TestConn) send(dir uint8, data []byte) {
+	packet := protos.Packet{Payload: data}
+	c.private = c.http.Parse(&packet, c.tuple, dir, c.private)
+}
+
+func TestHTTP2_RequestResponse(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	client, server := newHTTP2Writer(), newHTTP2Writer()
+	_ = client.framer.WriteSettings()
+	client.headers(1, true,
+		":method", "GET", ":scheme", "http", ":path", "/index.html?q=1",
+		":authority", "www.example.com", "user-agent", "curl/8.0")
+	client.headers(3, false,
+		":method", "POST", ":scheme", "http", ":path", "/submit",
+		":authority", "www.example.com", "user-agent", "curl/8.0",
+		"content-type", "text/plain")
+	client.data(3, true, "hello")
+
+	_ = server.framer.WriteSettings()
+	server.headers(3, false, ":status", "201", "content-length", "2")
+	server.data(3, true, "ok")
+	server.headers(1, false, ":status", "404", "content-type", "text/html")
+	server.data(1, false, "not ")
+	server.data(1, true, "found")
+
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+	conn.send(1, server.take())
+
+	// responses are correlated by stream, in the order they complete
+	trans := expectTransaction(t, &store)
+	assert.Equal(t, common.NetString("POST"), trans["method"])
+	assert.Equal(t, common.OK_STATUS, trans["status"])
+	httpFields := trans["http"].(mapstr.M)
+	assert.Equal(t, "2.0", httpFields["version"])
+	status, _ := httpFields.GetValue("response.status_code")
+	assert.EqualValues(t, 201, status)
+	bodyBytes, _ := httpFields.GetValue("request.body.bytes")
+	assert.EqualValues(t, 5, bodyBytes)
+
+	trans = expectTransaction(t, &store)
+	assert.Equal(t, common.NetString("GET"), trans["method"])
+	assert.Equal(t, common.ERROR_STATUS, trans["status"])
+	httpFields = trans["http"].(mapstr.M)
+	status, _ = httpFields.GetValue("response.status_code")
+	assert.EqualValues(t, 404, status)
+	bodyBytes, _ = httpFields.GetValue("response.body.bytes")
+	assert.EqualValues(t, 9, bodyBytes)
+	path, _ := trans.GetValue("url.path")
+	assert.Equal(t, "/index.html", path)
+	domain, _ := trans.GetValue("url.domain")
+	assert.Equal(t, "www.example.com", domain)
+	agent, _ := trans.GetValue("user_agent.original")
+	assert.Equal(t, "curl/8.0", agent)
+	assert.Empty(t, store.events)
+}
+
+func TestHTTP2_SplitFrames(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	client, server := newHTTP2Writer(), newHTTP2Writer()
+	for _, id := range []uint32{1, 3} {
+		// the second request is encoded with the HPACK dynamic table
+		client.headers(id, true,
+			":method", "GET", ":scheme", "http", ":path", "/",
+			":authority", "www.example.com", "x-custom", "value")
+		server.headers(id, true, ":status", "204", "x-custom", "value")
+	}
+
+	data := append([]byte(http2Preface), client.take()...)
+	for i := range data {
+		conn.send(0, data[i:i+1])
+	}
+	conn.send(1, server.take())
+
+	assert.Len(t, store.events, 2)
+}
+
+func TestHTTP2_Continuation(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	http.parserConfig.sendHeaders = true
+	http.parserConfig.sendAllHeaders = true
+	conn := newHTTP2TestConn(http)
+
+	client, server := newHTTP2Writer(), newHTTP2Writer()
+	block := client.headerBlock(
+		":method", "GET", ":scheme", "http", ":path", "/",
+		":authority", "www.example.com", "x-custom", "value")
+	_ = client.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block[:5],
+		EndStream:     true,
+		PadLength:     3,
+	})
+	_ = client.framer.WriteContinuation(1, false, block[5:10])
+	_ = client.framer.WriteContinuation(1, true, block[10:])
+	server.headers(1, true, ":status", "200")
+
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+	conn.send(1, server.take())
+
+	trans := expectTransaction(t, &store)
+	custom, _ := trans.GetValue("http.request.headers.x-custom")
+	assert.Equal(t, common.NetString("value"), custom)
+}
+
+func TestHTTP2_ContinuationLimit(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	http.maxMessageSize = 100
+	conn := newHTTP2TestConn(http)
+
+	client := newHTTP2Writer()
+	_ = client.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: client.headerBlock(":method", "GET"),
+		EndStream:     true,
+	})
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+
+	// Each CONTINUATION frame is below the size limit, but not the header
+	// block they add up to.
+	for i := 0; i < 10 && conn.private != nil; i++ {
+		_ = client.framer.WriteContinuation(1, false, bytes.Repeat([]byte{0}, 20))
+		conn.send(0, client.take())
+	}
+	assert.Nil(t, conn.private, "the connection should be dropped")
+}
+
+func TestHTTP2_GRPC(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	client, server := newHTTP2Writer(), newHTTP2Writer()
+	for _, id := range []uint32{1, 3, 5} {
+		client.headers(id, false,
+			":method", "POST", ":scheme", "http", ":path", "/helloworld.Greeter/SayHello",
+			":authority", "localhost:50051", "content-type", "application/grpc", "te", "trailers")
+		client.data(id, true, "\x00\x00\x00\x00\x07\x0a\x05world")
+	}
+
+	// successful call
+	server.headers(1, false, ":status", "200", "content-type", "application/grpc")
+	server.data(1, false, "\x00\x00\x00\x00\x0d\x0a\x0bHello world")
+	server.headers(1, true, "grpc-status", "0")
+
+	// error in trailers
+	server.headers(3, false, ":status", "200", "content-type", "application/grpc")
+	server.headers(3, true, "grpc-status", "5", "grpc-message", "user%20not%20found")
+
+	// trailers-only response
+	server.headers(5, true, ":status", "200", "content-type", "application/grpc", "grpc-status", "12")
+
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+	conn.send(1, server.take())
+
+	trans := expectTransaction(t, &store)
+	assert.Equal(t, common.OK_STATUS, trans["status"])
+	assert.Equal(t, mapstr.M{
+		"service":     "helloworld.Greeter",
+		"method":      "SayHello",
+		"status_code": 0,
+		"status":      "OK",
+	}, trans["grpc"])
+
+	trans = expectTransaction(t, &store)
+	assert.Equal(t, common.ERROR_STATUS, trans["status"])
+	assert.Equal(t, mapstr.M{
+		"service":     "helloworld.Greeter",
+		"method":      "SayHello",
+		"status_code": 5,
+		"status":      "NOT_FOUND",
+		"message":     "user not found",
+	}, trans["grpc"])
+
+	trans = expectTransaction(t, &store)
+	assert.Equal(t, common.ERROR_STATUS, trans["status"])
+	status, _ := trans.GetValue("grpc.status")
+	assert.Equal(t, "UNIMPLEMENTED", status)
+}
+
+func TestHTTP2_ResetStream(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	client := newHTTP2Writer()
+	client.headers(1, false,
+		":method", "POST", ":scheme", "http", ":path", "/upload",
+		":authority", "www.example.com")
+	_ = client.framer.WriteRSTStream(1, http2.ErrCodeCancel)
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+
+	trans := expectTransaction(t, &store)
+	assert.Equal(t, common.ERROR_STATUS, trans["status"])
+	notes, _ := trans.GetValue("error.message")
+	assert.Contains(t, notes, "Stream reset by client with error CANCEL")
+}
+
+func TestHTTP2_MaxStreams(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	// The responses are never seen, so the oldest streams are published
+	// as unmatched requests once the limit is reached.
+	client := newHTTP2Writer()
+	for i := 0; i < http2MaxStreams+2; i++ {
+		client.headers(uint32(2*i+1), true,
+			":method", "GET", ":scheme", "http", ":path", "/",
+			":authority", "www.example.com")
+	}
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+
+	h2 := conn.private.(*httpConnectionData).h2
+	assert.Len(t, h2.streams, http2MaxStreams)
+	assert.NotContains(t, h2.streams, uint32(1))
+	assert.NotContains(t, h2.streams, uint32(3))
+	assert.Len(t, store.events, 2)
+}
+
+func TestHTTP2_Upgrade(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	conn.send(0, []byte("GET /resource HTTP/1.1\r\n"+
+		"Host: www.example.com\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n"+
+		"\r\n"))
+
+	client, server := newHTTP2Writer(), newHTTP2Writer()
+	_ = server.framer.WriteSettings()
+	server.headers(1, false, ":status", "200", "content-length", "5")
+	server.data(1, true, "hello")
+	conn.send(1, append([]byte("HTTP/1.1 101 Switching Protocols\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: h2c\r\n"+
+		"\r\n"), server.take()...))
+
+	// the response of the upgraded request is sent on stream 1
+	trans := expectTransaction(t, &store)
+	assert.Equal(t, common.NetString("GET"), trans["method"])
+	status, _ := trans.GetValue("http.response.status_code")
+	assert.EqualValues(t, 200, status)
+	version, _ := trans.GetValue("http.version")
+	assert.Equal(t, "1.1", version)
+
+	_ = client.framer.WriteSettings()
+	client.headers(3, true,
+		":method", "GET", ":scheme", "http", ":path", "/next",
+		":authority", "www.example.com")
+	server.headers(3, true, ":status", "204")
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+	conn.send(1, server.take())
+
+	trans = expectTransaction(t, &store)
+	path, _ := trans.GetValue("url.path")
+	assert.Equal(t, "/next", path)
+	version, _ = trans.GetValue("http.version")
+	assert.Equal(t, "2.0", version)
+}
+
+func TestHTTP2_Gap(t *testing.T) {
+	var store eventStore
+	http := httpModForTests(&store)
+	conn := newHTTP2TestConn(http)
+
+	client := newHTTP2Writer()
+	client.headers(1, true,
+		":method", "GET", ":scheme", "http", ":path", "/",
+		":authority", "www.example.com")
+	conn.send(0, append([]byte(http2Preface), client.take()...))
+
+	private, drop := http.GapInStream(conn.tuple, 1, 100, conn.private)
+	assert.True(t, drop)
+	assert.Nil(t, private)
+
+	trans := expectTransaction(t, &store)
+	notes, _ := trans.GetValue("error.message")
+	assert.Contains(t, notes, "Unmatched request")
+}
+
+func TestParseGRPCPath(t *testing.T) {
+	for _, test := range []struct {
+		path            string
+		service, method string
+		ok              bool
+	}{
+		{"/helloworld.Greeter/SayHello", "helloworld.Greeter", "SayHello", true},
+		{"/grpc.health.v1.Health/Check", "grpc.health.v1.Health", "Check", true},
+		{"/Service/", "", "", false},
+		{"/a/b/c", "", "", false},
+		{"no/slash", "", "", false},
+	} {
+		service, method, ok := parseGRPCPath(test.path)
+		assert.Equal(t, test.ok, ok, test.path)
+		assert.Equal(t, test.service, service, test.path)
+		assert.Equal(t, test.method, method, test.path)
+	}
+}
+
+func TestDecodeGRPCMessage(t *testing.T) {
+	assert.Equal(t, "plain", decodeGRPCMessage("plain"))
+	assert.Equal(t, "not found: 100%", decodeGRPCMessage("not%20found%3A%20100%25"))
+	assert.Equal(t, "bad %zz escape%", decodeGRPCMessage("bad %zz escape%"))
+}
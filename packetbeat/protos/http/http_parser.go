@@ -38,6 +38,7 @@ type message struct {
 	headerOffset     int
 	version          version
 	connection       common.NetString
+	upgrade          common.NetString
 	chunkedLength    int
 
 	isRequest    bool
@@ -74,6 +75,11 @@ type message struct {
 	saveBody bool
 	body     []byte
 
+	// gRPC status, from the headers or trailers of HTTP/2 responses
+	grpcStatus    int
+	hasGRPCStatus bool
+	grpcMessage   string
+
 	notes          []string
 	packetLossReq  bool
 	packetLossResp bool
@@ -120,6 +126,7 @@ var (
 	nameTransferEncoding = []byte("transfer-encoding")
 	nameContentEncoding  = []byte("content-encoding")
 	nameConnection       = []byte("connection")
+	nameUpgrade          = []byte("upgrade")
 	nameHost             = []byte("host")
 	nameReferer          = []byte("referer")
 	nameUserAgent        = []byte("user-agent")
@@ -349,8 +356,6 @@ func (parser *parser) parseHeader(m *message, data []byte) (bool, bool, int) {
 		return true, false, 0
 	}
 
-	config := parser.config
-
 	// enabled if required. Allocs for parameters slow down parser big times
 	if isDetailed {
 		detailedf("Data: %s", data)
@@ -375,64 +380,7 @@ func (parser *parser) parseHeader(m *message, data []byte) (bool, bool, int) {
 				debugf("Header: '%s' Value: '%s'\n", data[:i], headerVal)
 			}
 
-			// Headers we need for parsing. Make sure we always
-			// capture their value
-			if bytes.Equal(headerName, nameContentLength) {
-				m.contentLength, _ = parseInt(headerVal)
-				m.hasContentLength = true
-			} else if bytes.Equal(headerName, nameContentType) {
-				m.contentType = headerVal
-			} else if bytes.Equal(headerName, nameTransferEncoding) {
-				encodings := parseCommaSeparatedList(headerVal)
-				// 'chunked' can only appear at the end
-				if n := len(encodings); n > 0 && encodings[n-1] == transferEncodingChunked {
-					m.isChunked = true
-					encodings = encodings[:n-1]
-				}
-				if len(encodings) > 0 {
-					// Append at the end of encodings. If a content-encoding
-					// header is also present, it was applied by sender before
-					// transfer-encoding.
-					m.encodings = append(m.encodings, encodings...)
-				}
-			} else if bytes.Equal(headerName, nameContentEncoding) {
-				encodings := parseCommaSeparatedList(headerVal)
-				// Append at the beginning of m.encodings, as Content-Encoding
-				// is supposed to be applied before Transfer-Encoding.
-				m.encodings = append(encodings, m.encodings...)
-			} else if bytes.Equal(headerName, nameConnection) {
-				m.connection = headerVal
-			} else if len(config.realIPHeader) > 0 && bytes.Equal(headerName, []byte(config.realIPHeader)) {
-				if ips := bytes.SplitN(headerVal, []byte{','}, 2); len(ips) > 0 {
-					m.realIP = trim(ips[0])
-				}
-			} else if bytes.Equal(headerName, nameHost) {
-				m.host = headerVal
-			} else if bytes.Equal(headerName, nameReferer) {
-				m.referer = headerVal
-			} else if bytes.Equal(headerName, nameUserAgent) {
-				m.userAgent = headerVal
-			}
-
-			if config.sendHeaders {
-				if !config.sendAllHeaders {
-					_, exists := config.headersWhitelist[string(headerName)]
-					if !exists {
-						return true, true, p + 2
-					}
-				}
-				if val, ok := m.headers[string(headerName)]; ok {
-					composed := make([]byte, len(val)+len(headerVal)+2)
-					off := copy(composed, val)
-					copy(composed[off:], []byte(", "))
-					copy(composed[off+2:], headerVal)
-
-					m.headers[string(headerName)] = composed
-				} else {
-					m.headers[string(headerName)] = headerVal
-				}
-			}
-
+			parser.processHeader(m, headerName, headerVal)
 			return true, true, p + 2
 		}
 	}
@@ -440,6 +388,72 @@ func (parser *parser) parseHeader(m *message, data []byte) (bool, bool, int) {
 	return true, false, len(data)
 }
 
+// processHeader stores the value of a header field, with headerName in
+// lowercase.
+func (parser *parser) processHeader(m *message, headerName, headerVal []byte) {
+	config := parser.config
+
+	// Headers we need for parsing. Make sure we always
+	// capture their value
+	if bytes.Equal(headerName, nameContentLength) {
+		m.contentLength, _ = parseInt(headerVal)
+		m.hasContentLength = true
+	} else if bytes.Equal(headerName, nameContentType) {
+		m.contentType = headerVal
+	} else if bytes.Equal(headerName, nameTransferEncoding) {
+		encodings := parseCommaSeparatedList(headerVal)
+		// 'chunked' can only appear at the end
+		if n := len(encodings); n > 0 && encodings[n-1] == transferEncodingChunked {
+			m.isChunked = true
+			encodings = encodings[:n-1]
+		}
+		if len(encodings) > 0 {
+			// Append at the end of encodings. If a content-encoding
+			// header is also present, it was applied by sender before
+			// transfer-encoding.
+			m.encodings = append(m.encodings, encodings...)
+		}
+	} else if bytes.Equal(headerName, nameContentEncoding) {
+		encodings := parseCommaSeparatedList(headerVal)
+		// Append at the beginning of m.encodings, as Content-Encoding
+		// is supposed to be applied before Transfer-Encoding.
+		m.encodings = append(encodings, m.encodings...)
+	} else if bytes.Equal(headerName, nameConnection) {
+		m.connection = headerVal
+	} else if bytes.Equal(headerName, nameUpgrade) {
+		m.upgrade = headerVal
+	} else if len(config.realIPHeader) > 0 && bytes.Equal(headerName, []byte(config.realIPHeader)) {
+		if ips := bytes.SplitN(headerVal, []byte{','}, 2); len(ips) > 0 {
+			m.realIP = trim(ips[0])
+		}
+	} else if bytes.Equal(headerName, nameHost) {
+		m.host = headerVal
+	} else if bytes.Equal(headerName, nameReferer) {
+		m.referer = headerVal
+	} else if bytes.Equal(headerName, nameUserAgent) {
+		m.userAgent = headerVal
+	}
+
+	if config.sendHeaders {
+		if !config.sendAllHeaders {
+			_, exists := config.headersWhitelist[string(headerName)]
+			if !exists {
+				return
+			}
+		}
+		if val, ok := m.headers[string(headerName)]; ok {
+			composed := make([]byte, len(val)+len(headerVal)+2)
+			off := copy(composed, val)
+			copy(composed[off:], []byte(", "))
+			copy(composed[off+2:], headerVal)
+
+			m.headers[string(headerName)] = composed
+		} else {
+			m.headers[string(headerName)] = headerVal
+		}
+	}
+}
+
 func parseCommaSeparatedList(s common.NetString) (list []string) {
 	values := bytes.Split(s, []byte(","))
 	list = make([]string, len(values))
@@ -0,0 +1,457 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+// decodeRequestBody decodes the topics, partitions and group of a request.
+func decodeRequestBody(msg *message, d *decoder) {
+	v := msg.apiVersion
+	switch msg.apiKey {
+	case apiProduce:
+		decodeProduceRequest(msg, d, v)
+	case apiFetch:
+		decodeFetchRequest(msg, d, v)
+	case apiListOffsets:
+		decodeListOffsetsRequest(msg, d, v)
+	case apiMetadata:
+		decodeMetadataRequest(msg, d, v)
+	case apiOffsetCommit:
+		decodeOffsetCommitRequest(msg, d, v)
+	case apiOffsetFetch:
+		decodeOffsetFetchRequest(msg, d, v)
+	case apiFindCoordinator:
+		decodeFindCoordinatorRequest(msg, d, v)
+	case apiJoinGroup, apiHeartbeat, apiLeaveGroup, apiSyncGroup:
+		msg.groupID = d.string()
+	}
+}
+
+func decodeProduceRequest(msg *message, d *decoder, v int16) {
+	if v >= 3 {
+		d.skipString() // transactional_id
+	}
+	msg.acks = d.int16()
+	msg.hasAcks = d.err == nil
+	d.skip(4) // timeout_ms
+	d.array(func() {
+		msg.addTopic(d.string())
+		d.array(func() {
+			msg.addPartition(d.int32())
+			d.skipBytes() // records
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeFetchRequest(msg *message, d *decoder, v int16) {
+	if v <= 14 {
+		d.skip(4) // replica_id
+	}
+	d.skip(8) // max_wait_ms, min_bytes
+	if v >= 3 {
+		d.skip(4) // max_bytes
+	}
+	if v >= 4 {
+		d.skip(1) // isolation_level
+	}
+	if v >= 7 {
+		d.skip(8) // session_id, session_epoch
+	}
+	d.array(func() {
+		if v >= 13 {
+			msg.addTopicID(d.uuid())
+		} else {
+			msg.addTopic(d.string())
+		}
+		d.array(func() {
+			msg.addPartition(d.int32())
+			if v >= 9 {
+				d.skip(4) // current_leader_epoch
+			}
+			d.skip(8) // fetch_offset
+			if v >= 12 {
+				d.skip(4) // last_fetched_epoch
+			}
+			if v >= 5 {
+				d.skip(8) // log_start_offset
+			}
+			d.skip(4) // partition_max_bytes
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeListOffsetsRequest(msg *message, d *decoder, v int16) {
+	d.skip(4) // replica_id
+	if v >= 2 {
+		d.skip(1) // isolation_level
+	}
+	d.array(func() {
+		msg.addTopic(d.string())
+		d.array(func() {
+			msg.addPartition(d.int32())
+			if v >= 4 {
+				d.skip(4) // current_leader_epoch
+			}
+			d.skip(8) // timestamp
+			if v == 0 {
+				d.skip(4) // max_num_offsets
+			}
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeMetadataRequest(msg *message, d *decoder, v int16) {
+	d.array(func() {
+		if v >= 10 {
+			msg.addTopicID(d.uuid())
+			msg.addTopic(d.nullableString())
+		} else {
+			msg.addTopic(d.string())
+		}
+		d.taggedFields()
+	})
+}
+
+func decodeOffsetCommitRequest(msg *message, d *decoder, v int16) {
+	msg.groupID = d.string()
+	if v >= 1 {
+		d.skip(4)      // generation_id
+		d.skipString() // member_id
+	}
+	if v >= 7 {
+		d.skipString() // group_instance_id
+	}
+	if v >= 2 && v <= 4 {
+		d.skip(8) // retention_time_ms
+	}
+	d.array(func() {
+		msg.addTopic(d.string())
+		d.array(func() {
+			msg.addPartition(d.int32())
+			d.skip(8) // committed_offset
+			if v >= 6 {
+				d.skip(4) // committed_leader_epoch
+			}
+			if v == 1 {
+				d.skip(8) // commit_timestamp
+			}
+			d.skipString() // committed_metadata
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeOffsetFetchRequest(msg *message, d *decoder, v int16) {
+	decodeTopics := func() {
+		d.array(func() {
+			msg.addTopic(d.string())
+			d.array(func() {
+				msg.addPartition(d.int32())
+			})
+			d.taggedFields()
+		})
+	}
+
+	if v < 8 {
+		msg.groupID = d.string()
+		decodeTopics()
+		return
+	}
+
+	// Since version 8, offsets of multiple groups can be fetched at once.
+	d.array(func() {
+		if group := d.string(); msg.groupID == "" {
+			msg.groupID = group
+		}
+		if v >= 9 {
+			d.skipString() // member_id
+			d.skip(4)      // member_epoch
+		}
+		decodeTopics()
+		d.taggedFields()
+	})
+}
+
+func decodeFindCoordinatorRequest(msg *message, d *decoder, v int16) {
+	const groupKeyType = 0
+
+	if v < 4 {
+		key := d.string()
+		if v == 0 || d.int8() == groupKeyType {
+			msg.groupID = key
+		}
+		return
+	}
+
+	keyType := d.int8()
+	d.array(func() {
+		if key := d.string(); keyType == groupKeyType && msg.groupID == "" {
+			msg.groupID = key
+		}
+	})
+}
+
+// decodeResponseBody collects the error codes of a response.
+func decodeResponseBody(v, apiKey int16, resp *message, d *decoder) {
+	switch apiKey {
+	case apiProduce:
+		decodeProduceResponse(resp, d, v)
+	case apiFetch:
+		decodeFetchResponse(resp, d, v)
+	case apiListOffsets:
+		decodeListOffsetsResponse(resp, d, v)
+	case apiMetadata:
+		decodeMetadataResponse(resp, d, v)
+	case apiOffsetCommit:
+		decodeOffsetCommitResponse(resp, d, v)
+	case apiOffsetFetch:
+		decodeOffsetFetchResponse(resp, d, v)
+	case apiFindCoordinator:
+		decodeFindCoordinatorResponse(resp, d, v)
+	case apiJoinGroup:
+		if v >= 2 {
+			d.skip(4) // throttle_time_ms
+		}
+		resp.addError(d.int16())
+	case apiHeartbeat, apiLeaveGroup, apiSyncGroup:
+		if v >= 1 {
+			d.skip(4) // throttle_time_ms
+		}
+		resp.addError(d.int16())
+	case apiInitProducerID:
+		d.skip(4) // throttle_time_ms
+		resp.addError(d.int16())
+	case apiAPIVersions:
+		resp.addError(d.int16())
+	}
+}
+
+func decodeProduceResponse(resp *message, d *decoder, v int16) {
+	d.array(func() {
+		d.skipString() // name
+		d.array(func() {
+			d.skip(4) // index
+			resp.addError(d.int16())
+			d.skip(8) // base_offset
+			if v >= 2 {
+				d.skip(8) // log_append_time_ms
+			}
+			if v >= 5 {
+				d.skip(8) // log_start_offset
+			}
+			if v >= 8 {
+				d.array(func() {
+					d.skip(4)      // batch_index
+					d.skipString() // batch_index_error_message
+					d.taggedFields()
+				})
+				d.skipString() // error_message
+			}
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeFetchResponse(resp *message, d *decoder, v int16) {
+	if v >= 1 {
+		d.skip(4) // throttle_time_ms
+	}
+	if v >= 7 {
+		resp.addError(d.int16())
+		d.skip(4) // session_id
+	}
+	d.array(func() {
+		if v >= 13 {
+			d.skip(16) // topic_id
+		} else {
+			d.skipString() // topic
+		}
+		d.array(func() {
+			d.skip(4) // partition_index
+			resp.addError(d.int16())
+			d.skip(8) // high_watermark
+			if v >= 4 {
+				d.skip(8) // last_stable_offset
+			}
+			if v >= 5 {
+				d.skip(8) // log_start_offset
+			}
+			if v >= 4 {
+				d.array(func() {
+					d.skip(16) // producer_id, first_offset
+					d.taggedFields()
+				})
+			}
+			if v >= 11 {
+				d.skip(4) // preferred_read_replica
+			}
+			d.skipBytes() // records
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeListOffsetsResponse(resp *message, d *decoder, v int16) {
+	if v >= 2 {
+		d.skip(4) // throttle_time_ms
+	}
+	d.array(func() {
+		d.skipString() // name
+		d.array(func() {
+			d.skip(4) // partition_index
+			resp.addError(d.int16())
+			if v == 0 {
+				d.array(func() {
+					d.skip(8) // old_style_offsets
+				})
+			} else {
+				d.skip(16) // timestamp, offset
+			}
+			if v >= 4 {
+				d.skip(4) // leader_epoch
+			}
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeMetadataResponse(resp *message, d *decoder, v int16) {
+	if v >= 3 {
+		d.skip(4) // throttle_time_ms
+	}
+	d.array(func() {
+		d.skip(4)      // node_id
+		d.skipString() // host
+		d.skip(4)      // port
+		if v >= 1 {
+			d.skipString() // rack
+		}
+		d.taggedFields()
+	})
+	if v >= 2 {
+		d.skipString() // cluster_id
+	}
+	if v >= 1 {
+		d.skip(4) // controller_id
+	}
+	d.array(func() {
+		resp.addError(d.int16())
+		d.skipString() // name
+		if v >= 10 {
+			d.skip(16) // topic_id
+		}
+		if v >= 1 {
+			d.skip(1) // is_internal
+		}
+		d.array(func() {
+			resp.addError(d.int16())
+			d.skip(8) // partition_index, leader_id
+			if v >= 7 {
+				d.skip(4) // leader_epoch
+			}
+			d.skipInt32Array() // replica_nodes
+			d.skipInt32Array() // isr_nodes
+			if v >= 5 {
+				d.skipInt32Array() // offline_replicas
+			}
+			d.taggedFields()
+		})
+		if v >= 8 {
+			d.skip(4) // topic_authorized_operations
+		}
+		d.taggedFields()
+	})
+}
+
+func decodeOffsetCommitResponse(resp *message, d *decoder, v int16) {
+	if v >= 3 {
+		d.skip(4) // throttle_time_ms
+	}
+	d.array(func() {
+		d.skipString() // name
+		d.array(func() {
+			d.skip(4) // partition_index
+			resp.addError(d.int16())
+			d.taggedFields()
+		})
+		d.taggedFields()
+	})
+}
+
+func decodeOffsetFetchResponse(resp *message, d *decoder, v int16) {
+	if v >= 3 {
+		d.skip(4) // throttle_time_ms
+	}
+	decodeTopics := func() {
+		d.array(func() {
+			d.skipString() // name
+			d.array(func() {
+				d.skip(12) // partition_index, committed_offset
+				if v >= 5 {
+					d.skip(4) // committed_leader_epoch
+				}
+				d.skipString() // metadata
+				resp.addError(d.int16())
+				d.taggedFields()
+			})
+			d.taggedFields()
+		})
+	}
+
+	if v < 8 {
+		decodeTopics()
+		if v >= 2 {
+			resp.addError(d.int16())
+		}
+		return
+	}
+
+	d.array(func() {
+		d.skipString() // group_id
+		decodeTopics()
+		resp.addError(d.int16())
+		d.taggedFields()
+	})
+}
+
+func decodeFindCoordinatorResponse(resp *message, d *decoder, v int16) {
+	if v >= 1 {
+		d.skip(4) // throttle_time_ms
+	}
+	if v < 4 {
+		resp.addError(d.int16())
+		return
+	}
+	d.array(func() {
+		d.skipString() // key
+		d.skip(4)      // node_id
+		d.skipString() // host
+		d.skip(4)      // port
+		resp.addError(d.int16())
+		d.skipString() // error_message
+		d.taggedFields()
+	})
+}
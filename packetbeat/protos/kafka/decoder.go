@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+var zeroUUID [16]byte
+
+var (
+	errTruncated     = errors.New("message truncated")
+	errInvalidLength = errors.New("invalid length")
+)
+
+// decoder reads the primitive types of the Kafka protocol. The first error
+// is kept, and all subsequent reads return zero values.
+//
+// If flexible is set, strings, arrays and bytes use the compact encodings
+// introduced with KIP-482, and tagged fields are expected.
+type decoder struct {
+	buf      []byte
+	off      int
+	flexible bool
+	err      error
+}
+
+func newDecoder(buf []byte, flexible bool) *decoder {
+	return &decoder{buf: buf, flexible: flexible}
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 {
+		d.fail(errInvalidLength)
+		return nil
+	}
+	if len(d.buf)-d.off < n {
+		d.fail(errTruncated)
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) skip(n int) {
+	d.next(n)
+}
+
+func (d *decoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.off:])
+	if n <= 0 {
+		d.fail(errTruncated)
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+// length reads the length of a string, bytes or array field. Null values
+// are returned as -1.
+func (d *decoder) length(classic func() int) int {
+	if !d.flexible {
+		return classic()
+	}
+	// compact lengths are encoded as length+1, with 0 for null values
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail(errInvalidLength)
+		return -1
+	}
+	return int(n) - 1
+}
+
+func (d *decoder) stringLength() int {
+	return d.length(func() int { return int(d.int16()) })
+}
+
+func (d *decoder) bytesLength() int {
+	return d.length(func() int { return int(d.int32()) })
+}
+
+// arrayLength returns the number of elements of an array, or -1 for null
+// arrays. Each element of an array is at least one byte long, which bounds
+// the length of arrays in invalid messages.
+func (d *decoder) arrayLength() int {
+	n := d.length(func() int { return int(d.int32()) })
+	if n > len(d.buf)-d.off {
+		d.fail(errInvalidLength)
+		return -1
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.stringLength()
+	if n < 0 {
+		d.fail(errInvalidLength)
+		return ""
+	}
+	return string(d.next(n))
+}
+
+func (d *decoder) nullableString() string {
+	n := d.stringLength()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(n))
+}
+
+// classicNullableString reads a nullable string with an int16 length, which
+// is used in request headers independent of the flexible version.
+func (d *decoder) classicNullableString() string {
+	n := int(d.int16())
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(n))
+}
+
+func (d *decoder) skipBytes() {
+	if n := d.bytesLength(); n > 0 {
+		d.skip(n)
+	}
+}
+
+func (d *decoder) skipString() {
+	if n := d.stringLength(); n > 0 {
+		d.skip(n)
+	}
+}
+
+// uuid reads a topic ID, formatted like Kafka does. The zero ID, which is
+// sent if the topic is identified by name, is returned as empty string.
+func (d *decoder) uuid() string {
+	b := d.next(16)
+	if b == nil || bytes.Equal(b, zeroUUID[:]) {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// array calls fn once per element of an array. In flexible versions, the
+// tagged fields following each element must be read by fn.
+func (d *decoder) array(fn func()) {
+	n := d.arrayLength()
+	for i := 0; i < n && d.err == nil; i++ {
+		fn()
+	}
+}
+
+func (d *decoder) skipInt32Array() {
+	if n := d.arrayLength(); n > 0 {
+		d.skip(4 * n)
+	}
+}
+
+// taggedFields skips the tagged fields of a structure in flexible versions.
+func (d *decoder) taggedFields() {
+	if !d.flexible {
+		return
+	}
+	n := d.uvarint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		d.uvarint() // tag
+		size := d.uvarint()
+		if size > uint64(len(d.buf)) {
+			d.fail(errInvalidLength)
+			return
+		}
+		d.skip(int(size))
+	}
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoderClassic(t *testing.T) {
+	e := &encoder{}
+	e.int16(-2)
+	e.string("topic")
+	e.nullString()
+	e.arrayLength(2)
+	e.int32(7)
+	e.int32(8)
+	e.bytes([]byte("data"))
+
+	d := newDecoder(e.buf, false)
+	assert.Equal(t, int16(-2), d.int16())
+	assert.Equal(t, "topic", d.string())
+	assert.Equal(t, "", d.nullableString())
+	var values []int32
+	d.array(func() { values = append(values, d.int32()) })
+	assert.Equal(t, []int32{7, 8}, values)
+	d.skipBytes()
+	assert.NoError(t, d.err)
+	assert.Equal(t, len(e.buf), d.off)
+}
+
+func TestDecoderFlexible(t *testing.T) {
+	e := &encoder{flexible: true}
+	e.string("topic")
+	e.nullString()
+	// tagged fields with two entries
+	e.uvarint(2)
+	e.uvarint(0)
+	e.uvarint(3)
+	e.buf = append(e.buf, "abc"...)
+	e.uvarint(1)
+	e.uvarint(0)
+	e.arrayLength(1)
+	e.int32(7)
+
+	d := newDecoder(e.buf, true)
+	assert.Equal(t, "topic", d.string())
+	assert.Equal(t, "", d.nullableString())
+	d.taggedFields()
+	d.skipInt32Array()
+	assert.NoError(t, d.err)
+	assert.Equal(t, len(e.buf), d.off)
+}
+
+func TestDecoderErrors(t *testing.T) {
+	d := newDecoder([]byte{0, 5, 'a'}, false)
+	assert.Equal(t, "", d.string())
+	assert.ErrorIs(t, d.err, errTruncated)
+
+	// errors are sticky
+	assert.Equal(t, int16(0), d.int16())
+	assert.ErrorIs(t, d.err, errTruncated)
+
+	d = newDecoder([]byte{0xff, 0xff}, false)
+	d.string()
+	assert.ErrorIs(t, d.err, errInvalidLength)
+
+	// arrays can't have more elements than bytes left
+	d = newDecoder([]byte{0, 0, 1, 0, 1, 2}, false)
+	d.array(func() { t.Fatal("unexpected element") })
+	assert.ErrorIs(t, d.err, errInvalidLength)
+}
+
+func TestDecoderUUID(t *testing.T) {
+	d := newDecoder(make([]byte, 16), false)
+	assert.Equal(t, "", d.uuid())
+
+	d = newDecoder([]byte{0xfb, 0xff, 0xbf, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, false)
+	assert.Equal(t, "-_-_AwQFBgcICQoLDA0ODw", d.uuid())
+}
@@ -0,0 +1,410 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+
+	"github.com/elastic/beats/v7/packetbeat/pb"
+	"github.com/elastic/beats/v7/packetbeat/procs"
+	"github.com/elastic/beats/v7/packetbeat/protos"
+	"github.com/elastic/beats/v7/packetbeat/protos/applayer"
+	"github.com/elastic/beats/v7/packetbeat/protos/tcp"
+)
+
+type stream struct {
+	applayer.Stream
+	tcptuple *common.TCPTuple
+
+	// skip is the number of bytes left of a message that is too large to
+	// be buffered.
+	skip int
+}
+
+type kafkaConnectionData struct {
+	streams [2]*stream
+}
+
+// Kafka protocol plugin
+type kafkaPlugin struct {
+	// config
+	ports              []int
+	maxMessageBytes    int
+	transactionTimeout time.Duration
+
+	// requests awaiting their response, keyed by connection and correlation ID
+	requests *common.Cache
+
+	watcher *procs.ProcessesWatcher
+	results protos.Reporter
+}
+
+type transactionKey struct {
+	tcp common.HashableTCPTuple
+	id  int32
+}
+
+var (
+	debugf  = logp.MakeDebug("kafka")
+	isDebug = false
+)
+
+var (
+	unmatchedResponses = monitoring.NewInt(nil, "kafka.unmatched_responses")
+	unmatchedRequests  = monitoring.NewInt(nil, "kafka.unmatched_requests")
+)
+
+func init() {
+	protos.Register("kafka", New)
+}
+
+func New(
+	testMode bool,
+	results protos.Reporter,
+	watcher *procs.ProcessesWatcher,
+	cfg *conf.C,
+) (protos.Plugin, error) {
+	p := &kafkaPlugin{}
+	config := defaultConfig
+	if !testMode {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.init(results, watcher, &config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (kafka *kafkaPlugin) init(results protos.Reporter, watcher *procs.ProcessesWatcher, config *kafkaConfig) error {
+	kafka.setFromConfig(config)
+
+	kafka.requests = common.NewCache(
+		kafka.transactionTimeout,
+		protos.DefaultTransactionHashSize)
+	kafka.requests.StartJanitor(kafka.transactionTimeout)
+	kafka.results = results
+	kafka.watcher = watcher
+	isDebug = logp.IsDebug("kafka")
+
+	return nil
+}
+
+func (kafka *kafkaPlugin) setFromConfig(config *kafkaConfig) {
+	kafka.ports = config.Ports
+	kafka.maxMessageBytes = config.MaxMessageBytes
+	kafka.transactionTimeout = config.TransactionTimeout
+}
+
+func (kafka *kafkaPlugin) GetPorts() []int {
+	return kafka.ports
+}
+
+func (kafka *kafkaPlugin) ConnectionTimeout() time.Duration {
+	return kafka.transactionTimeout
+}
+
+// isServerPort reports whether port is one of the configured broker ports.
+// Kafka messages don't tell requests from responses, so messages sent to a
+// broker port are requests.
+func (kafka *kafkaPlugin) isServerPort(port uint16) bool {
+	for _, p := range kafka.ports {
+		if p == int(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func (kafka *kafkaPlugin) Parse(
+	pkt *protos.Packet,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	private protos.ProtocolData,
+) protos.ProtocolData {
+	conn := ensureKafkaConnection(private)
+	conn = kafka.doParse(conn, pkt, tcptuple, dir)
+	if conn == nil {
+		return nil
+	}
+	return conn
+}
+
+func ensureKafkaConnection(private protos.ProtocolData) *kafkaConnectionData {
+	if private == nil {
+		return &kafkaConnectionData{}
+	}
+
+	priv, ok := private.(*kafkaConnectionData)
+	if !ok {
+		logp.Warn("kafka connection data type error, create new one")
+		return &kafkaConnectionData{}
+	}
+	if priv == nil {
+		logp.Warn("Unexpected: kafka connection data not set, create new one")
+		return &kafkaConnectionData{}
+	}
+
+	return priv
+}
+
+func (kafka *kafkaPlugin) doParse(
+	conn *kafkaConnectionData,
+	pkt *protos.Packet,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) *kafkaConnectionData {
+	st := conn.streams[dir]
+	if st == nil {
+		st = newStream(tcptuple)
+		conn.streams[dir] = st
+		if isDebug {
+			debugf("new stream: %p (dir=%v, len=%v)", st, dir, len(pkt.Payload))
+		}
+	}
+
+	payload := pkt.Payload
+	if st.skip > 0 {
+		n := min(st.skip, len(payload))
+		st.skip -= n
+		payload = payload[n:]
+	}
+	if err := st.Append(payload); err != nil {
+		if isDebug {
+			debugf("%v, dropping TCP stream: ", err)
+		}
+		return nil
+	}
+
+	isRequest := kafka.isServerPort(pkt.Tuple.DstPort)
+	for st.skip == 0 && st.Buf.Len() >= 4 {
+		msg, complete, err := kafka.parseMessage(st, isRequest, pkt.Ts)
+		if err != nil {
+			// drop this tcp stream. Will retry parsing with the next
+			// segment in it
+			conn.streams[dir] = nil
+			if isDebug {
+				debugf("Ignore Kafka message: %v. Drop tcp stream. Try parsing with the next segment", err)
+			}
+			return conn
+		}
+		if !complete {
+			// wait for more data
+			break
+		}
+
+		kafka.handleKafka(msg, tcptuple, dir)
+	}
+
+	return conn
+}
+
+func newStream(tcptuple *common.TCPTuple) *stream {
+	s := &stream{
+		tcptuple: tcptuple,
+	}
+	s.Stream.Init(tcp.TCPMaxDataInStream)
+	return s
+}
+
+// parseMessage parses the next message of the stream. Messages larger than
+// the max_message_bytes setting are decoded partially, and their remaining
+// bytes are skipped.
+func (kafka *kafkaPlugin) parseMessage(st *stream, isRequest bool, ts time.Time) (msg *message, complete bool, err error) {
+	buf := &st.Buf
+	size, _ := buf.ReadNetUint32At(0)
+	minSize := minResponseSize
+	if isRequest {
+		minSize = minRequestSize
+	}
+	if size < uint32(minSize) || size > maxMessageSize {
+		return nil, false, errInvalidSize
+	}
+
+	total := 4 + int(size)
+	available := min(total, kafka.maxMessageBytes)
+	if !buf.Avail(available) {
+		return nil, false, nil
+	}
+
+	data, _ := buf.Collect(available)
+	msg = &message{
+		ts:        ts,
+		isRequest: isRequest,
+		size:      total,
+		truncated: available < total,
+	}
+	if msg.truncated {
+		skipped := min(total-available, buf.Len())
+		_ = buf.Advance(skipped)
+		st.skip = total - available - skipped
+	}
+	buf.Reset()
+
+	if isRequest {
+		err = decodeRequest(msg, data[4:])
+		return msg, err == nil, err
+	}
+
+	// Responses can only be decoded knowing the request.
+	msg.correlationID = int32(common.BytesNtohl(data[4:8]))
+	msg.data = data[8:]
+	return msg, true, nil
+}
+
+func (kafka *kafkaPlugin) handleKafka(
+	m *message,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) {
+	m.tcpTuple = *tcptuple
+	m.direction = dir
+	m.cmdlineTuple = kafka.watcher.FindProcessesTupleTCP(tcptuple.IPPort())
+
+	if m.isRequest {
+		kafka.onRequest(m)
+	} else {
+		kafka.onResponse(m)
+	}
+}
+
+func (kafka *kafkaPlugin) onRequest(msg *message) {
+	if !msg.expectsResponse() {
+		kafka.publishTransaction(msg, nil)
+		return
+	}
+
+	key := transactionKey{tcp: msg.tcpTuple.Hashable(), id: msg.correlationID}
+	if old := kafka.requests.Put(key, msg); old != nil {
+		debugf("Two requests with the same correlation ID. Dropping old request")
+		unmatchedRequests.Add(1)
+	}
+}
+
+func (kafka *kafkaPlugin) onResponse(msg *message) {
+	key := transactionKey{tcp: msg.tcpTuple.Hashable(), id: msg.correlationID}
+	v := kafka.requests.Delete(key)
+	if v == nil {
+		debugf("Response from unknown transaction. Ignoring")
+		unmatchedResponses.Add(1)
+		return
+	}
+
+	requ := v.(*message)
+	decodeResponse(requ, msg, msg.data)
+	msg.data = nil
+	kafka.publishTransaction(requ, msg)
+}
+
+func (kafka *kafkaPlugin) publishTransaction(requ, resp *message) {
+	if kafka.results == nil {
+		return
+	}
+	kafka.results(kafka.newTransaction(requ, resp))
+}
+
+func (kafka *kafkaPlugin) newTransaction(requ, resp *message) beat.Event {
+	source, destination := common.MakeEndpointPair(requ.tcpTuple.BaseTuple, requ.cmdlineTuple)
+	src, dst := &source, &destination
+	if requ.direction == tcp.TCPDirectionReverse {
+		src, dst = dst, src
+	}
+
+	evt, pbf := pb.NewBeatEvent(requ.ts)
+	pbf.SetSource(src)
+	pbf.AddIP(src.IP)
+	pbf.SetDestination(dst)
+	pbf.AddIP(dst.IP)
+	pbf.Source.Bytes = int64(requ.size)
+	pbf.Event.Dataset = "kafka"
+	pbf.Event.Start = requ.ts
+	pbf.Network.Transport = "tcp"
+	pbf.Network.Protocol = pbf.Event.Dataset
+
+	method := apiName(requ.apiKey)
+	fields := evt.Fields
+	fields["type"] = pbf.Event.Dataset
+	fields["method"] = method
+	if len(requ.topics) == 1 {
+		fields["resource"] = requ.topics[0]
+	}
+	pbf.Event.Action = "kafka." + strings.ToLower(method)
+
+	kafkaFields := mapstr.M{
+		"api_key":        requ.apiKey,
+		"api_version":    requ.apiVersion,
+		"correlation_id": requ.correlationID,
+	}
+	if requ.clientID != "" {
+		kafkaFields["client_id"] = requ.clientID
+	}
+	if len(requ.topics) > 0 {
+		kafkaFields["topics"] = requ.topics
+	}
+	if len(requ.topicIDs) > 0 {
+		kafkaFields["topic_ids"] = requ.topicIDs
+	}
+	if len(requ.partitions) > 0 {
+		kafkaFields["partitions"] = requ.partitions
+	}
+	if requ.groupID != "" {
+		kafkaFields["group_id"] = requ.groupID
+	}
+	if requ.hasAcks {
+		kafkaFields["acks"] = requ.acks
+	}
+
+	fields["status"] = common.OK_STATUS
+	if resp != nil {
+		pbf.Destination.Bytes = int64(resp.size)
+		pbf.Event.End = resp.ts
+		if resp.errorCode != 0 {
+			fields["status"] = common.ERROR_STATUS
+			kafkaFields["error_code"] = resp.errorCode
+			kafkaFields["error"] = errorName(resp.errorCode)
+			pbf.Event.Outcome = "failure"
+		}
+	}
+	fields["kafka"] = kafkaFields
+
+	return evt
+}
+
+func (kafka *kafkaPlugin) GapInStream(tcptuple *common.TCPTuple, dir uint8,
+	nbytes int, private protos.ProtocolData) (priv protos.ProtocolData, drop bool,
+) {
+	// Message sizes are unknown after a gap, drop the stream and
+	// resynchronize with the next segment.
+	return private, true
+}
+
+func (kafka *kafkaPlugin) ReceivedFin(tcptuple *common.TCPTuple, dir uint8,
+	private protos.ProtocolData,
+) protos.ProtocolData {
+	return private
+}
@@ -0,0 +1,543 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package kafka
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/packetbeat/pb"
+	"github.com/elastic/beats/v7/packetbeat/procs"
+	"github.com/elastic/beats/v7/packetbeat/protos"
+	"github.com/elastic/beats/v7/packetbeat/protos/tcp"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type eventStore struct {
+	events []beat.Event
+}
+
+func (e *eventStore) publish(event beat.Event) {
+	e.events = append(e.events, event)
+}
+
+func kafkaModForTests(maxMessageBytes int) (*eventStore, *kafkaPlugin) {
+	var kafka kafkaPlugin
+	results := &eventStore{}
+	config := defaultConfig
+	config.Ports = []int{9092}
+	if maxMessageBytes > 0 {
+		config.MaxMessageBytes = maxMessageBytes
+	}
+	kafka.init(results.publish, &procs.ProcessesWatcher{}, &config)
+	return results, &kafka
+}
+
+func testTCPTuple() *common.TCPTuple {
+	t := &common.TCPTuple{
+		IPLength: 4,
+		BaseTuple: common.BaseTuple{
+			SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4(192, 168, 0, 2),
+			SrcPort: 6512, DstPort: 9092,
+		},
+	}
+	t.ComputeHashables()
+	return t
+}
+
+func expectTransaction(t *testing.T, e *eventStore) mapstr.M {
+	t.Helper()
+	if len(e.events) == 0 {
+		t.Fatal("No transaction")
+	}
+
+	event := e.events[0]
+	e.events = e.events[1:]
+	return event.Fields
+}
+
+// encoder writes Kafka primitive types, using the compact encodings of
+// flexible versions if flexible is set.
+type encoder struct {
+	buf      []byte
+	flexible bool
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) length(n int, classic func(int)) {
+	if e.flexible {
+		e.uvarint(uint64(n + 1))
+	} else {
+		classic(n)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.length(len(s), func(n int) { e.int16(int16(n)) })
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) nullString() {
+	e.length(-1, func(n int) { e.int16(int16(n)) })
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.length(len(b), func(n int) { e.int32(int32(n)) })
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) arrayLength(n int) {
+	e.length(n, func(n int) { e.int32(int32(n)) })
+}
+
+func (e *encoder) uuid(id [16]byte) {
+	e.buf = append(e.buf, id[:]...)
+}
+
+func (e *encoder) tags() {
+	if e.flexible {
+		e.uvarint(0)
+	}
+}
+
+func frame(payload []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(payload))), payload...)
+}
+
+func request(apiKey, version int16, correlationID int32, clientID string, body func(e *encoder)) []byte {
+	flexible, _ := isDecoded(apiKey, version)
+	e := &encoder{}
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(correlationID)
+	e.string(clientID)
+	e.flexible = flexible
+	e.tags()
+	body(e)
+	return frame(e.buf)
+}
+
+func response(apiKey, version int16, correlationID int32, body func(e *encoder)) []byte {
+	flexible, _ := isDecoded(apiKey, version)
+	e := &encoder{flexible: flexible}
+	e.int32(correlationID)
+	if apiKey != apiAPIVersions {
+		e.tags()
+	}
+	body(e)
+	return frame(e.buf)
+}
+
+func produceRequest(version int16, correlationID int32, acks int16, topic string, partitions []int32, records []byte) []byte {
+	return request(apiProduce, version, correlationID, "producer-1", func(e *encoder) {
+		e.nullString() // transactional_id
+		e.int16(acks)
+		e.int32(30000) // timeout_ms
+		e.arrayLength(1)
+		e.string(topic)
+		e.arrayLength(len(partitions))
+		for _, p := range partitions {
+			e.int32(p)
+			e.bytes(records)
+			e.tags()
+		}
+		e.tags()
+		e.tags()
+	})
+}
+
+func produceResponse(version int16, correlationID int32, topic string, errorCodes []int16) []byte {
+	return response(apiProduce, version, correlationID, func(e *encoder) {
+		e.arrayLength(1)
+		e.string(topic)
+		e.arrayLength(len(errorCodes))
+		for i, code := range errorCodes {
+			e.int32(int32(i))
+			e.int16(code)
+			e.int64(42) // base_offset
+			e.int64(-1) // log_append_time_ms
+			e.int64(0)  // log_start_offset
+			if version >= 8 {
+				e.arrayLength(0) // record_errors
+				e.nullString()   // error_message
+			}
+			e.tags()
+		}
+		e.tags()
+		e.int32(0) // throttle_time_ms
+		e.tags()
+	})
+}
+
+type testConn struct {
+	kafka *kafkaPlugin
+	tuple *common.TCPTuple
+	conn  protos.ProtocolData
+	ts    time.Time
+}
+
+func newTestConn(kafka *kafkaPlugin) *testConn {
+	return &testConn{kafka: kafka, tuple: testTCPTuple(), ts: time.Now()}
+}
+
+func (c *testConn) request(payload []byte) {
+	pkt := &protos.Packet{Ts: c.ts, Tuple: *c.tuple.IPPort(), Payload: payload}
+	c.conn = c.kafka.Parse(pkt, c.tuple, tcp.TCPDirectionOriginal, c.conn)
+}
+
+func (c *testConn) response(payload []byte) {
+	c.ts = c.ts.Add(time.Millisecond)
+	tuple := common.NewIPPortTuple(4,
+		c.tuple.DstIP, c.tuple.DstPort,
+		c.tuple.SrcIP, c.tuple.SrcPort)
+	pkt := &protos.Packet{Ts: c.ts, Tuple: tuple, Payload: payload}
+	c.conn = c.kafka.Parse(pkt, c.tuple, tcp.TCPDirectionReverse, c.conn)
+}
+
+func TestProduce(t *testing.T) {
+	logp.TestingSetup(logp.WithSelectors("kafka"))
+
+	for _, version := range []int16{7, 9} {
+		results, kafka := kafkaModForTests(0)
+		conn := newTestConn(kafka)
+
+		requ := produceRequest(version, 1, -1, "orders", []int32{0, 1}, []byte("records"))
+		resp := produceResponse(version, 1, "orders", []int16{0, 0})
+		conn.request(requ)
+		conn.response(resp)
+
+		fields := expectTransaction(t, results)
+		assert.Equal(t, "kafka", fields["type"])
+		assert.Equal(t, "Produce", fields["method"])
+		assert.Equal(t, "orders", fields["resource"])
+		assert.Equal(t, common.OK_STATUS, fields["status"])
+		assert.Equal(t, mapstr.M{
+			"api_key":        apiProduce,
+			"api_version":    version,
+			"correlation_id": int32(1),
+			"client_id":      "producer-1",
+			"topics":         []string{"orders"},
+			"partitions":     []int32{0, 1},
+			"acks":           int16(-1),
+		}, fields["kafka"])
+
+		pbf, err := pb.GetFields(fields)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "kafka.produce", pbf.Event.Action)
+			assert.EqualValues(t, len(requ), pbf.Source.Bytes)
+			assert.EqualValues(t, len(resp), pbf.Destination.Bytes)
+			assert.Equal(t, time.Millisecond, pbf.Event.End.Sub(pbf.Event.Start))
+		}
+	}
+}
+
+func TestProduceError(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(produceRequest(9, 7, 1, "orders", []int32{0, 1}, nil))
+	conn.response(produceResponse(9, 7, "orders", []int16{0, 3}))
+
+	fields := expectTransaction(t, results)
+	assert.Equal(t, common.ERROR_STATUS, fields["status"])
+	code, _ := fields.GetValue("kafka.error_code")
+	assert.Equal(t, int16(3), code)
+	name, _ := fields.GetValue("kafka.error")
+	assert.Equal(t, "UNKNOWN_TOPIC_OR_PARTITION", name)
+	pbf, err := pb.GetFields(fields)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "failure", pbf.Event.Outcome)
+	}
+}
+
+func TestProduceWithoutAcks(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(produceRequest(7, 1, 0, "orders", []int32{2}, []byte("records")))
+
+	fields := expectTransaction(t, results)
+	acks, _ := fields.GetValue("kafka.acks")
+	assert.Equal(t, int16(0), acks)
+	pbf, err := pb.GetFields(fields)
+	if assert.NoError(t, err) {
+		assert.Zero(t, pbf.Destination.Bytes)
+	}
+	assert.Equal(t, 0, kafka.requests.Size())
+}
+
+func TestFetchTopicIDs(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	topicID := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	conn.request(request(apiFetch, 13, 3, "consumer-1", func(e *encoder) {
+		e.int32(-1)      // replica_id
+		e.int32(500)     // max_wait_ms
+		e.int32(1)       // min_bytes
+		e.int32(1 << 20) // max_bytes
+		e.int8(0)        // isolation_level
+		e.int32(0)       // session_id
+		e.int32(-1)      // session_epoch
+		e.arrayLength(1)
+		e.uuid(topicID)
+		e.arrayLength(1)
+		e.int32(4)       // partition
+		e.int32(-1)      // current_leader_epoch
+		e.int64(100)     // fetch_offset
+		e.int32(-1)      // last_fetched_epoch
+		e.int64(-1)      // log_start_offset
+		e.int32(1 << 20) // partition_max_bytes
+		e.tags()
+		e.tags()
+		e.arrayLength(0) // forgotten_topics_data
+		e.string("")     // rack_id
+		e.tags()
+	}))
+	conn.response(response(apiFetch, 13, 3, func(e *encoder) {
+		e.int32(0) // throttle_time_ms
+		e.int16(0) // error_code
+		e.int32(0) // session_id
+		e.arrayLength(1)
+		e.uuid(topicID)
+		e.arrayLength(1)
+		e.int32(4)       // partition_index
+		e.int16(1)       // error_code
+		e.int64(100)     // high_watermark
+		e.int64(100)     // last_stable_offset
+		e.int64(0)       // log_start_offset
+		e.arrayLength(0) // aborted_transactions
+		e.int32(-1)      // preferred_read_replica
+		e.bytes(nil)     // records
+		e.tags()
+		e.tags()
+		e.tags()
+	}))
+
+	fields := expectTransaction(t, results)
+	assert.Equal(t, "Fetch", fields["method"])
+	assert.NotContains(t, fields, "resource")
+	ids, _ := fields.GetValue("kafka.topic_ids")
+	assert.Equal(t, []string{"AQIDBAUGBwgJCgsMDQ4PEA"}, ids)
+	partitions, _ := fields.GetValue("kafka.partitions")
+	assert.Equal(t, []int32{4}, partitions)
+	name, _ := fields.GetValue("kafka.error")
+	assert.Equal(t, "OFFSET_OUT_OF_RANGE", name)
+}
+
+func TestMetadata(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(request(apiMetadata, 12, 5, "admin", func(e *encoder) {
+		e.arrayLength(2)
+		for _, name := range []string{"orders", "payments"} {
+			e.uuid([16]byte{})
+			e.string(name)
+			e.tags()
+		}
+		e.int8(1) // allow_auto_topic_creation
+		e.int8(0) // include_topic_authorized_operations
+		e.tags()
+	}))
+	conn.response(response(apiMetadata, 12, 5, func(e *encoder) {
+		e.int32(0) // throttle_time_ms
+		e.arrayLength(1)
+		e.int32(1) // node_id
+		e.string("broker-1")
+		e.int32(9092)
+		e.nullString() // rack
+		e.tags()
+		e.string("cluster") // cluster_id
+		e.int32(1)          // controller_id
+		e.arrayLength(2)
+		for _, code := range []int16{0, 29} {
+			e.int16(code)
+			e.string("topic")
+			e.uuid([16]byte{})
+			e.int8(0)        // is_internal
+			e.arrayLength(0) // partitions
+			e.int32(0)       // topic_authorized_operations
+			e.tags()
+		}
+		e.tags()
+	}))
+
+	fields := expectTransaction(t, results)
+	assert.Equal(t, "Metadata", fields["method"])
+	topics, _ := fields.GetValue("kafka.topics")
+	assert.Equal(t, []string{"orders", "payments"}, topics)
+	name, _ := fields.GetValue("kafka.error")
+	assert.Equal(t, "TOPIC_AUTHORIZATION_FAILED", name)
+}
+
+func TestJoinGroup(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(request(apiJoinGroup, 5, 9, "consumer-1", func(e *encoder) {
+		e.string("billing")
+		e.int32(10000) // session_timeout_ms
+		e.int32(30000) // rebalance_timeout_ms
+		e.string("")   // member_id
+		e.nullString() // group_instance_id
+		e.string("consumer")
+		e.arrayLength(0) // protocols
+	}))
+	conn.response(response(apiJoinGroup, 5, 9, func(e *encoder) {
+		e.int32(0)  // throttle_time_ms
+		e.int16(79) // error_code
+	}))
+
+	fields := expectTransaction(t, results)
+	assert.Equal(t, "JoinGroup", fields["method"])
+	group, _ := fields.GetValue("kafka.group_id")
+	assert.Equal(t, "billing", group)
+	name, _ := fields.GetValue("kafka.error")
+	assert.Equal(t, "MEMBER_ID_REQUIRED", name)
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	var requests, responses []byte
+	for id := int32(1); id <= 3; id++ {
+		requests = append(requests, produceRequest(7, id, 1, "orders", []int32{id}, nil)...)
+	}
+	for _, id := range []int32{2, 1, 3} {
+		responses = append(responses, produceResponse(7, id, "orders", []int16{0})...)
+	}
+
+	// split messages across segments
+	conn.request(requests[:5])
+	conn.request(requests[5:30])
+	conn.request(requests[30:])
+	conn.response(responses[:len(responses)-3])
+	conn.response(responses[len(responses)-3:])
+
+	if assert.Len(t, results.events, 3) {
+		for i, id := range []int32{2, 1, 3} {
+			v, _ := results.events[i].Fields.GetValue("kafka.partitions")
+			assert.Equal(t, []int32{id}, v)
+		}
+	}
+}
+
+func TestUnmatchedResponse(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(produceRequest(7, 1, 1, "orders", []int32{0}, nil))
+	conn.response(produceResponse(7, 2, "orders", []int16{0}))
+
+	assert.Empty(t, results.events)
+	assert.Equal(t, 1, kafka.requests.Size())
+}
+
+func TestLargeMessage(t *testing.T) {
+	results, kafka := kafkaModForTests(1024)
+	conn := newTestConn(kafka)
+
+	// The records of the first message are not buffered, but the topic
+	// and the first partition are still decoded.
+	large := produceRequest(7, 1, 1, "orders", []int32{0, 1}, make([]byte, 4000))
+	next := produceRequest(7, 2, 1, "events", []int32{0}, nil)
+	data := append(large, next...)
+	conn.request(data[:1500])
+	conn.request(data[1500:3000])
+	conn.request(data[3000:])
+
+	conn.response(produceResponse(7, 1, "orders", []int16{0, 0}))
+	conn.response(produceResponse(7, 2, "events", []int16{0}))
+
+	if assert.Len(t, results.events, 2) {
+		fields := results.events[0].Fields
+		assert.Equal(t, "orders", fields["resource"])
+		pbf, err := pb.GetFields(fields)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, len(large), pbf.Source.Bytes)
+		}
+		partitions, _ := fields.GetValue("kafka.partitions")
+		assert.Equal(t, []int32{0}, partitions)
+
+		assert.Equal(t, "events", results.events[1].Fields["resource"])
+	}
+}
+
+func TestInvalidStream(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.Nil(t, conn.conn.(*kafkaConnectionData).streams[tcp.TCPDirectionOriginal])
+
+	// unknown API key
+	conn.request(request(1000, 0, 1, "client", func(e *encoder) {}))
+	assert.Nil(t, conn.conn.(*kafkaConnectionData).streams[tcp.TCPDirectionOriginal])
+
+	// parsing recovers at the next segment
+	conn.request(produceRequest(7, 1, 1, "orders", []int32{0}, nil))
+	conn.response(produceResponse(7, 1, "orders", []int16{0}))
+	assert.Len(t, results.events, 1)
+}
+
+func TestUndecodedVersion(t *testing.T) {
+	results, kafka := kafkaModForTests(0)
+	conn := newTestConn(kafka)
+
+	conn.request(request(apiProduce, 20, 1, "producer-1", func(e *encoder) {
+		e.buf = append(e.buf, "unknown"...)
+	}))
+	conn.response(response(apiProduce, 20, 1, func(e *encoder) {
+		e.buf = append(e.buf, "unknown"...)
+	}))
+
+	fields := expectTransaction(t, results)
+	assert.Equal(t, "Produce", fields["method"])
+	assert.Equal(t, common.OK_STATUS, fields["status"])
+	assert.NotContains(t, fields["kafka"], "topics")
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const (
+	// minRequestSize is the size of a request header with a null client ID.
+	minRequestSize = 10
+	// minResponseSize is the size of a response header.
+	minResponseSize = 4
+	// maxMessageSize bounds the message size to detect streams that are not
+	// Kafka. It matches the default socket.request.max.bytes of brokers.
+	maxMessageSize = 100 * 1024 * 1024
+)
+
+var (
+	errInvalidSize    = errors.New("invalid message size")
+	errInvalidAPI     = errors.New("invalid API key or version")
+	errInvalidRequest = errors.New("invalid request header")
+)
+
+type message struct {
+	ts time.Time
+
+	tcpTuple     common.TCPTuple
+	cmdlineTuple *common.ProcessTuple
+	direction    uint8
+
+	isRequest bool
+	// size is the size of the message, including the size field.
+	size int
+	// truncated is set if only a prefix of the message was decoded.
+	truncated bool
+
+	correlationID int32
+
+	// request header
+	apiKey     int16
+	apiVersion int16
+	clientID   string
+
+	// decoded request body
+	topics     []string
+	topicIDs   []string
+	partitions []int32
+	groupID    string
+	acks       int16
+	hasAcks    bool
+
+	// response body, kept until the request is found
+	data []byte
+	// first non-zero error code found in the response body
+	errorCode int16
+}
+
+// expectsResponse reports whether the broker responds to a request. Produce
+// requests with acks=0 are not acknowledged.
+func (m *message) expectsResponse() bool {
+	return !(m.apiKey == apiProduce && m.hasAcks && m.acks == 0)
+}
+
+func (m *message) addTopic(name string) {
+	if name == "" {
+		return
+	}
+	for _, t := range m.topics {
+		if t == name {
+			return
+		}
+	}
+	m.topics = append(m.topics, name)
+}
+
+func (m *message) addTopicID(id string) {
+	if id == "" {
+		return
+	}
+	for _, t := range m.topicIDs {
+		if t == id {
+			return
+		}
+	}
+	m.topicIDs = append(m.topicIDs, id)
+}
+
+func (m *message) addPartition(p int32) {
+	for _, v := range m.partitions {
+		if v == p {
+			return
+		}
+	}
+	m.partitions = append(m.partitions, p)
+}
+
+func (m *message) addError(code int16) {
+	if m.errorCode == 0 {
+		m.errorCode = code
+	}
+}
+
+// decodeRequest decodes the header and, for known API keys, the body of a
+// request. data holds the message without the size field.
+func decodeRequest(msg *message, data []byte) error {
+	d := newDecoder(data, false)
+	msg.apiKey = d.int16()
+	msg.apiVersion = d.int16()
+	msg.correlationID = d.int32()
+	msg.clientID = d.classicNullableString()
+	if d.err != nil {
+		return errInvalidRequest
+	}
+	if !isKnownAPI(msg.apiKey) || msg.apiVersion < 0 || msg.apiVersion > maxAPIVersion {
+		return errInvalidAPI
+	}
+
+	flexible, ok := isDecoded(msg.apiKey, msg.apiVersion)
+	if !ok {
+		return nil
+	}
+	d.flexible = flexible
+	d.taggedFields()
+	decodeRequestBody(msg, d)
+	if d.err != nil && !msg.truncated {
+		debugf("failed to decode %s request: %v", apiName(msg.apiKey), d.err)
+	}
+	return nil
+}
+
+// decodeResponse decodes the body of a response to the request requ. data
+// holds the message without the size field and correlation ID.
+func decodeResponse(requ, resp *message, data []byte) {
+	flexible, ok := isDecoded(requ.apiKey, requ.apiVersion)
+	if !ok {
+		return
+	}
+	d := newDecoder(data, flexible)
+	// ApiVersions responses always use the first header version, so
+	// clients can parse them before knowing the supported versions.
+	if requ.apiKey != apiAPIVersions {
+		d.taggedFields()
+	}
+	decodeResponseBody(requ.apiVersion, requ.apiKey, resp, d)
+	if d.err != nil && !resp.truncated {
+		debugf("failed to decode %s response: %v", apiName(requ.apiKey), d.err)
+	}
+}
@@ -11,12 +11,14 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 )
 
 // all test files are read from the "testdata" directory
 const testDataPath = "testdata"
 
-func TestParquetDecoding(t *testing.T) {
+func TestDecoding(t *testing.T) {
 	testCases := []struct {
 		name          string
 		file          string
@@ -30,9 +32,9 @@ func TestParquetDecoding(t *testing.T) {
 			file:      "vpc-flow.gz.parquet",
 			numEvents: 1304,
 			config: &readerConfig{
-				Decoding: decoderConfig{
-					Codec: &codecConfig{
-						Parquet: &parquetCodecConfig{
+				Decoding: decoder.Config{
+					Codec: &decoder.CodecConfig{
+						Parquet: &decoder.ParquetCodecConfig{
 							ProcessParallel: true,
 							BatchSize:       1,
 						},
@@ -45,9 +47,9 @@ func TestParquetDecoding(t *testing.T) {
 			file:      "vpc-flow.gz.parquet",
 			numEvents: 1304,
 			config: &readerConfig{
-				Decoding: decoderConfig{
-					Codec: &codecConfig{
-						Parquet: &parquetCodecConfig{
+				Decoding: decoder.Config{
+					Codec: &decoder.CodecConfig{
+						Parquet: &decoder.ParquetCodecConfig{
 							ProcessParallel: true,
 							BatchSize:       100,
 						},
@@ -60,9 +62,9 @@ func TestParquetDecoding(t *testing.T) {
 			file:      "vpc-flow.gz.parquet",
 			numEvents: 1304,
 			config: &readerConfig{
-				Decoding: decoderConfig{
-					Codec: &codecConfig{
-						Parquet: &parquetCodecConfig{
+				Decoding: decoder.Config{
+					Codec: &decoder.CodecConfig{
+						Parquet: &decoder.ParquetCodecConfig{
 							Enabled: true,
 						},
 					},
@@ -75,9 +77,9 @@ func TestParquetDecoding(t *testing.T) {
 			numEvents:     1,
 			assertAgainst: "cloudtrail.json",
 			config: &readerConfig{
-				Decoding: decoderConfig{
-					Codec: &codecConfig{
-						Parquet: &parquetCodecConfig{
+				Decoding: decoder.Config{
+					Codec: &decoder.CodecConfig{
+						Parquet: &decoder.ParquetCodecConfig{
 							Enabled:         true,
 							ProcessParallel: true,
 							BatchSize:       1,
@@ -86,6 +88,21 @@ func TestParquetDecoding(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "test decoding of a gzipped csv file and compare the events with the content",
+			file:          "events.csv.gz",
+			numEvents:     2,
+			assertAgainst: "events-csv.json",
+			config: &readerConfig{
+				Decoding: decoder.Config{
+					Codec: &decoder.CodecConfig{
+						CSV: &decoder.CSVCodecConfig{
+							Enabled: true,
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -25,6 +25,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/reader"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -158,27 +159,13 @@ func (p *s3ObjectProcessor) ProcessS3Object() error {
 	}
 
 	// try to create a decoder from the using the codec config
-	decoder, err := newDecoder(p.readerConfig.Decoding, reader)
+	dec, err := decoder.New(p.readerConfig.Decoding, reader)
 	if err != nil {
 		return err
 	}
-	if decoder != nil {
-		defer decoder.close()
-
-		var evtOffset int64
-		for decoder.next() {
-			data, err := decoder.decode()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					return nil
-				}
-				break
-			}
-			evtOffset, err = p.readJSONSlice(bytes.NewReader(data), evtOffset)
-			if err != nil {
-				break
-			}
-		}
+	if dec != nil {
+		defer dec.Close()
+		err = p.readDecoded(dec)
 	} else {
 		// This is the legacy path. It will be removed in future and clubbed together with the decoder.
 		// Process object content stream.
@@ -262,40 +249,28 @@ func (p *s3ObjectProcessor) readJSON(r io.Reader) error {
 	return nil
 }
 
-// readJSONSlice uses a json.RawMessage to process JSON slice data as individual JSON objects.
-// It accepts a reader and a starting offset, it returns an updated offset and an error if any.
-// It reads the opening token separately and then iterates over the slice, decoding each object and publishing it.
-func (p *s3ObjectProcessor) readJSONSlice(r io.Reader, evtOffset int64) (int64, error) {
-	dec := json.NewDecoder(r)
-	dec.UseNumber()
-
-	// reads starting token separately since this is always a slice.
-	_, err := dec.Token()
-	if err != nil {
-		return -1, fmt.Errorf("failed to read JSON slice token for object key: %s, with error: %w", p.s3Obj.S3.Object.Key, err)
-	}
-
-	// we track each event offset separately since we are reading a slice.
-	for dec.More() && p.ctx.Err() == nil {
-		var item json.RawMessage
-		if err := dec.Decode(&item); err != nil {
-			return -1, fmt.Errorf("failed to decode json: %w", err)
+// readDecoded publishes the records of a decoder as individual events.
+// Records are numbered from zero, and the number is used as the event offset.
+func (p *s3ObjectProcessor) readDecoded(dec decoder.Decoder) error {
+	var evtOffset int64
+	for dec.Next() && p.ctx.Err() == nil {
+		data, err := dec.Decode()
+		if err != nil {
+			return fmt.Errorf("failed to decode object key: %s, with error: %w", p.s3Obj.S3.Object.Key, err)
 		}
 
 		if p.readerConfig.ExpandEventListFromField != "" {
-			if err := p.splitEventList(p.readerConfig.ExpandEventListFromField, item, evtOffset, p.s3ObjHash); err != nil {
-				return -1, err
+			if err := p.splitEventList(p.readerConfig.ExpandEventListFromField, data, evtOffset, p.s3ObjHash); err != nil {
+				return err
 			}
-			continue
+		} else {
+			evt := p.createEvent(string(data), evtOffset)
+			p.publish(p.acker, &evt)
 		}
-
-		data, _ := item.MarshalJSON()
-		evt := p.createEvent(string(data), evtOffset)
-		p.publish(p.acker, &evt)
 		evtOffset++
 	}
 
-	return evtOffset, nil
+	return nil
 }
 
 func (p *s3ObjectProcessor) splitEventList(key string, raw json.RawMessage, offset int64, objHash string) error {
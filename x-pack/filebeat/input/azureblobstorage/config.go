@@ -8,9 +8,10 @@ import (
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 )
 
-// MaxWorkers, Poll, PollInterval, FileSelectors, TimeStampEpoch & ExpandEventListFromField can
+// MaxWorkers, Poll, PollInterval, FileSelectors, TimeStampEpoch, ExpandEventListFromField & Decoding can
 // be configured at a global level, which applies to all containers. They can also be configured at individual container levels.
 // Container level configurations will always override global level values.
 type config struct {
@@ -24,6 +25,7 @@ type config struct {
 	FileSelectors            []fileSelectorConfig `config:"file_selectors"`
 	TimeStampEpoch           *int64               `config:"timestamp_epoch"`
 	ExpandEventListFromField string               `config:"expand_event_list_from_field"`
+	Decoding                 decoder.Config       `config:"decoding"`
 }
 
 // container contains the config for each specific blob storage container in the root account
@@ -35,6 +37,7 @@ type container struct {
 	FileSelectors            []fileSelectorConfig `config:"file_selectors"`
 	TimeStampEpoch           *int64               `config:"timestamp_epoch"`
 	ExpandEventListFromField string               `config:"expand_event_list_from_field"`
+	Decoding                 decoder.Config       `config:"decoding"`
 }
 
 // fileSelectorConfig helps filter out azure blobs based on a regex pattern
@@ -70,6 +70,7 @@ func configure(cfg *conf.C) ([]cursor.Source, cursor.Input, error) {
 			PollInterval:             *container.PollInterval,
 			TimeStampEpoch:           container.TimeStampEpoch,
 			ExpandEventListFromField: container.ExpandEventListFromField,
+			Decoding:                 container.Decoding,
 			FileSelectors:            container.FileSelectors,
 		})
 	}
@@ -117,6 +118,9 @@ func tryOverrideOrDefault(cfg config, c container) container {
 	if c.ExpandEventListFromField == "" {
 		c.ExpandEventListFromField = cfg.ExpandEventListFromField
 	}
+	if c.Decoding.Codec == nil {
+		c.Decoding = cfg.Decoding
+	}
 	if len(c.FileSelectors) == 0 && len(cfg.FileSelectors) != 0 {
 		c.FileSelectors = cfg.FileSelectors
 	}
@@ -56,6 +56,7 @@ func (in *statelessInput) Run(inputCtx v2.Context, publisher stateless.Publisher
 			PollInterval:             *container.PollInterval,
 			TimeStampEpoch:           container.TimeStampEpoch,
 			ExpandEventListFromField: container.ExpandEventListFromField,
+			Decoding:                 container.Decoding,
 			FileSelectors:            container.FileSelectors,
 		}
 
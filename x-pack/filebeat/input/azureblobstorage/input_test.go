@@ -36,6 +36,8 @@ const (
 	beatsNdJSONContainer        = "beatsndjsoncontainer"
 	beatsGzJSONContainer        = "beatsgzjsoncontainer"
 	beatsJSONWithArrayContainer = "beatsjsonwitharraycontainer"
+	beatsParquetContainer       = "beatsparquetcontainer"
+	beatsCSVContainer           = "beatscsvcontainer"
 )
 
 func Test_StorageClient(t *testing.T) {
@@ -317,6 +319,111 @@ func Test_StorageClient(t *testing.T) {
 				mock.BeatsFilesContainer_multiline_json_gz[1]: true,
 			},
 		},
+		{
+			name: "ReadParquet",
+			baseConfig: map[string]interface{}{
+				"account_name":                        "beatsblobnew",
+				"auth.shared_credentials.account_key": "7pfLm1betGiRyyABEM/RFrLYlafLZHbLtGhB52LkWVeBxE7la9mIvk6YYAbQKYE/f0GdhiaOZeV8+AStsAdr/Q==",
+				"max_workers":                         1,
+				"poll":                                true,
+				"poll_interval":                       "10s",
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "^events\\.parquet$",
+					},
+				},
+				"containers": []map[string]interface{}{
+					{
+						"name":                           beatsParquetContainer,
+						"decoding.codec.parquet.enabled": true,
+					},
+				},
+			},
+			mockHandler: mock.AzureStorageFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesContainer_events_parquet[0]: true,
+				mock.BeatsFilesContainer_events_parquet[1]: true,
+			},
+		},
+		{
+			name: "ReadParquetExpandEventListFromField",
+			baseConfig: map[string]interface{}{
+				"account_name":                        "beatsblobnew",
+				"auth.shared_credentials.account_key": "7pfLm1betGiRyyABEM/RFrLYlafLZHbLtGhB52LkWVeBxE7la9mIvk6YYAbQKYE/f0GdhiaOZeV8+AStsAdr/Q==",
+				"max_workers":                         1,
+				"poll":                                true,
+				"poll_interval":                       "10s",
+				"expand_event_list_from_field":        "Events",
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "events-list",
+					},
+				},
+				"containers": []map[string]interface{}{
+					{
+						"name":                           beatsParquetContainer,
+						"decoding.codec.parquet.enabled": true,
+					},
+				},
+			},
+			mockHandler: mock.AzureStorageFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesContainer_events_list_parquet[0]: true,
+				mock.BeatsFilesContainer_events_list_parquet[1]: true,
+				mock.BeatsFilesContainer_events_list_parquet[2]: true,
+			},
+		},
+		{
+			name: "ReadGzCSV",
+			baseConfig: map[string]interface{}{
+				"account_name":                        "beatsblobnew",
+				"auth.shared_credentials.account_key": "7pfLm1betGiRyyABEM/RFrLYlafLZHbLtGhB52LkWVeBxE7la9mIvk6YYAbQKYE/f0GdhiaOZeV8+AStsAdr/Q==",
+				"max_workers":                         1,
+				"poll":                                true,
+				"poll_interval":                       "10s",
+				"decoding.codec.csv.enabled":          true,
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "^events\\.csv\\.gz$",
+					},
+				},
+				"containers": []map[string]interface{}{
+					{
+						"name": beatsCSVContainer,
+					},
+				},
+			},
+			mockHandler: mock.AzureStorageFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesContainer_events_csv[0]: true,
+				mock.BeatsFilesContainer_events_csv[1]: true,
+			},
+		},
+		{
+			name: "ReadCSVWithMalformedRecord",
+			baseConfig: map[string]interface{}{
+				"account_name":                        "beatsblobnew",
+				"auth.shared_credentials.account_key": "7pfLm1betGiRyyABEM/RFrLYlafLZHbLtGhB52LkWVeBxE7la9mIvk6YYAbQKYE/f0GdhiaOZeV8+AStsAdr/Q==",
+				"max_workers":                         1,
+				"poll":                                true,
+				"poll_interval":                       "10s",
+				"decoding.codec.csv.enabled":          true,
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "events-broken",
+					},
+				},
+				"containers": []map[string]interface{}{
+					{
+						"name": beatsCSVContainer,
+					},
+				},
+			},
+			mockHandler: mock.AzureStorageFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesContainer_events_broken_csv[0]: true,
+			},
+		},
 		{
 			name: "ReadJSONWithRootAsArray",
 			baseConfig: map[string]interface{}{
@@ -24,6 +24,7 @@ import (
 
 	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 )
@@ -80,7 +81,8 @@ func azureObjectHash(src *Source, blob *azcontainer.BlobItem) string {
 
 func (j *job) do(ctx context.Context, id string) {
 	var fields mapstr.M
-	if allowedContentTypes[*j.blob.Properties.ContentType] {
+	// blobs are decoded by the configured codec regardless of their content type
+	if j.src.Decoding.Codec != nil || allowedContentTypes[*j.blob.Properties.ContentType] {
 		if *j.blob.Properties.ContentType == gzType || (j.blob.Properties.ContentEncoding != nil && *j.blob.Properties.ContentEncoding == encodingGzip) {
 			j.isCompressed = true
 		}
@@ -134,7 +136,11 @@ func (j *job) processAndPublishData(ctx context.Context, id string) error {
 		}
 	}()
 
-	err = j.readJsonAndPublish(ctx, reader, id)
+	if j.src.Decoding.Codec != nil {
+		err = j.decodeAndPublish(ctx, reader, id)
+	} else {
+		err = j.readJsonAndPublish(ctx, reader, id)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read data from blob with error: %w", err)
 	}
@@ -201,6 +207,66 @@ func (j *job) readJsonAndPublish(ctx context.Context, r io.Reader, id string) er
 	return nil
 }
 
+// decodeAndPublish decodes the blob with the configured codec and publishes an event per record.
+// Records are numbered from zero, and the number is used as the event offset.
+func (j *job) decodeAndPublish(ctx context.Context, r io.Reader, id string) error {
+	dec, err := decoder.New(j.src.Decoding, r)
+	if err != nil {
+		return fmt.Errorf("failed to create decoder for blob: %s, with error: %w", *j.blob.Name, err)
+	}
+	defer func() {
+		if err := dec.Close(); err != nil {
+			j.log.Errorf(jobErrString, id, err)
+		}
+	}()
+
+	// events are published one record behind, so that the last event
+	// of the blob can carry the complete state save
+	var (
+		evt     beat.Event
+		pending bool
+		offset  int64
+	)
+	for dec.Next() && ctx.Err() == nil {
+		if pending {
+			// there is another record, so the pending event is not the last one, and it is
+			// published before decoding the record, so that it isn't lost if decoding fails.
+			// since we don't update the cursor checkpoint, lack of a lock here should be fine
+			if err := j.publisher.Publish(evt, nil); err != nil {
+				j.log.Errorf(jobErrString, id, err)
+			}
+			pending = false
+		}
+
+		data, err := dec.Decode()
+		if err != nil {
+			return fmt.Errorf("failed to decode blob: %s, with error: %w", *j.blob.Name, err)
+		}
+
+		// if expand_event_list_from_field is set, then split the event list
+		if j.src.ExpandEventListFromField != "" {
+			if err := j.splitEventList(j.src.ExpandEventListFromField, data, offset, j.hash, id); err != nil {
+				return err
+			}
+			offset++
+			continue
+		}
+
+		evt = j.createEvent(string(data), offset)
+		pending = true
+		offset++
+	}
+	if pending && ctx.Err() == nil {
+		// this is the last object, so perform a complete state save
+		cp, done := j.state.saveForTx(*j.blob.Name, *j.blob.Properties.LastModified)
+		if err := j.publisher.Publish(evt, cp); err != nil {
+			j.log.Errorf(jobErrString, id, err)
+		}
+		done()
+	}
+	return nil
+}
+
 // splitEventList splits the event list into individual events and publishes them
 func (j *job) splitEventList(key string, raw json.RawMessage, offset int64, objHash string, id string) error {
 	var jsonObject map[string]json.RawMessage
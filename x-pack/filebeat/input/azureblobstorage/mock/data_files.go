@@ -10,6 +10,8 @@ const (
 	beatsNdJSONContainer        = "beatsndjsoncontainer"
 	beatsGzJSONContainer        = "beatsgzjsoncontainer"
 	beatsJSONWithArrayContainer = "beatsjsonwitharraycontainer"
+	beatsParquetContainer       = "beatsparquetcontainer"
+	beatsCSVContainer           = "beatscsvcontainer"
 )
 
 var fileContainers = map[string]bool{
@@ -18,6 +20,8 @@ var fileContainers = map[string]bool{
 	beatsNdJSONContainer:        true,
 	beatsGzJSONContainer:        true,
 	beatsJSONWithArrayContainer: true,
+	beatsParquetContainer:       true,
+	beatsCSVContainer:           true,
 }
 
 var availableFileBlobs = map[string]map[string]bool{
@@ -38,6 +42,14 @@ var availableFileBlobs = map[string]map[string]bool{
 		"array-at-root.json": true,
 		"nested-arrays.json": true,
 	},
+	beatsParquetContainer: {
+		"events.parquet":      true,
+		"events-list.parquet": true,
+	},
+	beatsCSVContainer: {
+		"events.csv.gz":     true,
+		"events-broken.csv": true,
+	},
 }
 
 var fetchFilesContainer = map[string]string{
@@ -197,6 +209,90 @@ var fetchFilesContainer = map[string]string{
 						</Blobs>
 						<NextMarker />
 					</EnumerationResults>`,
+	beatsParquetContainer: `<?xml version="1.0" encoding="utf-8"?>
+				<EnumerationResults ServiceEndpoint="https://127.0.0.1/" ContainerName="beatsparquetcontainer">
+					<Blobs>
+						<Blob>
+							<Name>events.parquet</Name>
+							<Properties>
+								<Last-Modified>Wed, 14 Sep 2022 12:12:28 GMT</Last-Modified>
+								<Etag>0x8DA964A64516C82</Etag>
+								<Content-Length>644</Content-Length>
+								<Content-Type>application/vnd.apache.parquet</Content-Type>
+								<Content-Encoding />
+								<Content-Language />
+								<Content-MD5>UjQX73kQRTHx+UyXZDvVkg==</Content-MD5>
+								<Cache-Control />
+								<Content-Disposition />
+								<BlobType>BlockBlob</BlobType>
+								<LeaseStatus>unlocked</LeaseStatus>
+								<LeaseState>available</LeaseState>
+							</Properties>
+							<Metadata />
+						</Blob>
+						<Blob>
+							<Name>events-list.parquet</Name>
+							<Properties>
+								<Last-Modified>Wed, 14 Sep 2022 12:12:28 GMT</Last-Modified>
+								<Etag>0x8DA964A64516C82</Etag>
+								<Content-Length>728</Content-Length>
+								<Content-Type>application/vnd.apache.parquet</Content-Type>
+								<Content-Encoding />
+								<Content-Language />
+								<Content-MD5>UjQX73kQRTHx+UyXZDvVkg==</Content-MD5>
+								<Cache-Control />
+								<Content-Disposition />
+								<BlobType>BlockBlob</BlobType>
+								<LeaseStatus>unlocked</LeaseStatus>
+								<LeaseState>available</LeaseState>
+							</Properties>
+							<Metadata />
+						</Blob>
+						</Blobs>
+						<NextMarker />
+					</EnumerationResults>`,
+	beatsCSVContainer: `<?xml version="1.0" encoding="utf-8"?>
+				<EnumerationResults ServiceEndpoint="https://127.0.0.1/" ContainerName="beatscsvcontainer">
+					<Blobs>
+						<Blob>
+							<Name>events.csv.gz</Name>
+							<Properties>
+								<Last-Modified>Wed, 14 Sep 2022 12:12:28 GMT</Last-Modified>
+								<Etag>0x8DA964A64516C82</Etag>
+								<Content-Length>81</Content-Length>
+								<Content-Type>text/csv</Content-Type>
+								<Content-Encoding />
+								<Content-Language />
+								<Content-MD5>UjQX73kQRTHx+UyXZDvVkg==</Content-MD5>
+								<Cache-Control />
+								<Content-Disposition />
+								<BlobType>BlockBlob</BlobType>
+								<LeaseStatus>unlocked</LeaseStatus>
+								<LeaseState>available</LeaseState>
+							</Properties>
+							<Metadata />
+						</Blob>
+						<Blob>
+							<Name>events-broken.csv</Name>
+							<Properties>
+								<Last-Modified>Wed, 14 Sep 2022 12:12:28 GMT</Last-Modified>
+								<Etag>0x8DA964A64516C82</Etag>
+								<Content-Length>36</Content-Length>
+								<Content-Type>text/csv</Content-Type>
+								<Content-Encoding />
+								<Content-Language />
+								<Content-MD5>UjQX73kQRTHx+UyXZDvVkg==</Content-MD5>
+								<Cache-Control />
+								<Content-Disposition />
+								<BlobType>BlockBlob</BlobType>
+								<LeaseStatus>unlocked</LeaseStatus>
+								<LeaseState>available</LeaseState>
+							</Properties>
+							<Metadata />
+						</Blob>
+						</Blobs>
+						<NextMarker />
+					</EnumerationResults>`,
 }
 
 var BeatsFilesContainer_multiline_json = []string{
@@ -231,3 +327,23 @@ var BeatsFilesContainer_multiline_json_gz = []string{
 	"{\n    \"@timestamp\": \"2021-05-25T17:25:42.806Z\",\n    \"log.level\": \"error\",\n    \"message\": \"error making http request\"\n}",
 	"{\n    \"@timestamp\": \"2021-05-25T17:25:51.391Z\",\n    \"log.level\": \"info\",\n    \"message\": \"available disk space 44.3gb\"\n}",
 }
+
+var BeatsFilesContainer_events_parquet = []string{
+	`{"action":"login","id":1,"user":"alice"}`,
+	`{"action":"logout, forced","id":2,"user":"bob"}`,
+}
+
+var BeatsFilesContainer_events_csv = []string{
+	`{"id":"1","user":"alice","action":"login"}`,
+	`{"id":"2","user":"bob","action":"logout, forced"}`,
+}
+
+var BeatsFilesContainer_events_list_parquet = []string{
+	`{"action":"login","user":"alice"}`,
+	`{"action":"logout","user":"alice"}`,
+	`{"action":"login","user":"bob"}`,
+}
+
+var BeatsFilesContainer_events_broken_csv = []string{
+	`{"id":"3","user":"carol","action":"login"}`,
+}
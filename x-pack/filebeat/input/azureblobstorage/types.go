@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 )
 
 // Source, it is the cursor source
@@ -21,6 +23,7 @@ type Source struct {
 	TimeStampEpoch           *int64
 	FileSelectors            []fileSelectorConfig
 	ExpandEventListFromField string
+	Decoding                 decoder.Config
 }
 
 func (s *Source) Name() string {
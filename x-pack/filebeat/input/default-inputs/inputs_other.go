@@ -24,6 +24,7 @@ import (
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/lumberjack"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/o365audit"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/otlp"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/salesforce"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/websocket"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -46,6 +47,7 @@ func xpackInputs(info beat.Info, log *logp.Logger, store beater.StateStore) []v2
 		salesforce.Plugin(log, store),
 		websocket.Plugin(log, store),
 		netflow.Plugin(log),
+		otlp.Plugin(),
 		benchmark.Plugin(),
 	}
 }
@@ -16,9 +16,10 @@ import (
 	"golang.org/x/oauth2/google"
 
 	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 )
 
-// MaxWorkers, Poll, PollInterval, BucketTimeOut, ParseJSON, FileSelectors, TimeStampEpoch & ExpandEventListFromField
+// MaxWorkers, Poll, PollInterval, BucketTimeOut, ParseJSON, FileSelectors, TimeStampEpoch, ExpandEventListFromField & Decoding
 // can be configured at a global level, which applies to all buckets, as well as at the bucket level.
 // Bucket level configurations will always override global level values.
 type config struct {
@@ -45,6 +46,8 @@ type config struct {
 	TimeStampEpoch *int64 `config:"timestamp_epoch"`
 	// ExpandEventListFromField - Defines the field name that will be used to expand the event into separate events.
 	ExpandEventListFromField string `config:"expand_event_list_from_field"`
+	// Decoding - Defines the codec used to decode objects into events, instead of reading them as JSON.
+	Decoding decoder.Config `config:"decoding"`
 	// This field is only used for system test purposes, to override the HTTP endpoint.
 	AlternativeHost string `config:"alternative_host,omitempty"`
 }
@@ -60,6 +63,7 @@ type bucket struct {
 	FileSelectors            []fileSelectorConfig `config:"file_selectors"`
 	TimeStampEpoch           *int64               `config:"timestamp_epoch"`
 	ExpandEventListFromField string               `config:"expand_event_list_from_field"`
+	Decoding                 decoder.Config       `config:"decoding"`
 }
 
 // fileSelectorConfig helps filter out gcs objects based on a regex pattern
@@ -70,6 +70,7 @@ func configure(cfg *conf.C) ([]cursor.Source, cursor.Input, error) {
 			ParseJSON:                *bucket.ParseJSON,
 			TimeStampEpoch:           bucket.TimeStampEpoch,
 			ExpandEventListFromField: bucket.ExpandEventListFromField,
+			Decoding:                 bucket.Decoding,
 			FileSelectors:            bucket.FileSelectors,
 		})
 	}
@@ -122,6 +123,9 @@ func tryOverrideOrDefault(cfg config, b bucket) bucket {
 	if b.ExpandEventListFromField == "" {
 		b.ExpandEventListFromField = cfg.ExpandEventListFromField
 	}
+	if b.Decoding.Codec == nil {
+		b.Decoding = cfg.Decoding
+	}
 	if len(b.FileSelectors) == 0 && len(cfg.FileSelectors) != 0 {
 		b.FileSelectors = cfg.FileSelectors
 	}
@@ -61,6 +61,7 @@ func (in *statelessInput) Run(inputCtx v2.Context, publisher stateless.Publisher
 			ParseJSON:                *bucket.ParseJSON,
 			TimeStampEpoch:           bucket.TimeStampEpoch,
 			ExpandEventListFromField: bucket.ExpandEventListFromField,
+			Decoding:                 bucket.Decoding,
 			FileSelectors:            bucket.FileSelectors,
 		}
 
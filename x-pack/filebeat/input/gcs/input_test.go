@@ -34,6 +34,8 @@ const (
 	beatsNdJSONBucket        = "beatsndjsonbucket"
 	beatsGzJSONBucket        = "beatsgzjsonbucket"
 	beatsJSONWithArrayBucket = "beatsjsonwitharraybucket"
+	beatsParquetBucket       = "beatsparquetbucket"
+	beatsCSVBucket           = "beatscsvbucket"
 )
 
 func Test_StorageClient(t *testing.T) {
@@ -338,6 +340,111 @@ func Test_StorageClient(t *testing.T) {
 				mock.BeatsFilesBucket_multiline_json_gz[1]: true,
 			},
 		},
+		{
+			name: "ReadParquet",
+			baseConfig: map[string]interface{}{
+				"project_id":                 "elastic-sa",
+				"auth.credentials_file.path": "testdata/gcs_creds.json",
+				"max_workers":                1,
+				"poll":                       true,
+				"poll_interval":              "5s",
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "^events\\.parquet$",
+					},
+				},
+				"buckets": []map[string]interface{}{
+					{
+						"name":                           beatsParquetBucket,
+						"decoding.codec.parquet.enabled": true,
+					},
+				},
+			},
+			mockHandler: mock.GCSFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesBucket_events_parquet[0]: true,
+				mock.BeatsFilesBucket_events_parquet[1]: true,
+			},
+		},
+		{
+			name: "ReadParquetExpandEventListFromField",
+			baseConfig: map[string]interface{}{
+				"project_id":                   "elastic-sa",
+				"auth.credentials_file.path":   "testdata/gcs_creds.json",
+				"max_workers":                  1,
+				"poll":                         true,
+				"poll_interval":                "5s",
+				"expand_event_list_from_field": "Events",
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "events-list",
+					},
+				},
+				"buckets": []map[string]interface{}{
+					{
+						"name":                           beatsParquetBucket,
+						"decoding.codec.parquet.enabled": true,
+					},
+				},
+			},
+			mockHandler: mock.GCSFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesBucket_events_list_parquet[0]: true,
+				mock.BeatsFilesBucket_events_list_parquet[1]: true,
+				mock.BeatsFilesBucket_events_list_parquet[2]: true,
+			},
+		},
+		{
+			name: "ReadGzCSV",
+			baseConfig: map[string]interface{}{
+				"project_id":                 "elastic-sa",
+				"auth.credentials_file.path": "testdata/gcs_creds.json",
+				"max_workers":                1,
+				"poll":                       true,
+				"poll_interval":              "5s",
+				"decoding.codec.csv.enabled": true,
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "^events\\.csv\\.gz$",
+					},
+				},
+				"buckets": []map[string]interface{}{
+					{
+						"name": beatsCSVBucket,
+					},
+				},
+			},
+			mockHandler: mock.GCSFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesBucket_events_csv[0]: true,
+				mock.BeatsFilesBucket_events_csv[1]: true,
+			},
+		},
+		{
+			name: "ReadCSVWithMalformedRecord",
+			baseConfig: map[string]interface{}{
+				"project_id":                 "elastic-sa",
+				"auth.credentials_file.path": "testdata/gcs_creds.json",
+				"max_workers":                1,
+				"poll":                       true,
+				"poll_interval":              "5s",
+				"decoding.codec.csv.enabled": true,
+				"file_selectors": []map[string]interface{}{
+					{
+						"regex": "events-broken",
+					},
+				},
+				"buckets": []map[string]interface{}{
+					{
+						"name": beatsCSVBucket,
+					},
+				},
+			},
+			mockHandler: mock.GCSFileServer,
+			expected: map[string]bool{
+				mock.BeatsFilesBucket_events_broken_csv[0]: true,
+			},
+		},
 		{
 			name: "ReadJSONWithRootAsArray",
 			baseConfig: map[string]interface{}{
@@ -22,6 +22,7 @@ import (
 
 	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 )
@@ -79,7 +80,8 @@ func gcsObjectHash(src *Source, object *storage.ObjectAttrs) string {
 func (j *job) do(ctx context.Context, id string) {
 	var fields mapstr.M
 
-	if allowedContentTypes[j.object.ContentType] {
+	// objects are decoded by the configured codec regardless of their content type
+	if j.src.Decoding.Codec != nil || allowedContentTypes[j.object.ContentType] {
 		if j.object.ContentType == gzType || j.object.ContentEncoding == encodingGzip {
 			j.isCompressed = true
 		}
@@ -137,7 +139,11 @@ func (j *job) processAndPublishData(ctx context.Context, id string) error {
 		}
 	}()
 
-	err = j.readJsonAndPublish(ctx, reader, id)
+	if j.src.Decoding.Codec != nil {
+		err = j.decodeAndPublish(ctx, reader, id)
+	} else {
+		err = j.readJsonAndPublish(ctx, reader, id)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read data from object: %s, with error: %w", j.object.Name, err)
 	}
@@ -207,6 +213,74 @@ func (j *job) readJsonAndPublish(ctx context.Context, r io.Reader, id string) er
 	return nil
 }
 
+// decodeAndPublish decodes the object with the configured codec and publishes an event per record.
+// Records are numbered from zero, and the number is used as the event offset.
+func (j *job) decodeAndPublish(ctx context.Context, r io.Reader, id string) error {
+	dec, err := decoder.New(j.src.Decoding, r)
+	if err != nil {
+		return fmt.Errorf("failed to create decoder for object: %s, with error: %w", j.object.Name, err)
+	}
+	defer func() {
+		if err := dec.Close(); err != nil {
+			j.log.Errorw("failed to close decoder for object", "objectName", j.object.Name, "error", err)
+		}
+	}()
+
+	// events are published one record behind, so that the last event
+	// of the object can carry the complete state save
+	var (
+		evt     beat.Event
+		pending bool
+		offset  int64
+	)
+	for dec.Next() && ctx.Err() == nil {
+		if pending {
+			// there is another record, so the pending event is not the last one, and it is
+			// published before decoding the record, so that it isn't lost if decoding fails.
+			// since we don't update the cursor checkpoint, lack of a lock here is not a problem
+			if err := j.publisher.Publish(evt, nil); err != nil {
+				j.log.Errorw("job encountered an error while publishing event", "gcs.jobId", id, "error", err)
+			}
+			pending = false
+		}
+
+		data, err := dec.Decode()
+		if err != nil {
+			return fmt.Errorf("failed to decode object: %s, with error: %w", j.object.Name, err)
+		}
+
+		// if expand_event_list_from_field is set, then split the event list
+		if j.src.ExpandEventListFromField != "" {
+			if err := j.splitEventList(j.src.ExpandEventListFromField, data, offset, j.hash, id); err != nil {
+				return err
+			}
+			offset++
+			continue
+		}
+
+		var parsedData []mapstr.M
+		if j.src.ParseJSON {
+			parsedData, err = decodeJSON(bytes.NewReader(data))
+			if err != nil {
+				j.log.Errorw("job encountered an error", "gcs.jobId", id, "error", err)
+			}
+		}
+
+		evt = j.createEvent(data, parsedData, offset)
+		pending = true
+		offset++
+	}
+	if pending && ctx.Err() == nil {
+		// this is the last object, so perform a complete state save
+		cp, done := j.state.saveForTx(j.object.Name, j.object.Updated)
+		if err := j.publisher.Publish(evt, cp); err != nil {
+			j.log.Errorw("job encountered an error while publishing event", "gcs.jobId", id, "error", err)
+		}
+		done()
+	}
+	return nil
+}
+
 // splitEventList splits the event list into individual events and publishes them
 func (j *job) splitEventList(key string, raw json.RawMessage, offset int64, objHash string, id string) error {
 	var jsonObject map[string]json.RawMessage
@@ -10,6 +10,8 @@ const (
 	beatsNdJSONBucket        = "beatsndjsonbucket"
 	beatsGzJSONBucket        = "beatsgzjsonbucket"
 	beatsJSONWithArrayBucket = "beatsjsonwitharraybucket"
+	beatsParquetBucket       = "beatsparquetbucket"
+	beatsCSVBucket           = "beatscsvbucket"
 )
 
 var fileBuckets = map[string]bool{
@@ -18,6 +20,8 @@ var fileBuckets = map[string]bool{
 	beatsNdJSONBucket:        true,
 	beatsGzJSONBucket:        true,
 	beatsJSONWithArrayBucket: true,
+	beatsParquetBucket:       true,
+	beatsCSVBucket:           true,
 }
 
 var availableFileObjects = map[string]map[string]bool{
@@ -39,6 +43,14 @@ var availableFileObjects = map[string]map[string]bool{
 	beatsGzJSONBucket: {
 		"multiline.json.gz": true,
 	},
+	beatsParquetBucket: {
+		"events.parquet":      true,
+		"events-list.parquet": true,
+	},
+	beatsCSVBucket: {
+		"events.csv.gz":     true,
+		"events-broken.csv": true,
+	},
 }
 
 var fetchFileBuckets = map[string]string{
@@ -167,6 +179,56 @@ var fetchFileBuckets = map[string]string{
 		},
 		"locationType": "region"
 	  }`,
+	beatsParquetBucket: `{
+		"kind": "storage#bucket",
+		"selfLink": "https://www.googleapis.com/storage/v1/b/beatsparquetbucket",
+		"id": "beatsparquetbucket",
+		"name": "beatsparquetbucket",
+		"projectNumber": "1059491012611",
+		"metageneration": "1",
+		"location": "ASIA-SOUTH1",
+		"storageClass": "STANDARD",
+		"etag": "CAD=",
+		"timeCreated": "2022-08-24T12:20:04.723Z",
+		"updated": "2022-08-24T12:20:04.723Z",
+		"iamConfiguration": {
+		  "bucketPolicyOnly": {
+			"enabled": true,
+			"lockedTime": "2022-11-22T12:20:04.723Z"
+		  },
+		  "uniformBucketLevelAccess": {
+			"enabled": true,
+			"lockedTime": "2022-11-22T12:20:04.723Z"
+		  },
+		  "publicAccessPrevention": "enforced"
+		},
+		"locationType": "region"
+	  }`,
+	beatsCSVBucket: `{
+		"kind": "storage#bucket",
+		"selfLink": "https://www.googleapis.com/storage/v1/b/beatscsvbucket",
+		"id": "beatscsvbucket",
+		"name": "beatscsvbucket",
+		"projectNumber": "1059491012611",
+		"metageneration": "1",
+		"location": "ASIA-SOUTH1",
+		"storageClass": "STANDARD",
+		"etag": "CAD=",
+		"timeCreated": "2022-08-24T12:20:04.723Z",
+		"updated": "2022-08-24T12:20:04.723Z",
+		"iamConfiguration": {
+		  "bucketPolicyOnly": {
+			"enabled": true,
+			"lockedTime": "2022-11-22T12:20:04.723Z"
+		  },
+		  "uniformBucketLevelAccess": {
+			"enabled": true,
+			"lockedTime": "2022-11-22T12:20:04.723Z"
+		  },
+		  "publicAccessPrevention": "enforced"
+		},
+		"locationType": "region"
+	  }`,
 }
 
 var objectFileList = map[string]string{
@@ -328,6 +390,92 @@ var objectFileList = map[string]string{
 			}
 		]
 	  }`,
+	beatsParquetBucket: `{
+		"kind": "storage#objects",
+		"items": [
+			{
+				"kind": "storage#object",
+				"id": "beatsparquetbucket/events.parquet/1661343636712270",
+				"selfLink": "https://www.googleapis.com/storage/v1/b/beatsparquetbucket/o/events.parquet",
+				"mediaLink": "https://content-storage.googleapis.com/download/storage/v1/b/beatsparquetbucket/o/events.parquet?generation=1661343636712270&alt=media",
+				"name": "events.parquet",
+				"bucket": "beatsparquetbucket",
+				"generation": "1661343636712270",
+				"metageneration": "1",
+				"contentType": "application/vnd.apache.parquet",
+				"storageClass": "STANDARD",
+				"size": "644",
+				"md5Hash": "eOXjYygu6k6687Uf3vPtKQ==",
+				"crc32c": "hHW/Qw==",
+				"etag": "CM7Ww6q73/kCEAE=",
+				"timeCreated": "2022-08-24T12:20:36.713Z",
+				"updated": "2022-08-24T12:20:36.713Z",
+				"timeStorageClassUpdated": "2022-08-24T12:20:36.713Z"
+			},
+			{
+				"kind": "storage#object",
+				"id": "beatsparquetbucket/events-list.parquet/1661343636712271",
+				"selfLink": "https://www.googleapis.com/storage/v1/b/beatsparquetbucket/o/events-list.parquet",
+				"mediaLink": "https://content-storage.googleapis.com/download/storage/v1/b/beatsparquetbucket/o/events-list.parquet?generation=1661343636712271&alt=media",
+				"name": "events-list.parquet",
+				"bucket": "beatsparquetbucket",
+				"generation": "1661343636712271",
+				"metageneration": "1",
+				"contentType": "application/vnd.apache.parquet",
+				"storageClass": "STANDARD",
+				"size": "728",
+				"md5Hash": "eOXjYygu6k6687Uf3vPtKQ==",
+				"crc32c": "hHW/Qw==",
+				"etag": "CM7Ww6q73/kCEAE=",
+				"timeCreated": "2022-08-24T12:20:36.713Z",
+				"updated": "2022-08-24T12:20:36.713Z",
+				"timeStorageClassUpdated": "2022-08-24T12:20:36.713Z"
+			}
+		]
+	  }`,
+	beatsCSVBucket: `{
+		"kind": "storage#objects",
+		"items": [
+			{
+				"kind": "storage#object",
+				"id": "beatscsvbucket/events.csv.gz/1661343636712270",
+				"selfLink": "https://www.googleapis.com/storage/v1/b/beatscsvbucket/o/events.csv.gz",
+				"mediaLink": "https://content-storage.googleapis.com/download/storage/v1/b/beatscsvbucket/o/events.csv.gz?generation=1661343636712270&alt=media",
+				"name": "events.csv.gz",
+				"bucket": "beatscsvbucket",
+				"generation": "1661343636712270",
+				"metageneration": "1",
+				"contentType": "text/csv",
+				"storageClass": "STANDARD",
+				"size": "81",
+				"md5Hash": "eOXjYygu6k6687Uf3vPtKQ==",
+				"crc32c": "hHW/Qw==",
+				"etag": "CM7Ww6q73/kCEAE=",
+				"timeCreated": "2022-08-24T12:20:36.713Z",
+				"updated": "2022-08-24T12:20:36.713Z",
+				"timeStorageClassUpdated": "2022-08-24T12:20:36.713Z"
+			},
+			{
+				"kind": "storage#object",
+				"id": "beatscsvbucket/events-broken.csv/1661343636712271",
+				"selfLink": "https://www.googleapis.com/storage/v1/b/beatscsvbucket/o/events-broken.csv",
+				"mediaLink": "https://content-storage.googleapis.com/download/storage/v1/b/beatscsvbucket/o/events-broken.csv?generation=1661343636712271&alt=media",
+				"name": "events-broken.csv",
+				"bucket": "beatscsvbucket",
+				"generation": "1661343636712271",
+				"metageneration": "1",
+				"contentType": "text/csv",
+				"storageClass": "STANDARD",
+				"size": "36",
+				"md5Hash": "eOXjYygu6k6687Uf3vPtKQ==",
+				"crc32c": "hHW/Qw==",
+				"etag": "CM7Ww6q73/kCEAE=",
+				"timeCreated": "2022-08-24T12:20:36.713Z",
+				"updated": "2022-08-24T12:20:36.713Z",
+				"timeStorageClassUpdated": "2022-08-24T12:20:36.713Z"
+			}
+		]
+	  }`,
 }
 
 // These variables are intentionally indented like this to match the output of certain tests
@@ -362,3 +510,23 @@ var BeatsFilesBucket_events_array_json = []string{
 	"{\n            \"time\": \"2021-05-25 18:20:58 UTC\",\n            \"msg\": \"hello\"\n        }",
 	"{\n            \"time\": \"2021-05-26 22:21:40 UTC\",\n            \"msg\": \"world\"\n        }",
 }
+
+var BeatsFilesBucket_events_parquet = []string{
+	`{"action":"login","id":1,"user":"alice"}`,
+	`{"action":"logout, forced","id":2,"user":"bob"}`,
+}
+
+var BeatsFilesBucket_events_csv = []string{
+	`{"id":"1","user":"alice","action":"login"}`,
+	`{"id":"2","user":"bob","action":"logout, forced"}`,
+}
+
+var BeatsFilesBucket_events_list_parquet = []string{
+	`{"action":"login","user":"alice"}`,
+	`{"action":"logout","user":"alice"}`,
+	`{"action":"login","user":"bob"}`,
+}
+
+var BeatsFilesBucket_events_broken_csv = []string{
+	`{"id":"3","user":"carol","action":"login"}`,
+}
@@ -7,6 +7,8 @@ package gcs
 
 import (
 	"time"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/decoder"
 )
 
 // Source, it is the cursor source
@@ -21,6 +23,7 @@ type Source struct {
 	TimeStampEpoch           *int64
 	FileSelectors            []fileSelectorConfig
 	ExpandEventListFromField string
+	Decoding                 decoder.Config
 }
 
 func (s *Source) Name() string {
@@ -32,6 +32,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/ack"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/httplog"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -91,7 +92,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		timeout = time.NewTimer(wait)
 	}
 	start := time.Now()
-	acker := newBatchACKTracker(func() {
+	acker := ack.NewBatchACKTracker(func() {
 		h.metrics.batchACKTime.Update(time.Since(start).Nanoseconds())
 		h.metrics.batchesACKedTotal.Inc()
 		if acked != nil {
@@ -308,7 +309,7 @@ func (h *handler) sendResponse(w http.ResponseWriter, status int, message string
 	}
 }
 
-func (h *handler) publishEvent(obj, headers mapstr.M, acker *batchACKTracker) error {
+func (h *handler) publishEvent(obj, headers mapstr.M, acker *ack.BatchACKTracker) error {
 	event := beat.Event{
 		Timestamp: time.Now().UTC(),
 		Private:   acker,
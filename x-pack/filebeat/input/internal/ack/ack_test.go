@@ -2,7 +2,7 @@
 // or more contributor license agreements. Licensed under the Elastic License;
 // you may not use this file except in compliance with the Elastic License.
 
-package http_endpoint
+package ack
 
 import (
 	"testing"
@@ -12,9 +12,9 @@ import (
 
 func TestBatchACKTracker(t *testing.T) {
 	t.Run("empty", func(t *testing.T) {
-		tracker := make(ack)
+		tracker := make(ackChan)
 
-		acker := newBatchACKTracker(tracker.ACK)
+		acker := NewBatchACKTracker(tracker.ACK)
 		require.False(t, tracker.wasACKed())
 
 		acker.Ready()
@@ -22,9 +22,9 @@ func TestBatchACKTracker(t *testing.T) {
 	})
 
 	t.Run("single_event", func(t *testing.T) {
-		tracker := make(ack)
+		tracker := make(ackChan)
 
-		acker := newBatchACKTracker(tracker.ACK)
+		acker := NewBatchACKTracker(tracker.ACK)
 		acker.Add()
 		acker.ACK()
 		require.False(t, tracker.wasACKed())
@@ -34,13 +34,13 @@ func TestBatchACKTracker(t *testing.T) {
 	})
 }
 
-type ack chan struct{}
+type ackChan chan struct{}
 
-func (a ack) ACK() {
+func (a ackChan) ACK() {
 	close(a)
 }
 
-func (a ack) wasACKed() bool {
+func (a ackChan) wasACKed() bool {
 	select {
 	case <-a:
 		return true
@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Config contains the configuration options for instantiating a decoder.
+type Config struct {
+	Codec *CodecConfig `config:"codec"`
+}
+
+// CodecConfig contains the configuration options for the codecs used by a decoder.
+// At most one codec can be configured.
+type CodecConfig struct {
+	Parquet *ParquetCodecConfig `config:"parquet"`
+	CSV     *CSVCodecConfig     `config:"csv"`
+}
+
+// Validate checks that only one codec is configured.
+func (c *CodecConfig) Validate() error {
+	if c.Parquet != nil && c.CSV != nil {
+		return errors.New("only one codec can be configured")
+	}
+	return nil
+}
+
+// ParquetCodecConfig contains the configuration options for the parquet codec.
+type ParquetCodecConfig struct {
+	Enabled         bool `config:"enabled"`
+	ProcessParallel bool `config:"process_parallel"`
+	BatchSize       int  `config:"batch_size" default:"1"`
+}
+
+// CSVCodecConfig contains the configuration options for the CSV codec.
+type CSVCodecConfig struct {
+	Enabled bool `config:"enabled"`
+	// Separator is the field separator. Defaults to a comma.
+	Separator *configRune `config:"separator"`
+	// Comment, if set, is the character starting comment lines.
+	Comment *configRune `config:"comment"`
+	// LazyQuotes allows quotes to appear in unquoted fields and
+	// non-doubled quotes to appear in quoted fields.
+	LazyQuotes bool `config:"lazy_quotes"`
+	// TrimLeadingSpace ignores the leading white space of fields.
+	TrimLeadingSpace bool `config:"trim_leading_space"`
+}
+
+// configRune is a single character configuration value.
+type configRune rune
+
+func (r *configRune) Unpack(s string) error {
+	if utf8.RuneCountInString(s) != 1 {
+		return fmt.Errorf("%q must be a single character", s)
+	}
+	c, _ := utf8.DecodeRuneInString(s)
+	*r = configRune(c)
+	return nil
+}
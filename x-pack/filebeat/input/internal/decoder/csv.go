@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package decoder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// csvDecoder is a decoder for CSV data with a header row. Each row is decoded
+// into a JSON object keyed by the column names from the header.
+type csvDecoder struct {
+	reader *csv.Reader
+
+	header  []string
+	current []string
+	err     error
+}
+
+// newCSVDecoder creates a new CSV decoder.
+func newCSVDecoder(config *CSVCodecConfig, r io.Reader) Decoder {
+	reader := csv.NewReader(r)
+	if config.Separator != nil {
+		reader.Comma = rune(*config.Separator)
+	}
+	if config.Comment != nil {
+		reader.Comment = rune(*config.Comment)
+	}
+	reader.LazyQuotes = config.LazyQuotes
+	reader.TrimLeadingSpace = config.TrimLeadingSpace
+	return &csvDecoder{
+		reader: reader,
+	}
+}
+
+// Next advances the CSV decoder to the next row. The header row is read
+// on the first call.
+func (cd *csvDecoder) Next() bool {
+	if cd.err != nil {
+		return false
+	}
+	if cd.header == nil {
+		header, err := cd.reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return false
+			}
+			cd.err = fmt.Errorf("failed to read csv header: %w", err)
+			return true
+		}
+		cd.header = header
+	}
+	row, err := cd.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			cd.current = nil
+			return false
+		}
+		cd.err = fmt.Errorf("failed to read csv row: %w", err)
+		return true
+	}
+	cd.current = row
+	return true
+}
+
+// Decode returns the current row as a JSON object, keeping the order of the
+// columns.
+func (cd *csvDecoder) Decode() ([]byte, error) {
+	if cd.err != nil {
+		return nil, cd.err
+	}
+	if cd.current == nil {
+		return nil, io.EOF
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range cd.current {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		// Marshaling strings can't fail.
+		k, _ := json.Marshal(cd.header[i])
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, _ := json.Marshal(field)
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Close closes the CSV decoder.
+func (cd *csvDecoder) Close() error {
+	return nil
+}
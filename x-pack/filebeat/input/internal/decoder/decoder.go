@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package decoder provides the codecs used by the object storage inputs to
+// decode objects into records.
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decoder decodes the records of a data stream.
+type Decoder interface {
+	// Next advances the decoder to the next record and returns true if
+	// there is a record, or an error, to be returned by Decode.
+	Next() bool
+	// Decode returns the current record as a JSON object.
+	Decode() ([]byte, error)
+	// Close releases the resources associated with the decoder.
+	Close() error
+}
+
+// New creates a new decoder based on the codec type. Gzip compressed
+// streams are decompressed before being decoded.
+// If the config codec option is not set, it returns a nil decoder and nil error.
+func New(config Config, r io.Reader) (Decoder, error) {
+	if config.Codec == nil {
+		return nil, nil
+	}
+
+	r, err := addGzipDecoderIfNeeded(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add gzip decoder: %w", err)
+	}
+
+	switch {
+	case config.Codec.Parquet != nil:
+		return newParquetDecoder(config.Codec.Parquet, r)
+	case config.Codec.CSV != nil:
+		return newCSVDecoder(config.Codec.CSV, r), nil
+	default:
+		return nil, fmt.Errorf("unsupported config value: %v", config)
+	}
+}
+
+// addGzipDecoderIfNeeded determines whether the given stream of bytes (encapsulated in a buffered reader)
+// represents gzipped content or not and adds gzipped decoder if needed.
+func addGzipDecoderIfNeeded(reader *bufio.Reader) (io.Reader, error) {
+	// gzip magic number (1f 8b) and the compression method (08 for DEFLATE).
+	buf, err := reader.Peek(3)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return reader, err
+	}
+	if !bytes.Equal(buf, []byte{0x1F, 0x8B, 0x08}) {
+		return reader, nil
+	}
+	return gzip.NewReader(reader)
+}
@@ -0,0 +1,183 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package decoder
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+// all test files are read from the "testdata" directory
+const testDataPath = "testdata"
+
+func TestNewNoCodec(t *testing.T) {
+	dec, err := New(Config{}, strings.NewReader("{}"))
+	assert.NoError(t, err)
+	assert.Nil(t, dec)
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "parquet",
+			config: map[string]interface{}{"codec.parquet.enabled": true},
+		},
+		{
+			name:   "csv with options",
+			config: map[string]interface{}{"codec.csv.separator": ";", "codec.csv.comment": "#"},
+		},
+		{
+			name:    "multiple codecs",
+			config:  map[string]interface{}{"codec.parquet.enabled": true, "codec.csv.enabled": true},
+			wantErr: true,
+		},
+		{
+			name:    "invalid separator",
+			config:  map[string]interface{}{"codec.csv.separator": "||"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config Config
+			err := conf.MustNewConfigFrom(test.config).Unpack(&config)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCSVDecoding(t *testing.T) {
+	want := []string{
+		`{"id":"1","user":"alice","action":"login"}`,
+		`{"id":"2","user":"bob","action":"logout, forced"}`,
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		config  CSVCodecConfig
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "plain",
+			file: "events.csv",
+			want: want,
+		},
+		{
+			name: "gzip",
+			file: "events.csv.gz",
+			want: want,
+		},
+		{
+			name:    "separator and comments",
+			content: "# exported\nid;user\n1; alice\n",
+			config:  CSVCodecConfig{Separator: ptr(configRune(';')), Comment: ptr(configRune('#')), TrimLeadingSpace: true},
+			want:    []string{`{"id":"1","user":"alice"}`},
+		},
+		{
+			name:    "header only",
+			content: "id,user\n",
+		},
+		{
+			name: "empty",
+		},
+		{
+			name:    "wrong number of fields",
+			content: "id,user\n1,alice\n2\n",
+			want:    []string{`{"id":"1","user":"alice"}`},
+			wantErr: "wrong number of fields",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var r io.Reader = strings.NewReader(test.content)
+			if test.file != "" {
+				f, err := os.Open(filepath.Join(testDataPath, test.file))
+				require.NoError(t, err)
+				defer f.Close()
+				r = f
+			}
+			dec, err := New(Config{Codec: &CodecConfig{CSV: &test.config}}, r)
+			require.NoError(t, err)
+			assertRecords(t, dec, test.want, test.wantErr)
+		})
+	}
+}
+
+func TestParquetDecoding(t *testing.T) {
+	var want []json.RawMessage
+	data, err := os.ReadFile(filepath.Join(testDataPath, "cloudtrail.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &want))
+
+	for _, batchSize := range []int{0, 1, 100} {
+		f, err := os.Open(filepath.Join(testDataPath, "cloudtrail.parquet"))
+		require.NoError(t, err)
+
+		dec, err := New(Config{Codec: &CodecConfig{Parquet: &ParquetCodecConfig{BatchSize: batchSize}}}, f)
+		require.NoError(t, err)
+
+		var got int
+		for dec.Next() {
+			rec, err := dec.Decode()
+			require.NoError(t, err)
+			require.Less(t, got, len(want))
+			assert.JSONEq(t, string(want[got]), string(rec))
+			got++
+		}
+		assert.Equal(t, len(want), got, "batch size %d", batchSize)
+		assert.NoError(t, dec.Close())
+		f.Close()
+	}
+}
+
+func TestParquetDecodingInvalid(t *testing.T) {
+	_, err := New(Config{Codec: &CodecConfig{Parquet: &ParquetCodecConfig{}}}, strings.NewReader("not parquet"))
+	assert.ErrorContains(t, err, "failed to create parquet decoder")
+}
+
+func assertRecords(t *testing.T, dec Decoder, want []string, wantErr string) {
+	t.Helper()
+	defer dec.Close()
+
+	var got []string
+	for dec.Next() {
+		rec, err := dec.Decode()
+		if err != nil {
+			assert.ErrorContains(t, err, wantErr)
+			assert.Equal(t, want, got)
+			assert.False(t, dec.Next(), "decoder must stop after an error")
+			return
+		}
+		got = append(got, string(rec))
+	}
+	assert.Empty(t, wantErr, "expected an error")
+	assert.Equal(t, want, got)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/elastic/beats/v7/x-pack/libbeat/reader/parquet"
+)
+
+// parquetDecoder is a decoder for parquet data.
+type parquetDecoder struct {
+	reader *parquet.BufferedReader
+
+	// records holds the records of the current batch that are yet to be decoded.
+	records []json.RawMessage
+	err     error
+}
+
+// newParquetDecoder creates a new parquet decoder. It uses the libbeat parquet reader under the hood.
+// It returns an error if the parquet reader cannot be created.
+func newParquetDecoder(config *ParquetCodecConfig, r io.Reader) (Decoder, error) {
+	reader, err := parquet.NewBufferedReader(r, &parquet.Config{
+		ProcessParallel: config.ProcessParallel,
+		BatchSize:       config.BatchSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet decoder: %w", err)
+	}
+	return &parquetDecoder{
+		reader: reader,
+	}, nil
+}
+
+// Next advances the parquet decoder to the next record, reading the next
+// batch of records when the current one is exhausted.
+func (pd *parquetDecoder) Next() bool {
+	if pd.err != nil {
+		return false
+	}
+	if len(pd.records) > 1 {
+		pd.records = pd.records[1:]
+		return true
+	}
+	pd.records = nil
+	for len(pd.records) == 0 {
+		if !pd.reader.Next() {
+			return false
+		}
+		data, err := pd.reader.Record()
+		if err != nil {
+			pd.err = err
+			return true
+		}
+		if err = json.Unmarshal(data, &pd.records); err != nil {
+			pd.err = fmt.Errorf("failed to split parquet record batch: %w", err)
+			return true
+		}
+	}
+	return true
+}
+
+// Decode returns the current parquet record as a JSON object.
+func (pd *parquetDecoder) Decode() ([]byte, error) {
+	if pd.err != nil {
+		return nil, pd.err
+	}
+	if len(pd.records) == 0 {
+		return nil, io.EOF
+	}
+	return pd.records[0], nil
+}
+
+// Close closes the parquet decoder and releases the resources.
+func (pd *parquetDecoder) Close() error {
+	return pd.reader.Close()
+}
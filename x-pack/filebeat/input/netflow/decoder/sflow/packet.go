@@ -0,0 +1,177 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sflow
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/record"
+)
+
+// Header protocols of sampled packet headers, as assigned by sFlow.
+const (
+	headerProtocolEthernet = 1
+	headerProtocolIPv4     = 11
+	headerProtocolIPv6     = 12
+)
+
+const (
+	etherTypeIPv4   = 0x0800
+	etherTypeIPv6   = 0x86dd
+	etherTypeDot1Q  = 0x8100
+	etherTypeDot1AD = 0x88a8
+
+	ipProtoICMP   = 1
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	ipProtoICMPv6 = 58
+	ipProtoSCTP   = 132
+)
+
+// decodeHeader decodes a sampled packet header into IPFIX fields. Sampled
+// headers are usually truncated, so decoding stops silently at the first
+// layer that is not fully contained in data.
+func decodeHeader(protocol uint32, data []byte, fields record.Map) {
+	switch protocol {
+	case headerProtocolEthernet:
+		decodeEthernet(data, fields)
+	case headerProtocolIPv4:
+		decodeIPv4(data, fields)
+	case headerProtocolIPv6:
+		decodeIPv6(data, fields)
+	}
+}
+
+func decodeEthernet(data []byte, fields record.Map) {
+	if len(data) < 14 {
+		return
+	}
+	fields["destinationMacAddress"] = net.HardwareAddr(clone(data[0:6]))
+	fields["sourceMacAddress"] = net.HardwareAddr(clone(data[6:12]))
+	etherType := binary.BigEndian.Uint16(data[12:14])
+	data = data[14:]
+
+	// The outer tag of QinQ frames is the service VLAN, and the inner tag
+	// the customer VLAN.
+	for tags := 0; etherType == etherTypeDot1Q || etherType == etherTypeDot1AD; tags++ {
+		if len(data) < 4 {
+			return
+		}
+		vlan := uint64(binary.BigEndian.Uint16(data[0:2]) & 0x0fff)
+		if tags == 0 {
+			fields["vlanId"] = vlan
+		} else {
+			fields["dot1qCustomerVlanId"] = vlan
+		}
+		etherType = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+	}
+	fields["ethernetType"] = uint64(etherType)
+
+	switch etherType {
+	case etherTypeIPv4:
+		decodeIPv4(data, fields)
+	case etherTypeIPv6:
+		decodeIPv6(data, fields)
+	}
+}
+
+func decodeIPv4(data []byte, fields record.Map) {
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	if headerLen < 20 || headerLen > len(data) {
+		return
+	}
+	protocol := data[9]
+	fields["ipVersion"] = uint64(4)
+	fields["ipClassOfService"] = uint64(data[1])
+	fields["ipTTL"] = uint64(data[8])
+	fields["protocolIdentifier"] = uint64(protocol)
+	fields["sourceIPv4Address"] = net.IP(clone(data[12:16]))
+	fields["destinationIPv4Address"] = net.IP(clone(data[16:20]))
+
+	// Only the first fragment carries the transport header.
+	if binary.BigEndian.Uint16(data[6:8])&0x1fff != 0 {
+		return
+	}
+	decodeTransport(protocol, data[headerLen:], fields)
+}
+
+func decodeIPv6(data []byte, fields record.Map) {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return
+	}
+	fields["ipVersion"] = uint64(6)
+	fields["ipClassOfService"] = uint64(binary.BigEndian.Uint16(data[0:2]) >> 4 & 0xff)
+	fields["flowLabelIPv6"] = uint64(binary.BigEndian.Uint32(data[0:4]) & 0xfffff)
+	fields["ipTTL"] = uint64(data[7])
+	fields["sourceIPv6Address"] = net.IP(clone(data[8:24]))
+	fields["destinationIPv6Address"] = net.IP(clone(data[24:40]))
+
+	next := data[6]
+	data = data[40:]
+headers:
+	for {
+		switch next {
+		case 0, 43, 60: // Hop-by-hop, routing and destination options.
+			if len(data) < 2 {
+				return
+			}
+			n := (int(data[1]) + 1) * 8
+			if n > len(data) {
+				return
+			}
+			next, data = data[0], data[n:]
+		case 44: // Fragment.
+			if len(data) < 8 {
+				return
+			}
+			if binary.BigEndian.Uint16(data[2:4])>>3 != 0 {
+				fields["protocolIdentifier"] = uint64(data[0])
+				return
+			}
+			next, data = data[0], data[8:]
+		default:
+			break headers
+		}
+	}
+	fields["protocolIdentifier"] = uint64(next)
+	decodeTransport(next, data, fields)
+}
+
+func decodeTransport(protocol uint8, data []byte, fields record.Map) {
+	switch protocol {
+	case ipProtoTCP:
+		if len(data) < 14 {
+			return
+		}
+		fields["tcpControlBits"] = uint64(binary.BigEndian.Uint16(data[12:14]) & 0x01ff)
+		fallthrough
+	case ipProtoUDP, ipProtoSCTP:
+		if len(data) < 4 {
+			return
+		}
+		fields["sourceTransportPort"] = uint64(binary.BigEndian.Uint16(data[0:2]))
+		fields["destinationTransportPort"] = uint64(binary.BigEndian.Uint16(data[2:4]))
+	case ipProtoICMP:
+		if len(data) < 2 {
+			return
+		}
+		fields["icmpTypeCodeIPv4"] = uint64(binary.BigEndian.Uint16(data[0:2]))
+	case ipProtoICMPv6:
+		if len(data) < 2 {
+			return
+		}
+		fields["icmpTypeCodeIPv6"] = uint64(binary.BigEndian.Uint16(data[0:2]))
+	}
+}
+
+// clone copies b so that records don't keep a reference to the datagram.
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,389 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sflow
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/config"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/protocol"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/record"
+)
+
+const (
+	ProtocolName = "sflow"
+	LogPrefix    = "[sflow] "
+
+	// ProtocolID is the value of the first two bytes of an sFlow v5
+	// datagram. The decoder selects protocols by the 16 bit version that
+	// NetFlow and IPFIX use, but sFlow encodes its version as a 32 bit
+	// integer, so the upper half of it is zero.
+	ProtocolID uint16 = 0
+
+	datagramVersion = 5
+)
+
+// Sample formats, for the standard (zero) enterprise.
+const (
+	flowSample            = 1
+	counterSample         = 2
+	expandedFlowSample    = 3
+	expandedCounterSample = 4
+)
+
+// Flow record formats.
+const (
+	flowRawHeader      = 1
+	flowEthernet       = 2
+	flowIPv4           = 3
+	flowIPv6           = 4
+	flowExtendedSwitch = 1001
+	flowExtendedRouter = 1002
+)
+
+// Counter record formats.
+const (
+	countersGenericInterface = 1
+	countersEthernet         = 2
+	countersProcessor        = 1001
+)
+
+const (
+	addressTypeIPv4 = 1
+	addressTypeIPv6 = 2
+)
+
+type SFlowProtocol struct {
+	logger  *log.Logger
+	timeNow func() time.Time
+}
+
+func init() {
+	protocol.Registry.Register(ProtocolName, New)
+}
+
+func New(config config.Config) protocol.Protocol {
+	return &SFlowProtocol{
+		logger:  log.New(config.LogOutput(), LogPrefix, 0),
+		timeNow: time.Now,
+	}
+}
+
+func (*SFlowProtocol) Version() uint16 {
+	return ProtocolID
+}
+
+func (*SFlowProtocol) Start() error {
+	return nil
+}
+
+func (*SFlowProtocol) Stop() error {
+	return nil
+}
+
+// OnPacket decodes an sFlow v5 datagram. Flow samples are returned as flow
+// records with the same fields that NetFlow and IPFIX flows use, and counter
+// samples as options records.
+func (p *SFlowProtocol) OnPacket(buf *bytes.Buffer, source net.Addr) ([]record.Record, error) {
+	r := &xdrReader{data: buf.Next(buf.Len())}
+
+	if version := r.uint32(); r.err == nil && version != datagramVersion {
+		return nil, fmt.Errorf("unsupported sFlow version %d", version)
+	}
+	agent, err := readAddress(r)
+	if err != nil {
+		p.logger.Printf("Failed parsing packet: %v", err)
+		return nil, fmt.Errorf("error reading sFlow agent address: %w", err)
+	}
+	subAgentID := r.uint32()
+	r.uint32() // Datagram sequence number.
+	uptime := r.uint32()
+	numSamples := r.uint32()
+	if r.err != nil {
+		p.logger.Printf("Failed parsing packet: %v", r.err)
+		return nil, fmt.Errorf("error reading sFlow datagram header: %w", r.err)
+	}
+
+	// sFlow datagrams carry no wall clock time, so records are timestamped
+	// on reception.
+	now := p.timeNow().UTC()
+	exporter := record.Map{
+		"version":      uint64(datagramVersion),
+		"timestamp":    now,
+		"uptimeMillis": uint64(uptime),
+		"address":      source.String(),
+		"sourceId":     uint64(subAgentID),
+	}
+
+	var records []record.Record
+	for i := uint32(0); i < numSamples; i++ {
+		format := r.uint32()
+		sample := r.sub(int(r.uint32()))
+		if r.err != nil {
+			return nil, fmt.Errorf("error reading sFlow sample %d: %w", i, r.err)
+		}
+
+		var rec record.Record
+		switch format {
+		case flowSample, expandedFlowSample:
+			rec.Type = record.Flow
+			rec.Fields, err = decodeFlowSample(sample, format == expandedFlowSample)
+			if err == nil {
+				setAgentAddress(rec.Fields, agent)
+			}
+		case counterSample, expandedCounterSample:
+			rec.Type = record.Options
+			rec.Fields, err = decodeCounterSample(sample, format == expandedCounterSample)
+		default:
+			// Samples of other formats or enterprises are skipped.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding sFlow sample %d: %w", i, err)
+		}
+		rec.Timestamp = now
+		rec.Exporter = exporter
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func readAddress(r *xdrReader) (net.IP, error) {
+	switch addrType := r.uint32(); addrType {
+	case addressTypeIPv4:
+		return net.IP(clone(r.next(net.IPv4len))), r.err
+	case addressTypeIPv6:
+		return net.IP(clone(r.next(net.IPv6len))), r.err
+	case 0:
+		return nil, r.err
+	default:
+		return nil, fmt.Errorf("unknown address type %d", addrType)
+	}
+}
+
+func setAgentAddress(fields record.Map, agent net.IP) {
+	switch len(agent) {
+	case net.IPv4len:
+		fields["exporterIPv4Address"] = agent
+	case net.IPv6len:
+		fields["exporterIPv6Address"] = agent
+	}
+}
+
+// readDataSource reads the data source of a sample. Compact samples encode
+// the source type in the upper 8 bits and the index in the lower 24 bits of
+// a single word.
+func readDataSource(r *xdrReader, expanded bool) (sourceType, index uint32) {
+	if expanded {
+		return r.uint32(), r.uint32()
+	}
+	id := r.uint32()
+	return id >> 24, id & 0x00ffffff
+}
+
+// readInterface reads an interface of a flow sample, returning whether it
+// is a known interface index. Compact samples encode the format in the
+// upper 2 bits and the value in the lower 30 bits of a single word.
+func readInterface(r *xdrReader, expanded bool) (ifIndex uint32, ok bool) {
+	var format, value uint32
+	if expanded {
+		format, value = r.uint32(), r.uint32()
+	} else {
+		v := r.uint32()
+		format, value = v>>30, v&0x3fffffff
+	}
+	return value, format == 0 && value != 0 && value != 0x3fffffff
+}
+
+func decodeFlowSample(r *xdrReader, expanded bool) (record.Map, error) {
+	r.uint32() // Sample sequence number.
+	readDataSource(r, expanded)
+	rate := r.uint32()
+	pool := r.uint32()
+	r.uint32() // Drops.
+	input, hasInput := readInterface(r, expanded)
+	output, hasOutput := readInterface(r, expanded)
+	numRecords := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	fields := record.Map{
+		"samplingPacketInterval": uint64(rate),
+		"samplingPopulation":     uint64(pool),
+	}
+	if hasInput {
+		fields["ingressInterface"] = uint64(input)
+	}
+	if hasOutput {
+		fields["egressInterface"] = uint64(output)
+	}
+
+	var frameLength, ipLength uint32
+	for i := uint32(0); i < numRecords; i++ {
+		format := r.uint32()
+		rec := r.sub(int(r.uint32()))
+		if r.err != nil {
+			return nil, r.err
+		}
+		switch format {
+		case flowRawHeader:
+			protocol := rec.uint32()
+			frameLength = rec.uint32()
+			rec.uint32() // Bytes stripped from the frame.
+			header := rec.opaque(int(rec.uint32()))
+			decodeHeader(protocol, header, fields)
+		case flowEthernet:
+			if length := rec.uint32(); frameLength == 0 {
+				frameLength = length
+			}
+			fields["sourceMacAddress"] = net.HardwareAddr(clone(rec.opaque(6)))
+			fields["destinationMacAddress"] = net.HardwareAddr(clone(rec.opaque(6)))
+			fields["ethernetType"] = uint64(rec.uint32())
+		case flowIPv4, flowIPv6:
+			ipLength = rec.uint32()
+			fields["protocolIdentifier"] = uint64(rec.uint32())
+			addrLen, src, dst := net.IPv4len, "sourceIPv4Address", "destinationIPv4Address"
+			if format == flowIPv6 {
+				addrLen, src, dst = net.IPv6len, "sourceIPv6Address", "destinationIPv6Address"
+			}
+			fields[src] = net.IP(clone(rec.next(addrLen)))
+			fields[dst] = net.IP(clone(rec.next(addrLen)))
+			fields["sourceTransportPort"] = uint64(rec.uint32())
+			fields["destinationTransportPort"] = uint64(rec.uint32())
+			fields["tcpControlBits"] = uint64(rec.uint32())
+			fields["ipClassOfService"] = uint64(rec.uint32())
+		case flowExtendedSwitch:
+			fields["vlanId"] = uint64(rec.uint32())
+			rec.uint32() // Source priority.
+			fields["postVlanId"] = uint64(rec.uint32())
+			rec.uint32() // Destination priority.
+		case flowExtendedRouter:
+			nextHop, err := readAddress(rec)
+			if err != nil {
+				return nil, err
+			}
+			family := "IPv4"
+			if len(nextHop) == net.IPv6len {
+				family = "IPv6"
+			}
+			if nextHop != nil {
+				fields["ipNextHop"+family+"Address"] = nextHop
+			}
+			fields["source"+family+"PrefixLength"] = uint64(rec.uint32())
+			fields["destination"+family+"PrefixLength"] = uint64(rec.uint32())
+		}
+		if rec.err != nil {
+			return nil, fmt.Errorf("error reading flow record %d: %w", format, rec.err)
+		}
+	}
+
+	if frameLength == 0 {
+		frameLength = ipLength
+	}
+	// Each sampled packet stands for rate packets.
+	fields["packetDeltaCount"] = uint64(rate)
+	fields["octetDeltaCount"] = uint64(frameLength) * uint64(rate)
+	return fields, nil
+}
+
+func decodeCounterSample(r *xdrReader, expanded bool) (record.Map, error) {
+	r.uint32() // Sample sequence number.
+	sourceType, index := readDataSource(r, expanded)
+	numRecords := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	options := record.Map{}
+	for i := uint32(0); i < numRecords; i++ {
+		format := r.uint32()
+		rec := r.sub(int(r.uint32()))
+		if r.err != nil {
+			return nil, r.err
+		}
+		switch format {
+		case countersGenericInterface:
+			readCounters(rec, options, genericInterfaceCounters)
+		case countersEthernet:
+			readCounters(rec, options, ethernetCounters)
+		case countersProcessor:
+			// CPU utilization is expressed in hundredths of a percent.
+			options["fiveSecondCpuPercentage"] = float64(rec.uint32()) / 100
+			options["oneMinuteCpuPercentage"] = float64(rec.uint32()) / 100
+			options["fiveMinuteCpuPercentage"] = float64(rec.uint32()) / 100
+			options["totalMemory"] = rec.uint64()
+			options["freeMemory"] = rec.uint64()
+		}
+		if rec.err != nil {
+			return nil, fmt.Errorf("error reading counter record %d: %w", format, rec.err)
+		}
+	}
+
+	return record.Map{
+		"scope": record.Map{
+			"sourceIdType":  uint64(sourceType),
+			"sourceIdIndex": uint64(index),
+		},
+		"options": options,
+	}, nil
+}
+
+type counter struct {
+	name string
+	size int // 4 or 8 bytes.
+}
+
+var genericInterfaceCounters = []counter{
+	{"ifIndex", 4},
+	{"ifType", 4},
+	{"ifSpeed", 8},
+	{"ifDirection", 4},
+	{"ifStatus", 4},
+	{"ifInOctets", 8},
+	{"ifInUcastPkts", 4},
+	{"ifInMulticastPkts", 4},
+	{"ifInBroadcastPkts", 4},
+	{"ifInDiscards", 4},
+	{"ifInErrors", 4},
+	{"ifInUnknownProtos", 4},
+	{"ifOutOctets", 8},
+	{"ifOutUcastPkts", 4},
+	{"ifOutMulticastPkts", 4},
+	{"ifOutBroadcastPkts", 4},
+	{"ifOutDiscards", 4},
+	{"ifOutErrors", 4},
+	{"ifPromiscuousMode", 4},
+}
+
+var ethernetCounters = []counter{
+	{"dot3StatsAlignmentErrors", 4},
+	{"dot3StatsFCSErrors", 4},
+	{"dot3StatsSingleCollisionFrames", 4},
+	{"dot3StatsMultipleCollisionFrames", 4},
+	{"dot3StatsSQETestErrors", 4},
+	{"dot3StatsDeferredTransmissions", 4},
+	{"dot3StatsLateCollisions", 4},
+	{"dot3StatsExcessiveCollisions", 4},
+	{"dot3StatsInternalMacTransmitErrors", 4},
+	{"dot3StatsCarrierSenseErrors", 4},
+	{"dot3StatsFrameTooLongs", 4},
+	{"dot3StatsInternalMacReceiveErrors", 4},
+	{"dot3StatsSymbolErrors", 4},
+}
+
+func readCounters(r *xdrReader, dst record.Map, counters []counter) {
+	for _, c := range counters {
+		if c.size == 8 {
+			dst[c.name] = r.uint64()
+		} else {
+			dst[c.name] = uint64(r.uint32())
+		}
+	}
+}
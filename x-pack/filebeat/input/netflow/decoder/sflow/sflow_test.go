@@ -0,0 +1,329 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sflow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/config"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/netflow/decoder/record"
+)
+
+// xdrWriter builds sFlow datagrams for tests.
+type xdrWriter struct {
+	bytes.Buffer
+}
+
+func (w *xdrWriter) u32(values ...uint32) *xdrWriter {
+	for _, v := range values {
+		_ = binary.Write(w, binary.BigEndian, v)
+	}
+	return w
+}
+
+func (w *xdrWriter) u64(v uint64) *xdrWriter {
+	_ = binary.Write(w, binary.BigEndian, v)
+	return w
+}
+
+func (w *xdrWriter) opaque(b []byte) *xdrWriter {
+	w.Write(b)
+	w.Write(make([]byte, (4-len(b)%4)%4))
+	return w
+}
+
+// item appends a format and length prefixed structure.
+func (w *xdrWriter) item(format uint32, data *xdrWriter) *xdrWriter {
+	return w.u32(format, uint32(data.Len())).opaque(data.Bytes())
+}
+
+func datagram(samples ...func(*xdrWriter)) []byte {
+	w := new(xdrWriter)
+	w.u32(datagramVersion, addressTypeIPv4).opaque([]byte{10, 0, 0, 1})
+	w.u32(7, 1234, 60000, uint32(len(samples)))
+	for _, s := range samples {
+		s(w)
+	}
+	return w.Bytes()
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+var (
+	testSource = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 6343}
+	testTime   = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func newTestProtocol() *SFlowProtocol {
+	proto := New(config.Defaults()).(*SFlowProtocol)
+	proto.timeNow = func() time.Time { return testTime }
+	return proto
+}
+
+func TestSFlowProtocol_New(t *testing.T) {
+	proto := New(config.Defaults())
+
+	assert.Nil(t, proto.Start())
+	assert.Equal(t, uint16(0), proto.Version())
+	assert.Nil(t, proto.Stop())
+}
+
+func TestOnPacket_FlowSample(t *testing.T) {
+	// Ethernet frame with an 802.1Q tag, carrying a TCP SYN from
+	// 192.168.1.10:51000 to 10.1.2.3:443.
+	header := mustDecodeHex(t,
+		"0011223344550a0b0c0d0e0f"+ // Destination and source MAC.
+			"810000640800"+ // VLAN 100, IPv4.
+			"4500003c0000400040060000c0a8010a0a010203"+ // IPv4 header.
+			"c73801bb0000000000000000a0020000") // TCP header.
+
+	rawHeader := new(xdrWriter).u32(headerProtocolEthernet, 78, 4, uint32(len(header))).opaque(header)
+	switchData := new(xdrWriter).u32(100, 0, 200, 0)
+	sample := new(xdrWriter).
+		u32(1, 0x00000003, 512, 4096, 0, 3, 0x3fffffff, 2).
+		item(flowRawHeader, rawHeader).
+		item(flowExtendedSwitch, switchData)
+
+	proto := newTestProtocol()
+	records, err := proto.OnPacket(bytes.NewBuffer(datagram(func(w *xdrWriter) {
+		w.item(flowSample, sample)
+	})), testSource)
+	require.NoError(t, err)
+
+	assert.Equal(t, []record.Record{
+		{
+			Type:      record.Flow,
+			Timestamp: testTime,
+			Fields: record.Map{
+				"destinationMacAddress":    net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+				"sourceMacAddress":         net.HardwareAddr{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f},
+				"vlanId":                   uint64(100),
+				"postVlanId":               uint64(200),
+				"ethernetType":             uint64(0x0800),
+				"ipVersion":                uint64(4),
+				"ipClassOfService":         uint64(0),
+				"ipTTL":                    uint64(64),
+				"protocolIdentifier":       uint64(6),
+				"sourceIPv4Address":        net.IP{192, 168, 1, 10},
+				"destinationIPv4Address":   net.IP{10, 1, 2, 3},
+				"sourceTransportPort":      uint64(51000),
+				"destinationTransportPort": uint64(443),
+				"tcpControlBits":           uint64(0x02),
+				"ingressInterface":         uint64(3),
+				"samplingPacketInterval":   uint64(512),
+				"samplingPopulation":       uint64(4096),
+				"packetDeltaCount":         uint64(512),
+				"octetDeltaCount":          uint64(78 * 512),
+				"exporterIPv4Address":      net.IP{10, 0, 0, 1},
+			},
+			Exporter: record.Map{
+				"version":      uint64(5),
+				"timestamp":    testTime,
+				"uptimeMillis": uint64(60000),
+				"address":      "192.0.2.1:6343",
+				"sourceId":     uint64(7),
+			},
+		},
+	}, records)
+}
+
+func TestOnPacket_ExpandedFlowSample(t *testing.T) {
+	// IPv6 packet with a UDP datagram from [2001:db8::1]:5353 to
+	// [2001:db8::2]:53.
+	header := mustDecodeHex(t,
+		"6000000100081140"+
+			"20010db8000000000000000000000001"+
+			"20010db8000000000000000000000002"+
+			"14e9003500080000")
+
+	rawHeader := new(xdrWriter).u32(headerProtocolIPv6, 100, 0, uint32(len(header))).opaque(header)
+	router := new(xdrWriter).u32(addressTypeIPv6).
+		opaque(net.ParseIP("2001:db8::fe")).
+		u32(48, 64)
+	sample := new(xdrWriter).
+		u32(9, 0, 5, 100, 1000, 0, 0, 1, 1, 0x2).
+		u32(3).
+		item(flowRawHeader, rawHeader).
+		item(0xdead, new(xdrWriter).u32(1, 2, 3)). // Unknown records are skipped.
+		item(flowExtendedRouter, router)
+
+	proto := newTestProtocol()
+	records, err := proto.OnPacket(bytes.NewBuffer(datagram(func(w *xdrWriter) {
+		w.item(expandedFlowSample, sample)
+	})), testSource)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	assert.Equal(t, record.Map{
+		"ipVersion":                   uint64(6),
+		"ipClassOfService":            uint64(0),
+		"flowLabelIPv6":               uint64(1),
+		"ipTTL":                       uint64(64),
+		"protocolIdentifier":          uint64(17),
+		"sourceIPv6Address":           net.ParseIP("2001:db8::1"),
+		"destinationIPv6Address":      net.ParseIP("2001:db8::2"),
+		"sourceTransportPort":         uint64(5353),
+		"destinationTransportPort":    uint64(53),
+		"ipNextHopIPv6Address":        net.ParseIP("2001:db8::fe"),
+		"sourceIPv6PrefixLength":      uint64(48),
+		"destinationIPv6PrefixLength": uint64(64),
+		"ingressInterface":            uint64(1),
+		"samplingPacketInterval":      uint64(100),
+		"samplingPopulation":          uint64(1000),
+		"packetDeltaCount":            uint64(100),
+		"octetDeltaCount":             uint64(100 * 100),
+		"exporterIPv4Address":         net.IP{10, 0, 0, 1},
+	}, records[0].Fields)
+}
+
+func TestOnPacket_CounterSamples(t *testing.T) {
+	generic := new(xdrWriter).u32(3, 6).u64(1e9).u32(1, 3).
+		u64(1000).u32(10, 11, 12, 13, 14, 15).
+		u64(2000).u32(20, 21, 22, 23, 24, 0)
+	ethernet := new(xdrWriter).u32(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13)
+	processor := new(xdrWriter).u32(1250, 2500, 5000).u64(8 << 30).u64(2 << 30)
+
+	proto := newTestProtocol()
+	records, err := proto.OnPacket(bytes.NewBuffer(datagram(
+		func(w *xdrWriter) {
+			w.item(counterSample, new(xdrWriter).u32(1, 0x00000003, 2).
+				item(countersGenericInterface, generic).
+				item(countersEthernet, ethernet))
+		},
+		func(w *xdrWriter) {
+			w.item(0x1000|counterSample, new(xdrWriter).u32(1, 2, 3)) // Other enterprises are skipped.
+		},
+		func(w *xdrWriter) {
+			w.item(expandedCounterSample, new(xdrWriter).u32(1, 2, 1, 1).
+				item(countersProcessor, processor))
+		},
+	)), testSource)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	for _, rec := range records {
+		assert.Equal(t, record.Options, rec.Type)
+		assert.Equal(t, testTime, rec.Timestamp)
+	}
+
+	assert.Equal(t, record.Map{"sourceIdType": uint64(0), "sourceIdIndex": uint64(3)}, records[0].Fields["scope"])
+	options := records[0].Fields["options"].(record.Map)
+	assert.Equal(t, uint64(3), options["ifIndex"])
+	assert.Equal(t, uint64(1e9), options["ifSpeed"])
+	assert.Equal(t, uint64(1000), options["ifInOctets"])
+	assert.Equal(t, uint64(15), options["ifInUnknownProtos"])
+	assert.Equal(t, uint64(2000), options["ifOutOctets"])
+	assert.Equal(t, uint64(24), options["ifOutErrors"])
+	assert.Equal(t, uint64(0), options["ifPromiscuousMode"])
+	assert.Equal(t, uint64(2), options["dot3StatsFCSErrors"])
+	assert.Equal(t, uint64(13), options["dot3StatsSymbolErrors"])
+
+	assert.Equal(t, record.Map{"sourceIdType": uint64(2), "sourceIdIndex": uint64(1)}, records[1].Fields["scope"])
+	assert.Equal(t, record.Map{
+		"fiveSecondCpuPercentage": 12.5,
+		"oneMinuteCpuPercentage":  25.0,
+		"fiveMinuteCpuPercentage": 50.0,
+		"totalMemory":             uint64(8 << 30),
+		"freeMemory":              uint64(2 << 30),
+	}, records[1].Fields["options"])
+}
+
+func TestOnPacket_Errors(t *testing.T) {
+	proto := newTestProtocol()
+
+	valid := datagram(func(w *xdrWriter) {
+		w.item(counterSample, new(xdrWriter).u32(1, 3, 1).
+			item(countersProcessor, new(xdrWriter).u32(1, 2, 3).u64(4).u64(5)))
+	})
+	for i := 0; i < len(valid); i += 4 {
+		_, err := proto.OnPacket(bytes.NewBuffer(valid[:i]), testSource)
+		assert.Error(t, err, "truncated at %d bytes", i)
+	}
+
+	version4 := append([]byte{0, 0, 0, 4}, valid[4:]...)
+	_, err := proto.OnPacket(bytes.NewBuffer(version4), testSource)
+	assert.ErrorContains(t, err, "unsupported sFlow version 4")
+
+	// A truncated record inside a well formed sample.
+	truncated := datagram(func(w *xdrWriter) {
+		w.item(counterSample, new(xdrWriter).u32(1, 3, 1).
+			item(countersProcessor, new(xdrWriter).u32(1, 2, 3)))
+	})
+	_, err = proto.OnPacket(bytes.NewBuffer(truncated), testSource)
+	assert.ErrorIs(t, err, errShortRead)
+}
+
+func TestDecodeHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		protocol uint32
+		header   string
+		expected record.Map
+	}{
+		{
+			name:     "ICMP echo request",
+			protocol: headerProtocolIPv4,
+			header:   "450000540000400040010000c0a800010808080808000000",
+			expected: record.Map{
+				"ipVersion":              uint64(4),
+				"ipClassOfService":       uint64(0),
+				"ipTTL":                  uint64(64),
+				"protocolIdentifier":     uint64(1),
+				"sourceIPv4Address":      net.IP{192, 168, 0, 1},
+				"destinationIPv4Address": net.IP{8, 8, 8, 8},
+				"icmpTypeCodeIPv4":       uint64(0x0800),
+			},
+		},
+		{
+			name:     "non-first fragment",
+			protocol: headerProtocolIPv4,
+			header:   "4500005400000010401100000a0000010a00000214e90035",
+			expected: record.Map{
+				"ipVersion":              uint64(4),
+				"ipClassOfService":       uint64(0),
+				"ipTTL":                  uint64(64),
+				"protocolIdentifier":     uint64(17),
+				"sourceIPv4Address":      net.IP{10, 0, 0, 1},
+				"destinationIPv4Address": net.IP{10, 0, 0, 2},
+			},
+		},
+		{
+			name:     "truncated ethernet",
+			protocol: headerProtocolEthernet,
+			header:   "001122334455",
+			expected: record.Map{},
+		},
+		{
+			name:     "QinQ without payload",
+			protocol: headerProtocolEthernet,
+			header:   "0011223344550a0b0c0d0e0f88a8000a8100001486dd",
+			expected: record.Map{
+				"destinationMacAddress": net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+				"sourceMacAddress":      net.HardwareAddr{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f},
+				"vlanId":                uint64(10),
+				"dot1qCustomerVlanId":   uint64(20),
+				"ethernetType":          uint64(0x86dd),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := record.Map{}
+			decodeHeader(tc.protocol, mustDecodeHex(t, tc.header), fields)
+			assert.Equal(t, tc.expected, fields)
+		})
+	}
+}
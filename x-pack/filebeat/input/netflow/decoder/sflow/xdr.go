@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sflow
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortRead = errors.New("unexpected end of sFlow data")
+
+// xdrReader reads the XDR encoded, big endian and 4 byte aligned values
+// used by sFlow. Once a read fails all subsequent reads return zero values,
+// and err holds the error.
+type xdrReader struct {
+	data []byte
+	err  error
+}
+
+func (r *xdrReader) len() int {
+	return len(r.data)
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// opaque reads n bytes, and skips the padding to the next 4 byte boundary.
+func (r *xdrReader) opaque(n int) []byte {
+	b := r.next(n)
+	if pad := (4 - n%4) % 4; b != nil && pad > 0 {
+		r.next(pad)
+	}
+	return b
+}
+
+// sub returns a reader for the next n bytes, used to read length prefixed
+// structures so that unknown or partially decoded data can be skipped.
+func (r *xdrReader) sub(n int) *xdrReader {
+	b := r.next(n)
+	if b == nil {
+		return &xdrReader{err: r.err}
+	}
+	return &xdrReader{data: b}
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errShortRead
+		r.data = nil
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
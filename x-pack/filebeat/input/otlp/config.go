@@ -0,0 +1,56 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// config contains the otlp input configuration.
+type config struct {
+	ListenAddress string                  `config:"listen_address"`
+	GRPC          endpointConfig          `config:"grpc"`
+	HTTP          endpointConfig          `config:"http"`
+	TLS           *tlscommon.ServerConfig `config:"ssl"`
+
+	// ACKTimeout is how long a request waits for its events to be
+	// acknowledged by the outputs before the sender is asked to retry.
+	ACKTimeout time.Duration `config:"ack_timeout" validate:"nonzero,positive"`
+
+	// MaxMessageSize limits the size of decoded requests.
+	MaxMessageSize cfgtype.ByteSize `config:"max_message_size" validate:"nonzero,positive"`
+}
+
+// endpointConfig configures one of the receiver protocols.
+type endpointConfig struct {
+	Enabled bool   `config:"enabled"`
+	Port    string `config:"port"`
+}
+
+func defaultConfig() config {
+	return config{
+		ListenAddress:  "127.0.0.1",
+		GRPC:           endpointConfig{Enabled: true, Port: "4317"},
+		HTTP:           endpointConfig{Enabled: true, Port: "4318"},
+		ACKTimeout:     30 * time.Second,
+		MaxMessageSize: 4 * humanize.MiByte,
+	}
+}
+
+func (c *config) Validate() error {
+	if !c.GRPC.Enabled && !c.HTTP.Enabled {
+		return errors.New("at least one of grpc and http must be enabled")
+	}
+	if c.GRPC.Enabled && c.HTTP.Enabled && c.GRPC.Port == c.HTTP.Port {
+		return errors.New("grpc and http can not listen on the same port")
+	}
+	return nil
+}
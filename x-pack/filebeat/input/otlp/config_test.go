@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     map[string]interface{}
+		wantErr bool
+	}{
+		{name: "default", cfg: map[string]interface{}{}},
+		{name: "grpc only", cfg: map[string]interface{}{"http.enabled": false}},
+		{name: "http only", cfg: map[string]interface{}{"grpc.enabled": false}},
+		{
+			name:    "nothing enabled",
+			cfg:     map[string]interface{}{"grpc.enabled": false, "http.enabled": false},
+			wantErr: true,
+		},
+		{
+			name:    "same port",
+			cfg:     map[string]interface{}{"grpc.port": "4318"},
+			wantErr: true,
+		},
+		{
+			name:    "zero ack timeout",
+			cfg:     map[string]interface{}{"ack_timeout": 0},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := conf.MustNewConfigFrom(test.cfg)
+			c := defaultConfig()
+			err := cfg.Unpack(&c)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/safemapstr"
+)
+
+// ecsFields maps OpenTelemetry semantic convention attribute names to ECS
+// fields where the two differ. All other attributes keep their names.
+var ecsFields = map[string]string{
+	"deployment.environment": "service.environment",
+	"service.instance.id":    "service.node.name",
+	"host.arch":              "host.architecture",
+	"os.type":                "host.os.type",
+	"os.name":                "host.os.name",
+	"os.version":             "host.os.version",
+	"os.description":         "host.os.full",
+	"k8s.namespace.name":     "kubernetes.namespace",
+	"k8s.pod.name":           "kubernetes.pod.name",
+	"k8s.pod.uid":            "kubernetes.pod.uid",
+	"k8s.node.name":          "kubernetes.node.name",
+	"k8s.container.name":     "kubernetes.container.name",
+	"k8s.deployment.name":    "kubernetes.deployment.name",
+	"telemetry.sdk.language": "service.language.name",
+	"exception.type":         "error.type",
+	"exception.message":      "error.message",
+	"exception.stacktrace":   "error.stack_trace",
+	"code.function":          "log.origin.function",
+	"code.filepath":          "log.origin.file.name",
+	"code.lineno":            "log.origin.file.line",
+}
+
+// severityLevels gives the log.level used for records that only have a
+// severity number.
+var severityLevels = [...]string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// toEvents converts the log records of an export request into events.
+// Resource, scope and record attributes are merged in that order, so that
+// more specific attributes take precedence.
+func toEvents(req *collogspb.ExportLogsServiceRequest, now time.Time) []beat.Event {
+	var events []beat.Event
+	for _, rl := range req.GetResourceLogs() {
+		resource := mapstr.M{}
+		putAttributes(resource, rl.GetResource().GetAttributes())
+
+		for _, sl := range rl.GetScopeLogs() {
+			scope := resource.Clone()
+			putAttributes(scope, sl.GetScope().GetAttributes())
+			if name := sl.GetScope().GetName(); name != "" {
+				safemapstr.Put(scope, "log.logger", name)
+			}
+
+			for _, record := range sl.GetLogRecords() {
+				events = append(events, toEvent(scope.Clone(), record, now))
+			}
+		}
+	}
+	return events
+}
+
+func toEvent(fields mapstr.M, record *logspb.LogRecord, now time.Time) beat.Event {
+	putAttributes(fields, record.GetAttributes())
+
+	if body := record.GetBody(); body != nil {
+		if s, ok := body.GetValue().(*commonpb.AnyValue_StringValue); ok {
+			fields["message"] = s.StringValue
+		} else if v := anyValue(body); v != nil {
+			safemapstr.Put(fields, "otlp.body", v)
+		}
+	}
+
+	severity := record.GetSeverityNumber()
+	if severity != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		safemapstr.Put(fields, "event.severity", int64(severity))
+	}
+	if text := record.GetSeverityText(); text != "" {
+		safemapstr.Put(fields, "log.level", strings.ToLower(text))
+	} else if severity > 0 && int(severity-1)/4 < len(severityLevels) {
+		safemapstr.Put(fields, "log.level", severityLevels[(severity-1)/4])
+	}
+
+	if id := record.GetTraceId(); len(id) > 0 && !allZero(id) {
+		safemapstr.Put(fields, "trace.id", hex.EncodeToString(id))
+	}
+	if id := record.GetSpanId(); len(id) > 0 && !allZero(id) {
+		safemapstr.Put(fields, "span.id", hex.EncodeToString(id))
+	}
+
+	ts := now
+	if t := record.GetTimeUnixNano(); t != 0 {
+		ts = time.Unix(0, int64(t)).UTC()
+	} else if t := record.GetObservedTimeUnixNano(); t != 0 {
+		ts = time.Unix(0, int64(t)).UTC()
+	}
+
+	return beat.Event{
+		Timestamp: ts,
+		Fields:    fields,
+	}
+}
+
+// putAttributes adds attributes to fields, renaming attributes that have
+// an ECS equivalent. Dotted attribute names are expanded into objects.
+func putAttributes(fields mapstr.M, attrs []*commonpb.KeyValue) {
+	for _, kv := range attrs {
+		key := kv.GetKey()
+		if key == "" {
+			continue
+		}
+		if ecs, ok := ecsFields[key]; ok {
+			key = ecs
+		}
+		safemapstr.Put(fields, key, anyValue(kv.GetValue()))
+	}
+}
+
+// anyValue converts an OTLP value into an event field value.
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, len(v.ArrayValue.GetValues()))
+		for i, e := range v.ArrayValue.GetValues() {
+			values[i] = anyValue(e)
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		m := mapstr.M{}
+		for _, kv := range v.KvlistValue.GetValues() {
+			m[kv.GetKey()] = anyValue(kv.GetValue())
+		}
+		return m
+	}
+	return nil
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
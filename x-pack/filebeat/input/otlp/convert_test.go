@@ -0,0 +1,135 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func stringKV(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func intKV(k string, v int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}}
+}
+
+var testRequest = &collogspb.ExportLogsServiceRequest{
+	ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringKV("service.name", "checkout"),
+			stringKV("deployment.environment", "production"),
+			stringKV("k8s.pod.name", "checkout-1"),
+		}},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{
+				Name:       "com.example.checkout",
+				Attributes: []*commonpb.KeyValue{stringKV("scope.attr", "x")},
+			},
+			LogRecords: []*logspb.LogRecord{
+				{
+					TimeUnixNano:   uint64(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixNano()),
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+					SeverityText:   "ERROR",
+					Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+					Attributes: []*commonpb.KeyValue{
+						stringKV("exception.type", "TimeoutError"),
+						intKV("http.response.status_code", 504),
+						stringKV("service.name", "override"),
+					},
+					TraceId: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+					SpanId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				},
+				{
+					ObservedTimeUnixNano: uint64(time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC).UnixNano()),
+					SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_WARN2,
+					Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+						Values: []*commonpb.KeyValue{intKV("count", 3)},
+					}}},
+					TraceId: make([]byte, 16),
+				},
+			},
+		}},
+	}},
+}
+
+func TestToEvents(t *testing.T) {
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	events := toEvents(testRequest, now)
+
+	if len(events) != 2 {
+		t.Fatalf("unexpected number of events: got=%d want=2", len(events))
+	}
+
+	wantTimes := []time.Time{
+		time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC),
+	}
+	wantFields := []mapstr.M{
+		{
+			"service": mapstr.M{"name": "override", "environment": "production"},
+			"kubernetes": mapstr.M{
+				"pod": mapstr.M{"name": "checkout-1"},
+			},
+			"scope":   mapstr.M{"attr": "x"},
+			"log":     mapstr.M{"logger": "com.example.checkout", "level": "error"},
+			"error":   mapstr.M{"type": "TimeoutError"},
+			"http":    mapstr.M{"response": mapstr.M{"status_code": int64(504)}},
+			"message": "payment failed",
+			"event":   mapstr.M{"severity": int64(17)},
+			"trace":   mapstr.M{"id": "0102030405060708090a0b0c0d0e0f10"},
+			"span":    mapstr.M{"id": "0102030405060708"},
+		},
+		{
+			"service": mapstr.M{"name": "checkout", "environment": "production"},
+			"kubernetes": mapstr.M{
+				"pod": mapstr.M{"name": "checkout-1"},
+			},
+			"scope": mapstr.M{"attr": "x"},
+			"log":   mapstr.M{"logger": "com.example.checkout", "level": "warn"},
+			"otlp":  mapstr.M{"body": mapstr.M{"count": int64(3)}},
+			"event": mapstr.M{"severity": int64(14)},
+		},
+	}
+
+	for i, e := range events {
+		if !e.Timestamp.Equal(wantTimes[i]) {
+			t.Errorf("unexpected timestamp for event %d: got=%v want=%v", i, e.Timestamp, wantTimes[i])
+		}
+		if !cmp.Equal(e.Fields, wantFields[i]) {
+			t.Errorf("unexpected fields for event %d:\n%s", i, cmp.Diff(wantFields[i], e.Fields))
+		}
+	}
+}
+
+func TestToEventsDefaultTimestamp(t *testing.T) {
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	events := toEvents(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			ScopeLogs: []*logspb.ScopeLogs{{
+				LogRecords: []*logspb.LogRecord{{}},
+			}},
+		}},
+	}, now)
+
+	if len(events) != 1 {
+		t.Fatalf("unexpected number of events: got=%d want=1", len(events))
+	}
+	if !events[0].Timestamp.Equal(now) {
+		t.Errorf("unexpected timestamp: got=%v want=%v", events[0].Timestamp, now)
+	}
+	if len(events[0].Fields) != 0 {
+		t.Errorf("unexpected fields: %v", events[0].Fields)
+	}
+}
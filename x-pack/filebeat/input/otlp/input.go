@@ -0,0 +1,244 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/libbeat/monitoring/inputmon"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/ack"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/monitoring/adapter"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/elastic/go-concert/ctxtool"
+)
+
+const (
+	inputName = "otlp"
+
+	// logsPath is the OTLP/HTTP logs endpoint defined by the specification.
+	logsPath = "/v1/logs"
+)
+
+type otlpInput struct {
+	config    config
+	tlsConfig *tls.Config
+}
+
+func Plugin() v2.Plugin {
+	return v2.Plugin{
+		Name:       inputName,
+		Stability:  feature.Beta,
+		Deprecated: false,
+		Info:       "OpenTelemetry protocol logs receiver",
+		Manager:    v2.ConfigureWith(configure),
+	}
+}
+
+func configure(cfg *conf.C) (v2.Input, error) {
+	conf := defaultConfig()
+	if err := cfg.Unpack(&conf); err != nil {
+		return nil, err
+	}
+
+	return newOTLPInput(conf)
+}
+
+func newOTLPInput(config config) (*otlpInput, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	tlsConfigBuilder, err := tlscommon.LoadTLSServerConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfigBuilder != nil {
+		tlsConfig = tlsConfigBuilder.BuildServerConfig(config.ListenAddress)
+	}
+
+	return &otlpInput{
+		config:    config,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+func (*otlpInput) Name() string { return inputName }
+
+func (in *otlpInput) Test(_ v2.TestContext) error {
+	for _, addr := range in.addrs() {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		l.Close()
+	}
+	return nil
+}
+
+// addrs returns the addresses of the enabled endpoints.
+func (in *otlpInput) addrs() []string {
+	var addrs []string
+	if in.config.GRPC.Enabled {
+		addrs = append(addrs, in.grpcAddr())
+	}
+	if in.config.HTTP.Enabled {
+		addrs = append(addrs, in.httpAddr())
+	}
+	return addrs
+}
+
+func (in *otlpInput) grpcAddr() string {
+	return net.JoinHostPort(in.config.ListenAddress, in.config.GRPC.Port)
+}
+
+func (in *otlpInput) httpAddr() string {
+	return net.JoinHostPort(in.config.ListenAddress, in.config.HTTP.Port)
+}
+
+func (in *otlpInput) Run(ctx v2.Context, pipeline beat.Pipeline) error {
+	metrics := newInputMetrics(ctx.ID)
+	defer metrics.Close()
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		EventListener: ack.NewEventACKHandler(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create pipeline client: %w", err)
+	}
+	defer client.Close()
+
+	runCtx := ctxtool.FromCanceller(ctx.Cancelation)
+	recv := &receiver{
+		ctx:        runCtx,
+		log:        ctx.Logger,
+		publish:    client.Publish,
+		ackTimeout: in.config.ACKTimeout,
+		metrics:    metrics,
+	}
+
+	// Open all listeners before starting any server, so that a port
+	// conflict does not leave the other server running.
+	var grpcLis, httpLis net.Listener
+	if in.config.GRPC.Enabled {
+		grpcLis, err = net.Listen("tcp", in.grpcAddr())
+		if err != nil {
+			return err
+		}
+		defer grpcLis.Close()
+	}
+	if in.config.HTTP.Enabled {
+		httpLis, err = net.Listen("tcp", in.httpAddr())
+		if err != nil {
+			return err
+		}
+		defer httpLis.Close()
+	}
+
+	g, gctx := errgroup.WithContext(runCtx)
+	if grpcLis != nil {
+		opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(in.config.MaxMessageSize))}
+		if in.tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(in.tlsConfig)))
+		}
+		srv := grpc.NewServer(opts...)
+		collogspb.RegisterLogsServiceServer(srv, &grpcService{receiver: recv})
+
+		ctx.Logger.Infof("Starting OTLP/gRPC receiver on %s", grpcLis.Addr())
+		g.Go(func() error {
+			return srv.Serve(grpcLis)
+		})
+		g.Go(func() error {
+			<-gctx.Done()
+			srv.GracefulStop()
+			return nil
+		})
+	}
+	if httpLis != nil {
+		mux := http.NewServeMux()
+		mux.Handle(logsPath, &httpHandler{receiver: recv, maxMessageSize: int(in.config.MaxMessageSize)})
+		srv := &http.Server{Handler: mux, TLSConfig: in.tlsConfig, ReadHeaderTimeout: 5 * time.Second}
+
+		ctx.Logger.Infof("Starting OTLP/HTTP receiver on %s", httpLis.Addr())
+		g.Go(func() error {
+			var err error
+			if in.tlsConfig != nil {
+				// The certificate is already loaded so we do not need
+				// to pass the cert file and key file parameters.
+				err = srv.ServeTLS(httpLis, "", "")
+			} else {
+				err = srv.Serve(httpLis)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		})
+		g.Go(func() error {
+			<-gctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		})
+	}
+
+	err = g.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("unable to run OTLP receiver: %w", err)
+	}
+	return nil
+}
+
+// inputMetrics handles the input's metric reporting.
+type inputMetrics struct {
+	unregister func()
+
+	apiErrors         *monitoring.Uint // number of failed export requests
+	batchesReceived   *monitoring.Uint // number of export requests received
+	batchesACKedTotal *monitoring.Uint // number of export requests ACKed
+	eventsPublished   *monitoring.Uint // number of events published
+	batchSize         metrics.Sample   // histogram of the number of log records per request
+	batchACKTime      metrics.Sample   // histogram of the elapsed times in nanoseconds from receiving a request to its ACK
+}
+
+func newInputMetrics(id string) *inputMetrics {
+	reg, unreg := inputmon.NewInputRegistry(inputName, id, nil)
+	out := &inputMetrics{
+		unregister:        unreg,
+		apiErrors:         monitoring.NewUint(reg, "api_errors_total"),
+		batchesReceived:   monitoring.NewUint(reg, "batches_received_total"),
+		batchesACKedTotal: monitoring.NewUint(reg, "batches_acked_total"),
+		eventsPublished:   monitoring.NewUint(reg, "events_published_total"),
+		batchSize:         metrics.NewUniformSample(1024),
+		batchACKTime:      metrics.NewUniformSample(1024),
+	}
+	_ = adapter.NewGoMetrics(reg, "batch_size", adapter.Accept).
+		Register("histogram", metrics.NewHistogram(out.batchSize))
+	_ = adapter.NewGoMetrics(reg, "batch_ack_time", adapter.Accept).
+		Register("histogram", metrics.NewHistogram(out.batchACKTime))
+
+	return out
+}
+
+func (m *inputMetrics) Close() {
+	m.unregister()
+}
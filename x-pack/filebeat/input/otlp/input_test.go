@@ -0,0 +1,292 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// ackPipeline is a beat.Pipeline whose clients hold published events until
+// the test ACKs them.
+type ackPipeline struct {
+	mu       sync.Mutex
+	listener beat.EventListener
+	events   []beat.Event
+	pending  int
+	received chan struct{}
+}
+
+func newACKPipeline() *ackPipeline {
+	return &ackPipeline{received: make(chan struct{}, 100)}
+}
+
+func (p *ackPipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
+	p.mu.Lock()
+	p.listener = cfg.EventListener
+	p.mu.Unlock()
+	return p, nil
+}
+
+func (p *ackPipeline) Connect() (beat.Client, error) {
+	return p.ConnectWith(beat.ClientConfig{})
+}
+
+func (p *ackPipeline) Publish(e beat.Event) {
+	p.mu.Lock()
+	p.listener.AddEvent(e, true)
+	p.events = append(p.events, e)
+	p.pending++
+	p.mu.Unlock()
+	p.received <- struct{}{}
+}
+
+func (p *ackPipeline) PublishAll(events []beat.Event) {
+	for _, e := range events {
+		p.Publish(e)
+	}
+}
+
+func (p *ackPipeline) Close() error { return nil }
+
+// ackAll waits for n events to be published and ACKs all pending events.
+func (p *ackPipeline) ackAll(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-p.received:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listener.ACKEvents(p.pending)
+	p.pending = 0
+}
+
+func (p *ackPipeline) published() []beat.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]beat.Event(nil), p.events...)
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	return port
+}
+
+// runInput starts an otlp input and returns the addresses of its gRPC and
+// HTTP endpoints.
+func runInput(t *testing.T, pipeline beat.Pipeline, modify func(*config)) (grpcAddr, httpAddr string) {
+	t.Helper()
+
+	c := defaultConfig()
+	c.GRPC.Port = freePort(t)
+	c.HTTP.Port = freePort(t)
+	if modify != nil {
+		modify(&c)
+	}
+	in, err := newOTLPInput(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- in.Run(v2.Context{
+			Logger:      logp.NewLogger(inputName),
+			ID:          t.Name(),
+			Cancelation: ctx,
+		}, pipeline)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	grpcAddr, httpAddr = in.grpcAddr(), in.httpAddr()
+	require.Eventually(t, func() bool {
+		for _, addr := range []string{grpcAddr, httpAddr} {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+	return grpcAddr, httpAddr
+}
+
+func TestGRPCWaitsForACK(t *testing.T) {
+	pipeline := newACKPipeline()
+	grpcAddr, _ := runInput(t, pipeline, nil)
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := collogspb.NewLogsServiceClient(conn)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Export(context.Background(), testRequest)
+		errc <- err
+	}()
+
+	// Events are published, but the sender must not see a response
+	// until they are ACKed.
+	for i := 0; i < 2; i++ {
+		<-pipeline.received
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("export returned before events were ACKed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	pipeline.ackAll(t, 0)
+	require.NoError(t, <-errc)
+
+	events := pipeline.published()
+	require.Len(t, events, 2)
+	assert.Equal(t, "payment failed", events[0].Fields["message"])
+}
+
+func TestGRPCACKTimeout(t *testing.T) {
+	pipeline := newACKPipeline()
+	grpcAddr, _ := runInput(t, pipeline, func(c *config) {
+		c.ACKTimeout = 50 * time.Millisecond
+	})
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = collogspb.NewLogsServiceClient(conn).Export(context.Background(), testRequest)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestHTTPProtobuf(t *testing.T) {
+	pipeline := newACKPipeline()
+	_, httpAddr := runInput(t, pipeline, nil)
+
+	body, err := proto.Marshal(testRequest)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+httpAddr+logsPath, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		respc <- resp
+	}()
+	pipeline.ackAll(t, 2)
+
+	resp := <-respc
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contentTypeProtobuf, resp.Header.Get("Content-Type"))
+	assert.Len(t, pipeline.published(), 2)
+}
+
+func TestHTTPJSON(t *testing.T) {
+	pipeline := newACKPipeline()
+	_, httpAddr := runInput(t, pipeline, nil)
+
+	body := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"hello"},"traceId":"0102030405060708090a0b0c0d0e0f10"}]}]}]}`
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post("http://"+httpAddr+logsPath, contentTypeJSON, strings.NewReader(body))
+		assert.NoError(t, err)
+		respc <- resp
+	}()
+	pipeline.ackAll(t, 1)
+
+	resp := <-respc
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contentTypeJSON, resp.Header.Get("Content-Type"))
+
+	events := pipeline.published()
+	require.Len(t, events, 1)
+	assert.Equal(t, "hello", events[0].Fields["message"])
+	traceID, err := events[0].Fields.GetValue("trace.id")
+	require.NoError(t, err)
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", traceID)
+}
+
+func TestHTTPErrors(t *testing.T) {
+	pipeline := newACKPipeline()
+	_, httpAddr := runInput(t, pipeline, func(c *config) {
+		c.ACKTimeout = 50 * time.Millisecond
+		c.MaxMessageSize = 64
+	})
+	url := "http://" + httpAddr + logsPath
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "method", method: http.MethodGet, contentType: contentTypeJSON, want: http.StatusMethodNotAllowed},
+		{name: "content type", contentType: "text/plain", body: "hello", want: http.StatusUnsupportedMediaType},
+		{name: "invalid body", contentType: contentTypeJSON, body: "{", want: http.StatusBadRequest},
+		{name: "too large", contentType: contentTypeJSON, body: strings.Repeat(" ", 100) + "{}", want: http.StatusRequestEntityTooLarge},
+		{name: "ack timeout", contentType: contentTypeJSON, body: `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{}]}]}]}`, want: http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, url, strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", test.contentType)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, test.want, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/ack"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+var errACKTimeout = errors.New("events were not acknowledged within the ack_timeout")
+
+// receiver publishes exported log records and waits for the pipeline to
+// ACK them, so that senders only see a successful response once the events
+// are safely stored by the outputs.
+type receiver struct {
+	ctx        context.Context
+	log        *logp.Logger
+	publish    func(beat.Event)
+	ackTimeout time.Duration
+	metrics    *inputMetrics
+}
+
+// export publishes the log records of req, and returns once all of them
+// have been ACKed. The request context or input being cancelled, or the
+// ACK timeout expiring, cause an error to be returned.
+func (r *receiver) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	start := time.Now()
+	events := toEvents(req, start)
+
+	r.metrics.batchesReceived.Inc()
+	r.metrics.batchSize.Update(int64(len(events)))
+
+	acked := make(chan struct{})
+	tracker := ack.NewBatchACKTracker(func() {
+		r.metrics.batchACKTime.Update(time.Since(start).Nanoseconds())
+		r.metrics.batchesACKedTotal.Inc()
+		close(acked)
+	})
+	for _, event := range events {
+		tracker.Add()
+		event.Private = tracker
+		r.publish(event)
+		r.metrics.eventsPublished.Inc()
+	}
+	tracker.Ready()
+
+	timeout := time.NewTimer(r.ackTimeout)
+	defer timeout.Stop()
+	select {
+	case <-acked:
+		return nil
+	case <-timeout.C:
+		return errACKTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+// grpcService implements the OTLP/gRPC logs service.
+type grpcService struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	receiver *receiver
+}
+
+func (s *grpcService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if err := s.receiver.export(ctx, req); err != nil {
+		s.receiver.metrics.apiErrors.Inc()
+		s.receiver.log.Debugw("failed to export logs", "protocol", "grpc", "error", err)
+		// UNAVAILABLE tells the sender to retry the request.
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// httpHandler implements the OTLP/HTTP logs endpoint, accepting binary
+// protobuf and JSON encoded requests.
+type httpHandler struct {
+	receiver       *receiver
+	maxMessageSize int
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if r.Method != http.MethodPost {
+		h.sendError(w, contentType, http.StatusMethodNotAllowed, codes.Unimplemented,
+			fmt.Errorf("unsupported method %s", r.Method))
+		return
+	}
+
+	var unmarshal func([]byte, proto.Message) error
+	switch contentType {
+	case contentTypeProtobuf:
+		unmarshal = proto.Unmarshal
+	case contentTypeJSON:
+		unmarshal = unmarshalJSON
+	default:
+		h.sendError(w, contentTypeProtobuf, http.StatusUnsupportedMediaType, codes.InvalidArgument,
+			fmt.Errorf("unsupported content type %q", contentType))
+		return
+	}
+
+	body, status, err := h.readBody(w, r)
+	if err != nil {
+		h.sendError(w, contentType, status, codes.InvalidArgument, err)
+		return
+	}
+
+	var req collogspb.ExportLogsServiceRequest
+	if err := unmarshal(body, &req); err != nil {
+		h.sendError(w, contentType, http.StatusBadRequest, codes.InvalidArgument,
+			fmt.Errorf("failed to decode request: %w", err))
+		return
+	}
+
+	if err := h.receiver.export(r.Context(), &req); err != nil {
+		// 503 tells the sender to retry the request.
+		h.sendError(w, contentType, http.StatusServiceUnavailable, codes.Unavailable, err)
+		return
+	}
+
+	h.send(w, contentType, http.StatusOK, &collogspb.ExportLogsServiceResponse{})
+}
+
+// readBody reads the request body, decompressing it if needed. It returns
+// the HTTP status to use if reading the body failed.
+func (h *httpHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, int, error) {
+	body := io.Reader(http.MaxBytesReader(w, r.Body, int64(h.maxMessageSize)))
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to decompress request: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+
+	// Limit the decompressed size as well as the size on the wire.
+	data, err := io.ReadAll(io.LimitReader(body, int64(h.maxMessageSize)+1))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to read request: %w", err)
+	}
+	if len(data) > h.maxMessageSize {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("request is larger than max_message_size")
+	}
+	return data, 0, nil
+}
+
+// unmarshalJSON decodes an OTLP/JSON request. OTLP/JSON encodes trace and
+// span IDs as hex strings rather than the base64 used by protojson, so they
+// are re-encoded before decoding the request.
+func unmarshalJSON(data []byte, msg proto.Message) error {
+	var raw map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	for _, rl := range jsonObjects(raw["resourceLogs"]) {
+		for _, sl := range jsonObjects(rl["scopeLogs"]) {
+			for _, record := range jsonObjects(sl["logRecords"]) {
+				for _, key := range []string{"traceId", "spanId"} {
+					if id, ok := record[key].(string); ok {
+						if b, err := hex.DecodeString(id); err == nil {
+							record[key] = base64.StdEncoding.EncodeToString(b)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+}
+
+// jsonObjects returns the objects in a decoded JSON array.
+func jsonObjects(v interface{}) []map[string]interface{} {
+	arr, _ := v.([]interface{})
+	objs := make([]map[string]interface{}, 0, len(arr))
+	for _, e := range arr {
+		if obj, ok := e.(map[string]interface{}); ok {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+func (h *httpHandler) sendError(w http.ResponseWriter, contentType string, httpStatus int, code codes.Code, err error) {
+	h.receiver.metrics.apiErrors.Inc()
+	h.receiver.log.Debugw("failed to export logs", "protocol", "http", "status", httpStatus, "error", err)
+	h.send(w, contentType, httpStatus, status.New(code, err.Error()).Proto())
+}
+
+// send writes msg using the encoding of the request.
+func (h *httpHandler) send(w http.ResponseWriter, contentType string, httpStatus int, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if contentType == contentTypeJSON {
+		data, err = protojson.Marshal(msg)
+	} else {
+		contentType = contentTypeProtobuf
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		h.receiver.log.Errorw("failed to encode response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(data)
+}